@@ -15,7 +15,6 @@ import (
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/handler"
 	"github.com/seifghazi/claude-code-monitor/internal/middleware"
-	"github.com/seifghazi/claude-code-monitor/internal/provider"
 	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
@@ -27,43 +26,35 @@ func main() {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize providers dynamically based on format
-	providers := make(map[string]provider.Provider)
-	for name, providerCfg := range cfg.Providers {
-		switch providerCfg.Format {
-		case "anthropic":
-			providers[name] = provider.NewAnthropicProvider(name, providerCfg)
-			logger.Printf("Initialized Anthropic-format provider: %s (%s)", name, providerCfg.BaseURL)
-		case "openai":
-			providers[name] = provider.NewOpenAIProvider(name, providerCfg)
-			logger.Printf("Initialized OpenAI-format provider: %s (%s)", name, providerCfg.BaseURL)
-		default:
-			logger.Printf("Unknown provider format '%s' for provider '%s', skipping", providerCfg.Format, name)
-		}
-	}
-
-	if len(providers) == 0 {
-		logger.Fatalf("No providers configured. Please configure at least one provider in config.yaml")
+	// Use SQLite storage, or JSONL files with storage.backend: jsonl (write-only for proxy-core)
+	storageService, err := service.NewStorageService(&cfg.Storage)
+	if err != nil {
+		logger.Fatalf("Failed to initialize %s storage: %v", cfg.Storage.Backend, err)
 	}
+	logger.Printf("%s storage ready", cfg.Storage.Backend)
 
-	// Initialize model router
-	modelRouter := service.NewModelRouter(cfg, providers, logger)
-
-	// Use SQLite storage (write-only for proxy-core)
-	storageService, err := service.NewSQLiteStorageService(&cfg.Storage)
+	// Build providers, the model router, health probes, and rate limits from
+	// the config. They are rebuilt and swapped in when config.yaml changes or
+	// on SIGHUP; in-flight requests finish on the previous set.
+	rt, err := service.NewRuntime(cfg, storageService, logger)
 	if err != nil {
-		logger.Fatalf("Failed to initialize SQLite storage: %v", err)
+		logger.Fatalf("Failed to initialize providers: %v", err)
+	}
+	rt.Start()
+	reloader := service.NewConfigReloader(config.Path(), rt, storageService, logger)
+	if err := reloader.Start(); err != nil {
+		logger.Printf("Failed to watch config for changes: %v", err)
 	}
-	logger.Println("SQLite database ready")
+	defer reloader.Stop()
 
 	// Create core handler (minimal dependencies)
-	h := handler.NewCoreHandler(storageService, logger, modelRouter, cfg)
+	h := handler.NewCoreHandler(storageService, logger, reloader)
 
 	r := mux.NewRouter()
 
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		handlers.AllowedHeaders([]string{"*"}),
 	)
 
@@ -75,6 +66,25 @@ func main() {
 	r.HandleFunc("/v1/models", h.Models).Methods("GET")
 	r.HandleFunc("/health", h.Health).Methods("GET")
 
+	// Config API - writes are applied live by this process's config reloader
+	r.HandleFunc("/api/v2/config", h.GetConfigV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/providers", h.GetProvidersV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/subagents", h.GetSubagentConfigV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/subagents", h.PatchSubagentConfigV2).Methods("PATCH")
+	r.HandleFunc("/api/v2/config/revisions", h.GetConfigRevisionsV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/revisions/{id}", h.GetConfigRevisionV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/revisions/{id}/rollback", h.RollbackConfigV2).Methods("POST")
+
+	// Routing API - the model router and breaker state live in this process
+	r.HandleFunc("/api/v2/routing/config", h.GetRoutingConfigV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/config", h.PatchRoutingConfigV2).Methods("PATCH")
+	r.HandleFunc("/api/v2/routing/rules", h.PutRoutingRulesV2).Methods("PUT")
+	r.HandleFunc("/api/v2/routing/providers", h.GetProviderStatusV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/providers/{name}/circuit-breaker", h.SetCircuitBreakerV2).Methods("POST")
+	r.HandleFunc("/api/v2/routing/providers/{name}/health-checks", h.GetHealthChecksV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/stats", h.GetRoutingStatsV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/explain", h.ExplainRouteV2).Methods("POST")
+
 	r.NotFoundHandler = http.HandlerFunc(h.NotFound)
 
 	// Get port from environment or config
@@ -97,6 +107,13 @@ func main() {
 		logger.Printf("   - POST /v1/messages (Anthropic format)")
 		logger.Printf("   - GET  /v1/models")
 		logger.Printf("   - GET  /health")
+		logger.Printf("   - GET  /api/v2/config/* (PATCH subagents, revisions and rollback: admin)")
+		logger.Printf("   - GET  /api/v2/routing/config (PATCH config, PUT rules: admin)")
+		logger.Printf("   - GET  /api/v2/routing/providers")
+		logger.Printf("   - POST /api/v2/routing/providers/{name}/circuit-breaker (admin)")
+		logger.Printf("   - GET  /api/v2/routing/providers/{name}/health-checks")
+		logger.Printf("   - GET  /api/v2/routing/stats")
+		logger.Printf("   - POST /api/v2/routing/explain")
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Server failed to start: %v", err)
@@ -26,33 +26,44 @@ func main() {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Use SQLite storage (full read/write access)
-	storageService, err := service.NewSQLiteStorageService(&cfg.Storage)
-	if err != nil {
-		logger.Fatalf("Failed to initialize SQLite storage: %v", err)
-	}
-	logger.Println("SQLite database ready")
-
-	// Start conversation indexer (fail-fast on error)
-	sqliteStorage, ok := storageService.(*service.SQLiteStorageService)
-	if !ok {
-		logger.Fatalf("Storage service must be SQLite for indexer support")
+	// The jsonl index is built once at startup, so this process would never
+	// see the requests proxy-core appends afterwards
+	if cfg.Storage.Backend == "jsonl" {
+		logger.Fatalf("storage.backend: jsonl is not supported by proxy-data; use sqlite, which proxy-core and proxy-data share, or run the single proxy binary")
 	}
 
-	indexer, err := service.NewConversationIndexer(sqliteStorage)
+	storageService, err := service.NewStorageService(&cfg.Storage)
 	if err != nil {
-		logger.Fatalf("Failed to create conversation indexer: %v", err)
+		logger.Fatalf("Failed to initialize %s storage: %v", cfg.Storage.Backend, err)
 	}
-
-	if err := indexer.Start(); err != nil {
-		logger.Fatalf("Failed to start conversation indexer: %v", err)
-	}
-	defer indexer.Stop()
-	logger.Println("Conversation indexer started")
+	logger.Printf("%s storage ready", cfg.Storage.Backend)
 
 	// Create data handler (full dependencies)
 	h := handler.NewDataHandler(storageService, logger, cfg)
-	h.SetIndexer(indexer)
+
+	// The conversation indexer, body migration, and retention work on the
+	// SQLite database
+	if sqliteStorage, ok := storageService.(*service.SQLiteStorageService); ok {
+		indexer, err := service.NewConversationIndexer(sqliteStorage)
+		if err != nil {
+			logger.Fatalf("Failed to create conversation indexer: %v", err)
+		}
+
+		if err := indexer.Start(); err != nil {
+			logger.Fatalf("Failed to start conversation indexer: %v", err)
+		}
+		defer indexer.Stop()
+		logger.Println("Conversation indexer started")
+		h.SetIndexer(indexer)
+
+		// Split request bodies stored before dedup was turned on
+		sqliteStorage.StartBodyMigration()
+
+		// Strip, archive, and delete old requests per storage.retention
+		retention := service.NewRetentionJob(sqliteStorage)
+		retention.Start()
+		defer retention.Stop()
+	}
 
 	r := mux.NewRouter()
 
@@ -83,6 +94,8 @@ func main() {
 	r.HandleFunc("/api/stats/hourly", h.GetHourlyStats).Methods("GET")
 	r.HandleFunc("/api/stats/models", h.GetModelStats).Methods("GET")
 	r.HandleFunc("/api/stats/providers", h.GetProviderStats).Methods("GET")
+	r.HandleFunc("/api/stats/prompt-caching", h.GetPromptCachingStats).Methods("GET")
+	r.HandleFunc("/api/stats/storage", h.GetStorageStats).Methods("GET")
 	r.HandleFunc("/api/stats/subagents", h.GetSubagentStats).Methods("GET")
 	r.HandleFunc("/api/stats/tools", h.GetToolStats).Methods("GET")
 	r.HandleFunc("/api/stats/performance", h.GetPerformanceStats).Methods("GET")
@@ -108,6 +121,10 @@ func main() {
 	r.HandleFunc("/api/v2/stats/providers", h.GetProvidersV2).Methods("GET")
 	r.HandleFunc("/api/v2/stats/subagents", h.GetSubagentStatsV2).Methods("GET")
 	r.HandleFunc("/api/v2/stats/performance", h.GetPerformanceStatsV2).Methods("GET")
+	r.HandleFunc("/api/v2/experiments/{id}/results", h.GetExperimentResultsV2).Methods("GET")
+	r.HandleFunc("/api/v2/tool-policies/hits", h.GetToolPolicyHitsV2).Methods("GET")
+	r.HandleFunc("/api/v2/tool-calls", h.GetToolCallsV2).Methods("GET")
+	r.HandleFunc("/api/v2/retention", h.GetRetentionStatusV2).Methods("GET")
 
 	// V2 Configuration API
 	r.HandleFunc("/api/v2/config", h.GetConfigV2).Methods("GET")
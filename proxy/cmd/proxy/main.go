@@ -16,7 +16,6 @@ import (
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/handler"
 	"github.com/seifghazi/claude-code-monitor/internal/middleware"
-	"github.com/seifghazi/claude-code-monitor/internal/provider"
 	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
@@ -28,64 +27,26 @@ func main() {
 		logger.Fatalf("❌ Failed to load configuration: %v", err)
 	}
 
-	// Initialize providers dynamically based on format
-	// First pass: create all base providers
-	baseProviders := make(map[string]provider.Provider)
-	for name, providerCfg := range cfg.Providers {
-		switch providerCfg.Format {
-		case "anthropic":
-			baseProviders[name] = provider.NewAnthropicProvider(name, providerCfg)
-			logger.Printf("📡 Initialized Anthropic-format provider: %s (%s)", name, providerCfg.BaseURL)
-		case "openai":
-			baseProviders[name] = provider.NewOpenAIProvider(name, providerCfg)
-			logger.Printf("📡 Initialized OpenAI-format provider: %s (%s)", name, providerCfg.BaseURL)
-		default:
-			logger.Printf("⚠️  Unknown provider format '%s' for provider '%s', skipping", providerCfg.Format, name)
-		}
-	}
-
-	if len(baseProviders) == 0 {
-		logger.Fatalf("❌ No providers configured. Please configure at least one provider in config.yaml")
-	}
-
-	// Second pass: wrap providers with resilience features (circuit breaker, retry, fallback)
-	providers := make(map[string]provider.Provider)
-	for name, baseProvider := range baseProviders {
-		providerCfg := cfg.Providers[name]
-
-		// Check if this provider has a fallback configured
-		var fallbackProvider provider.Provider
-		if providerCfg.FallbackProvider != "" {
-			if fb, exists := baseProviders[providerCfg.FallbackProvider]; exists {
-				fallbackProvider = fb
-				logger.Printf("🔄 Provider '%s' configured with fallback to '%s'", name, providerCfg.FallbackProvider)
-			} else {
-				logger.Printf("⚠️  Provider '%s' has invalid fallback_provider '%s' (not found)", name, providerCfg.FallbackProvider)
-			}
-		}
-
-		// Wrap with resilient provider if circuit breaker enabled or fallback configured
-		if providerCfg.CircuitBreaker.Enabled || fallbackProvider != nil {
-			providers[name] = provider.NewResilientProvider(name, baseProvider, fallbackProvider, providerCfg)
-			if providerCfg.CircuitBreaker.Enabled {
-				logger.Printf("🛡️  Circuit breaker enabled for '%s' (max_failures: %d, timeout: %s)",
-					name, providerCfg.CircuitBreaker.MaxFailures, providerCfg.CircuitBreaker.TimeoutDuration)
-			}
-		} else {
-			// No resilience features needed, use base provider directly
-			providers[name] = baseProvider
-		}
+	// Use SQLite storage, or JSONL files with storage.backend: jsonl
+	storageService, err := service.NewStorageService(&cfg.Storage)
+	if err != nil {
+		logger.Fatalf("❌ Failed to initialize %s storage: %v", cfg.Storage.Backend, err)
 	}
+	logger.Printf("🗿 %s storage ready", cfg.Storage.Backend)
 
-	// Initialize model router
-	modelRouter := service.NewModelRouter(cfg, providers, logger)
-
-	// Use SQLite storage
-	storageService, err := service.NewSQLiteStorageService(&cfg.Storage)
+	// Build providers, the model router, health probes, and rate limits from
+	// the config. They are rebuilt and swapped in when config.yaml changes or
+	// on SIGHUP; in-flight requests finish on the previous set.
+	rt, err := service.NewRuntime(cfg, storageService, logger)
 	if err != nil {
-		logger.Fatalf("❌ Failed to initialize SQLite storage: %v", err)
+		logger.Fatalf("❌ Failed to initialize providers: %v", err)
+	}
+	rt.Start()
+	reloader := service.NewConfigReloader(config.Path(), rt, storageService, logger)
+	if err := reloader.Start(); err != nil {
+		logger.Printf("⚠️  Failed to watch config for changes: %v", err)
 	}
-	logger.Println("🗿 SQLite database ready")
+	defer reloader.Stop()
 
 	// Start conversation indexer
 	sqliteStorage, ok := storageService.(*service.SQLiteStorageService)
@@ -99,15 +60,23 @@ func main() {
 			}
 			defer indexer.Stop()
 		}
+
+		// Split request bodies stored before dedup was turned on
+		sqliteStorage.StartBodyMigration()
+
+		// Strip, archive, and delete old requests per storage.retention
+		retention := service.NewRetentionJob(sqliteStorage)
+		retention.Start()
+		defer retention.Stop()
 	}
 
-	h := handler.New(storageService, logger, modelRouter, cfg)
+	h := handler.New(storageService, logger, reloader)
 
 	r := mux.NewRouter()
 
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		handlers.AllowedHeaders([]string{"*"}),
 	)
 
@@ -131,6 +100,8 @@ func main() {
 	r.HandleFunc("/api/stats/hourly", h.GetHourlyStats).Methods("GET")
 	r.HandleFunc("/api/stats/models", h.GetModelStats).Methods("GET")
 	r.HandleFunc("/api/stats/providers", h.GetProviderStats).Methods("GET")
+	r.HandleFunc("/api/stats/prompt-caching", h.GetPromptCachingStats).Methods("GET")
+	r.HandleFunc("/api/stats/storage", h.GetStorageStats).Methods("GET")
 	r.HandleFunc("/api/stats/subagents", h.GetSubagentStats).Methods("GET")
 	r.HandleFunc("/api/stats/tools", h.GetToolStats).Methods("GET")
 	r.HandleFunc("/api/stats/performance", h.GetPerformanceStats).Methods("GET")
@@ -152,16 +123,29 @@ func main() {
 	r.HandleFunc("/api/v2/stats/providers", h.GetProvidersV2).Methods("GET")
 	r.HandleFunc("/api/v2/stats/subagents", h.GetSubagentStatsV2).Methods("GET")
 	r.HandleFunc("/api/v2/stats/performance", h.GetPerformanceStatsV2).Methods("GET")
+	r.HandleFunc("/api/v2/experiments/{id}/results", h.GetExperimentResultsV2).Methods("GET")
+	r.HandleFunc("/api/v2/tool-policies/hits", h.GetToolPolicyHitsV2).Methods("GET")
+	r.HandleFunc("/api/v2/tool-calls", h.GetToolCallsV2).Methods("GET")
+	r.HandleFunc("/api/v2/retention", h.GetRetentionStatusV2).Methods("GET")
 
 	// V2 Configuration API
 	r.HandleFunc("/api/v2/config", h.GetConfigV2).Methods("GET")
 	r.HandleFunc("/api/v2/config/providers", h.GetProvidersV2).Methods("GET")
 	r.HandleFunc("/api/v2/config/subagents", h.GetSubagentConfigV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/subagents", h.PatchSubagentConfigV2).Methods("PATCH")
+	r.HandleFunc("/api/v2/config/revisions", h.GetConfigRevisionsV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/revisions/{id}", h.GetConfigRevisionV2).Methods("GET")
+	r.HandleFunc("/api/v2/config/revisions/{id}/rollback", h.RollbackConfigV2).Methods("POST")
 
 	// V2 Routing API (Phase 4.1)
 	r.HandleFunc("/api/v2/routing/config", h.GetRoutingConfigV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/config", h.PatchRoutingConfigV2).Methods("PATCH")
+	r.HandleFunc("/api/v2/routing/rules", h.PutRoutingRulesV2).Methods("PUT")
 	r.HandleFunc("/api/v2/routing/providers", h.GetProviderStatusV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/providers/{name}/circuit-breaker", h.SetCircuitBreakerV2).Methods("POST")
+	r.HandleFunc("/api/v2/routing/providers/{name}/health-checks", h.GetHealthChecksV2).Methods("GET")
 	r.HandleFunc("/api/v2/routing/stats", h.GetRoutingStatsV2).Methods("GET")
+	r.HandleFunc("/api/v2/routing/explain", h.ExplainRouteV2).Methods("POST")
 
 	r.NotFoundHandler = http.HandlerFunc(h.NotFound)
 
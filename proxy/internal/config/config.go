@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,11 +15,75 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig               `yaml:"server" json:"server"`
-	Providers map[string]*ProviderConfig `yaml:"providers" json:"providers"`
-	Storage   StorageConfig              `yaml:"storage" json:"storage"`
-	Subagents SubagentsConfig            `yaml:"subagents" json:"subagents"`
-	Routing   RoutingConfig              `yaml:"routing" json:"routing"`
+	Server        ServerConfig               `yaml:"server" json:"server"`
+	Providers     map[string]*ProviderConfig `yaml:"providers" json:"providers"`
+	Storage       StorageConfig              `yaml:"storage" json:"storage"`
+	Subagents     SubagentsConfig            `yaml:"subagents" json:"subagents"`
+	Routing       RoutingConfig              `yaml:"routing" json:"routing"`
+	RateLimits    RateLimitConfig            `yaml:"rate_limits" json:"rate_limits"`
+	ModelAliases  []ModelAliasConfig         `yaml:"model_aliases" json:"model_aliases,omitempty"`
+	Plugins       []PluginConfig             `yaml:"plugins" json:"plugins,omitempty"`
+	PromptCaching PromptCachingConfig        `yaml:"prompt_caching" json:"prompt_caching"`
+	ToolPolicies  []ToolPolicyConfig         `yaml:"tool_policies" json:"tool_policies,omitempty"`
+	Admin         AdminConfig                `yaml:"admin" json:"-"`
+}
+
+// ModelAliasConfig rewrites the requested model before routing, regardless
+// of subagent. Exact model names take precedence over globs; otherwise the
+// first matching entry wins.
+type ModelAliasConfig struct {
+	Match     string            `yaml:"match" json:"match"`                                 // Required: Model name or glob ("claude-3-5-haiku-*")
+	Target    string            `yaml:"target" json:"target"`                               // Required: "provider:model", or just "model" to let routing pick the provider
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`         // Optional: Header -> glob; every header must be present and match
+	Clients   []string          `yaml:"clients,omitempty" json:"-"`                         // Optional: Client API keys (or globs) the alias is limited to
+	TimeOfDay string            `yaml:"time_of_day,omitempty" json:"time_of_day,omitempty"` // Optional: Local time window "HH:MM-HH:MM" (may wrap midnight)
+
+	// Parsed target and time window (not in YAML or JSON)
+	Provider    string `yaml:"-" json:"-"`
+	Model       string `yaml:"-" json:"-"`
+	StartMinute int    `yaml:"-" json:"-"`
+	EndMinute   int    `yaml:"-" json:"-"`
+}
+
+// PluginConfig enables a built-in plugin on the /v1/messages path. Plugins
+// run in the order listed, after routing, on the requests they match.
+type PluginConfig struct {
+	Name      string          `yaml:"name" json:"name"`                                 // Required: Recorded on requests the plugin changed
+	Type      string          `yaml:"type" json:"type"`                                 // Required: system_prompt, remove_tools, max_tokens, or metadata
+	Match     RuleMatchConfig `yaml:"match,omitempty" json:"match"`                     // Optional: Conditions, as for routing rules (default: match every request)
+	Routes    []string        `yaml:"routes,omitempty" json:"routes,omitempty"`         // Optional: Routed "provider:model" matches any of these globs
+	Text      string          `yaml:"text,omitempty" json:"text,omitempty"`             // system_prompt: Snippet appended as a system block
+	Tools     []string        `yaml:"tools,omitempty" json:"tools,omitempty"`           // remove_tools: Tool names or globs to remove
+	MaxTokens int             `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"` // max_tokens: Upper bound on the request's max_tokens
+	UserID    string          `yaml:"user_id,omitempty" json:"user_id,omitempty"`       // metadata: metadata.user_id for requests that don't send one
+}
+
+// ToolPolicyConfig inspects the tool calls a model emits before Claude Code
+// runs them. Policies are checked in the order listed, and the first one
+// matching a call decides what happens to it.
+type ToolPolicyConfig struct {
+	Name           string          `yaml:"name" json:"name"`                                           // Required: Recorded on each call the policy matched
+	Tools          []string        `yaml:"tools" json:"tools"`                                         // Required: Tool names or globs the policy inspects
+	Action         string          `yaml:"action" json:"action"`                                       // Required: block, confirm, or annotate
+	Field          string          `yaml:"field,omitempty" json:"field,omitempty"`                     // Optional: Input field to inspect, e.g. command or file_path (default: the whole input as JSON)
+	Pattern        string          `yaml:"pattern,omitempty" json:"pattern,omitempty"`                 // Optional: RE2 regex the field must match
+	OutsideProject bool            `yaml:"outside_project,omitempty" json:"outside_project,omitempty"` // Optional: Match when the field is a path outside the request's project (needs field)
+	Message        string          `yaml:"message,omitempty" json:"message,omitempty"`                 // Optional: Explanation shown with the blocked or annotated call
+	Match          RuleMatchConfig `yaml:"match,omitempty" json:"match"`                               // Optional: Conditions, as for routing rules (default: match every request)
+	Routes         []string        `yaml:"routes,omitempty" json:"routes,omitempty"`                   // Optional: Routed "provider:model" matches any of these globs
+}
+
+// PromptCachingConfig adds cache_control breakpoints to requests that have
+// none, once their session has shown it resends the same prefix
+type PromptCachingConfig struct {
+	Enabled     bool     `yaml:"enabled" json:"enabled"`
+	Providers   []string `yaml:"providers,omitempty" json:"providers,omitempty"`       // Optional: Providers to optimize for; must use the anthropic format (default: every anthropic-format provider)
+	MaxSessions int      `yaml:"max_sessions,omitempty" json:"max_sessions,omitempty"` // Optional: Sessions whose last request's prefixes are remembered (default: 10000)
+}
+
+// AdminConfig protects the config write API
+type AdminConfig struct {
+	APIKey string `yaml:"api_key"` // Optional: Key the config write API requires as a Bearer token; env ADMIN_API_KEY (default: write API disabled)
 }
 
 type ServerConfig struct {
@@ -43,6 +110,78 @@ type ProviderConfig struct {
 	MaxRetries       int    `yaml:"max_retries" json:"max_retries"`             // Optional: Max retry attempts (default: 3)
 	FallbackProvider string `yaml:"fallback_provider" json:"fallback_provider,omitempty"` // Optional: Provider to use when this one fails
 	CircuitBreaker   CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"` // Optional: Circuit breaker settings
+	Retry            RetryConfig          `yaml:"retry" json:"retry"`                     // Optional: Retry policy (backoff, jitter, budget, per-error rules)
+	HealthCheck      HealthCheckConfig    `yaml:"health_check" json:"health_check"`       // Optional: Active health probes
+	Concurrency      ConcurrencyConfig    `yaml:"concurrency" json:"concurrency"`         // Optional: In-flight request limits and wait queue
+}
+
+// ConcurrencyConfig holds bulkhead limits for a provider. Requests over a
+// limit wait in a bounded queue where main-agent requests go before subagents.
+type ConcurrencyConfig struct {
+	MaxInFlight  int            `yaml:"max_in_flight" json:"max_in_flight,omitempty"` // Optional: Concurrent requests to this provider (default: 0 = unlimited)
+	Models       map[string]int `yaml:"models" json:"models,omitempty"`               // Optional: Concurrent requests per model (model -> limit)
+	MaxQueue     int            `yaml:"max_queue" json:"max_queue,omitempty"`         // Optional: Requests allowed to wait for a slot (default: 100)
+	QueueTimeout string         `yaml:"queue_timeout" json:"queue_timeout,omitempty"` // Optional: Longest a request waits for a slot (default: 60s)
+
+	// Parsed queue timeout (not in YAML or JSON)
+	QueueTimeoutDuration time.Duration `yaml:"-" json:"-"`
+}
+
+// IsConfigured reports whether any concurrency limit is set
+func (c *ConcurrencyConfig) IsConfigured() bool {
+	return c.MaxInFlight > 0 || len(c.Models) > 0
+}
+
+// HealthCheckConfig holds the active health probe settings for a provider
+type HealthCheckConfig struct {
+	Enabled          bool   `yaml:"enabled" json:"enabled"`                                   // Optional: Probe this provider on a schedule (default: false)
+	Interval         string `yaml:"interval" json:"interval,omitempty"`                       // Optional: Time between probes (default: 30s)
+	Timeout          string `yaml:"timeout" json:"timeout,omitempty"`                         // Optional: Per-probe timeout (default: 10s)
+	Method           string `yaml:"method" json:"method,omitempty"`                           // Optional: "models" (list models) or "completion" (1-token request) (default: models)
+	Model            string `yaml:"model" json:"model,omitempty"`                             // Optional: Model for completion probes (required when method is completion)
+	FailureThreshold int    `yaml:"failure_threshold" json:"failure_threshold,omitempty"`     // Optional: Consecutive failed probes before the provider is unhealthy (default: 2)
+
+	// Parsed durations (not in YAML or JSON)
+	IntervalDuration time.Duration `yaml:"-" json:"-"`
+	TimeoutDuration  time.Duration `yaml:"-" json:"-"`
+}
+
+// RetryConfig holds the retry policy for a provider
+type RetryConfig struct {
+	InitialBackoff    string  `yaml:"initial_backoff" json:"initial_backoff,omitempty"`         // Optional: First backoff (default: 1s)
+	MaxBackoff        string  `yaml:"max_backoff" json:"max_backoff,omitempty"`                 // Optional: Backoff cap (default: 30s)
+	Multiplier        float64 `yaml:"multiplier" json:"multiplier,omitempty"`                   // Optional: Exponential multiplier (default: 2.0)
+	Jitter            string  `yaml:"jitter" json:"jitter,omitempty"`                           // Optional: "full" or "none" (default: full)
+	RespectRetryAfter *bool   `yaml:"respect_retry_after" json:"respect_retry_after,omitempty"` // Optional: Honor retry-after / retry-after-ms (default: true)
+	MaxRetryAfter     string  `yaml:"max_retry_after" json:"max_retry_after,omitempty"`         // Optional: Give up if the server asks to wait longer (default: 60s)
+	BudgetPercent     float64 `yaml:"budget_percent" json:"budget_percent,omitempty"`           // Optional: Retries allowed as % of requests (0 = unlimited)
+	BudgetMinRetries  int     `yaml:"budget_min_retries" json:"budget_min_retries,omitempty"`   // Optional: Retries always allowed per minute (default: 10)
+
+	// Per-error-class rules; unset fields inherit the values above and max_retries
+	RateLimit    RetryRuleConfig `yaml:"rate_limit" json:"rate_limit"`       // 429
+	Overloaded   RetryRuleConfig `yaml:"overloaded" json:"overloaded"`       // 529 / overloaded_error
+	ServerError  RetryRuleConfig `yaml:"server_error" json:"server_error"`   // other 5xx and 408
+	ConnectError RetryRuleConfig `yaml:"connect_error" json:"connect_error"` // transport errors
+
+	// Parsed durations (not in YAML or JSON)
+	InitialBackoffDuration time.Duration `yaml:"-" json:"-"`
+	MaxBackoffDuration     time.Duration `yaml:"-" json:"-"`
+	MaxRetryAfterDuration  time.Duration `yaml:"-" json:"-"`
+
+	// tuned records whether multiplier, jitter or respect_retry_after were set
+	// before applyDefaults filled them in
+	tuned bool
+}
+
+// RetryRuleConfig overrides the retry policy for one class of error
+type RetryRuleConfig struct {
+	MaxRetries     *int   `yaml:"max_retries" json:"max_retries,omitempty"`         // Optional: 0 disables retries for this class
+	InitialBackoff string `yaml:"initial_backoff" json:"initial_backoff,omitempty"` // Optional: Overrides retry.initial_backoff
+	MaxBackoff     string `yaml:"max_backoff" json:"max_backoff,omitempty"`         // Optional: Overrides retry.max_backoff
+
+	// Parsed durations (not in YAML or JSON)
+	InitialBackoffDuration time.Duration `yaml:"-" json:"-"`
+	MaxBackoffDuration     time.Duration `yaml:"-" json:"-"`
 }
 
 // CircuitBreakerConfig holds circuit breaker configuration
@@ -51,18 +190,92 @@ type CircuitBreakerConfig struct {
 	MaxFailures int    `yaml:"max_failures" json:"max_failures"` // Optional: Failures before opening circuit (default: 5)
 	Timeout     string `yaml:"timeout" json:"timeout,omitempty"` // Optional: Time before retry in half-open state (default: 30s)
 
-	// Parsed timeout duration (not in YAML or JSON)
+	Mode               string  `yaml:"mode" json:"mode,omitempty"`                                 // Optional: "consecutive" or "error_rate" (default: consecutive)
+	Window             string  `yaml:"window" json:"window,omitempty"`                             // Optional: Sliding window for error_rate mode (default: 60s)
+	ErrorRateThreshold float64 `yaml:"error_rate_threshold" json:"error_rate_threshold,omitempty"` // Optional: Failure ratio that opens the circuit in error_rate mode (default: 0.5)
+	MinRequests        int     `yaml:"min_requests" json:"min_requests,omitempty"`                 // Optional: Requests in the window before error_rate mode can trip (default: 20)
+	HalfOpenMaxProbes  int     `yaml:"half_open_max_probes" json:"half_open_max_probes,omitempty"` // Optional: Concurrent requests allowed while half-open (default: 1)
+	PerModel           bool    `yaml:"per_model" json:"per_model,omitempty"`                       // Optional: Also keep a breaker per model, so with error_rate mode a failing model trips before the provider does (default: false)
+
+	// Parsed timeout durations (not in YAML or JSON)
 	TimeoutDuration time.Duration `yaml:"-" json:"-"`
+	WindowDuration  time.Duration `yaml:"-" json:"-"`
 }
 
 type StorageConfig struct {
-	RequestsDir string `yaml:"requests_dir" json:"requests_dir,omitempty"`
-	DBPath      string `yaml:"db_path" json:"db_path,omitempty"`
+	Backend     string          `yaml:"backend,omitempty" json:"backend,omitempty"` // Optional: sqlite or jsonl (default: sqlite)
+	RequestsDir string          `yaml:"requests_dir" json:"requests_dir,omitempty"` // Optional: Directory for the jsonl backend's files (default: requests)
+	DBPath      string          `yaml:"db_path" json:"db_path,omitempty"`
+	Redaction   RedactionConfig `yaml:"redaction" json:"redaction"`
+	Bodies      BodyStoreConfig `yaml:"bodies" json:"bodies"`
+	Retention   RetentionConfig `yaml:"retention" json:"retention"`
+}
+
+// StorageBackends are where requests are stored: a SQLite database, or
+// append-only JSONL files in requests_dir
+var StorageBackends = []string{"sqlite", "jsonl"}
+
+// BodyStoreCodecs are the compression codecs for stored body blobs
+var BodyStoreCodecs = []string{"gzip", "none"}
+
+// BodyStoreConfig controls how request bodies are stored. With dedup on,
+// the system prompt, each tool definition, and each message are stored once
+// as compressed, content-addressed blobs shared by every request that sends
+// them, instead of being copied into every row.
+type BodyStoreConfig struct {
+	Dedup       bool   `yaml:"dedup" json:"dedup"`
+	Compression string `yaml:"compression,omitempty" json:"compression,omitempty"` // Optional: One of BodyStoreCodecs (default: gzip)
+}
+
+// RedactionDetectors are the built-in redaction detectors, in the order
+// they run
+var RedactionDetectors = []string{
+	"private_key", "jwt", "aws_access_key", "aws_secret_key", "gcp_api_key",
+	"github_token", "slack_token", "api_key", "email", "high_entropy",
+}
+
+// RedactionConfig masks secrets and personal data in request bodies,
+// responses, and indexed conversations before they are stored. Traffic to
+// providers is not changed.
+type RedactionConfig struct {
+	Enabled    bool                     `yaml:"enabled" json:"enabled"`
+	Detectors  []string                 `yaml:"detectors,omitempty" json:"detectors,omitempty"`     // Optional: Built-in detectors to run (default: all of RedactionDetectors)
+	Patterns   []RedactionPatternConfig `yaml:"patterns,omitempty" json:"patterns,omitempty"`       // Optional: Custom detectors, run after the built-in ones
+	MinEntropy float64                  `yaml:"min_entropy,omitempty" json:"min_entropy,omitempty"` // Optional: Bits per character for high_entropy to redact a 32+ character token (default: 4.5)
+}
+
+// RedactionPatternConfig is a custom redaction detector
+type RedactionPatternConfig struct {
+	Name  string `yaml:"name" json:"name"`   // Required: Label in the redaction marker and counts
+	Regex string `yaml:"regex" json:"regex"` // Required: RE2 regex; if it has a capture group, only the first group is redacted
 }
 
 type SubagentsConfig struct {
-	Enable   bool              `yaml:"enable" json:"enable"`
-	Mappings map[string]string `yaml:"mappings" json:"mappings"` // agentName -> "provider:model"
+	Enable              bool              `yaml:"enable" json:"enable"`
+	Mappings            map[string]string `yaml:"mappings" json:"mappings"`                                   // agentName -> "provider:model"
+	AgentDirs           []string          `yaml:"agent_dirs" json:"agent_dirs,omitempty"`                     // Optional: Directories of agent .md files, highest priority first (default: [".claude/agents", "~/.claude/agents"])
+	SimilarityThreshold float64           `yaml:"similarity_threshold" json:"similarity_threshold,omitempty"` // Optional: Prompt similarity, 0-1, needed for a fuzzy match (default: 0.9; 1 = exact match only)
+}
+
+// RateLimitConfig holds token-bucket limits on inbound /v1/messages traffic.
+// Each scope is checked independently; a request must fit in every bucket.
+type RateLimitConfig struct {
+	Enabled    bool                     `yaml:"enabled" json:"enabled"`
+	Global     RateLimitRule            `yaml:"global" json:"global"`           // Optional: Limit across all traffic
+	PerClient  RateLimitRule            `yaml:"per_client" json:"per_client"`   // Optional: Limit per client API key
+	PerSession RateLimitRule            `yaml:"per_session" json:"per_session"` // Optional: Limit per Claude Code session (metadata.user_id)
+	Clients    map[string]RateLimitRule `yaml:"clients" json:"-"`               // Optional: per_client overrides keyed by client API key (never serialized)
+}
+
+// RateLimitRule is a pair of per-minute limits. Zero means unlimited.
+type RateLimitRule struct {
+	RequestsPerMinute int `yaml:"requests_per_minute" json:"requests_per_minute,omitempty"` // Optional: Requests per minute (default: 0 = unlimited)
+	TokensPerMinute   int `yaml:"tokens_per_minute" json:"tokens_per_minute,omitempty"`     // Optional: Estimated input tokens per minute (default: 0 = unlimited)
+}
+
+// IsConfigured returns true if the rule limits anything
+func (r RateLimitRule) IsConfigured() bool {
+	return r.RequestsPerMinute > 0 || r.TokensPerMinute > 0
 }
 
 // RoutingConfig holds preference-based routing configuration
@@ -70,6 +283,119 @@ type RoutingConfig struct {
 	Preferences      PreferencesConfig                `yaml:"preferences" json:"preferences"`
 	Tasks            map[string]TaskRoutingConfig     `yaml:"tasks" json:"tasks"`
 	ProviderProfiles map[string]ProviderProfileConfig `yaml:"provider_profiles" json:"provider_profiles"`
+	Hedging          HedgingConfig                    `yaml:"hedging" json:"hedging"`
+	AdaptiveWeights  AdaptiveWeightsConfig            `yaml:"adaptive_weights" json:"adaptive_weights"`
+	Rules            []RoutingRuleConfig              `yaml:"rules" json:"rules,omitempty"`
+	ContextWindows   []ContextWindowConfig            `yaml:"context_windows" json:"context_windows,omitempty"`
+	Experiments      []ExperimentConfig               `yaml:"experiments" json:"experiments,omitempty"`
+	Projects         []ProjectConfig                  `yaml:"projects" json:"projects,omitempty"`
+}
+
+// ProjectConfig overrides routing for one Claude Code project, identified by
+// the working directory in the request's system prompt. The first entry
+// matching the project applies. Routing rules still take precedence over
+// target and preference, but never over providers.
+type ProjectConfig struct {
+	Path       string   `yaml:"path" json:"path"`                                 // Required: Project directory (subdirectories match too) or glob
+	Providers  []string `yaml:"providers,omitempty" json:"providers,omitempty"`   // Optional: The only providers that may serve the project, including fallbacks, hedges, and overflow
+	Target     string   `yaml:"target,omitempty" json:"target,omitempty"`         // Optional: "provider:model" for every request, subagents included
+	Preference string   `yaml:"preference,omitempty" json:"preference,omitempty"` // Optional: cost, speed, quality, or balanced; picks among providers (default: all) keeping the model
+}
+
+// ExperimentConfig splits the traffic it matches between weighted arms. A
+// Claude Code session stays on one arm for as long as the arms and weights
+// are unchanged. Routing rules take precedence: experiments only see
+// requests no rule matched.
+type ExperimentConfig struct {
+	ID    string                `yaml:"id" json:"id"`                 // Required: Recorded on requests the experiment assigns
+	Match RuleMatchConfig       `yaml:"match,omitempty" json:"match"` // Optional: Conditions, as for routing rules (default: match every request)
+	Arms  []ExperimentArmConfig `yaml:"arms" json:"arms"`             // Required: At least two arms
+}
+
+// ExperimentArmConfig is one arm of an experiment. Prices are only used to
+// estimate each arm's cost in the results.
+type ExperimentArmConfig struct {
+	ID                string  `yaml:"id" json:"id"`                                                         // Required: Recorded on requests assigned to the arm
+	Target            string  `yaml:"target,omitempty" json:"target,omitempty"`                             // Optional: "provider:model" to route to (default: keep the normal route)
+	Weight            int     `yaml:"weight" json:"weight"`                                                 // Required: Share of traffic relative to the other arms
+	InputCostPerMTok  float64 `yaml:"input_cost_per_mtok,omitempty" json:"input_cost_per_mtok,omitempty"`   // Optional: USD per million input tokens
+	OutputCostPerMTok float64 `yaml:"output_cost_per_mtok,omitempty" json:"output_cost_per_mtok,omitempty"` // Optional: USD per million output tokens
+}
+
+// ContextWindowConfig declares a model's context window and where requests
+// too large for it go instead. The first entry matching the routed model
+// applies; models with no entry are not checked.
+type ContextWindowConfig struct {
+	Match     string   `yaml:"match" json:"match"`                           // Required: Model glob ("gpt-4o*"), or "provider:model" glob to limit it to one provider
+	MaxTokens int      `yaml:"max_tokens" json:"max_tokens"`                 // Required: Context window in tokens; estimated input plus max_tokens must fit
+	Overflow  []string `yaml:"overflow,omitempty" json:"overflow,omitempty"` // Optional: "provider:model" alternatives tried in order (default: reject the request)
+}
+
+// RoutingRuleConfig is one entry in the ordered routing.rules list. The first
+// rule whose conditions all match decides the route; conditions left empty
+// match anything. Exactly one of target, preference, or action "reject" is set.
+type RoutingRuleConfig struct {
+	ID         string          `yaml:"id" json:"id"`                                     // Required: Recorded on requests the rule matches
+	Match      RuleMatchConfig `yaml:"match,omitempty" json:"match"`                     // Optional: Conditions (default: match every request)
+	Target     string          `yaml:"target,omitempty" json:"target,omitempty"`         // Optional: "provider:model" to route to
+	Preference string          `yaml:"preference,omitempty" json:"preference,omitempty"` // Optional: cost, speed, quality, or balanced; picks a provider keeping the model
+	Providers  []string        `yaml:"providers,omitempty" json:"providers,omitempty"`   // Optional: Candidates for preference (default: all providers)
+	Action     string          `yaml:"action,omitempty" json:"action,omitempty"`         // Optional: "route" or "reject" (default: route)
+	Message    string          `yaml:"message,omitempty" json:"message,omitempty"`       // Optional: Error message for rejected requests
+}
+
+// RuleMatchConfig holds a routing rule's conditions. Model, subagent, header,
+// and project patterns are globs ("claude-*-haiku-*").
+type RuleMatchConfig struct {
+	Models         []string          `yaml:"models,omitempty" json:"models,omitempty"`                     // Optional: Original model matches any of these
+	Subagents      []string          `yaml:"subagents,omitempty" json:"subagents,omitempty"`               // Optional: Matched subagent name is any of these
+	Tools          []string          `yaml:"tools,omitempty" json:"tools,omitempty"`                       // Optional: Request offers all of these tools
+	MinInputTokens int               `yaml:"min_input_tokens,omitempty" json:"min_input_tokens,omitempty"` // Optional: Estimated input tokens at least this
+	MaxInputTokens int               `yaml:"max_input_tokens,omitempty" json:"max_input_tokens,omitempty"` // Optional: Estimated input tokens at most this
+	Stream         *bool             `yaml:"stream,omitempty" json:"stream,omitempty"`                     // Optional: Request stream flag equals this
+	Headers        map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`                   // Optional: Header -> pattern; every header must be present and match
+	ProjectPaths   []string          `yaml:"project_paths,omitempty" json:"project_paths,omitempty"`       // Optional: Project directory is, or is under, any of these
+	TimeOfDay      string            `yaml:"time_of_day,omitempty" json:"time_of_day,omitempty"`           // Optional: Local time window "HH:MM-HH:MM" (may wrap midnight)
+
+	// Parsed time window in minutes after midnight (not in YAML or JSON)
+	StartMinute int `yaml:"-" json:"-"`
+	EndMinute   int `yaml:"-" json:"-"`
+}
+
+// AdaptiveWeightsConfig controls the background controller that adjusts
+// load balancer weights from observed latency, TTFB, and error rate
+type AdaptiveWeightsConfig struct {
+	Enabled    bool    `yaml:"enabled" json:"enabled"`
+	Interval   string  `yaml:"interval" json:"interval,omitempty"`       // Optional: How often weights are recomputed (default: 10s)
+	Alpha      float64 `yaml:"alpha" json:"alpha,omitempty"`             // Optional: EWMA smoothing factor per observation, 0-1 (default: 0.2)
+	Decay      float64 `yaml:"decay" json:"decay,omitempty"`             // Optional: Per-interval pull of idle providers back to neutral, 0-1 (default: 0.1)
+	MinSamples int     `yaml:"min_samples" json:"min_samples,omitempty"` // Optional: Observations before a provider's weight is adjusted (default: 5)
+	MinWeight  int     `yaml:"min_weight" json:"min_weight,omitempty"`   // Optional: Lower bound on effective weight (default: 1)
+	MaxWeight  int     `yaml:"max_weight" json:"max_weight,omitempty"`   // Optional: Upper bound on effective weight (default: 100)
+
+	// Parsed interval (not in YAML or JSON)
+	IntervalDuration time.Duration `yaml:"-" json:"-"`
+}
+
+// HedgingConfig controls request hedging: when the routed provider has not
+// produced a first byte within a percentile of its recent TTFB, the same
+// request is sent to a second provider and the first response wins
+type HedgingConfig struct {
+	Enabled         bool              `yaml:"enabled" json:"enabled"`
+	Models          []string          `yaml:"models" json:"models,omitempty"`                       // Optional: Model name substrings eligible for hedging (default: ["haiku"])
+	MaxRequestBytes int               `yaml:"max_request_bytes" json:"max_request_bytes,omitempty"` // Optional: Larger requests are never hedged (default: 65536)
+	Percentile      float64           `yaml:"percentile" json:"percentile,omitempty"`               // Optional: Recent TTFB percentile that triggers the hedge (default: 95)
+	WindowSize      int               `yaml:"window_size" json:"window_size,omitempty"`             // Optional: TTFB samples kept per provider (default: 200)
+	MinSamples      int               `yaml:"min_samples" json:"min_samples,omitempty"`             // Optional: Samples needed before the percentile is used (default: 20)
+	InitialDelay    string            `yaml:"initial_delay" json:"initial_delay,omitempty"`         // Optional: Hedge delay until min_samples is reached (default: 2s)
+	MinDelay        string            `yaml:"min_delay" json:"min_delay,omitempty"`                 // Optional: Lower bound on the hedge delay (default: 250ms)
+	MaxDelay        string            `yaml:"max_delay" json:"max_delay,omitempty"`                 // Optional: Upper bound on the hedge delay (default: 10s)
+	Targets         map[string]string `yaml:"targets" json:"targets"`                               // provider -> "provider:model" to send the hedge to
+
+	// Parsed durations (not in YAML or JSON)
+	InitialDelayDuration time.Duration `yaml:"-" json:"-"`
+	MinDelayDuration     time.Duration `yaml:"-" json:"-"`
+	MaxDelayDuration     time.Duration `yaml:"-" json:"-"`
 }
 
 // PreferencesConfig holds default routing preferences
@@ -79,8 +405,8 @@ type PreferencesConfig struct {
 
 // TaskRoutingConfig defines routing for a specific task type
 type TaskRoutingConfig struct {
-	Preference string   `yaml:"preference" json:"preference"` // cost, speed, quality, balanced
-	Providers  []string `yaml:"providers" json:"providers"`   // Preferred providers for this task
+	Preference string   `yaml:"preference" json:"preference"`         // cost, speed, quality, balanced
+	Providers  []string `yaml:"providers,omitempty" json:"providers"` // Preferred providers for this task
 }
 
 // ProviderProfileConfig describes provider characteristics
@@ -90,7 +416,34 @@ type ProviderProfileConfig struct {
 	Quality int `yaml:"quality" json:"quality"` // 1-10 scale
 }
 
+// Path returns the config.yaml location Load reads from
+func Path() string {
+	// Try to load config.yaml from the project root
+	// The proxy binary is in proxy/ directory, config.yaml is in the parent
+	configPath := filepath.Join(filepath.Dir(os.Args[0]), "..", "config.yaml")
+
+	// If that doesn't work, try relative to current directory
+	if _, err := os.Stat(configPath); err != nil {
+		// Try common locations relative to where the binary might be run
+		for _, tryPath := range []string{"config.yaml", "../config.yaml", "../../config.yaml"} {
+			if _, err := os.Stat(tryPath); err == nil {
+				configPath = tryPath
+				break
+			}
+		}
+	}
+	return configPath
+}
+
+// Load loads configuration from the config.yaml found by Path
 func Load() (*Config, error) {
+	return LoadFile(Path())
+}
+
+// LoadFile loads configuration from the given config.yaml, applying defaults,
+// environment overrides, and validation. A missing file falls back to the
+// defaults; a file that cannot be parsed is an error.
+func LoadFile(configPath string) (*Config, error) {
 	// Load .env file if it exists
 	// Look for .env file in the project root (one level up from proxy/)
 	envPath := filepath.Join("..", ".env")
@@ -134,23 +487,10 @@ func Load() (*Config, error) {
 		},
 	}
 
-	// Try to load config.yaml from the project root
-	// The proxy binary is in proxy/ directory, config.yaml is in the parent
-	configPath := filepath.Join(filepath.Dir(os.Args[0]), "..", "config.yaml")
-
-	// If that doesn't work, try relative to current directory
-	if _, err := os.Stat(configPath); err != nil {
-		// Try common locations relative to where the binary might be run
-		for _, tryPath := range []string{"config.yaml", "../config.yaml", "../../config.yaml"} {
-			if _, err := os.Stat(tryPath); err == nil {
-				configPath = tryPath
-				break
-			}
-		}
+	if err := cfg.loadFromFile(configPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
 	}
 
-	cfg.loadFromFile(configPath)
-
 	// Apply environment variable overrides AFTER loading from file
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		cfg.Server.Port = envPort
@@ -188,6 +528,10 @@ func Load() (*Config, error) {
 		}
 	}
 
+	if envKey := os.Getenv("ADMIN_API_KEY"); envKey != "" {
+		cfg.Admin.APIKey = envKey
+	}
+
 	// Override storage settings
 	if envPath := os.Getenv("DB_PATH"); envPath != "" {
 		cfg.Storage.DBPath = envPath
@@ -217,33 +561,81 @@ func Load() (*Config, error) {
 			provider.MaxRetries = 3
 		}
 
-		// Parse circuit breaker timeout
-		if provider.CircuitBreaker.Timeout != "" {
-			if duration, err := time.ParseDuration(provider.CircuitBreaker.Timeout); err == nil {
-				provider.CircuitBreaker.TimeoutDuration = duration
-			} else {
-				return nil, fmt.Errorf("provider '%s': invalid circuit_breaker.timeout '%s': %w", name, provider.CircuitBreaker.Timeout, err)
-			}
-		} else {
-			// Default timeout: 30s
-			provider.CircuitBreaker.TimeoutDuration = 30 * time.Second
-		}
-
-		// Default max failures: 5
-		if provider.CircuitBreaker.MaxFailures == 0 {
-			provider.CircuitBreaker.MaxFailures = 5
+		if err := provider.CircuitBreaker.applyDefaults(name); err != nil {
+			return nil, err
 		}
 
 		// Enable circuit breaker by default if fallback is configured
 		if provider.FallbackProvider != "" && !provider.CircuitBreaker.Enabled {
 			provider.CircuitBreaker.Enabled = true
 		}
+
+		if err := provider.Retry.applyDefaults(name); err != nil {
+			return nil, err
+		}
+
+		if err := provider.HealthCheck.applyDefaults(name); err != nil {
+			return nil, err
+		}
+
+		if err := provider.Concurrency.applyDefaults(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Subagents.applyDefaults(); err != nil {
+		return nil, err
 	}
 
 	// Apply routing defaults
 	if cfg.Routing.Preferences.Default == "" {
 		cfg.Routing.Preferences.Default = "balanced"
 	}
+	if err := cfg.Routing.Hedging.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Routing.AdaptiveWeights.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.RateLimits.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Storage.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Storage.Redaction.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Storage.Bodies.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Storage.Retention.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateRoutingRules(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateModelAliases(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateContextWindows(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateExperiments(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateProjects(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePlugins(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateToolPolicies(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePromptCaching(); err != nil {
+		return nil, err
+	}
 
 	// Validate provider configurations
 	if err := cfg.validateProviders(); err != nil {
@@ -253,6 +645,708 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// applyDefaults parses circuit breaker durations and fills in defaults
+func (c *CircuitBreakerConfig) applyDefaults(providerName string) error {
+	var err error
+	if c.TimeoutDuration, err = parseDurationDefault(c.Timeout, 30*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid circuit_breaker.timeout '%s': %w", providerName, c.Timeout, err)
+	}
+	if c.WindowDuration, err = parseDurationDefault(c.Window, 60*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid circuit_breaker.window '%s': %w", providerName, c.Window, err)
+	}
+	if c.MaxFailures == 0 {
+		c.MaxFailures = 5
+	}
+	if c.Mode == "" {
+		c.Mode = "consecutive"
+	}
+	if c.Mode != "consecutive" && c.Mode != "error_rate" {
+		return fmt.Errorf("provider '%s': invalid circuit_breaker.mode '%s' (must be 'consecutive' or 'error_rate')", providerName, c.Mode)
+	}
+	if c.ErrorRateThreshold == 0 {
+		c.ErrorRateThreshold = 0.5
+	}
+	if c.ErrorRateThreshold < 0 || c.ErrorRateThreshold > 1 {
+		return fmt.Errorf("provider '%s': circuit_breaker.error_rate_threshold must be between 0 and 1", providerName)
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = 20
+	}
+	if c.HalfOpenMaxProbes == 0 {
+		c.HalfOpenMaxProbes = 1
+	}
+	if c.MinRequests < 0 || c.HalfOpenMaxProbes < 0 {
+		return fmt.Errorf("provider '%s': circuit_breaker.min_requests and half_open_max_probes must not be negative", providerName)
+	}
+	return nil
+}
+
+// applyDefaults parses health check durations and fills in defaults
+func (h *HealthCheckConfig) applyDefaults(providerName string) error {
+	var err error
+	if h.IntervalDuration, err = parseDurationDefault(h.Interval, 30*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid health_check.interval '%s': %w", providerName, h.Interval, err)
+	}
+	if h.TimeoutDuration, err = parseDurationDefault(h.Timeout, 10*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid health_check.timeout '%s': %w", providerName, h.Timeout, err)
+	}
+	if h.IntervalDuration <= 0 || h.TimeoutDuration <= 0 {
+		return fmt.Errorf("provider '%s': health_check.interval and timeout must be positive", providerName)
+	}
+	if h.Method == "" {
+		h.Method = "models"
+	}
+	if h.Method != "models" && h.Method != "completion" {
+		return fmt.Errorf("provider '%s': invalid health_check.method '%s' (must be 'models' or 'completion')", providerName, h.Method)
+	}
+	if h.Enabled && h.Method == "completion" && h.Model == "" {
+		return fmt.Errorf("provider '%s': health_check.model is required for completion probes", providerName)
+	}
+	if h.FailureThreshold == 0 {
+		h.FailureThreshold = 2
+	}
+	if h.FailureThreshold < 0 {
+		return fmt.Errorf("provider '%s': health_check.failure_threshold must not be negative", providerName)
+	}
+	return nil
+}
+
+// applyDefaults parses the queue timeout and fills in defaults
+func (c *ConcurrencyConfig) applyDefaults(providerName string) error {
+	var err error
+	if c.QueueTimeoutDuration, err = parseDurationDefault(c.QueueTimeout, 60*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid concurrency.queue_timeout '%s': %w", providerName, c.QueueTimeout, err)
+	}
+	if c.MaxQueue == 0 {
+		c.MaxQueue = 100
+	}
+	if c.MaxInFlight < 0 || c.MaxQueue < 0 {
+		return fmt.Errorf("provider '%s': concurrency.max_in_flight and max_queue must not be negative", providerName)
+	}
+	for model, limit := range c.Models {
+		if limit <= 0 {
+			return fmt.Errorf("provider '%s': concurrency.models.%s must be positive", providerName, model)
+		}
+	}
+	return nil
+}
+
+// applyDefaults parses retry durations and fills in defaults
+func (r *RetryConfig) applyDefaults(providerName string) error {
+	r.tuned = r.Multiplier != 0 || r.Jitter != "" || r.RespectRetryAfter != nil
+
+	var err error
+	if r.InitialBackoffDuration, err = parseDurationDefault(r.InitialBackoff, 1*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid retry.initial_backoff '%s': %w", providerName, r.InitialBackoff, err)
+	}
+	if r.MaxBackoffDuration, err = parseDurationDefault(r.MaxBackoff, 30*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid retry.max_backoff '%s': %w", providerName, r.MaxBackoff, err)
+	}
+	if r.MaxRetryAfterDuration, err = parseDurationDefault(r.MaxRetryAfter, 60*time.Second); err != nil {
+		return fmt.Errorf("provider '%s': invalid retry.max_retry_after '%s': %w", providerName, r.MaxRetryAfter, err)
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = 2.0
+	}
+	if r.Jitter == "" {
+		r.Jitter = "full"
+	}
+	if r.Jitter != "full" && r.Jitter != "none" {
+		return fmt.Errorf("provider '%s': invalid retry.jitter '%s' (must be 'full' or 'none')", providerName, r.Jitter)
+	}
+	if r.RespectRetryAfter == nil {
+		respect := true
+		r.RespectRetryAfter = &respect
+	}
+	if r.BudgetPercent < 0 {
+		return fmt.Errorf("provider '%s': retry.budget_percent must not be negative", providerName)
+	}
+	if r.BudgetPercent > 0 && r.BudgetMinRetries == 0 {
+		r.BudgetMinRetries = 10
+	}
+
+	rules := map[string]*RetryRuleConfig{
+		"rate_limit":    &r.RateLimit,
+		"overloaded":    &r.Overloaded,
+		"server_error":  &r.ServerError,
+		"connect_error": &r.ConnectError,
+	}
+	for key, rule := range rules {
+		if rule.InitialBackoffDuration, err = parseDurationDefault(rule.InitialBackoff, 0); err != nil {
+			return fmt.Errorf("provider '%s': invalid retry.%s.initial_backoff '%s': %w", providerName, key, rule.InitialBackoff, err)
+		}
+		if rule.MaxBackoffDuration, err = parseDurationDefault(rule.MaxBackoff, 0); err != nil {
+			return fmt.Errorf("provider '%s': invalid retry.%s.max_backoff '%s': %w", providerName, key, rule.MaxBackoff, err)
+		}
+		if rule.MaxRetries != nil && *rule.MaxRetries < 0 {
+			return fmt.Errorf("provider '%s': retry.%s.max_retries must not be negative", providerName, key)
+		}
+	}
+
+	return nil
+}
+
+// applyDefaults fills in agent directories and the similarity threshold
+func (s *SubagentsConfig) applyDefaults() error {
+	if len(s.AgentDirs) == 0 {
+		s.AgentDirs = []string{".claude/agents", "~/.claude/agents"}
+	}
+	if s.SimilarityThreshold == 0 {
+		s.SimilarityThreshold = 0.9
+	}
+	if s.SimilarityThreshold < 0 || s.SimilarityThreshold > 1 {
+		return fmt.Errorf("subagents.similarity_threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+// validateRoutingRules checks rule IDs, targets, and time windows
+func (c *Config) validateRoutingRules() error {
+	seen := make(map[string]bool)
+	for i := range c.Routing.Rules {
+		rule := &c.Routing.Rules[i]
+		if rule.ID == "" {
+			return fmt.Errorf("routing.rules[%d] is missing required 'id' field", i)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("routing rule '%s' is defined more than once", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		if rule.Action == "" {
+			rule.Action = "route"
+		}
+		switch rule.Action {
+		case "reject":
+			if rule.Target != "" || rule.Preference != "" {
+				return fmt.Errorf("routing rule '%s': a reject rule cannot also set target or preference", rule.ID)
+			}
+		case "route":
+			if (rule.Target == "") == (rule.Preference == "") {
+				return fmt.Errorf("routing rule '%s' must set exactly one of target or preference", rule.ID)
+			}
+		default:
+			return fmt.Errorf("routing rule '%s' has invalid action '%s' (must be 'route' or 'reject')", rule.ID, rule.Action)
+		}
+
+		if rule.Target != "" {
+			parts := strings.SplitN(rule.Target, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("routing rule '%s' has invalid target '%s' (expected 'provider:model')", rule.ID, rule.Target)
+			}
+			if _, exists := c.Providers[parts[0]]; !exists {
+				return fmt.Errorf("routing rule '%s' targets unknown provider '%s'", rule.ID, parts[0])
+			}
+		}
+		if rule.Preference != "" {
+			switch rule.Preference {
+			case "cost", "speed", "quality", "balanced":
+			default:
+				return fmt.Errorf("routing rule '%s' has invalid preference '%s' (must be cost, speed, quality, or balanced)", rule.ID, rule.Preference)
+			}
+		}
+		for _, name := range rule.Providers {
+			if _, exists := c.Providers[name]; !exists {
+				return fmt.Errorf("routing rule '%s' lists unknown provider '%s'", rule.ID, name)
+			}
+		}
+
+		if err := rule.Match.validate(); err != nil {
+			return fmt.Errorf("routing rule '%s': %w", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// validate checks token bounds and parses the time window
+func (m *RuleMatchConfig) validate() error {
+	if m.MaxInputTokens > 0 && m.MaxInputTokens < m.MinInputTokens {
+		return fmt.Errorf("max_input_tokens must not be less than min_input_tokens")
+	}
+	if m.TimeOfDay != "" {
+		start, end, err := parseTimeWindow(m.TimeOfDay)
+		if err != nil {
+			return fmt.Errorf("invalid time_of_day '%s': %w", m.TimeOfDay, err)
+		}
+		m.StartMinute, m.EndMinute = start, end
+	}
+	return nil
+}
+
+// validateExperiments checks experiment and arm IDs, weights, and targets
+func (c *Config) validateExperiments() error {
+	seen := make(map[string]bool)
+	for i := range c.Routing.Experiments {
+		experiment := &c.Routing.Experiments[i]
+		if experiment.ID == "" {
+			return fmt.Errorf("routing.experiments[%d] is missing required 'id' field", i)
+		}
+		if seen[experiment.ID] {
+			return fmt.Errorf("experiment '%s' is defined more than once", experiment.ID)
+		}
+		seen[experiment.ID] = true
+
+		if len(experiment.Arms) < 2 {
+			return fmt.Errorf("experiment '%s' needs at least two arms", experiment.ID)
+		}
+		arms := make(map[string]bool)
+		for j, arm := range experiment.Arms {
+			if arm.ID == "" {
+				return fmt.Errorf("experiment '%s' arms[%d] is missing required 'id' field", experiment.ID, j)
+			}
+			if arms[arm.ID] {
+				return fmt.Errorf("experiment '%s' has arm '%s' more than once", experiment.ID, arm.ID)
+			}
+			arms[arm.ID] = true
+			if arm.Weight <= 0 {
+				return fmt.Errorf("experiment '%s' arm '%s' must set weight greater than 0", experiment.ID, arm.ID)
+			}
+			if arm.InputCostPerMTok < 0 || arm.OutputCostPerMTok < 0 {
+				return fmt.Errorf("experiment '%s' arm '%s' has a negative price", experiment.ID, arm.ID)
+			}
+			if arm.Target != "" {
+				parts := strings.SplitN(arm.Target, ":", 2)
+				if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+					return fmt.Errorf("experiment '%s' arm '%s' has invalid target '%s' (expected 'provider:model')", experiment.ID, arm.ID, arm.Target)
+				}
+				if _, exists := c.Providers[parts[0]]; !exists {
+					return fmt.Errorf("experiment '%s' arm '%s' targets unknown provider '%s'", experiment.ID, arm.ID, parts[0])
+				}
+			}
+		}
+
+		if err := experiment.Match.validate(); err != nil {
+			return fmt.Errorf("experiment '%s': %w", experiment.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateProjects checks project paths, providers, targets, and preferences
+func (c *Config) validateProjects() error {
+	for i, project := range c.Routing.Projects {
+		if project.Path == "" {
+			return fmt.Errorf("routing.projects[%d] is missing required 'path' field", i)
+		}
+		if len(project.Providers) == 0 && project.Target == "" && project.Preference == "" {
+			return fmt.Errorf("project '%s' must set providers, target, or preference", project.Path)
+		}
+		if project.Target != "" && project.Preference != "" {
+			return fmt.Errorf("project '%s' cannot set both target and preference", project.Path)
+		}
+		for _, name := range project.Providers {
+			if _, exists := c.Providers[name]; !exists {
+				return fmt.Errorf("project '%s' lists unknown provider '%s'", project.Path, name)
+			}
+		}
+
+		if project.Target != "" {
+			parts := strings.SplitN(project.Target, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("project '%s' has invalid target '%s' (expected 'provider:model')", project.Path, project.Target)
+			}
+			if _, exists := c.Providers[parts[0]]; !exists {
+				return fmt.Errorf("project '%s' targets unknown provider '%s'", project.Path, parts[0])
+			}
+			if len(project.Providers) > 0 && !slices.Contains(project.Providers, parts[0]) {
+				return fmt.Errorf("project '%s' targets provider '%s', which is not in its providers", project.Path, parts[0])
+			}
+		}
+		if project.Preference != "" {
+			switch project.Preference {
+			case "cost", "speed", "quality", "balanced":
+			default:
+				return fmt.Errorf("project '%s' has invalid preference '%s' (must be cost, speed, quality, or balanced)", project.Path, project.Preference)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePlugins checks plugin names, types, and the settings each type needs
+func (c *Config) validatePlugins() error {
+	seen := make(map[string]bool)
+	for i := range c.Plugins {
+		plugin := &c.Plugins[i]
+		if plugin.Name == "" {
+			return fmt.Errorf("plugins[%d] is missing required 'name' field", i)
+		}
+		if seen[plugin.Name] {
+			return fmt.Errorf("plugin '%s' is defined more than once", plugin.Name)
+		}
+		seen[plugin.Name] = true
+
+		switch plugin.Type {
+		case "system_prompt":
+			if plugin.Text == "" {
+				return fmt.Errorf("plugin '%s' of type system_prompt must set text", plugin.Name)
+			}
+		case "remove_tools":
+			if len(plugin.Tools) == 0 {
+				return fmt.Errorf("plugin '%s' of type remove_tools must list tools", plugin.Name)
+			}
+		case "max_tokens":
+			if plugin.MaxTokens <= 0 {
+				return fmt.Errorf("plugin '%s' of type max_tokens must set max_tokens greater than 0", plugin.Name)
+			}
+		case "metadata":
+			if plugin.UserID == "" {
+				return fmt.Errorf("plugin '%s' of type metadata must set user_id", plugin.Name)
+			}
+		case "":
+			return fmt.Errorf("plugin '%s' is missing required 'type' field", plugin.Name)
+		default:
+			return fmt.Errorf("plugin '%s' has invalid type '%s' (must be system_prompt, remove_tools, max_tokens, or metadata)", plugin.Name, plugin.Type)
+		}
+
+		if err := plugin.Match.validate(); err != nil {
+			return fmt.Errorf("plugin '%s': %w", plugin.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateToolPolicies checks policy names, actions, and patterns
+func (c *Config) validateToolPolicies() error {
+	seen := make(map[string]bool)
+	for i := range c.ToolPolicies {
+		policy := &c.ToolPolicies[i]
+		if policy.Name == "" {
+			return fmt.Errorf("tool_policies[%d] is missing required 'name' field", i)
+		}
+		if seen[policy.Name] {
+			return fmt.Errorf("tool policy '%s' is defined more than once", policy.Name)
+		}
+		seen[policy.Name] = true
+
+		if len(policy.Tools) == 0 {
+			return fmt.Errorf("tool policy '%s' must list tools", policy.Name)
+		}
+		switch policy.Action {
+		case "block", "confirm", "annotate":
+		case "":
+			return fmt.Errorf("tool policy '%s' is missing required 'action' field", policy.Name)
+		default:
+			return fmt.Errorf("tool policy '%s' has invalid action '%s' (must be block, confirm, or annotate)", policy.Name, policy.Action)
+		}
+		if policy.Pattern != "" {
+			if _, err := regexp.Compile(policy.Pattern); err != nil {
+				return fmt.Errorf("tool policy '%s' has invalid pattern: %w", policy.Name, err)
+			}
+		}
+		if policy.OutsideProject && policy.Field == "" {
+			return fmt.Errorf("tool policy '%s' sets outside_project without a path field", policy.Name)
+		}
+
+		if err := policy.Match.validate(); err != nil {
+			return fmt.Errorf("tool policy '%s': %w", policy.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePromptCaching checks the optimized providers and fills in defaults
+func (c *Config) validatePromptCaching() error {
+	caching := &c.PromptCaching
+	for _, name := range caching.Providers {
+		provider, exists := c.Providers[name]
+		if !exists {
+			return fmt.Errorf("prompt_caching lists unknown provider '%s'", name)
+		}
+		if provider.Format != "anthropic" {
+			return fmt.Errorf("prompt_caching provider '%s' must use the anthropic format", name)
+		}
+	}
+	if caching.MaxSessions < 0 {
+		return fmt.Errorf("prompt_caching.max_sessions must not be negative")
+	}
+	if caching.MaxSessions == 0 {
+		caching.MaxSessions = 10000
+	}
+	return nil
+}
+
+// validateModelAliases checks alias patterns, targets, and time windows
+func (c *Config) validateModelAliases() error {
+	for i := range c.ModelAliases {
+		alias := &c.ModelAliases[i]
+		if alias.Match == "" {
+			return fmt.Errorf("model_aliases[%d] is missing required 'match' field", i)
+		}
+		if alias.Target == "" {
+			return fmt.Errorf("model alias '%s' is missing required 'target' field", alias.Match)
+		}
+
+		alias.Provider, alias.Model = "", alias.Target
+		if parts := strings.SplitN(alias.Target, ":", 2); len(parts) == 2 {
+			if parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("model alias '%s' has invalid target '%s' (expected 'provider:model' or 'model')", alias.Match, alias.Target)
+			}
+			if _, exists := c.Providers[parts[0]]; !exists {
+				return fmt.Errorf("model alias '%s' targets unknown provider '%s'", alias.Match, parts[0])
+			}
+			alias.Provider, alias.Model = parts[0], parts[1]
+		}
+
+		if alias.TimeOfDay != "" {
+			start, end, err := parseTimeWindow(alias.TimeOfDay)
+			if err != nil {
+				return fmt.Errorf("model alias '%s' has invalid time_of_day '%s': %w", alias.Match, alias.TimeOfDay, err)
+			}
+			alias.StartMinute, alias.EndMinute = start, end
+		}
+	}
+	return nil
+}
+
+// validateContextWindows checks context window sizes and overflow targets
+func (c *Config) validateContextWindows() error {
+	for i, window := range c.Routing.ContextWindows {
+		if window.Match == "" {
+			return fmt.Errorf("routing.context_windows[%d] is missing required 'match' field", i)
+		}
+		if window.MaxTokens <= 0 {
+			return fmt.Errorf("context window '%s' must set max_tokens greater than 0", window.Match)
+		}
+		for _, target := range window.Overflow {
+			parts := strings.SplitN(target, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("context window '%s' has invalid overflow target '%s' (expected 'provider:model')", window.Match, target)
+			}
+			if _, exists := c.Providers[parts[0]]; !exists {
+				return fmt.Errorf("context window '%s' overflows to unknown provider '%s'", window.Match, parts[0])
+			}
+		}
+	}
+	return nil
+}
+
+// parseTimeWindow parses "HH:MM-HH:MM" into minutes after midnight
+func parseTimeWindow(window string) (start, end int, err error) {
+	parts := strings.SplitN(window, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected 'HH:MM-HH:MM'")
+	}
+	minutes := make([]int, 2)
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("expected 'HH:MM-HH:MM'")
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, fmt.Errorf("window start and end must differ")
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// validate rejects negative rate limits
+func (r *RateLimitConfig) validate() error {
+	rules := map[string]RateLimitRule{
+		"global":      r.Global,
+		"per_client":  r.PerClient,
+		"per_session": r.PerSession,
+	}
+	for client, rule := range r.Clients {
+		rules["clients."+maskKey(client)] = rule
+	}
+	for name, rule := range rules {
+		if rule.RequestsPerMinute < 0 || rule.TokensPerMinute < 0 {
+			return fmt.Errorf("rate_limits.%s limits must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// applyDefaults checks the backend and fills in the defaults. The jsonl
+// backend stores bodies whole and keeps everything, so it cannot be combined
+// with body dedup or retention.
+func (s *StorageConfig) applyDefaults() error {
+	if s.Backend == "" {
+		s.Backend = "sqlite"
+	}
+	if !slices.Contains(StorageBackends, s.Backend) {
+		return fmt.Errorf("storage.backend must be one of %s, got '%s'", strings.Join(StorageBackends, ", "), s.Backend)
+	}
+	if s.Backend != "jsonl" {
+		return nil
+	}
+	if s.RequestsDir == "" {
+		s.RequestsDir = "requests"
+	}
+	if s.Bodies.Dedup {
+		return fmt.Errorf("storage.bodies.dedup requires the sqlite backend")
+	}
+	if s.Retention.Enabled {
+		return fmt.Errorf("storage.retention requires the sqlite backend")
+	}
+	return nil
+}
+
+// applyDefaults checks detector names and custom patterns, and fills in
+// the default detectors and entropy threshold
+func (r *RedactionConfig) applyDefaults() error {
+	if len(r.Detectors) == 0 {
+		r.Detectors = RedactionDetectors
+	}
+	for _, name := range r.Detectors {
+		if !slices.Contains(RedactionDetectors, name) {
+			return fmt.Errorf("storage.redaction has unknown detector '%s' (must be one of %s)", name, strings.Join(RedactionDetectors, ", "))
+		}
+	}
+	if r.MinEntropy < 0 {
+		return fmt.Errorf("storage.redaction.min_entropy must not be negative")
+	}
+	if r.MinEntropy == 0 {
+		r.MinEntropy = 4.5
+	}
+	for i, pattern := range r.Patterns {
+		if pattern.Name == "" {
+			return fmt.Errorf("storage.redaction.patterns[%d] is missing required 'name' field", i)
+		}
+		if pattern.Regex == "" {
+			return fmt.Errorf("redaction pattern '%s' is missing required 'regex' field", pattern.Name)
+		}
+		if _, err := regexp.Compile(pattern.Regex); err != nil {
+			return fmt.Errorf("redaction pattern '%s' has invalid regex: %w", pattern.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyDefaults checks the compression codec and fills in the default
+func (b *BodyStoreConfig) applyDefaults() error {
+	if b.Compression == "" {
+		b.Compression = "gzip"
+	}
+	if !slices.Contains(BodyStoreCodecs, b.Compression) {
+		return fmt.Errorf("storage.bodies.compression must be one of %s, got '%s'", strings.Join(BodyStoreCodecs, ", "), b.Compression)
+	}
+	return nil
+}
+
+// RetentionConfig ages out stored requests. Past body_days, a request keeps
+// only its summary columns (model, provider, tokens, timings, ...); past
+// row_days, or while the database is larger than max_db_size_mb, the oldest
+// requests are deleted. With archive_dir set, requests are written there as
+// gzipped JSONL before anything is removed.
+type RetentionConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	BodyDays    int    `yaml:"body_days,omitempty" json:"body_days,omitempty"`           // Optional: Days to keep full bodies and responses (default: 0, forever)
+	RowDays     int    `yaml:"row_days,omitempty" json:"row_days,omitempty"`             // Optional: Days to keep requests at all (default: 0, forever)
+	MaxDBSizeMB int    `yaml:"max_db_size_mb,omitempty" json:"max_db_size_mb,omitempty"` // Optional: Delete the oldest requests while the data is larger (default: 0, no cap)
+	ArchiveDir  string `yaml:"archive_dir,omitempty" json:"archive_dir,omitempty"`       // Optional: Directory for requests-YYYY-MM-DD.jsonl.gz archives (default: none, data is dropped)
+	Interval    string `yaml:"interval,omitempty" json:"interval,omitempty"`             // Optional: Time between runs (default: 1h)
+
+	// Parsed duration (not in YAML or JSON)
+	IntervalDuration time.Duration `yaml:"-" json:"-"`
+}
+
+// applyDefaults checks the retention limits and parses the interval
+func (r *RetentionConfig) applyDefaults() error {
+	var err error
+	if r.IntervalDuration, err = parseDurationDefault(r.Interval, time.Hour); err != nil {
+		return fmt.Errorf("invalid storage.retention.interval '%s': %w", r.Interval, err)
+	}
+	if r.IntervalDuration < time.Minute {
+		return fmt.Errorf("storage.retention.interval must be at least 1m")
+	}
+	if r.BodyDays < 0 || r.RowDays < 0 || r.MaxDBSizeMB < 0 {
+		return fmt.Errorf("storage.retention body_days, row_days, and max_db_size_mb must not be negative")
+	}
+	if r.BodyDays > 0 && r.RowDays > 0 && r.BodyDays >= r.RowDays {
+		return fmt.Errorf("storage.retention.body_days must be less than row_days")
+	}
+	if r.Enabled && r.BodyDays == 0 && r.RowDays == 0 && r.MaxDBSizeMB == 0 {
+		return fmt.Errorf("storage.retention needs at least one of body_days, row_days, or max_db_size_mb")
+	}
+	return nil
+}
+
+// maskKey shortens a client key so it can appear in error messages
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+// applyDefaults parses hedging durations and fills in defaults
+func (h *HedgingConfig) applyDefaults() error {
+	var err error
+	if h.InitialDelayDuration, err = parseDurationDefault(h.InitialDelay, 2*time.Second); err != nil {
+		return fmt.Errorf("invalid routing.hedging.initial_delay '%s': %w", h.InitialDelay, err)
+	}
+	if h.MinDelayDuration, err = parseDurationDefault(h.MinDelay, 250*time.Millisecond); err != nil {
+		return fmt.Errorf("invalid routing.hedging.min_delay '%s': %w", h.MinDelay, err)
+	}
+	if h.MaxDelayDuration, err = parseDurationDefault(h.MaxDelay, 10*time.Second); err != nil {
+		return fmt.Errorf("invalid routing.hedging.max_delay '%s': %w", h.MaxDelay, err)
+	}
+	if h.MaxDelayDuration < h.MinDelayDuration {
+		return fmt.Errorf("routing.hedging.max_delay must not be less than min_delay")
+	}
+	if len(h.Models) == 0 {
+		h.Models = []string{"haiku"}
+	}
+	if h.MaxRequestBytes == 0 {
+		h.MaxRequestBytes = 64 * 1024
+	}
+	if h.Percentile == 0 {
+		h.Percentile = 95
+	}
+	if h.Percentile < 0 || h.Percentile > 100 {
+		return fmt.Errorf("routing.hedging.percentile must be between 0 and 100")
+	}
+	if h.WindowSize == 0 {
+		h.WindowSize = 200
+	}
+	if h.MinSamples == 0 {
+		h.MinSamples = 20
+	}
+	return nil
+}
+
+// applyDefaults parses the adaptive weights interval and fills in defaults
+func (a *AdaptiveWeightsConfig) applyDefaults() error {
+	var err error
+	if a.IntervalDuration, err = parseDurationDefault(a.Interval, 10*time.Second); err != nil {
+		return fmt.Errorf("invalid routing.adaptive_weights.interval '%s': %w", a.Interval, err)
+	}
+	if a.IntervalDuration <= 0 {
+		return fmt.Errorf("routing.adaptive_weights.interval must be positive")
+	}
+	if a.Alpha == 0 {
+		a.Alpha = 0.2
+	}
+	if a.Decay == 0 {
+		a.Decay = 0.1
+	}
+	if a.Alpha < 0 || a.Alpha > 1 || a.Decay < 0 || a.Decay > 1 {
+		return fmt.Errorf("routing.adaptive_weights.alpha and decay must be between 0 and 1")
+	}
+	if a.MinSamples == 0 {
+		a.MinSamples = 5
+	}
+	if a.MinWeight == 0 {
+		a.MinWeight = 1
+	}
+	if a.MaxWeight == 0 {
+		a.MaxWeight = 100
+	}
+	if a.MinWeight < 0 || a.MaxWeight < a.MinWeight {
+		return fmt.Errorf("routing.adaptive_weights.min_weight must be between 0 and max_weight")
+	}
+	return nil
+}
+
+// IsConfigured reports whether any retry setting was given explicitly in config.yaml
+func (r *RetryConfig) IsConfigured() bool {
+	return r.tuned || r.InitialBackoff != "" || r.MaxBackoff != "" || r.MaxRetryAfter != "" || r.BudgetPercent > 0 || r.RateLimit.MaxRetries != nil || r.Overloaded.MaxRetries != nil ||
+		r.ServerError.MaxRetries != nil || r.ConnectError.MaxRetries != nil
+}
+
 func (c *Config) validateProviders() error {
 	for name, provider := range c.Providers {
 		if provider.Format == "" {
@@ -264,6 +1358,11 @@ func (c *Config) validateProviders() error {
 		if provider.BaseURL == "" {
 			return fmt.Errorf("provider '%s' is missing required 'base_url' field", name)
 		}
+		// Probes carry no client request, so a pass-through provider has no
+		// key to send and every probe would be rejected
+		if provider.HealthCheck.Enabled && provider.Format == "anthropic" && provider.APIKey == "" {
+			return fmt.Errorf("provider '%s': health_check needs an api_key to authenticate its probes", name)
+		}
 
 		// Validate fallback provider exists
 		if provider.FallbackProvider != "" {
@@ -309,6 +1408,14 @@ func (c *Config) loadFromFile(path string) error {
 	return yaml.Unmarshal(data, c)
 }
 
+// parseDurationDefault parses a duration string, returning defaultValue if empty
+func parseDurationDefault(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -2,7 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestProviderConfigJSONContract ensures Go structs serialize to snake_case JSON
@@ -171,6 +175,134 @@ func TestRoutingConfigJSONContract(t *testing.T) {
 	t.Logf("✓ RoutingConfig serializes correctly: %s", string(data))
 }
 
+// TestRetryConfigDefaults ensures unset retry fields get sensible defaults
+func TestRetryConfigDefaults(t *testing.T) {
+	zero := 0
+	cfg := &RetryConfig{
+		Overloaded: RetryRuleConfig{MaxRetries: &zero, InitialBackoff: "5s"},
+	}
+
+	if err := cfg.applyDefaults("test"); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+
+	if cfg.InitialBackoffDuration != time.Second || cfg.MaxBackoffDuration != 30*time.Second {
+		t.Errorf("Unexpected backoff defaults: %v / %v", cfg.InitialBackoffDuration, cfg.MaxBackoffDuration)
+	}
+	if cfg.Jitter != "full" {
+		t.Errorf("Expected jitter default 'full', got %q", cfg.Jitter)
+	}
+	if cfg.RespectRetryAfter == nil || !*cfg.RespectRetryAfter {
+		t.Error("Expected respect_retry_after to default to true")
+	}
+	if cfg.Overloaded.InitialBackoffDuration != 5*time.Second {
+		t.Errorf("Expected overloaded initial_backoff 5s, got %v", cfg.Overloaded.InitialBackoffDuration)
+	}
+	if cfg.IsConfigured() != true {
+		t.Error("Expected per-class max_retries to count as an explicit retry policy")
+	}
+
+	// Defaults alone are not a policy, but any explicitly set key is
+	for name, retry := range map[string]*RetryConfig{
+		"multiplier":          {Multiplier: 3},
+		"jitter":              {Jitter: "none"},
+		"respect_retry_after": {RespectRetryAfter: new(bool)},
+	} {
+		if err := retry.applyDefaults("test"); err != nil {
+			t.Fatalf("applyDefaults failed: %v", err)
+		}
+		if !retry.IsConfigured() {
+			t.Errorf("Expected %s to count as an explicit retry policy", name)
+		}
+	}
+	unset := &RetryConfig{}
+	if err := unset.applyDefaults("test"); err != nil || unset.IsConfigured() {
+		t.Errorf("Expected defaults alone not to count as configured, got %v", err)
+	}
+
+	bad := &RetryConfig{Jitter: "partial"}
+	if err := bad.applyDefaults("test"); err == nil {
+		t.Error("Expected invalid jitter mode to be rejected")
+	}
+}
+
+// TestHealthCheckNeedsAPIKey ensures anthropic providers can't probe without credentials
+func TestHealthCheckNeedsAPIKey(t *testing.T) {
+	cfg := &Config{Providers: map[string]*ProviderConfig{
+		"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com", HealthCheck: HealthCheckConfig{Enabled: true}},
+		"local":     {Format: "openai", BaseURL: "http://localhost:11434", HealthCheck: HealthCheckConfig{Enabled: true}},
+	}}
+	if err := cfg.validateProviders(); err == nil || !strings.Contains(err.Error(), "api_key") {
+		t.Errorf("Expected a pass-through anthropic provider with probes to be rejected, got %v", err)
+	}
+
+	cfg.Providers["anthropic"].APIKey = "key"
+	if err := cfg.validateProviders(); err != nil {
+		t.Errorf("Expected keyed providers and keyless openai providers to be accepted, got %v", err)
+	}
+}
+
+// TestCircuitBreakerConfigDefaults ensures error-rate settings get defaults and are validated
+func TestCircuitBreakerConfigDefaults(t *testing.T) {
+	cfg := &CircuitBreakerConfig{Enabled: true, Mode: "error_rate"}
+	if err := cfg.applyDefaults("test"); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if cfg.TimeoutDuration != 30*time.Second || cfg.WindowDuration != time.Minute {
+		t.Errorf("Unexpected duration defaults: %v / %v", cfg.TimeoutDuration, cfg.WindowDuration)
+	}
+	if cfg.ErrorRateThreshold != 0.5 || cfg.MinRequests != 20 || cfg.HalfOpenMaxProbes != 1 {
+		t.Errorf("Unexpected error-rate defaults: %+v", cfg)
+	}
+
+	bad := &CircuitBreakerConfig{Mode: "sliding"}
+	if err := bad.applyDefaults("test"); err == nil {
+		t.Error("Expected invalid mode to be rejected")
+	}
+	bad = &CircuitBreakerConfig{ErrorRateThreshold: 1.5}
+	if err := bad.applyDefaults("test"); err == nil {
+		t.Error("Expected error_rate_threshold above 1 to be rejected")
+	}
+}
+
+// TestHealthCheckConfigDefaults ensures probe settings get defaults and completion probes need a model
+func TestHealthCheckConfigDefaults(t *testing.T) {
+	cfg := &HealthCheckConfig{Enabled: true}
+	if err := cfg.applyDefaults("test"); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if cfg.IntervalDuration != 30*time.Second || cfg.TimeoutDuration != 10*time.Second {
+		t.Errorf("Unexpected duration defaults: %v / %v", cfg.IntervalDuration, cfg.TimeoutDuration)
+	}
+	if cfg.Method != "models" || cfg.FailureThreshold != 2 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+
+	bad := &HealthCheckConfig{Enabled: true, Method: "completion"}
+	if err := bad.applyDefaults("test"); err == nil {
+		t.Error("Expected completion probe without a model to be rejected")
+	}
+}
+
+// TestAdaptiveWeightsConfigDefaults ensures weight bounds and EWMA settings get defaults
+func TestAdaptiveWeightsConfigDefaults(t *testing.T) {
+	cfg := &AdaptiveWeightsConfig{Enabled: true}
+	if err := cfg.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if cfg.IntervalDuration != 10*time.Second || cfg.Alpha != 0.2 || cfg.Decay != 0.1 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	if cfg.MinWeight != 1 || cfg.MaxWeight != 100 {
+		t.Errorf("Unexpected weight bounds: %d-%d", cfg.MinWeight, cfg.MaxWeight)
+	}
+
+	bad := &AdaptiveWeightsConfig{MinWeight: 50, MaxWeight: 10}
+	if err := bad.applyDefaults(); err == nil {
+		t.Error("Expected max_weight below min_weight to be rejected")
+	}
+}
+
 func keysOf(m map[string]interface{}) []string {
 	keys := make([]string, 0, len(m))
 	for k := range m {
@@ -178,3 +310,410 @@ func keysOf(m map[string]interface{}) []string {
 	}
 	return keys
 }
+
+// TestRoutingRulesValidation ensures rules need an ID and exactly one action
+func TestRoutingRulesValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{"openai": {Format: "openai", BaseURL: "https://api.openai.com"}}
+
+	cfg := &Config{Providers: providers, Routing: RoutingConfig{Rules: []RoutingRuleConfig{
+		{ID: "night", Target: "openai:gpt-4o-mini", Match: RuleMatchConfig{TimeOfDay: "22:30-06:00"}},
+		{ID: "block", Action: "reject"},
+	}}}
+	if err := cfg.validateRoutingRules(); err != nil {
+		t.Fatalf("validateRoutingRules failed: %v", err)
+	}
+	if cfg.Routing.Rules[0].Action != "route" {
+		t.Errorf("Expected action to default to route, got %q", cfg.Routing.Rules[0].Action)
+	}
+	if m := cfg.Routing.Rules[0].Match; m.StartMinute != 22*60+30 || m.EndMinute != 6*60 {
+		t.Errorf("Unexpected time window: %d-%d", m.StartMinute, m.EndMinute)
+	}
+
+	invalid := []RoutingRuleConfig{
+		{Target: "openai:gpt-4o"},
+		{ID: "both", Target: "openai:gpt-4o", Preference: "cost"},
+		{ID: "neither"},
+		{ID: "unknown-provider", Target: "nope:model"},
+		{ID: "bad-target", Target: "openai"},
+		{ID: "bad-preference", Preference: "cheapest"},
+		{ID: "reject-with-target", Action: "reject", Target: "openai:gpt-4o"},
+		{ID: "bad-window", Target: "openai:gpt-4o", Match: RuleMatchConfig{TimeOfDay: "9-5"}},
+	}
+	for _, rule := range invalid {
+		cfg := &Config{Providers: providers, Routing: RoutingConfig{Rules: []RoutingRuleConfig{rule}}}
+		if err := cfg.validateRoutingRules(); err == nil {
+			t.Errorf("Expected rule %+v to be rejected", rule)
+		}
+	}
+
+	dup := &Config{Providers: providers, Routing: RoutingConfig{Rules: []RoutingRuleConfig{
+		{ID: "a", Action: "reject"}, {ID: "a", Action: "reject"},
+	}}}
+	if err := dup.validateRoutingRules(); err == nil {
+		t.Error("Expected duplicate rule IDs to be rejected")
+	}
+}
+
+// TestModelAliasesValidation ensures alias targets are parsed and checked
+func TestModelAliasesValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{"zai": {Format: "anthropic", BaseURL: "https://api.z.ai/api/anthropic"}}
+
+	cfg := &Config{Providers: providers, ModelAliases: []ModelAliasConfig{
+		{Match: "claude-3-5-haiku-*", Target: "zai:glm-4.5-air"},
+		{Match: "claude-opus-*", Target: "claude-sonnet-4", TimeOfDay: "18:00-09:00"},
+	}}
+	if err := cfg.validateModelAliases(); err != nil {
+		t.Fatalf("validateModelAliases failed: %v", err)
+	}
+	if a := cfg.ModelAliases[0]; a.Provider != "zai" || a.Model != "glm-4.5-air" {
+		t.Errorf("Unexpected parsed target: %q:%q", a.Provider, a.Model)
+	}
+	if a := cfg.ModelAliases[1]; a.Provider != "" || a.Model != "claude-sonnet-4" || a.StartMinute != 18*60 || a.EndMinute != 9*60 {
+		t.Errorf("Unexpected parsed alias: %+v", a)
+	}
+
+	invalid := []ModelAliasConfig{
+		{Target: "zai:glm-4.5-air"},
+		{Match: "claude-*"},
+		{Match: "claude-*", Target: "nope:model"},
+		{Match: "claude-*", Target: "zai:"},
+		{Match: "claude-*", Target: "claude-sonnet-4", TimeOfDay: "evenings"},
+	}
+	for _, alias := range invalid {
+		cfg := &Config{Providers: providers, ModelAliases: []ModelAliasConfig{alias}}
+		if err := cfg.validateModelAliases(); err == nil {
+			t.Errorf("Expected alias %+v to be rejected", alias)
+		}
+	}
+}
+
+// TestContextWindowsValidation ensures context window sizes and overflow targets are checked
+func TestContextWindowsValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{"openai": {Format: "openai", BaseURL: "https://api.openai.com"}}
+
+	valid := &Config{Providers: providers, Routing: RoutingConfig{ContextWindows: []ContextWindowConfig{
+		{Match: "gpt-4o*", MaxTokens: 128000, Overflow: []string{"openai:gpt-4.1"}},
+		{Match: "openai:gpt-4.1", MaxTokens: 1000000},
+	}}}
+	if err := valid.validateContextWindows(); err != nil {
+		t.Fatalf("validateContextWindows failed: %v", err)
+	}
+
+	invalid := []ContextWindowConfig{
+		{MaxTokens: 128000},
+		{Match: "gpt-4o*"},
+		{Match: "gpt-4o*", MaxTokens: -1},
+		{Match: "gpt-4o*", MaxTokens: 128000, Overflow: []string{"gpt-4.1"}},
+		{Match: "gpt-4o*", MaxTokens: 128000, Overflow: []string{"groq:llama"}},
+	}
+	for _, window := range invalid {
+		cfg := &Config{Providers: providers, Routing: RoutingConfig{ContextWindows: []ContextWindowConfig{window}}}
+		if err := cfg.validateContextWindows(); err == nil {
+			t.Errorf("Expected context window %+v to be rejected", window)
+		}
+	}
+}
+
+// TestExperimentsValidation ensures experiment arms, weights, and targets are checked
+func TestExperimentsValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{"openai": {Format: "openai", BaseURL: "https://api.openai.com"}}
+	arms := func(arms ...ExperimentArmConfig) []ExperimentArmConfig { return arms }
+	control := ExperimentArmConfig{ID: "control", Weight: 80}
+
+	valid := &Config{Providers: providers, Routing: RoutingConfig{Experiments: []ExperimentConfig{{
+		ID:    "reviewer",
+		Match: RuleMatchConfig{Subagents: []string{"code-reviewer"}, TimeOfDay: "09:00-17:00"},
+		Arms:  arms(ExperimentArmConfig{ID: "gpt-4o", Target: "openai:gpt-4o", Weight: 20}, control),
+	}}}}
+	if err := valid.validateExperiments(); err != nil {
+		t.Fatalf("validateExperiments failed: %v", err)
+	}
+	if match := valid.Routing.Experiments[0].Match; match.StartMinute != 9*60 || match.EndMinute != 17*60 {
+		t.Errorf("Expected the time window to be parsed, got %+v", match)
+	}
+
+	invalid := []ExperimentConfig{
+		{Arms: arms(ExperimentArmConfig{ID: "a", Weight: 1}, control)},
+		{ID: "one-arm", Arms: arms(control)},
+		{ID: "no-arm-id", Arms: arms(ExperimentArmConfig{Weight: 1}, control)},
+		{ID: "duplicate-arm", Arms: arms(control, control)},
+		{ID: "zero-weight", Arms: arms(ExperimentArmConfig{ID: "a"}, control)},
+		{ID: "negative-price", Arms: arms(ExperimentArmConfig{ID: "a", Weight: 1, InputCostPerMTok: -1}, control)},
+		{ID: "bad-target", Arms: arms(ExperimentArmConfig{ID: "a", Weight: 1, Target: "gpt-4o"}, control)},
+		{ID: "unknown-provider", Arms: arms(ExperimentArmConfig{ID: "a", Weight: 1, Target: "groq:llama"}, control)},
+		{ID: "bad-window", Match: RuleMatchConfig{TimeOfDay: "always"}, Arms: arms(ExperimentArmConfig{ID: "a", Weight: 1}, control)},
+	}
+	for _, experiment := range invalid {
+		cfg := &Config{Providers: providers, Routing: RoutingConfig{Experiments: []ExperimentConfig{experiment}}}
+		if err := cfg.validateExperiments(); err == nil {
+			t.Errorf("Expected experiment '%s' to be rejected", experiment.ID)
+		}
+	}
+
+	duplicate := valid.Routing.Experiments[0]
+	valid.Routing.Experiments = append(valid.Routing.Experiments, duplicate)
+	if err := valid.validateExperiments(); err == nil {
+		t.Error("Expected a duplicate experiment ID to be rejected")
+	}
+}
+
+// TestLoadFile ensures a missing config falls back to defaults while an
+// unparseable one is an error (so a hot reload can keep the old config)
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := LoadFile(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatalf("Expected defaults for a missing file, got error: %v", err)
+	}
+	if _, ok := cfg.Providers["anthropic"]; !ok {
+		t.Errorf("Expected the default anthropic provider")
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("routing:\n  preferences:\n    default: cost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.Routing.Preferences.Default != "cost" {
+		t.Errorf("Expected preference from file, got %q", cfg.Routing.Preferences.Default)
+	}
+
+	if err := os.WriteFile(path, []byte("routing: [unterminated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected invalid YAML to be an error")
+	}
+}
+
+func TestProjectsValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{
+		"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+		"zai":       {Format: "anthropic", BaseURL: "https://api.z.ai/api/anthropic"},
+	}
+
+	valid := &Config{Providers: providers, Routing: RoutingConfig{Projects: []ProjectConfig{
+		{Path: "/work/client", Providers: []string{"anthropic"}},
+		{Path: "/work/sandbox*", Target: "zai:glm-4.5-air"},
+		{Path: "/work/oss", Preference: "cost", Providers: []string{"anthropic", "zai"}},
+	}}}
+	if err := valid.validateProjects(); err != nil {
+		t.Fatalf("validateProjects failed: %v", err)
+	}
+
+	invalid := []ProjectConfig{
+		{Providers: []string{"anthropic"}},
+		{Path: "/work/nothing"},
+		{Path: "/work/unknown", Providers: []string{"openai"}},
+		{Path: "/work/both", Target: "zai:glm-4.6", Preference: "cost"},
+		{Path: "/work/bad-target", Target: "glm-4.6"},
+		{Path: "/work/unknown-target", Target: "openai:gpt-4o"},
+		{Path: "/work/outside", Target: "zai:glm-4.6", Providers: []string{"anthropic"}},
+		{Path: "/work/bad-preference", Preference: "cheapest"},
+	}
+	for _, project := range invalid {
+		cfg := &Config{Providers: providers, Routing: RoutingConfig{Projects: []ProjectConfig{project}}}
+		if err := cfg.validateProjects(); err == nil {
+			t.Errorf("Expected project %+v to be rejected", project)
+		}
+	}
+}
+
+func TestPluginsValidation(t *testing.T) {
+	valid := &Config{Plugins: []PluginConfig{
+		{Name: "team-prompt", Type: "system_prompt", Text: "Follow the team style guide."},
+		{Name: "no-web", Type: "remove_tools", Tools: []string{"WebFetch", "WebSearch"}, Routes: []string{"zai:*"}},
+		{Name: "cap-subagents", Type: "max_tokens", MaxTokens: 8192, Match: RuleMatchConfig{Subagents: []string{"*"}}},
+		{Name: "team-id", Type: "metadata", UserID: "team-platform"},
+	}}
+	if err := valid.validatePlugins(); err != nil {
+		t.Fatalf("validatePlugins failed: %v", err)
+	}
+
+	invalid := []PluginConfig{
+		{Type: "system_prompt", Text: "hi"},
+		{Name: "untyped", Text: "hi"},
+		{Name: "unknown", Type: "rewrite"},
+		{Name: "empty-prompt", Type: "system_prompt"},
+		{Name: "no-tools", Type: "remove_tools"},
+		{Name: "zero-cap", Type: "max_tokens"},
+		{Name: "no-user", Type: "metadata"},
+		{Name: "bad-window", Type: "max_tokens", MaxTokens: 100, Match: RuleMatchConfig{TimeOfDay: "25:00-26:00"}},
+	}
+	for _, plugin := range invalid {
+		cfg := &Config{Plugins: []PluginConfig{plugin}}
+		if err := cfg.validatePlugins(); err == nil {
+			t.Errorf("Expected plugin %+v to be rejected", plugin)
+		}
+	}
+
+	duplicate := &Config{Plugins: []PluginConfig{
+		{Name: "cap", Type: "max_tokens", MaxTokens: 100},
+		{Name: "cap", Type: "max_tokens", MaxTokens: 200},
+	}}
+	if err := duplicate.validatePlugins(); err == nil {
+		t.Error("Expected duplicate plugin names to be rejected")
+	}
+}
+
+func TestToolPoliciesValidation(t *testing.T) {
+	valid := &Config{ToolPolicies: []ToolPolicyConfig{
+		{Name: "no-rm-root", Tools: []string{"Bash"}, Field: "command", Pattern: `rm\s+-rf\s+/`, Action: "block"},
+		{Name: "force-push", Tools: []string{"Bash"}, Field: "command", Pattern: `git push .*--force`, Action: "confirm"},
+		{Name: "outside-project", Tools: []string{"Edit", "Write"}, Field: "file_path", OutsideProject: true, Action: "annotate"},
+		{Name: "subagents-no-web", Tools: []string{"Web*"}, Action: "block", Match: RuleMatchConfig{Subagents: []string{"*"}}},
+	}}
+	if err := valid.validateToolPolicies(); err != nil {
+		t.Fatalf("validateToolPolicies failed: %v", err)
+	}
+
+	invalid := []ToolPolicyConfig{
+		{Tools: []string{"Bash"}, Action: "block"},
+		{Name: "no-tools", Action: "block"},
+		{Name: "no-action", Tools: []string{"Bash"}},
+		{Name: "bad-action", Tools: []string{"Bash"}, Action: "deny"},
+		{Name: "bad-pattern", Tools: []string{"Bash"}, Action: "block", Pattern: "("},
+		{Name: "no-field", Tools: []string{"Write"}, Action: "block", OutsideProject: true},
+		{Name: "bad-window", Tools: []string{"Bash"}, Action: "block", Match: RuleMatchConfig{TimeOfDay: "25:00-26:00"}},
+	}
+	for _, policy := range invalid {
+		cfg := &Config{ToolPolicies: []ToolPolicyConfig{policy}}
+		if err := cfg.validateToolPolicies(); err == nil {
+			t.Errorf("Expected tool policy %+v to be rejected", policy)
+		}
+	}
+
+	duplicate := &Config{ToolPolicies: []ToolPolicyConfig{
+		{Name: "p", Tools: []string{"Bash"}, Action: "block"},
+		{Name: "p", Tools: []string{"Edit"}, Action: "annotate"},
+	}}
+	if err := duplicate.validateToolPolicies(); err == nil {
+		t.Error("Expected duplicate tool policy names to be rejected")
+	}
+}
+
+func TestPromptCachingValidation(t *testing.T) {
+	providers := map[string]*ProviderConfig{
+		"anthropic": {Format: "anthropic"},
+		"openai":    {Format: "openai"},
+	}
+
+	valid := &Config{Providers: providers, PromptCaching: PromptCachingConfig{Enabled: true, Providers: []string{"anthropic"}}}
+	if err := valid.validatePromptCaching(); err != nil {
+		t.Fatalf("validatePromptCaching failed: %v", err)
+	}
+	if valid.PromptCaching.MaxSessions != 10000 {
+		t.Errorf("Expected max_sessions to default to 10000, got %d", valid.PromptCaching.MaxSessions)
+	}
+
+	invalid := []PromptCachingConfig{
+		{Enabled: true, Providers: []string{"missing"}},
+		{Enabled: true, Providers: []string{"openai"}},
+		{Enabled: true, MaxSessions: -1},
+	}
+	for _, caching := range invalid {
+		cfg := &Config{Providers: providers, PromptCaching: caching}
+		if err := cfg.validatePromptCaching(); err == nil {
+			t.Errorf("Expected prompt_caching %+v to be rejected", caching)
+		}
+	}
+}
+
+func TestRedactionDefaults(t *testing.T) {
+	defaults := RedactionConfig{Enabled: true}
+	if err := defaults.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if len(defaults.Detectors) != len(RedactionDetectors) || defaults.MinEntropy != 4.5 {
+		t.Errorf("Expected every detector and min_entropy 4.5, got %+v", defaults)
+	}
+
+	invalid := []RedactionConfig{
+		{Detectors: []string{"credit_card"}},
+		{MinEntropy: -1},
+		{Patterns: []RedactionPatternConfig{{Regex: "x"}}},
+		{Patterns: []RedactionPatternConfig{{Name: "empty"}}},
+		{Patterns: []RedactionPatternConfig{{Name: "broken", Regex: "("}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.applyDefaults(); err == nil {
+			t.Errorf("Expected redaction config %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestBodyStoreDefaults(t *testing.T) {
+	defaults := BodyStoreConfig{Dedup: true}
+	if err := defaults.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if defaults.Compression != "gzip" {
+		t.Errorf("Expected gzip compression by default, got %q", defaults.Compression)
+	}
+
+	invalid := BodyStoreConfig{Dedup: true, Compression: "lz4"}
+	if err := invalid.applyDefaults(); err == nil {
+		t.Error("Expected an unknown codec to be rejected")
+	}
+}
+
+func TestRetentionDefaults(t *testing.T) {
+	defaults := RetentionConfig{Enabled: true, BodyDays: 7, RowDays: 90}
+	if err := defaults.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if defaults.IntervalDuration != time.Hour {
+		t.Errorf("Expected a 1h interval by default, got %v", defaults.IntervalDuration)
+	}
+
+	disabled := RetentionConfig{}
+	if err := disabled.applyDefaults(); err != nil {
+		t.Errorf("Expected an empty, disabled config to be accepted: %v", err)
+	}
+
+	invalid := []RetentionConfig{
+		{Enabled: true},
+		{Enabled: true, BodyDays: 30, RowDays: 30},
+		{Enabled: true, RowDays: -1},
+		{Enabled: true, MaxDBSizeMB: 500, Interval: "10s"},
+		{Enabled: true, MaxDBSizeMB: 500, Interval: "hourly"},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.applyDefaults(); err == nil {
+			t.Errorf("Expected retention config %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestStorageBackendDefaults(t *testing.T) {
+	defaults := StorageConfig{}
+	if err := defaults.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if defaults.Backend != "sqlite" || defaults.RequestsDir != "" {
+		t.Errorf("Expected the sqlite backend by default, got %+v", defaults)
+	}
+
+	jsonl := StorageConfig{Backend: "jsonl"}
+	if err := jsonl.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults failed: %v", err)
+	}
+	if jsonl.RequestsDir != "requests" {
+		t.Errorf("Expected requests_dir to default to requests, got %q", jsonl.RequestsDir)
+	}
+
+	invalid := []StorageConfig{
+		{Backend: "postgres"},
+		{Backend: "jsonl", Bodies: BodyStoreConfig{Dedup: true}},
+		{Backend: "jsonl", Retention: RetentionConfig{Enabled: true, RowDays: 30}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.applyDefaults(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
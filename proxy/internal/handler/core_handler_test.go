@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+func newTestCoreHandler(t *testing.T) *CoreHandler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `providers:
+  anthropic:
+    format: anthropic
+    base_url: "https://api.anthropic.com"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	storage, err := service.NewJSONLStorageService(&config.StorageConfig{Backend: "jsonl", RequestsDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	logger := log.New(io.Discard, "", 0)
+	rt, err := service.NewRuntime(cfg, storage, logger)
+	if err != nil {
+		t.Fatalf("Failed to build runtime: %v", err)
+	}
+	return NewCoreHandler(storage, logger, service.NewConfigReloader(path, rt, storage, logger))
+}
+
+func TestCoreHandlerExplainRoute(t *testing.T) {
+	h := newTestCoreHandler(t)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantProvider string
+	}{
+		{"anthropic request", `{"model": "claude-3-haiku-20240307", "max_tokens": 10, "messages": [{"role": "user", "content": "hi"}]}`, http.StatusOK, "anthropic"},
+		{"missing model", `{"messages": []}`, http.StatusBadRequest, ""},
+		{"unknown request id", `{"request_id": "missing"}`, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ExplainRouteV2(w, httptest.NewRequest(http.MethodPost, "/api/v2/routing/explain", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantProvider == "" {
+				return
+			}
+
+			var trace service.RouteTrace
+			if err := json.Unmarshal(w.Body.Bytes(), &trace); err != nil {
+				t.Fatalf("Failed to decode trace: %v", err)
+			}
+			if trace.Decision == nil || trace.Decision.Provider != tt.wantProvider {
+				t.Errorf("decision = %+v, want provider %q", trace.Decision, tt.wantProvider)
+			}
+		})
+	}
+}
@@ -162,6 +162,7 @@ func (h *DataHandler) GetRequestsSummary(w http.ResponseWriter, r *http.Request)
 
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	offset := 0
 	limit := 0
@@ -178,7 +179,7 @@ func (h *DataHandler) GetRequestsSummary(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, offset, limit)
+	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project, offset, limit)
 	if err != nil {
 		log.Printf("Error getting request summaries: %v", err)
 		http.Error(w, "Failed to get requests", http.StatusInternalServerError)
@@ -273,6 +274,7 @@ func (h *DataHandler) DeleteRequests(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		now := time.Now().UTC()
@@ -280,10 +282,10 @@ func (h *DataHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		startTime = now.AddDate(0, 0, -7).Format(time.RFC3339)
 	}
 
-	stats, err := h.storageService.GetStats(startTime, endTime)
+	stats, err := h.storageService.GetStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting stats: %v", err)
-		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get stats")
 		return
 	}
 
@@ -295,16 +297,17 @@ func (h *DataHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetHourlyStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetHourlyStats(startTime, endTime)
+	stats, err := h.storageService.GetHourlyStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting hourly stats: %v", err)
-		http.Error(w, "Failed to get hourly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get hourly stats")
 		return
 	}
 
@@ -316,16 +319,17 @@ func (h *DataHandler) GetHourlyStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetModelStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetModelStats(startTime, endTime)
+	stats, err := h.storageService.GetModelStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting model stats: %v", err)
-		http.Error(w, "Failed to get model stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get model stats")
 		return
 	}
 
@@ -337,16 +341,53 @@ func (h *DataHandler) GetModelStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetProviderStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetProviderStats(startTime, endTime)
+	stats, err := h.storageService.GetProviderStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting provider stats: %v", err)
-		http.Error(w, "Failed to get provider stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get provider stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetPromptCachingStats compares cache reads between requests the prompt-caching
+// optimizer added breakpoints to and the rest.
+func (h *DataHandler) GetPromptCachingStats(w http.ResponseWriter, r *http.Request) {
+	startTime := r.URL.Query().Get("start")
+	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
+
+	if startTime == "" || endTime == "" {
+		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.storageService.GetPromptCachingStats(startTime, endTime, project)
+	if err != nil {
+		log.Printf("Error getting prompt caching stats: %v", err)
+		writeStorageError(w, err, "Failed to get prompt caching stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetStorageStats reports how much space deduplicating request bodies saves.
+func (h *DataHandler) GetStorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.storageService.GetBodyStorageStats()
+	if err != nil {
+		log.Printf("Error getting storage stats: %v", err)
+		writeStorageError(w, err, "Failed to get storage stats")
 		return
 	}
 
@@ -358,16 +399,17 @@ func (h *DataHandler) GetProviderStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetSubagentStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetSubagentStats(startTime, endTime)
+	stats, err := h.storageService.GetSubagentStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting subagent stats: %v", err)
-		http.Error(w, "Failed to get subagent stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get subagent stats")
 		return
 	}
 
@@ -379,16 +421,17 @@ func (h *DataHandler) GetSubagentStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetToolStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetToolStats(startTime, endTime)
+	stats, err := h.storageService.GetToolStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting tool stats: %v", err)
-		http.Error(w, "Failed to get tool stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get tool stats")
 		return
 	}
 
@@ -400,16 +443,17 @@ func (h *DataHandler) GetToolStats(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetPerformanceStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetPerformanceStats(startTime, endTime)
+	stats, err := h.storageService.GetPerformanceStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting performance stats: %v", err)
-		http.Error(w, "Failed to get performance stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get performance stats")
 		return
 	}
 
@@ -571,7 +615,7 @@ func (h *DataHandler) SearchConversations(w http.ResponseWriter, r *http.Request
 	results, err := h.storageService.SearchConversations(opts)
 	if err != nil {
 		log.Printf("❌ Error searching conversations (query=%q, project=%q): %v", query, projectPath, err)
-		writeErrorResponse(w, "Failed to search conversations", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to search conversations")
 		return
 	}
 
@@ -592,6 +636,7 @@ func (h *DataHandler) GetRequestsSummaryV2(w http.ResponseWriter, r *http.Reques
 
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	offset := 0
 	limit := 100
@@ -608,7 +653,7 @@ func (h *DataHandler) GetRequestsSummaryV2(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, offset, limit)
+	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project, offset, limit)
 	if err != nil {
 		log.Printf("Error getting request summaries: %v", err)
 		writeErrorResponse(w, "Failed to get requests", http.StatusInternalServerError)
@@ -660,7 +705,7 @@ func (h *DataHandler) GetConversationsV2(w http.ResponseWriter, r *http.Request)
 	conversations, err := h.storageService.GetIndexedConversations(100)
 	if err != nil {
 		log.Printf("❌ Error getting indexed conversations: %v", err)
-		writeErrorResponse(w, "Failed to get conversations", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get conversations")
 		return
 	}
 
@@ -785,7 +830,7 @@ func (h *DataHandler) GetConversationMessagesV2(w http.ResponseWriter, r *http.R
 func (h *DataHandler) ReindexConversationsV2(w http.ResponseWriter, r *http.Request) {
 	if err := h.storageService.ReindexConversations(); err != nil {
 		log.Printf("❌ Error triggering re-index: %v", err)
-		writeErrorResponse(w, "Failed to trigger re-index", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to trigger re-index")
 		return
 	}
 
@@ -795,20 +840,48 @@ func (h *DataHandler) ReindexConversationsV2(w http.ResponseWriter, r *http.Requ
 	})
 }
 
+// GetExperimentResultsV2 compares the arms of a traffic-split experiment.
+func (h *DataHandler) GetExperimentResultsV2(w http.ResponseWriter, r *http.Request) {
+	writeExperimentResults(w, r, h.storageService, service.NewExperiments(h.config.Routing.Experiments))
+}
+
+// GetToolPolicyHitsV2 lists tool calls matched by tool policies.
+func (h *DataHandler) GetToolPolicyHitsV2(w http.ResponseWriter, r *http.Request) {
+	writeToolPolicyHits(w, r, h.storageService)
+}
+
+// GetToolCallsV2 lists audited tool calls with their results.
+func (h *DataHandler) GetToolCallsV2(w http.ResponseWriter, r *http.Request) {
+	writeToolCalls(w, r, h.storageService)
+}
+
+// GetRetentionStatusV2 returns the retention settings, how much is stored,
+// and the last retention run.
+func (h *DataHandler) GetRetentionStatusV2(w http.ResponseWriter, r *http.Request) {
+	status, err := h.storageService.GetRetentionStatus()
+	if err != nil {
+		log.Printf("Error getting retention status: %v", err)
+		writeStorageError(w, err, "Failed to get retention status")
+		return
+	}
+	writeJSONResponse(w, status)
+}
+
 // GetHourlyStatsV2 returns hourly stats with consistent format.
 func (h *DataHandler) GetHourlyStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetHourlyStats(startTime, endTime)
+	stats, err := h.storageService.GetHourlyStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting hourly stats: %v", err)
-		writeErrorResponse(w, "Failed to get hourly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get hourly stats")
 		return
 	}
 
@@ -823,16 +896,17 @@ func (h *DataHandler) GetHourlyStatsV2(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetModelStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetModelStats(startTime, endTime)
+	stats, err := h.storageService.GetModelStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting model stats: %v", err)
-		writeErrorResponse(w, "Failed to get model stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get model stats")
 		return
 	}
 
@@ -874,16 +948,17 @@ func (h *DataHandler) GetProvidersV2(w http.ResponseWriter, r *http.Request) {
 func (h *DataHandler) GetSubagentStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetSubagentStats(startTime, endTime)
+	stats, err := h.storageService.GetSubagentStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting subagent stats: %v", err)
-		writeErrorResponse(w, "Failed to get subagent stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get subagent stats")
 		return
 	}
 
@@ -898,16 +973,17 @@ func (h *DataHandler) GetSubagentStatsV2(w http.ResponseWriter, r *http.Request)
 func (h *DataHandler) GetPerformanceStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetPerformanceStats(startTime, endTime)
+	stats, err := h.storageService.GetPerformanceStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting performance stats: %v", err)
-		writeErrorResponse(w, "Failed to get performance stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get performance stats")
 		return
 	}
 
@@ -922,6 +998,7 @@ func (h *DataHandler) GetPerformanceStatsV2(w http.ResponseWriter, r *http.Reque
 func (h *DataHandler) GetWeeklyStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		now := time.Now()
@@ -929,10 +1006,10 @@ func (h *DataHandler) GetWeeklyStatsV2(w http.ResponseWriter, r *http.Request) {
 		startTime = now.AddDate(0, 0, -30).Format(time.RFC3339)
 	}
 
-	stats, err := h.storageService.GetStats(startTime, endTime)
+	stats, err := h.storageService.GetStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting weekly stats: %v", err)
-		writeErrorResponse(w, "Failed to get weekly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get weekly stats")
 		return
 	}
 
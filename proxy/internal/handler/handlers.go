@@ -1,45 +1,39 @@
 package handler
 
 import (
-	"bufio"
-	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
-	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
 	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
 type Handler struct {
+	*routingAPI
 	storageService      service.StorageService
 	conversationService service.ConversationService
-	modelRouter         *service.ModelRouter
+	messages            *messagesPipeline
 	logger              *log.Logger
-	config              *config.Config
 }
 
-func New(storageService service.StorageService, logger *log.Logger, modelRouter *service.ModelRouter, cfg *config.Config) *Handler {
+func New(storageService service.StorageService, logger *log.Logger, reloader *service.ConfigReloader) *Handler {
 	conversationService := service.NewConversationService()
 
 	return &Handler{
+		routingAPI:          newRoutingAPI(storageService, logger, reloader),
 		storageService:      storageService,
 		conversationService: conversationService,
-		modelRouter:         modelRouter,
+		messages:            newMessagesPipeline(storageService, reloader),
 		logger:              logger,
-		config:              cfg,
 	}
 }
 
@@ -50,93 +44,7 @@ func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Messages(w http.ResponseWriter, r *http.Request) {
-	// Get body bytes from context (set by middleware)
-	bodyBytes := getBodyBytes(r)
-	if bodyBytes == nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
-	}
-
-	// Parse the request
-	var req model.AnthropicRequest
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
-		log.Printf("❌ Error parsing JSON: %v", err)
-		writeErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	requestID := generateRequestID()
-	startTime := time.Now()
-
-	// Use model router to determine provider and route the request
-	decision, err := h.modelRouter.DetermineRoute(&req)
-	if err != nil {
-		log.Printf("❌ Error routing request: %v", err)
-		writeErrorResponse(w, "Failed to route request", http.StatusInternalServerError)
-		return
-	}
-
-	// Extract tools used from request
-	var toolsUsed []string
-	for _, tool := range req.Tools {
-		toolsUsed = append(toolsUsed, tool.Name)
-	}
-
-	// Create request log with routing information
-	requestLog := &model.RequestLog{
-		RequestID:     requestID,
-		Timestamp:     time.Now().Format(time.RFC3339),
-		Method:        r.Method,
-		Endpoint:      r.URL.Path,
-		Headers:       SanitizeHeaders(r.Header),
-		Body:          req,
-		Model:         decision.OriginalModel,
-		OriginalModel: decision.OriginalModel,
-		RoutedModel:   decision.TargetModel,
-		Provider:      decision.ProviderName,
-		SubagentName:  decision.SubagentName,
-		ToolsUsed:     toolsUsed,
-		UserAgent:     r.Header.Get("User-Agent"),
-		ContentType:   r.Header.Get("Content-Type"),
-	}
-
-	if _, err := h.storageService.SaveRequest(requestLog); err != nil {
-		log.Printf("❌ Error saving request: %v", err)
-	}
-
-	// If the model was changed by routing, update the request body
-	if decision.TargetModel != decision.OriginalModel {
-		req.Model = decision.TargetModel
-
-		// Re-marshal the request with the updated model
-		updatedBodyBytes, err := json.Marshal(req)
-		if err != nil {
-			log.Printf("❌ Error marshaling updated request: %v", err)
-			writeErrorResponse(w, "Failed to process request", http.StatusInternalServerError)
-			return
-		}
-
-		// Update the request body
-		r.Body = io.NopCloser(bytes.NewReader(updatedBodyBytes))
-		r.ContentLength = int64(len(updatedBodyBytes))
-		r.Header.Set("Content-Length", fmt.Sprintf("%d", len(updatedBodyBytes)))
-	}
-
-	// Forward the request to the selected provider
-	resp, err := decision.Provider.ForwardRequest(r.Context(), r)
-	if err != nil {
-		log.Printf("❌ Error forwarding to %s API: %v", decision.Provider.Name(), err)
-		writeErrorResponse(w, "Failed to forward request", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if req.Stream {
-		h.handleStreamingResponse(w, resp, requestLog, startTime)
-		return
-	}
-
-	h.handleNonStreamingResponse(w, resp, requestLog, startTime)
+	h.messages.serve(w, r)
 }
 
 func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
@@ -173,6 +81,14 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		Status:    "healthy",
 		Timestamp: time.Now(),
 	}
+	if h.reloader != nil {
+		// A rejected config.yaml leaves the previous config serving traffic
+		status := h.reloader.Status()
+		response.Config = &status
+		if status.LastError != "" {
+			response.Status = "degraded"
+		}
+	}
 
 	writeJSONResponse(w, response)
 }
@@ -257,6 +173,7 @@ func (h *Handler) GetRequestsSummary(w http.ResponseWriter, r *http.Request) {
 	// Get start/end time range (UTC ISO 8601 format from browser)
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	// Parse pagination params
 	offset := 0
@@ -274,7 +191,7 @@ func (h *Handler) GetRequestsSummary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, offset, limit)
+	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project, offset, limit)
 	if err != nil {
 		log.Printf("Error getting request summaries: %v", err)
 		http.Error(w, "Failed to get requests", http.StatusInternalServerError)
@@ -333,6 +250,7 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	// Browser sends the user's local day boundaries converted to UTC
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	// Fallback to last 7 days if not provided
 	if startTime == "" || endTime == "" {
@@ -341,10 +259,10 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 		startTime = now.AddDate(0, 0, -7).Format(time.RFC3339)
 	}
 
-	stats, err := h.storageService.GetStats(startTime, endTime)
+	stats, err := h.storageService.GetStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting stats: %v", err)
-		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get stats")
 		return
 	}
 
@@ -357,16 +275,17 @@ func (h *Handler) GetHourlyStats(w http.ResponseWriter, r *http.Request) {
 	// Get start/end time range (UTC ISO 8601 format from browser)
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetHourlyStats(startTime, endTime)
+	stats, err := h.storageService.GetHourlyStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting hourly stats: %v", err)
-		http.Error(w, "Failed to get hourly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get hourly stats")
 		return
 	}
 
@@ -379,16 +298,17 @@ func (h *Handler) GetModelStats(w http.ResponseWriter, r *http.Request) {
 	// Get start/end time range (UTC ISO 8601 format from browser)
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetModelStats(startTime, endTime)
+	stats, err := h.storageService.GetModelStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting model stats: %v", err)
-		http.Error(w, "Failed to get model stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get model stats")
 		return
 	}
 
@@ -417,16 +337,53 @@ func (h *Handler) GetLatestRequestDate(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetProviderStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetProviderStats(startTime, endTime)
+	stats, err := h.storageService.GetProviderStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting provider stats: %v", err)
-		http.Error(w, "Failed to get provider stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get provider stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetPromptCachingStats compares cache reads between requests the prompt-caching
+// optimizer added breakpoints to and the rest
+func (h *Handler) GetPromptCachingStats(w http.ResponseWriter, r *http.Request) {
+	startTime := r.URL.Query().Get("start")
+	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
+
+	if startTime == "" || endTime == "" {
+		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.storageService.GetPromptCachingStats(startTime, endTime, project)
+	if err != nil {
+		log.Printf("Error getting prompt caching stats: %v", err)
+		writeStorageError(w, err, "Failed to get prompt caching stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetStorageStats reports how much space deduplicating request bodies saves
+func (h *Handler) GetStorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.storageService.GetBodyStorageStats()
+	if err != nil {
+		log.Printf("Error getting storage stats: %v", err)
+		writeStorageError(w, err, "Failed to get storage stats")
 		return
 	}
 
@@ -438,16 +395,17 @@ func (h *Handler) GetProviderStats(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetSubagentStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetSubagentStats(startTime, endTime)
+	stats, err := h.storageService.GetSubagentStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting subagent stats: %v", err)
-		http.Error(w, "Failed to get subagent stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get subagent stats")
 		return
 	}
 
@@ -459,16 +417,17 @@ func (h *Handler) GetSubagentStats(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetToolStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetToolStats(startTime, endTime)
+	stats, err := h.storageService.GetToolStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting tool stats: %v", err)
-		http.Error(w, "Failed to get tool stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get tool stats")
 		return
 	}
 
@@ -480,16 +439,17 @@ func (h *Handler) GetToolStats(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetPerformanceStats(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetPerformanceStats(startTime, endTime)
+	stats, err := h.storageService.GetPerformanceStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting performance stats: %v", err)
-		http.Error(w, "Failed to get performance stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get performance stats")
 		return
 	}
 
@@ -518,256 +478,6 @@ func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
 	writeErrorResponse(w, "Not found", http.StatusNotFound)
 }
 
-func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time) {
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("❌ Anthropic API error: %d", resp.StatusCode)
-		errorBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Error details: %s", string(errorBytes))
-
-		responseLog := &model.ResponseLog{
-			StatusCode:   resp.StatusCode,
-			Headers:      SanitizeHeaders(resp.Header),
-			BodyText:     string(errorBytes),
-			ResponseTime: time.Since(startTime).Milliseconds(),
-			IsStreaming:  true,
-			CompletedAt:  time.Now().Format(time.RFC3339),
-		}
-
-		requestLog.Response = responseLog
-		if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
-			log.Printf("❌ Error updating request with error response: %v", err)
-		}
-
-		w.WriteHeader(resp.StatusCode)
-		w.Write(errorBytes)
-		return
-	}
-
-	var fullResponseText strings.Builder
-	var toolCalls []model.ContentBlock
-	var streamingChunks []string
-	var finalUsage *model.AnthropicUsage
-	var messageID string
-	var modelName string
-	var stopReason string
-	var firstByteTime int64
-
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" || !strings.HasPrefix(line, "data:") {
-			continue
-		}
-
-		// Track time to first byte (first actual data)
-		if firstByteTime == 0 {
-			firstByteTime = time.Since(startTime).Milliseconds()
-		}
-
-		streamingChunks = append(streamingChunks, line)
-		fmt.Fprintf(w, "%s\n\n", line)
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
-		}
-
-		jsonData := strings.TrimPrefix(line, "data: ")
-
-		// Parse as generic JSON first to capture usage data
-		var genericEvent map[string]interface{}
-		if err := json.Unmarshal([]byte(jsonData), &genericEvent); err != nil {
-			log.Printf("⚠️ Error unmarshalling streaming event: %v", err)
-			continue
-		}
-
-		// Capture metadata from message_start event
-		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_start" {
-			if message, ok := genericEvent["message"].(map[string]interface{}); ok {
-				// Capture message metadata
-				if id, ok := message["id"].(string); ok {
-					messageID = id
-				}
-				if model, ok := message["model"].(string); ok {
-					modelName = model
-				}
-				if reason, ok := message["stop_reason"].(string); ok {
-					stopReason = reason
-				}
-			}
-		}
-
-		// Capture usage data from message_delta event
-		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_delta" {
-			// Usage is at top level for message_delta events
-			if usage, ok := genericEvent["usage"].(map[string]interface{}); ok {
-				// Create finalUsage if it doesn't exist yet
-				if finalUsage == nil {
-					finalUsage = &model.AnthropicUsage{}
-				}
-
-				// Capture all usage fields
-				if inputTokens, ok := usage["input_tokens"].(float64); ok {
-					finalUsage.InputTokens = int(inputTokens)
-				}
-				if outputTokens, ok := usage["output_tokens"].(float64); ok {
-					finalUsage.OutputTokens = int(outputTokens)
-				}
-				if cacheCreation, ok := usage["cache_creation_input_tokens"].(float64); ok {
-					finalUsage.CacheCreationInputTokens = int(cacheCreation)
-				}
-				if cacheRead, ok := usage["cache_read_input_tokens"].(float64); ok {
-					finalUsage.CacheReadInputTokens = int(cacheRead)
-				}
-
-			}
-		}
-
-		// Parse as structured event for content processing
-		var event model.StreamingEvent
-		if err := json.Unmarshal([]byte(jsonData), &event); err != nil {
-			// Skip if structured parsing fails, but we already got the usage data above
-			continue
-		}
-
-		switch event.Type {
-		case "content_block_delta":
-			if event.Delta != nil {
-				if event.Delta.Type == "text_delta" {
-					fullResponseText.WriteString(event.Delta.Text)
-				} else if event.Delta.Type == "input_json_delta" {
-					if event.Index != nil && *event.Index < len(toolCalls) {
-						toolCalls[*event.Index].Input = append(toolCalls[*event.Index].Input, event.Delta.Input...)
-					}
-				}
-			}
-		case "content_block_start":
-			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
-				toolCalls = append(toolCalls, *event.ContentBlock)
-			}
-		case "message_stop":
-			// End of stream - scanner will exit on its own
-		}
-	}
-
-	responseLog := &model.ResponseLog{
-		StatusCode:      resp.StatusCode,
-		Headers:         SanitizeHeaders(resp.Header),
-		StreamingChunks: streamingChunks,
-		ResponseTime:    time.Since(startTime).Milliseconds(),
-		FirstByteTime:   firstByteTime,
-		IsStreaming:     true,
-		CompletedAt:     time.Now().Format(time.RFC3339),
-		ToolCallCount:   len(toolCalls),
-	}
-
-	// Create a structured response body that matches Anthropic's format
-	var contentBlocks []model.AnthropicContentBlock
-	if fullResponseText.Len() > 0 {
-		contentBlocks = append(contentBlocks, model.AnthropicContentBlock{
-			Type: "text",
-			Text: fullResponseText.String(),
-		})
-	}
-
-	// Create an AnthropicResponse-like structure for consistency
-	responseBody := map[string]interface{}{
-		"content":     contentBlocks,
-		"id":          messageID,
-		"model":       modelName,
-		"role":        "assistant",
-		"stop_reason": stopReason,
-		"type":        "message",
-	}
-
-	// Add usage data if we captured it
-	if finalUsage != nil {
-		responseBody["usage"] = finalUsage
-	}
-
-	// Marshal to JSON for storage
-	responseBodyBytes, err := json.Marshal(responseBody)
-	if err != nil {
-		log.Printf("❌ Error marshaling streaming response body: %v", err)
-		responseBodyBytes = []byte("{}")
-	}
-
-	responseLog.Body = json.RawMessage(responseBodyBytes)
-
-	requestLog.Response = responseLog
-	if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
-		log.Printf("❌ Error updating request with streaming response: %v", err)
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Printf("❌ Streaming error: %v", err)
-	} else {
-		log.Println("✅ Streaming response completed")
-	}
-}
-
-func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time) {
-	responseBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("❌ Error reading Anthropic response: %v", err)
-		writeErrorResponse(w, "Failed to read response", http.StatusInternalServerError)
-		return
-	}
-
-	responseLog := &model.ResponseLog{
-		StatusCode:   resp.StatusCode,
-		Headers:      SanitizeHeaders(resp.Header),
-		ResponseTime: time.Since(startTime).Milliseconds(),
-		IsStreaming:  false,
-		CompletedAt:  time.Now().Format(time.RFC3339),
-	}
-
-	// Parse the response as AnthropicResponse for consistent structure
-	if resp.StatusCode == http.StatusOK {
-		var anthropicResp model.AnthropicResponse
-		if err := json.Unmarshal(responseBytes, &anthropicResp); err == nil {
-			// Successfully parsed - store the structured response
-			responseLog.Body = json.RawMessage(responseBytes)
-
-			// Count tool_use blocks in response content
-			toolCallCount := 0
-			for _, block := range anthropicResp.Content {
-				if block.Type == "tool_use" {
-					toolCallCount++
-				}
-			}
-			responseLog.ToolCallCount = toolCallCount
-		} else {
-			// If parsing fails, store as text but log the error
-			log.Printf("⚠️ Failed to parse Anthropic response: %v", err)
-			log.Printf("📄 Response body (first 500 chars): %s", string(responseBytes[:min(500, len(responseBytes))]))
-			responseLog.BodyText = string(responseBytes)
-		}
-	} else {
-		// For error responses, store as text
-		responseLog.BodyText = string(responseBytes)
-	}
-
-	requestLog.Response = responseLog
-	if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
-		log.Printf("❌ Error updating request with response: %v", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("❌ Anthropic API error: %d %s", resp.StatusCode, string(responseBytes))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		w.Write(responseBytes)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseBytes)
-}
-
 // Helper function to get minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -1019,7 +729,7 @@ func (h *Handler) SearchConversations(w http.ResponseWriter, r *http.Request) {
 	results, err := h.storageService.SearchConversations(opts)
 	if err != nil {
 		log.Printf("❌ Error searching conversations: %v", err)
-		writeErrorResponse(w, "Failed to search conversations", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to search conversations")
 		return
 	}
 
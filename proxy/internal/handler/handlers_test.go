@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
 func TestExtractToolsUsed(t *testing.T) {
@@ -239,3 +244,60 @@ func TestSanitizeHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		auth       string
+		wantOK     bool
+		wantStatus int
+	}{
+		{"disabled without a key", "", "Bearer anything", false, http.StatusForbidden},
+		{"missing token", "secret", "", false, http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", false, http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Admin: config.AdminConfig{APIKey: tt.apiKey}}
+			r := httptest.NewRequest(http.MethodPatch, "/api/v2/config/subagents", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+
+			if ok := requireAdmin(w, r, cfg); ok != tt.wantOK {
+				t.Errorf("requireAdmin() = %v, want %v", ok, tt.wantOK)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUnsupportedStorageQueries(t *testing.T) {
+	storage, err := service.NewJSONLStorageService(&config.StorageConfig{Backend: "jsonl", RequestsDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+	h := New(storage, nil, nil)
+
+	for _, tt := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/api/stats", h.GetStats},
+		{"/api/v2/stats/hourly?start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z", h.GetHourlyStatsV2},
+		{"/api/conversations/search?q=test", h.SearchConversations},
+	} {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusNotImplemented || !strings.Contains(w.Body.String(), "storage.backend: sqlite") {
+			t.Errorf("%s: expected 501 naming the sqlite backend, got %d %s", tt.path, w.Code, w.Body.String())
+		}
+	}
+}
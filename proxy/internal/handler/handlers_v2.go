@@ -3,7 +3,6 @@ package handler
 import (
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"time"
 
@@ -11,6 +10,7 @@ import (
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
 // ============================================================================
@@ -26,6 +26,7 @@ func (h *Handler) GetRequestsSummaryV2(w http.ResponseWriter, r *http.Request) {
 
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	offset := 0
 	limit := 100
@@ -42,7 +43,7 @@ func (h *Handler) GetRequestsSummaryV2(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, offset, limit)
+	summaries, total, err := h.storageService.GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project, offset, limit)
 	if err != nil {
 		log.Printf("Error getting request summaries: %v", err)
 		writeErrorResponse(w, "Failed to get requests", http.StatusInternalServerError)
@@ -99,7 +100,7 @@ func (h *Handler) GetConversationsV2(w http.ResponseWriter, r *http.Request) {
 	conversations, err := h.storageService.GetIndexedConversations(100)
 	if err != nil {
 		log.Printf("❌ Error getting indexed conversations: %v", err)
-		writeErrorResponse(w, "Failed to get conversations", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get conversations")
 		return
 	}
 
@@ -149,16 +150,17 @@ func (h *Handler) GetConversationByIDV2(w http.ResponseWriter, r *http.Request)
 func (h *Handler) GetHourlyStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetHourlyStats(startTime, endTime)
+	stats, err := h.storageService.GetHourlyStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting hourly stats: %v", err)
-		writeErrorResponse(w, "Failed to get hourly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get hourly stats")
 		return
 	}
 
@@ -174,16 +176,17 @@ func (h *Handler) GetHourlyStatsV2(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetModelStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetModelStats(startTime, endTime)
+	stats, err := h.storageService.GetModelStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting model stats: %v", err)
-		writeErrorResponse(w, "Failed to get model stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get model stats")
 		return
 	}
 
@@ -199,16 +202,17 @@ func (h *Handler) GetModelStatsV2(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetSubagentStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetSubagentStats(startTime, endTime)
+	stats, err := h.storageService.GetSubagentStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting subagent stats: %v", err)
-		writeErrorResponse(w, "Failed to get subagent stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get subagent stats")
 		return
 	}
 
@@ -224,16 +228,17 @@ func (h *Handler) GetSubagentStatsV2(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetPerformanceStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		writeErrorResponse(w, "start and end parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	stats, err := h.storageService.GetPerformanceStats(startTime, endTime)
+	stats, err := h.storageService.GetPerformanceStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting performance stats: %v", err)
-		writeErrorResponse(w, "Failed to get performance stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get performance stats")
 		return
 	}
 
@@ -249,6 +254,7 @@ func (h *Handler) GetPerformanceStatsV2(w http.ResponseWriter, r *http.Request)
 func (h *Handler) GetWeeklyStatsV2(w http.ResponseWriter, r *http.Request) {
 	startTime := r.URL.Query().Get("start")
 	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
 
 	if startTime == "" || endTime == "" {
 		// Default to last 30 days if not specified
@@ -257,10 +263,10 @@ func (h *Handler) GetWeeklyStatsV2(w http.ResponseWriter, r *http.Request) {
 		startTime = now.AddDate(0, 0, -30).Format(time.RFC3339)
 	}
 
-	stats, err := h.storageService.GetStats(startTime, endTime)
+	stats, err := h.storageService.GetStats(startTime, endTime, project)
 	if err != nil {
 		log.Printf("Error getting weekly stats: %v", err)
-		writeErrorResponse(w, "Failed to get weekly stats", http.StatusInternalServerError)
+		writeStorageError(w, err, "Failed to get weekly stats")
 		return
 	}
 
@@ -272,188 +278,37 @@ func (h *Handler) GetWeeklyStatsV2(w http.ResponseWriter, r *http.Request) {
 	writeJSONResponse(w, stats)
 }
 
-// ============================================================================
-// Configuration API V2
-// ============================================================================
-
-// GetConfigV2 returns the full configuration (sanitized)
-func (h *Handler) GetConfigV2(w http.ResponseWriter, r *http.Request) {
-	if h.config == nil {
-		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
-		return
+// GetExperimentResultsV2 compares the arms of a traffic-split experiment on
+// latency, tokens, cost, errors, tool calls, and stop reasons
+func (h *Handler) GetExperimentResultsV2(w http.ResponseWriter, r *http.Request) {
+	var experiments *service.Experiments
+	if router := h.currentRouter(); router != nil {
+		experiments = router.Experiments()
 	}
-
-	// Sanitize the config before returning
-	sanitized := sanitizeConfig(h.config)
-	writeJSONResponse(w, sanitized)
+	writeExperimentResults(w, r, h.storageService, experiments)
 }
 
-// GetProvidersV2 returns all provider configurations (sanitized)
-func (h *Handler) GetProvidersV2(w http.ResponseWriter, r *http.Request) {
-	if h.config == nil {
-		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
-		return
-	}
-
-	// Create sanitized provider map
-	providers := make(map[string]*config.ProviderConfig)
-	for name, provider := range h.config.Providers {
-		providers[name] = &config.ProviderConfig{
-			Format:     provider.Format,
-			BaseURL:    provider.BaseURL,
-			Version:    provider.Version,
-			MaxRetries: provider.MaxRetries,
-			APIKey:     redactAPIKey(provider.APIKey),
-		}
-	}
-
-	// Return empty object if no providers (not null)
-	if providers == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("{}"))
-		return
-	}
-
-	writeJSONResponse(w, providers)
+// GetToolPolicyHitsV2 lists tool calls matched by tool policies, newest
+// first
+func (h *Handler) GetToolPolicyHitsV2(w http.ResponseWriter, r *http.Request) {
+	writeToolPolicyHits(w, r, h.storageService)
 }
 
-// GetSubagentConfigV2 returns subagent routing configuration
-func (h *Handler) GetSubagentConfigV2(w http.ResponseWriter, r *http.Request) {
-	if h.config == nil {
-		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
-		return
-	}
-
-	// Create response with subagent config
-	subagentConfig := map[string]interface{}{
-		"enable":   h.config.Subagents.Enable,
-		"mappings": h.config.Subagents.Mappings,
-	}
-
-	// Ensure mappings is never null
-	if subagentConfig["mappings"] == nil {
-		subagentConfig["mappings"] = make(map[string]string)
-	}
-
-	writeJSONResponse(w, subagentConfig)
+// GetToolCallsV2 lists audited tool calls with their results, newest first
+func (h *Handler) GetToolCallsV2(w http.ResponseWriter, r *http.Request) {
+	writeToolCalls(w, r, h.storageService)
 }
 
-// ============================================================================
-// Routing API V2 (NEW for Phase 4.1)
-// ============================================================================
-
-// GetRoutingConfigV2 returns current routing configuration including:
-// - Provider mappings
-// - Subagent routing rules
-// - Circuit breaker settings
-// - Fallback configuration
-func (h *Handler) GetRoutingConfigV2(w http.ResponseWriter, r *http.Request) {
-	if h.config == nil {
-		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
-		return
-	}
-
-	// Build routing configuration response
-	routingConfig := map[string]interface{}{
-		"providers": make(map[string]interface{}),
-		"subagents": map[string]interface{}{
-			"enable":   h.config.Subagents.Enable,
-			"mappings": h.config.Subagents.Mappings,
-		},
-	}
-
-	// Add provider routing details
-	providers := make(map[string]interface{})
-	for name, providerCfg := range h.config.Providers {
-		providers[name] = map[string]interface{}{
-			"format":            providerCfg.Format,
-			"base_url":          providerCfg.BaseURL,
-			"max_retries":       providerCfg.MaxRetries,
-			"fallback_provider": providerCfg.FallbackProvider,
-			"circuit_breaker": map[string]interface{}{
-				"enabled":      providerCfg.CircuitBreaker.Enabled,
-				"max_failures": providerCfg.CircuitBreaker.MaxFailures,
-				"timeout":      providerCfg.CircuitBreaker.TimeoutDuration.String(),
-			},
-		}
-	}
-	routingConfig["providers"] = providers
-
-	// Ensure mappings is never null
-	if routingConfig["subagents"].(map[string]interface{})["mappings"] == nil {
-		subagents := routingConfig["subagents"].(map[string]interface{})
-		subagents["mappings"] = make(map[string]string)
-	}
-
-	writeJSONResponse(w, routingConfig)
-}
-
-// GetProviderStatusV2 returns real-time provider health status including:
-// - Circuit breaker state (open/closed/half-open)
-// - Fallback provider configuration
-// - Health status
-func (h *Handler) GetProviderStatusV2(w http.ResponseWriter, r *http.Request) {
-	if h.modelRouter == nil {
-		writeErrorResponse(w, "Model router not available", http.StatusInternalServerError)
-		return
-	}
-
-	// Get provider health from model router
-	providerHealth := h.modelRouter.GetProviderHealth()
-
-	// Sort by name for consistent ordering
-	sort.Slice(providerHealth, func(i, j int) bool {
-		return providerHealth[i].Name < providerHealth[j].Name
-	})
-
-	writeJSONResponse(w, providerHealth)
-}
-
-// GetRoutingStatsV2 returns routing statistics including:
-// - Requests per provider
-// - Circuit breaker trips
-// - Fallback activations
-// - Average response times per provider
-func (h *Handler) GetRoutingStatsV2(w http.ResponseWriter, r *http.Request) {
-	startTime := r.URL.Query().Get("start")
-	endTime := r.URL.Query().Get("end")
-
-	if startTime == "" || endTime == "" {
-		// Default to last 24 hours if not specified
-		now := time.Now()
-		endTime = now.Format(time.RFC3339)
-		startTime = now.AddDate(0, 0, -1).Format(time.RFC3339)
-	}
-
-	// Get provider stats from storage service
-	providerStats, err := h.storageService.GetProviderStats(startTime, endTime)
+// GetRetentionStatusV2 returns the retention settings, how much is stored,
+// and the last retention run
+func (h *Handler) GetRetentionStatusV2(w http.ResponseWriter, r *http.Request) {
+	status, err := h.storageService.GetRetentionStatus()
 	if err != nil {
-		log.Printf("Error getting routing stats: %v", err)
-		writeErrorResponse(w, "Failed to get routing stats", http.StatusInternalServerError)
+		log.Printf("Error getting retention status: %v", err)
+		writeStorageError(w, err, "Failed to get retention status")
 		return
 	}
-
-	// Add subagent stats
-	subagentStats, err := h.storageService.GetSubagentStats(startTime, endTime)
-	if err != nil {
-		log.Printf("Error getting subagent stats: %v", err)
-		// Continue with just provider stats
-		subagentStats = &model.SubagentStatsResponse{
-			Subagents: []model.SubagentStats{},
-		}
-	}
-
-	// Build comprehensive routing stats
-	routingStats := map[string]interface{}{
-		"providers": providerStats,
-		"subagents": subagentStats,
-		"timeRange": map[string]string{
-			"start": startTime,
-			"end":   endTime,
-		},
-	}
-
-	writeJSONResponse(w, routingStats)
+	writeJSONResponse(w, status)
 }
 
 // ============================================================================
@@ -467,8 +322,10 @@ func sanitizeConfig(cfg *config.Config) *config.Config {
 		Server:  cfg.Server,
 		Storage: cfg.Storage,
 		Subagents: config.SubagentsConfig{
-			Enable:   cfg.Subagents.Enable,
-			Mappings: make(map[string]string),
+			Enable:              cfg.Subagents.Enable,
+			Mappings:            make(map[string]string),
+			AgentDirs:           cfg.Subagents.AgentDirs,
+			SimilarityThreshold: cfg.Subagents.SimilarityThreshold,
 		},
 		Providers: make(map[string]*config.ProviderConfig),
 	}
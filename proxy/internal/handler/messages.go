@@ -0,0 +1,463 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+// messagesPipeline proxies /v1/messages: rate limits, aliases, routing,
+// plugins, tool policies and caching, then forwarding and logging the
+// response. Handler and CoreHandler both serve the endpoint through it.
+type messagesPipeline struct {
+	storageService service.StorageService
+	reloader       *service.ConfigReloader
+}
+
+func newMessagesPipeline(storageService service.StorageService, reloader *service.ConfigReloader) *messagesPipeline {
+	return &messagesPipeline{
+		storageService: storageService,
+		reloader:       reloader,
+	}
+}
+
+func (p *messagesPipeline) serve(w http.ResponseWriter, r *http.Request) {
+	// Get body bytes from context (set by middleware)
+	bodyBytes := getBodyBytes(r)
+	if bodyBytes == nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request
+	var req model.AnthropicRequest
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		log.Printf("❌ Error parsing JSON: %v", err)
+		writeErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	requestID := generateRequestID()
+	startTime := time.Now()
+
+	// Use one config generation for the whole request; a reload mid-request
+	// only affects requests that arrive after it
+	rt := p.reloader.Current()
+
+	// Turn the request away before routing if the caller is over a rate limit
+	if err := rt.RateLimiter.Allow(rateLimitClientKey(r), rateLimitSessionID(&req), bodyBytes); err != nil {
+		var limitErr *service.RateLimitError
+		if errors.As(err, &limitErr) {
+			rejectRateLimited(w, p.storageService, newRejectedRequestLog(r, requestID, startTime, &req), limitErr, req.Stream)
+			return
+		}
+	}
+
+	// Apply model_aliases first: routing sees the aliased model, while the
+	// request log keeps the model the client asked for
+	routeReq := &req
+	alias := rt.Router.ResolveAlias(&req, r.Header, rateLimitClientKey(r))
+	if alias != nil {
+		aliased := req
+		aliased.Model = alias.Model
+		routeReq = &aliased
+	}
+
+	// Use model router to determine provider and route the request
+	// (routing rules may reject the request outright, as may the context
+	// window check)
+	decision, err := rt.Router.DetermineAliasedRoute(routeReq, r.Header, alias)
+	var ruleErr *service.RuleRejectError
+	if errors.As(err, &ruleErr) {
+		rejectByRule(w, p.storageService, newRejectedRequestLog(r, requestID, startTime, &req), ruleErr, req.Stream)
+		return
+	}
+	var overflowErr *service.ContextOverflowError
+	if errors.As(err, &overflowErr) {
+		rejectContextOverflow(w, p.storageService, newRejectedRequestLog(r, requestID, startTime, &req), overflowErr, req.Stream)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error routing request: %v", err)
+		writeErrorResponse(w, "Failed to route request", http.StatusInternalServerError)
+		return
+	}
+	decision.OriginalModel = req.Model
+
+	// Run the plugins enabled for this route; the request is logged and
+	// forwarded as they leave it
+	ruleInput := service.RuleInput{
+		Request:      routeReq,
+		Headers:      r.Header,
+		SubagentName: decision.SubagentName,
+		ProjectPath:  decision.ProjectPath,
+	}
+	route := decision.ProviderName + ":" + decision.TargetModel
+	plugins := rt.Plugins.Start(ruleInput, route)
+	appliedPlugins := plugins.OnRequest(&req)
+
+	// Tool policies for this route check the tool calls in the response
+	policies := rt.ToolPolicies.Start(ruleInput, route)
+
+	// Add prompt-caching breakpoints on prefixes this session keeps resending
+	cacheBreakpoints := rt.Caching.Optimize(&req, decision.ProviderName, rateLimitSessionID(&req))
+
+	// Extract tools used from request
+	var toolsUsed []string
+	for _, tool := range req.Tools {
+		toolsUsed = append(toolsUsed, tool.Name)
+	}
+
+	// Create request log with routing information
+	requestLog := &model.RequestLog{
+		RequestID:     requestID,
+		Timestamp:     time.Now().Format(time.RFC3339),
+		Method:        r.Method,
+		Endpoint:      r.URL.Path,
+		Headers:       SanitizeHeaders(r.Header),
+		Body:          req,
+		Model:         decision.OriginalModel,
+		OriginalModel: decision.OriginalModel,
+		RoutedModel:   decision.TargetModel,
+		Provider:      decision.ProviderName,
+		SubagentName:  decision.SubagentName,
+		RoutingRule:   decision.RuleID,
+		Experiment:    decision.ExperimentID,
+		ExperimentArm: decision.ExperimentArm,
+		ProjectPath:   decision.ProjectPath,
+		Plugins:       appliedPlugins,
+		Breakpoints:   cacheBreakpoints,
+		ToolsUsed:     toolsUsed,
+		UserAgent:     r.Header.Get("User-Agent"),
+		ContentType:   r.Header.Get("Content-Type"),
+	}
+
+	if _, err := p.storageService.SaveRequest(requestLog); err != nil {
+		log.Printf("❌ Error saving request: %v", err)
+	}
+
+	// If routing changed the model, or a plugin or the caching optimizer
+	// changed the request, update the request body
+	if decision.TargetModel != decision.OriginalModel || len(appliedPlugins) > 0 || cacheBreakpoints > 0 {
+		req.Model = decision.TargetModel
+
+		// Re-marshal the updated request
+		updatedBodyBytes, err := json.Marshal(req)
+		if err != nil {
+			log.Printf("❌ Error marshaling updated request: %v", err)
+			writeErrorResponse(w, "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+
+		// Update the request body
+		r.Body = io.NopCloser(bytes.NewReader(updatedBodyBytes))
+		r.ContentLength = int64(len(updatedBodyBytes))
+		r.Header.Set("Content-Length", fmt.Sprintf("%d", len(updatedBodyBytes)))
+	}
+
+	// Forward the request to the selected provider
+	// (hedged to a second provider if the primary is slow to respond)
+	// (queued first if the provider is at its concurrency limit)
+	resp, meta, err := rt.Router.Forward(r.Context(), decision, r)
+	requestLog.Hedge = meta.Hedge
+	if meta.Hedge != nil && meta.Hedge.Winner == service.HedgeWinnerHedge {
+		// The hedge answered first, so it served the request
+		requestLog.Provider = meta.Hedge.HedgeProvider
+		requestLog.RoutedModel = meta.Hedge.HedgeModel
+	}
+	requestLog.Queue = meta.Queue
+	if errors.Is(err, service.ErrQueueFull) || errors.Is(err, service.ErrQueueTimeout) {
+		log.Printf("⏳ Provider '%s' at concurrency limit: %v", decision.ProviderName, err)
+		writeAnthropicError(w, statusOverloaded, "overloaded_error", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error forwarding to %s API: %v", decision.Provider.Name(), err)
+		writeErrorResponse(w, "Failed to forward request", http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	if req.Stream {
+		p.handleStreamingResponse(w, resp, requestLog, startTime, plugins, policies)
+		return
+	}
+
+	p.handleNonStreamingResponse(w, resp, requestLog, startTime, plugins, policies)
+}
+
+func (p *messagesPipeline) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time, plugins *service.PluginRun, policies *service.ToolPolicyRun) {
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Anthropic API error: %d", resp.StatusCode)
+		errorBytes, _ := io.ReadAll(resp.Body)
+		log.Printf("Error details: %s", string(errorBytes))
+
+		responseLog := &model.ResponseLog{
+			StatusCode:   resp.StatusCode,
+			Headers:      SanitizeHeaders(resp.Header),
+			BodyText:     string(errorBytes),
+			ResponseTime: time.Since(startTime).Milliseconds(),
+			IsStreaming:  true,
+			CompletedAt:  time.Now().Format(time.RFC3339),
+		}
+
+		requestLog.Response = responseLog
+		if err := p.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+			log.Printf("❌ Error updating request with error response: %v", err)
+		}
+		plugins.OnComplete(requestLog)
+
+		w.WriteHeader(resp.StatusCode)
+		w.Write(errorBytes)
+		return
+	}
+
+	var fullResponseText strings.Builder
+	var toolCalls []model.ContentBlock
+	var streamingChunks []string
+	var finalUsage *model.AnthropicUsage
+	var messageID string
+	var modelName string
+	var stopReason string
+	var firstByteTime int64
+	failures := &streamFailureTracker{provider: requestLog.Provider}
+
+	// Tool policies hold each tool_use block back until its input is
+	// complete, then pass it on, replace it, or add a note before it
+	scanner := bufio.NewScanner(policies.FilterStream(resp.Body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		// Track time to first byte (first actual data)
+		if firstByteTime == 0 {
+			firstByteTime = time.Since(startTime).Milliseconds()
+		}
+
+		// Plugins see each event before the client, and may rewrite it
+		line = applyResponseEventPlugins(plugins, line)
+
+		streamingChunks = append(streamingChunks, line)
+		fmt.Fprintf(w, "%s\n\n", line)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		jsonData := strings.TrimPrefix(line, "data: ")
+
+		// Parse as generic JSON first to capture usage data
+		var genericEvent map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonData), &genericEvent); err != nil {
+			log.Printf("⚠️ Error unmarshalling streaming event: %v", err)
+			continue
+		}
+		failures.observe(genericEvent)
+
+		// Capture metadata from message_start event
+		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_start" {
+			if message, ok := genericEvent["message"].(map[string]interface{}); ok {
+				// Capture message metadata
+				if id, ok := message["id"].(string); ok {
+					messageID = id
+				}
+				if model, ok := message["model"].(string); ok {
+					modelName = model
+				}
+				if reason, ok := message["stop_reason"].(string); ok {
+					stopReason = reason
+				}
+			}
+		}
+
+		// Capture usage data from message_delta event
+		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_delta" {
+			// Usage is at top level for message_delta events
+			if usage, ok := genericEvent["usage"].(map[string]interface{}); ok {
+				// Create finalUsage if it doesn't exist yet
+				if finalUsage == nil {
+					finalUsage = &model.AnthropicUsage{}
+				}
+
+				// Capture all usage fields
+				if inputTokens, ok := usage["input_tokens"].(float64); ok {
+					finalUsage.InputTokens = int(inputTokens)
+				}
+				if outputTokens, ok := usage["output_tokens"].(float64); ok {
+					finalUsage.OutputTokens = int(outputTokens)
+				}
+				if cacheCreation, ok := usage["cache_creation_input_tokens"].(float64); ok {
+					finalUsage.CacheCreationInputTokens = int(cacheCreation)
+				}
+				if cacheRead, ok := usage["cache_read_input_tokens"].(float64); ok {
+					finalUsage.CacheReadInputTokens = int(cacheRead)
+				}
+
+			}
+		}
+
+		// Parse as structured event for content processing
+		var event model.StreamingEvent
+		if err := json.Unmarshal([]byte(jsonData), &event); err != nil {
+			// Skip if structured parsing fails, but we already got the usage data above
+			continue
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta != nil {
+				if event.Delta.Type == "text_delta" {
+					fullResponseText.WriteString(event.Delta.Text)
+				} else if event.Delta.Type == "input_json_delta" {
+					if event.Index != nil && *event.Index < len(toolCalls) {
+						toolCalls[*event.Index].Input = append(toolCalls[*event.Index].Input, event.Delta.Input...)
+					}
+				}
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				toolCalls = append(toolCalls, *event.ContentBlock)
+			}
+		case "message_stop":
+			// End of stream - scanner will exit on its own
+		}
+	}
+
+	responseLog := &model.ResponseLog{
+		StatusCode:      resp.StatusCode,
+		Headers:         SanitizeHeaders(resp.Header),
+		StreamingChunks: streamingChunks,
+		ResponseTime:    time.Since(startTime).Milliseconds(),
+		FirstByteTime:   firstByteTime,
+		IsStreaming:     true,
+		CompletedAt:     time.Now().Format(time.RFC3339),
+		ToolCallCount:   len(toolCalls),
+	}
+
+	// Create a structured response body that matches Anthropic's format
+	var contentBlocks []model.AnthropicContentBlock
+	if fullResponseText.Len() > 0 {
+		contentBlocks = append(contentBlocks, model.AnthropicContentBlock{
+			Type: "text",
+			Text: fullResponseText.String(),
+		})
+	}
+
+	// Create an AnthropicResponse-like structure for consistency
+	responseBody := map[string]interface{}{
+		"content":     contentBlocks,
+		"id":          messageID,
+		"model":       modelName,
+		"role":        "assistant",
+		"stop_reason": stopReason,
+		"type":        "message",
+	}
+
+	// Add usage data if we captured it
+	if finalUsage != nil {
+		responseBody["usage"] = finalUsage
+	}
+
+	// Marshal to JSON for storage
+	responseBodyBytes, err := json.Marshal(responseBody)
+	if err != nil {
+		log.Printf("❌ Error marshaling streaming response body: %v", err)
+		responseBodyBytes = []byte("{}")
+	}
+
+	responseLog.Body = json.RawMessage(responseBodyBytes)
+
+	requestLog.Response = responseLog
+	if err := p.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+		log.Printf("❌ Error updating request with streaming response: %v", err)
+	}
+	plugins.OnComplete(requestLog)
+	saveToolPolicyHits(p.storageService, requestLog, policies)
+
+	failures.finish(scanner.Err())
+	if err := scanner.Err(); err != nil {
+		log.Printf("❌ Streaming error: %v", err)
+	} else {
+		log.Println("✅ Streaming response completed")
+	}
+}
+
+func (p *messagesPipeline) handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time, plugins *service.PluginRun, policies *service.ToolPolicyRun) {
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("❌ Error reading Anthropic response: %v", err)
+		writeErrorResponse(w, "Failed to read response", http.StatusInternalServerError)
+		return
+	}
+
+	responseLog := &model.ResponseLog{
+		StatusCode:   resp.StatusCode,
+		Headers:      SanitizeHeaders(resp.Header),
+		ResponseTime: time.Since(startTime).Milliseconds(),
+		IsStreaming:  false,
+		CompletedAt:  time.Now().Format(time.RFC3339),
+	}
+
+	// Parse the response as AnthropicResponse for consistent structure
+	if resp.StatusCode == http.StatusOK {
+		responseBytes = policies.FilterMessage(responseBytes)
+		responseBytes = applyResponseMessagePlugins(plugins, responseBytes)
+
+		var anthropicResp model.AnthropicResponse
+		if err := json.Unmarshal(responseBytes, &anthropicResp); err == nil {
+			// Successfully parsed - store the structured response
+			responseLog.Body = json.RawMessage(responseBytes)
+
+			// Count tool_use blocks in response content
+			toolCallCount := 0
+			for _, block := range anthropicResp.Content {
+				if block.Type == "tool_use" {
+					toolCallCount++
+				}
+			}
+			responseLog.ToolCallCount = toolCallCount
+		} else {
+			// If parsing fails, store as text but log the error
+			log.Printf("⚠️ Failed to parse Anthropic response: %v", err)
+			log.Printf("📄 Response body (first 500 chars): %s", string(responseBytes[:min(500, len(responseBytes))]))
+			responseLog.BodyText = string(responseBytes)
+		}
+	} else {
+		// For error responses, store as text
+		responseLog.BodyText = string(responseBytes)
+	}
+
+	requestLog.Response = responseLog
+	if err := p.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+		log.Printf("❌ Error updating request with response: %v", err)
+	}
+	plugins.OnComplete(requestLog)
+	saveToolPolicyHits(p.storageService, requestLog, policies)
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Anthropic API error: %d %s", resp.StatusCode, string(responseBytes))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		w.Write(responseBytes)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseBytes)
+}
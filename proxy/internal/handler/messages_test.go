@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+// redactingPlugin rewrites text in responses and records the completed log
+type redactingPlugin struct {
+	events    []string
+	completed *model.RequestLog
+}
+
+func (p *redactingPlugin) Name() string { return "redact" }
+
+func (p *redactingPlugin) OnResponseEvent(event *service.ResponseEvent) {
+	p.events = append(p.events, event.Type)
+	event.Data = []byte(strings.ReplaceAll(string(event.Data), "secret", "[redacted]"))
+}
+
+func (p *redactingPlugin) OnComplete(requestLog *model.RequestLog) { p.completed = requestLog }
+
+func setupTestMessagesPipeline(t *testing.T) (*messagesPipeline, service.StorageService) {
+	t.Helper()
+	storage, err := service.NewJSONLStorageService(&config.StorageConfig{Backend: "jsonl", RequestsDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return newMessagesPipeline(storage, nil), storage
+}
+
+func savedTestRequest(t *testing.T, storage service.StorageService, id string) *model.RequestLog {
+	t.Helper()
+	requestLog := &model.RequestLog{
+		RequestID: id,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Headers:   map[string][]string{},
+		Body:      model.AnthropicRequest{Model: "claude-sonnet-4"},
+		Model:     "claude-sonnet-4",
+		Provider:  "anthropic",
+	}
+	if _, err := storage.SaveRequest(requestLog); err != nil {
+		t.Fatalf("SaveRequest() error = %v", err)
+	}
+	return requestLog
+}
+
+func TestMessagesPipeline_StreamingResponsePlugins(t *testing.T) {
+	pipeline, storage := setupTestMessagesPipeline(t)
+	requestLog := savedTestRequest(t, storage, "req-stream")
+	plugin := &redactingPlugin{}
+
+	upstream := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the secret is out"}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n")
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(upstream))}
+
+	w := httptest.NewRecorder()
+	pipeline.handleStreamingResponse(w, resp, requestLog, time.Now(), service.NewPluginRun(plugin), nil)
+
+	if strings.Contains(w.Body.String(), "secret") || !strings.Contains(w.Body.String(), "the [redacted] is out") {
+		t.Errorf("Expected the client to see the rewritten event, got %s", w.Body.String())
+	}
+	if strings.Join(plugin.events, ",") != "message_start,content_block_delta,message_stop" {
+		t.Errorf("Expected every event to reach the plugin, got %v", plugin.events)
+	}
+	if plugin.completed != requestLog || requestLog.Response == nil {
+		t.Fatal("Expected OnComplete to receive the logged request")
+	}
+	if body := string(requestLog.Response.Body); !strings.Contains(body, "the [redacted] is out") {
+		t.Errorf("Expected the log to record what the client saw, got %s", body)
+	}
+}
+
+func TestMessagesPipeline_NonStreamingResponsePlugins(t *testing.T) {
+	pipeline, storage := setupTestMessagesPipeline(t)
+	requestLog := savedTestRequest(t, storage, "req-message")
+	plugin := &redactingPlugin{}
+
+	upstream := `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"the secret is out"}],"usage":{"input_tokens":10,"output_tokens":5}}`
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(upstream))}
+
+	w := httptest.NewRecorder()
+	pipeline.handleNonStreamingResponse(w, resp, requestLog, time.Now(), service.NewPluginRun(plugin), nil)
+
+	if w.Body.String() != strings.ReplaceAll(upstream, "secret", "[redacted]") {
+		t.Errorf("Expected the client to see the rewritten message, got %s", w.Body.String())
+	}
+	if strings.Join(plugin.events, ",") != "message" {
+		t.Errorf("Expected a single message event, got %v", plugin.events)
+	}
+	if plugin.completed != requestLog {
+		t.Fatal("Expected OnComplete to receive the logged request")
+	}
+
+	stored, _, err := storage.GetRequestByShortID("req-message")
+	if err != nil || stored == nil || stored.Response == nil {
+		t.Fatalf("GetRequestByShortID() = %+v, %v", stored, err)
+	}
+	if body := string(stored.Response.Body); strings.Contains(body, "secret") {
+		t.Errorf("Expected the stored response to be rewritten, got %s", body)
+	}
+}
@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+// routingAPI serves the config and routing endpoints. They read and change
+// the live config and model router, so both the monolith's Handler and
+// proxy-core's CoreHandler embed it.
+type routingAPI struct {
+	storageService service.StorageService
+	reloader       *service.ConfigReloader
+	configEditor   *service.ConfigEditor
+}
+
+func newRoutingAPI(storageService service.StorageService, logger *log.Logger, reloader *service.ConfigReloader) *routingAPI {
+	api := &routingAPI{
+		storageService: storageService,
+		reloader:       reloader,
+	}
+	if reloader != nil {
+		api.configEditor = service.NewConfigEditor(reloader, storageService, logger)
+	}
+	return api
+}
+
+// currentConfig returns the live config, or nil if none is loaded
+func (h *routingAPI) currentConfig() *config.Config {
+	if h.reloader == nil {
+		return nil
+	}
+	return h.reloader.Current().Config
+}
+
+// currentRouter returns the live model router, or nil if none is loaded
+func (h *routingAPI) currentRouter() *service.ModelRouter {
+	if h.reloader == nil {
+		return nil
+	}
+	return h.reloader.Current().Router
+}
+
+// ============================================================================
+// Configuration API V2
+// ============================================================================
+
+// GetConfigV2 returns the full configuration (sanitized)
+func (h *routingAPI) GetConfigV2(w http.ResponseWriter, r *http.Request) {
+	cfg := h.currentConfig()
+	if cfg == nil {
+		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Sanitize the config before returning
+	sanitized := sanitizeConfig(cfg)
+	writeJSONResponse(w, sanitized)
+}
+
+// GetProvidersV2 returns all provider configurations (sanitized)
+func (h *routingAPI) GetProvidersV2(w http.ResponseWriter, r *http.Request) {
+	cfg := h.currentConfig()
+	if cfg == nil {
+		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Create sanitized provider map
+	providers := make(map[string]*config.ProviderConfig)
+	for name, provider := range cfg.Providers {
+		providers[name] = &config.ProviderConfig{
+			Format:     provider.Format,
+			BaseURL:    provider.BaseURL,
+			Version:    provider.Version,
+			MaxRetries: provider.MaxRetries,
+			APIKey:     redactAPIKey(provider.APIKey),
+		}
+	}
+
+	// Return empty object if no providers (not null)
+	if providers == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	writeJSONResponse(w, providers)
+}
+
+// GetSubagentConfigV2 returns subagent routing configuration
+func (h *routingAPI) GetSubagentConfigV2(w http.ResponseWriter, r *http.Request) {
+	cfg := h.currentConfig()
+	if cfg == nil {
+		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Create response with subagent config
+	subagentConfig := map[string]interface{}{
+		"enable":   cfg.Subagents.Enable,
+		"mappings": cfg.Subagents.Mappings,
+	}
+
+	// Ensure mappings is never null
+	if subagentConfig["mappings"] == nil {
+		subagentConfig["mappings"] = make(map[string]string)
+	}
+
+	writeJSONResponse(w, subagentConfig)
+}
+
+// ============================================================================
+// Configuration Write API V2
+// ============================================================================
+//
+// Changes are written back to config.yaml (comments are kept), validated with
+// the same checks as startup, and applied live through the config reloader.
+// Every change is recorded as a revision that can be rolled back to. All
+// endpoints require "Authorization: Bearer <admin.api_key>".
+
+// PatchSubagentConfigV2 enables subagent routing and adds, changes, or removes
+// mappings. Body: {"enable": true, "mappings": {"reviewer": "openai:gpt-4o", "old": null}}
+func (h *routingAPI) PatchSubagentConfigV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	var patch service.SubagentsPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.configEditor.PatchSubagents(patch, configAuthor(r))
+	h.writeConfigChange(w, revision, err)
+}
+
+// PatchRoutingConfigV2 changes the default preference and adds, changes, or
+// removes provider profiles and tasks. Body: {"preferences": {"default": "cost"},
+// "provider_profiles": {"openai": {"speed": 8, "cost": 5, "quality": 9}},
+// "tasks": {"budget_tasks": null}}
+func (h *routingAPI) PatchRoutingConfigV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	var patch service.RoutingPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.configEditor.PatchRouting(patch, configAuthor(r))
+	h.writeConfigChange(w, revision, err)
+}
+
+// PutRoutingRulesV2 replaces the ordered routing rules. Body: [{"id": ..., "match": {...}, "target": ...}]
+func (h *routingAPI) PutRoutingRulesV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	var rules []config.RoutingRuleConfig
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.configEditor.ReplaceRules(rules, configAuthor(r))
+	h.writeConfigChange(w, revision, err)
+}
+
+// GetConfigRevisionsV2 lists config revisions, newest first (?limit=, default 50)
+func (h *routingAPI) GetConfigRevisionsV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+
+	revisions, err := h.configEditor.Revisions(limit)
+	if err != nil {
+		log.Printf("❌ Error getting config revisions: %v", err)
+		writeErrorResponse(w, "Failed to get config revisions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, revisions)
+}
+
+// GetConfigRevisionV2 returns a config revision including its config.yaml content
+func (h *routingAPI) GetConfigRevisionV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrorResponse(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.configEditor.Revision(id)
+	if errors.Is(err, service.ErrConfigRevisionNotFound) {
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error getting config revision: %v", err)
+		writeErrorResponse(w, "Failed to get config revision", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, revision)
+}
+
+// RollbackConfigV2 restores config.yaml to an earlier revision
+func (h *routingAPI) RollbackConfigV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrorResponse(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := h.configEditor.Rollback(id, configAuthor(r))
+	h.writeConfigChange(w, revision, err)
+}
+
+// writeConfigChange reports the outcome of a config write. A change that
+// left config.yaml as it was has no revision.
+func (h *routingAPI) writeConfigChange(w http.ResponseWriter, revision *model.ConfigRevision, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidConfigChange):
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrConfigRevisionNotFound):
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("❌ Error writing config: %v", err)
+		writeErrorResponse(w, "Failed to write config", http.StatusInternalServerError)
+		return
+	}
+
+	if revision != nil {
+		// The content can hold provider API keys; fetch the revision to see it
+		revision.Content = ""
+	}
+	writeJSONResponse(w, map[string]interface{}{
+		"changed":  revision != nil,
+		"revision": revision,
+		"config":   h.reloader.Status(),
+	})
+}
+
+// ============================================================================
+// Routing API V2 (NEW for Phase 4.1)
+// ============================================================================
+
+// GetRoutingConfigV2 returns current routing configuration including:
+// - Provider mappings
+// - Subagent routing rules
+// - Circuit breaker settings
+// - Fallback configuration
+func (h *routingAPI) GetRoutingConfigV2(w http.ResponseWriter, r *http.Request) {
+	cfg := h.currentConfig()
+	if cfg == nil {
+		writeErrorResponse(w, "Configuration not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Build routing configuration response
+	routingConfig := map[string]interface{}{
+		"providers": make(map[string]interface{}),
+		"subagents": map[string]interface{}{
+			"enable":   cfg.Subagents.Enable,
+			"mappings": cfg.Subagents.Mappings,
+		},
+	}
+
+	// Add provider routing details
+	providers := make(map[string]interface{})
+	for name, providerCfg := range cfg.Providers {
+		providers[name] = map[string]interface{}{
+			"format":            providerCfg.Format,
+			"base_url":          providerCfg.BaseURL,
+			"max_retries":       providerCfg.MaxRetries,
+			"fallback_provider": providerCfg.FallbackProvider,
+			"circuit_breaker": map[string]interface{}{
+				"enabled":      providerCfg.CircuitBreaker.Enabled,
+				"max_failures": providerCfg.CircuitBreaker.MaxFailures,
+				"timeout":      providerCfg.CircuitBreaker.TimeoutDuration.String(),
+			},
+		}
+	}
+	routingConfig["providers"] = providers
+	routingConfig["rules"] = cfg.Routing.Rules
+	routingConfig["context_windows"] = cfg.Routing.ContextWindows
+	routingConfig["experiments"] = cfg.Routing.Experiments
+	routingConfig["projects"] = cfg.Routing.Projects
+	routingConfig["model_aliases"] = cfg.ModelAliases
+
+	// Ensure mappings is never null
+	if routingConfig["subagents"].(map[string]interface{})["mappings"] == nil {
+		subagents := routingConfig["subagents"].(map[string]interface{})
+		subagents["mappings"] = make(map[string]string)
+	}
+
+	writeJSONResponse(w, routingConfig)
+}
+
+// GetProviderStatusV2 returns real-time provider health status including:
+// - Circuit breaker state (open/closed/half-open)
+// - Fallback provider configuration
+// - Health status
+// - Last successful and failed active probe (when health checks are enabled)
+func (h *routingAPI) GetProviderStatusV2(w http.ResponseWriter, r *http.Request) {
+	router := h.currentRouter()
+	if router == nil {
+		writeErrorResponse(w, "Model router not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Get provider health from model router
+	providerHealth := router.GetProviderHealth()
+
+	// Sort by name for consistent ordering
+	sort.Slice(providerHealth, func(i, j int) bool {
+		return providerHealth[i].Name < providerHealth[j].Name
+	})
+
+	writeJSONResponse(w, providerHealth)
+}
+
+// GetHealthChecksV2 returns recent active health probe results for a
+// provider, newest first (?limit=, default 50)
+func (h *routingAPI) GetHealthChecksV2(w http.ResponseWriter, r *http.Request) {
+	router := h.currentRouter()
+	if router == nil || router.HealthChecker() == nil {
+		writeErrorResponse(w, "Health checks not available", http.StatusInternalServerError)
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+
+	checks, err := router.HealthChecker().History(mux.Vars(r)["name"], limit)
+	if err != nil {
+		log.Printf("❌ Error getting health checks: %v", err)
+		writeErrorResponse(w, "Failed to get health checks", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, checks)
+}
+
+// SetCircuitBreakerV2 forces a provider's circuit breaker open or closed, or
+// returns it to automatic control. Body: {"state": "open|closed|auto", "model": "..."}
+// where model is optional and targets a per-model breaker. Like the config
+// write API, it needs the admin API key.
+func (h *routingAPI) SetCircuitBreakerV2(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.currentConfig()) {
+		return
+	}
+
+	router := h.currentRouter()
+	if router == nil {
+		writeErrorResponse(w, "Model router not available", http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		State string `json:"state"`
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	override, err := provider.ParseCircuitOverride(body.State)
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	providerName := mux.Vars(r)["name"]
+	if err := router.SetCircuitBreakerOverride(providerName, body.Model, override); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrUnknownProvider) {
+			status = http.StatusNotFound
+		}
+		writeErrorResponse(w, err.Error(), status)
+		return
+	}
+
+	log.Printf("🛠️  Circuit breaker for provider '%s' set to %s (model: %q)", providerName, override, body.Model)
+	for _, health := range router.GetProviderHealth() {
+		if health.Name == providerName {
+			writeJSONResponse(w, health)
+			return
+		}
+	}
+	writeJSONResponse(w, map[string]string{"status": "ok"})
+}
+
+// ExplainRouteV2 shows how a request would be routed without forwarding it.
+// Body: an Anthropic request, or {"request_id": "..."} to replay a logged one.
+func (h *routingAPI) ExplainRouteV2(w http.ResponseWriter, r *http.Request) {
+	router := h.currentRouter()
+	if router == nil {
+		writeErrorResponse(w, "Model router not available", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	var replay struct {
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(body, &replay)
+
+	headers := r.Header
+	if replay.RequestID != "" {
+		logged, _, err := h.storageService.GetRequestByShortID(replay.RequestID)
+		if err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if body, err = json.Marshal(logged.Body); err != nil {
+			writeErrorResponse(w, "Logged request body is not valid JSON", http.StatusUnprocessableEntity)
+			return
+		}
+		headers = http.Header(logged.Headers)
+	}
+
+	var req model.AnthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Model == "" {
+		writeErrorResponse(w, "Body must be an Anthropic messages request or {\"request_id\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	writeJSONResponse(w, router.Explain(&req, headers, rateLimitClientKey(r)))
+}
+
+// GetRoutingStatsV2 returns routing statistics including:
+// - Requests per provider
+// - Circuit breaker trips
+// - Fallback activations
+// - Average response times per provider
+// - Effective load balancer weights (adjusted live when adaptive weights are enabled)
+func (h *routingAPI) GetRoutingStatsV2(w http.ResponseWriter, r *http.Request) {
+	startTime := r.URL.Query().Get("start")
+	endTime := r.URL.Query().Get("end")
+	project := r.URL.Query().Get("project")
+
+	if startTime == "" || endTime == "" {
+		// Default to last 24 hours if not specified
+		now := time.Now()
+		endTime = now.Format(time.RFC3339)
+		startTime = now.AddDate(0, 0, -1).Format(time.RFC3339)
+	}
+
+	// Get provider stats from storage service
+	providerStats, err := h.storageService.GetProviderStats(startTime, endTime, project)
+	if err != nil {
+		log.Printf("Error getting routing stats: %v", err)
+		writeStorageError(w, err, "Failed to get routing stats")
+		return
+	}
+
+	// Add subagent stats
+	subagentStats, err := h.storageService.GetSubagentStats(startTime, endTime, project)
+	if err != nil {
+		log.Printf("Error getting subagent stats: %v", err)
+		// Continue with just provider stats
+		subagentStats = &model.SubagentStatsResponse{
+			Subagents: []model.SubagentStats{},
+		}
+	}
+
+	// Build comprehensive routing stats
+	routingStats := map[string]interface{}{
+		"providers": providerStats,
+		"subagents": subagentStats,
+		"timeRange": map[string]string{
+			"start": startTime,
+			"end":   endTime,
+		},
+	}
+	if router := h.currentRouter(); router != nil {
+		routingStats["weights"] = router.ProviderWeights()
+	}
+
+	writeJSONResponse(w, routingStats)
+}
@@ -2,15 +2,316 @@ package handler
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
+// statusOverloaded is Anthropic's non-standard "overloaded" HTTP status
+const statusOverloaded = 529
+
+// writeAnthropicError writes an error in the Anthropic API's shape, so
+// clients like Claude Code apply their usual retry handling
+func writeAnthropicError(w http.ResponseWriter, statusCode int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+}
+
+// rateLimitClientKey identifies the caller for per-client rate limits: the
+// API key it sent, or its address when it sent none
+func rateLimitClientKey(r *http.Request) string {
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// requireAdmin checks the config write API's Bearer token. The API stays
+// disabled until admin.api_key (or ADMIN_API_KEY) is set.
+func requireAdmin(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	if cfg == nil || cfg.Admin.APIKey == "" {
+		writeErrorResponse(w, "Config write API is disabled; set admin.api_key in config.yaml", http.StatusForbidden)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Admin.APIKey)) != 1 {
+		writeErrorResponse(w, "Invalid admin API key", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// configAuthor names who made a config change for its revision: the
+// X-Config-Author header, or the client address
+func configAuthor(r *http.Request) string {
+	if author := r.Header.Get("X-Config-Author"); author != "" {
+		return author
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// rateLimitSessionID returns the Claude Code session identifier from the
+// request metadata, or "" if there is none
+func rateLimitSessionID(req *model.AnthropicRequest) string {
+	if req.Metadata == nil {
+		return ""
+	}
+	return req.Metadata.UserID
+}
+
+// newRejectedRequestLog builds the request log for a request turned away
+// before it was routed
+func newRejectedRequestLog(r *http.Request, requestID string, startTime time.Time, req *model.AnthropicRequest) *model.RequestLog {
+	return &model.RequestLog{
+		RequestID:     requestID,
+		Timestamp:     startTime.Format(time.RFC3339),
+		Method:        r.Method,
+		Endpoint:      r.URL.Path,
+		Headers:       SanitizeHeaders(r.Header),
+		Body:          *req,
+		Model:         req.Model,
+		OriginalModel: req.Model,
+		ProjectPath:   service.RequestProjectPath(req),
+		UserAgent:     r.Header.Get("User-Agent"),
+		ContentType:   r.Header.Get("Content-Type"),
+	}
+}
+
+// rejectRateLimited answers with an Anthropic rate_limit_error and records
+// the rejected request, so it shows up alongside forwarded traffic
+func rejectRateLimited(w http.ResponseWriter, storage service.StorageService, requestLog *model.RequestLog, limitErr *service.RateLimitError, stream bool) {
+	log.Printf("🚦 Rate limited request %s: %v", requestLog.RequestID, limitErr)
+
+	requestLog.RateLimit = &model.RateLimitInfo{
+		Scope:        limitErr.Scope,
+		Limit:        limitErr.Limit,
+		RetryAfterMs: limitErr.RetryAfter.Milliseconds(),
+	}
+	w.Header().Set("retry-after", fmt.Sprintf("%d", limitErr.RetryAfterSeconds()))
+	recordRejection(w, storage, requestLog, http.StatusTooManyRequests, "rate_limit_error", limitErr.Error(), stream)
+}
+
+// rejectByRule answers a request matched by a reject routing rule
+func rejectByRule(w http.ResponseWriter, storage service.StorageService, requestLog *model.RequestLog, ruleErr *service.RuleRejectError, stream bool) {
+	requestLog.RoutingRule = ruleErr.RuleID
+	recordRejection(w, storage, requestLog, http.StatusForbidden, "permission_error", ruleErr.Error(), stream)
+}
+
+// rejectContextOverflow answers a request too large for the routed model's
+// context window
+func rejectContextOverflow(w http.ResponseWriter, storage service.StorageService, requestLog *model.RequestLog, overflowErr *service.ContextOverflowError, stream bool) {
+	recordRejection(w, storage, requestLog, http.StatusBadRequest, "invalid_request_error", overflowErr.Error(), stream)
+}
+
+// recordRejection saves a request the proxy refused to forward, along with
+// the error response it was given, then writes that response
+func recordRejection(w http.ResponseWriter, storage service.StorageService, requestLog *model.RequestLog, statusCode int, errorType, message string, stream bool) {
+	if _, err := storage.SaveRequest(requestLog); err != nil {
+		log.Printf("❌ Error saving request: %v", err)
+	}
+
+	errorBody, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+	requestLog.Response = &model.ResponseLog{
+		StatusCode:  statusCode,
+		Body:        errorBody,
+		IsStreaming: stream,
+		CompletedAt: time.Now().Format(time.RFC3339),
+	}
+	if err := storage.UpdateRequestWithResponse(requestLog); err != nil {
+		log.Printf("❌ Error updating request with response: %v", err)
+	}
+
+	writeAnthropicError(w, statusCode, errorType, message)
+}
+
+// writeStorageError answers a failed storage query. Queries the storage
+// backend cannot run (analytics and search on jsonl) are 501 Not Implemented
+// rather than a server error.
+func writeStorageError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, service.ErrNotSupported) {
+		writeErrorResponse(w, message+": this needs storage.backend: sqlite", http.StatusNotImplemented)
+		return
+	}
+	writeErrorResponse(w, message, http.StatusInternalServerError)
+}
+
+// writeExperimentResults answers /api/v2/experiments/{id}/results. start
+// and end are optional; experiments removed from the config still report
+// the traffic they assigned, without cost estimates.
+func writeExperimentResults(w http.ResponseWriter, r *http.Request, storage service.StorageService, experiments *service.Experiments) {
+	id := mux.Vars(r)["id"]
+	results, err := storage.GetExperimentResults(id, r.URL.Query().Get("start"), r.URL.Query().Get("end"))
+	if err != nil {
+		log.Printf("Error getting experiment results: %v", err)
+		writeStorageError(w, err, "Failed to get experiment results")
+		return
+	}
+
+	experiment := experiments.Experiment(id)
+	if experiment == nil && len(results.Arms) == 0 {
+		writeErrorResponse(w, "Experiment not found", http.StatusNotFound)
+		return
+	}
+	results.Active = experiment != nil
+	service.AddExperimentCosts(results, experiment)
+	writeJSONResponse(w, results)
+}
+
+// applyResponseEventPlugins runs the response event plugins on one SSE
+// "data:" line and returns the line to send on
+func applyResponseEventPlugins(plugins *service.PluginRun, line string) string {
+	if plugins == nil {
+		return line
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	var header struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal([]byte(data), &header)
+
+	event := &service.ResponseEvent{Type: header.Type, Data: []byte(data)}
+	plugins.OnResponseEvent(event)
+	return "data: " + string(event.Data)
+}
+
+// applyResponseMessagePlugins runs the response event plugins on a
+// non-streaming response body
+func applyResponseMessagePlugins(plugins *service.PluginRun, body []byte) []byte {
+	if plugins == nil {
+		return body
+	}
+	event := &service.ResponseEvent{Type: "message", Data: body}
+	plugins.OnResponseEvent(event)
+	return event.Data
+}
+
+// saveToolPolicyHits stores the tool calls the request's policies matched,
+// tagged with the request they came from
+func saveToolPolicyHits(storage service.StorageService, requestLog *model.RequestLog, policies *service.ToolPolicyRun) {
+	hits := policies.Hits()
+	if len(hits) == 0 {
+		return
+	}
+	for _, hit := range hits {
+		hit.RequestID = requestLog.RequestID
+		hit.Provider = requestLog.Provider
+		hit.Model = requestLog.RoutedModel
+		hit.SubagentName = requestLog.SubagentName
+		hit.ProjectPath = requestLog.ProjectPath
+		log.Printf("🛡️ Tool policy '%s' matched a %s call (%s)", hit.Policy, hit.ToolName, hit.Action)
+	}
+	if err := storage.SaveToolPolicyHits(hits); err != nil {
+		log.Printf("❌ Error saving tool policy hits: %v", err)
+	}
+}
+
+// writeToolPolicyHits answers /api/v2/tool-policies/hits, filtered by
+// ?policy=, ?action=, ?request_id=, ?start=, and ?end= (?limit=, default 100)
+func writeToolPolicyHits(w http.ResponseWriter, r *http.Request, storage service.StorageService) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	hits, err := storage.GetToolPolicyHits(model.ToolPolicyHitFilter{
+		Policy:    query.Get("policy"),
+		Action:    query.Get("action"),
+		RequestID: query.Get("request_id"),
+		StartTime: query.Get("start"),
+		EndTime:   query.Get("end"),
+		Limit:     limit,
+	})
+	if err != nil {
+		log.Printf("Error getting tool policy hits: %v", err)
+		writeErrorResponse(w, "Failed to get tool policy hits", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{"hits": hits})
+}
+
+// writeToolCalls answers /api/v2/tool-calls, filtered by ?tool=,
+// ?provider=, ?model=, ?subagent=, ?session=, ?project=, ?is_error=, ?start=,
+// and ?end= (?limit=, default 100, and ?offset=)
+func writeToolCalls(w http.ResponseWriter, r *http.Request, storage service.StorageService) {
+	query := r.URL.Query()
+	filter := model.ToolCallFilter{
+		ToolName:     query.Get("tool"),
+		Provider:     query.Get("provider"),
+		Model:        query.Get("model"),
+		SubagentName: query.Get("subagent"),
+		SessionID:    query.Get("session"),
+		ProjectPath:  query.Get("project"),
+		StartTime:    query.Get("start"),
+		EndTime:      query.Get("end"),
+	}
+	if isError := query.Get("is_error"); isError != "" {
+		value, err := strconv.ParseBool(isError)
+		if err != nil {
+			writeErrorResponse(w, "is_error must be true or false", http.StatusBadRequest)
+			return
+		}
+		filter.IsError = &value
+	}
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	filter.Offset, _ = strconv.Atoi(query.Get("offset"))
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	calls, total, err := storage.GetToolCalls(filter)
+	if err != nil {
+		log.Printf("Error getting tool calls: %v", err)
+		writeStorageError(w, err, "Failed to get tool calls")
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{
+		"toolCalls": calls,
+		"total":     total,
+		"offset":    filter.Offset,
+		"limit":     filter.Limit,
+	})
+}
+
 // SanitizeHeaders removes sensitive headers before logging/storage
 func SanitizeHeaders(headers http.Header) http.Header {
 	sanitized := make(http.Header)
@@ -269,3 +570,37 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+// streamFailureTracker watches a streaming response for failures after the
+// first content event. Failures before that point are detected (and retried)
+// by the resilient provider, which records them as pre_stream.
+type streamFailureTracker struct {
+	provider       string
+	contentStarted bool
+}
+
+// observe inspects one parsed SSE event
+func (t *streamFailureTracker) observe(event map[string]interface{}) {
+	switch event["type"] {
+	case "content_block_start", "content_block_delta":
+		t.contentStarted = true
+	case "error":
+		if !t.contentStarted {
+			return
+		}
+		reason := "api_error"
+		if errObj, ok := event["error"].(map[string]interface{}); ok {
+			if errType, ok := errObj["type"].(string); ok && errType != "" {
+				reason = errType
+			}
+		}
+		metrics.RecordStreamFailure(t.provider, provider.StreamPhaseMidStream, reason)
+	}
+}
+
+// finish records a broken stream once content had started flowing
+func (t *streamFailureTracker) finish(err error) {
+	if err != nil && t.contentStarted {
+		metrics.RecordStreamFailure(t.provider, provider.StreamPhaseMidStream, "disconnect")
+	}
+}
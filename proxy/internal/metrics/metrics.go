@@ -53,6 +53,246 @@ var (
 		[]string{"provider"},
 	)
 
+	// RetryByClassTotal counts retry attempts by the class of error that triggered them
+	RetryByClassTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_retry_by_class_total",
+			Help: "Total number of retry attempts by error class",
+		},
+		[]string{"provider", "class"},
+	)
+
+	// RetryBudgetExhaustedTotal counts retries denied by the retry budget
+	RetryBudgetExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_retry_budget_exhausted_total",
+			Help: "Total number of retries skipped because the retry budget was exhausted",
+		},
+		[]string{"provider", "class"},
+	)
+
+	// StreamFailuresTotal counts streaming failures, split by whether they
+	// happened before the first content event (recoverable) or mid-stream
+	StreamFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_stream_failures_total",
+			Help: "Total number of streaming failures by phase (pre_stream, mid_stream) and reason",
+		},
+		[]string{"provider", "phase", "reason"},
+	)
+
+	// StreamRecoveriesTotal counts pre-stream failures that were recovered
+	// by a retry or fallback before the client saw any bytes
+	StreamRecoveriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_stream_recoveries_total",
+			Help: "Total number of streaming requests recovered after a pre-stream failure",
+		},
+		[]string{"provider"},
+	)
+
+	// HedgeEligibleTotal counts requests that qualified for hedging; together
+	// with HedgeFiredTotal it gives the hedge rate
+	HedgeEligibleTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedge_eligible_total",
+			Help: "Total number of requests eligible for hedging",
+		},
+		[]string{"provider"},
+	)
+
+	// HedgeFiredTotal counts hedge requests actually sent
+	HedgeFiredTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedge_fired_total",
+			Help: "Total number of hedge requests sent to a second provider",
+		},
+		[]string{"provider", "hedge_provider"},
+	)
+
+	// HedgeWinsTotal counts which side of a hedged request was served
+	HedgeWinsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedge_wins_total",
+			Help: "Total number of hedged requests by winner (primary, hedge)",
+		},
+		[]string{"provider", "winner"},
+	)
+
+	// HedgeExtraTokensTotal estimates the input tokens spent on cancelled hedge losers
+	HedgeExtraTokensTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedge_extra_input_tokens_total",
+			Help: "Estimated input tokens sent to providers whose hedged response was discarded",
+		},
+		[]string{"provider"},
+	)
+
+	// ProviderWeight tracks the effective load balancer weight per provider
+	ProviderWeight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_provider_weight",
+			Help: "Effective load balancer weight per provider",
+		},
+		[]string{"provider"},
+	)
+
+	// HealthProbesTotal counts active health probes by result
+	HealthProbesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_health_probes_total",
+			Help: "Active provider health probes by result",
+		},
+		[]string{"provider", "result"},
+	)
+
+	// HealthProbeDuration tracks active health probe latency
+	HealthProbeDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_health_probe_duration_seconds",
+			Help:    "Active provider health probe latency in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"provider"},
+	)
+
+	// ConcurrencyInFlight tracks requests holding a bulkhead slot
+	ConcurrencyInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_concurrency_in_flight",
+			Help: "Requests holding a concurrency slot per bulkhead (provider or provider:model)",
+		},
+		[]string{"bulkhead"},
+	)
+
+	// QueueDepth tracks requests waiting for a bulkhead slot
+	QueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_queue_depth",
+			Help: "Requests waiting for a concurrency slot per bulkhead and priority",
+		},
+		[]string{"bulkhead", "priority"},
+	)
+
+	// QueueWaitDuration tracks time spent waiting for a bulkhead slot
+	QueueWaitDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_queue_wait_seconds",
+			Help:    "Time spent waiting for a concurrency slot in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"bulkhead", "priority"},
+	)
+
+	// QueueRejectionsTotal counts requests turned away by a bulkhead
+	QueueRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_queue_rejections_total",
+			Help: "Requests rejected by a bulkhead (queue_full or timeout)",
+		},
+		[]string{"bulkhead", "priority", "reason"},
+	)
+
+	// RoutingRuleMatchesTotal counts requests matched by each routing rule
+	RoutingRuleMatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_routing_rule_matches_total",
+			Help: "Requests matched by a routing rule per rule ID and action (route, reject)",
+		},
+		[]string{"rule", "action"},
+	)
+
+	// ModelAliasRewritesTotal counts requests whose model was rewritten by an alias
+	ModelAliasRewritesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_model_alias_rewrites_total",
+			Help: "Requests whose model was rewritten by a model_aliases entry per pattern and target",
+		},
+		[]string{"alias", "target"},
+	)
+
+	// ContextOverflowsTotal counts requests too large for the routed model's context window
+	ContextOverflowsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_context_overflows_total",
+			Help: "Requests too large for the routed model's context window per subagent (main for the main agent) and action (rerouted, rejected)",
+		},
+		[]string{"subagent", "action"},
+	)
+
+	// ProjectRoutesTotal counts requests routed or restricted by routing.projects
+	ProjectRoutesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_project_routes_total",
+			Help: "Requests routed by a routing.projects entry per project and action (routed, restricted)",
+		},
+		[]string{"project", "action"},
+	)
+
+	// PluginsAppliedTotal counts requests each plugin changed
+	PluginsAppliedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_plugins_applied_total",
+			Help: "Requests changed by each /v1/messages plugin",
+		},
+		[]string{"plugin"},
+	)
+
+	// RedactionsTotal counts secrets and personal data masked before storage
+	RedactionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_redactions_total",
+			Help: "Matches masked before storage per detector and source (request, response, conversation)",
+		},
+		[]string{"detector", "source"},
+	)
+
+	// CacheBreakpointsTotal counts cache_control breakpoints added by the
+	// prompt-caching optimizer
+	CacheBreakpointsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_cache_breakpoints_total",
+			Help: "Prompt-caching breakpoints added to requests per provider",
+		},
+		[]string{"provider"},
+	)
+
+	// ToolPolicyHitsTotal counts tool calls each tool policy matched
+	ToolPolicyHitsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_tool_policy_hits_total",
+			Help: "Tool calls matched by each tool policy, by the action taken",
+		},
+		[]string{"policy", "action"},
+	)
+
+	// ExperimentAssignmentsTotal counts requests assigned to each experiment arm
+	ExperimentAssignmentsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_experiment_assignments_total",
+			Help: "Requests assigned to a traffic-split experiment per experiment and arm",
+		},
+		[]string{"experiment", "arm"},
+	)
+
+	// RateLimitRejectionsTotal counts inbound requests rejected by a rate limit
+	RateLimitRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_rate_limit_rejections_total",
+			Help: "Inbound requests rejected by a rate limit per scope (global, client, session) and limit (requests, tokens)",
+		},
+		[]string{"scope", "limit"},
+	)
+
+	// ConfigReloadsTotal counts config.yaml reload attempts
+	ConfigReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_config_reloads_total",
+			Help: "config.yaml reload attempts per result (success, failure)",
+		},
+		[]string{"result"},
+	)
+
 	// CircuitBreakerStateChanges counts state transitions
 	CircuitBreakerStateChanges = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -84,6 +324,139 @@ func RecordRetry(provider string) {
 	RetryTotal.WithLabelValues(provider).Inc()
 }
 
+// RecordRetryClass records a retry attempt triggered by the given error class
+func RecordRetryClass(provider, class string) {
+	RetryByClassTotal.WithLabelValues(provider, class).Inc()
+}
+
+// RecordRetryBudgetExhausted records a retry denied by the retry budget
+func RecordRetryBudgetExhausted(provider, class string) {
+	RetryBudgetExhaustedTotal.WithLabelValues(provider, class).Inc()
+}
+
+// RecordStreamFailure records a streaming failure in the given phase
+func RecordStreamFailure(provider, phase, reason string) {
+	StreamFailuresTotal.WithLabelValues(provider, phase, reason).Inc()
+}
+
+// RecordStreamRecovery records a stream served after a pre-stream failure
+func RecordStreamRecovery(provider string) {
+	StreamRecoveriesTotal.WithLabelValues(provider).Inc()
+}
+
+// RecordHedgeEligible records a request that qualified for hedging
+func RecordHedgeEligible(provider string) {
+	HedgeEligibleTotal.WithLabelValues(provider).Inc()
+}
+
+// RecordHedgeFired records a hedge request sent to a second provider
+func RecordHedgeFired(provider, hedgeProvider string) {
+	HedgeFiredTotal.WithLabelValues(provider, hedgeProvider).Inc()
+}
+
+// RecordHedgeOutcome records the winner of a hedged request and the
+// estimated input tokens wasted on the loser
+func RecordHedgeOutcome(provider, winner, loserProvider string, extraTokens int) {
+	HedgeWinsTotal.WithLabelValues(provider, winner).Inc()
+	HedgeExtraTokensTotal.WithLabelValues(loserProvider).Add(float64(extraTokens))
+}
+
+// UpdateProviderWeight updates the effective load balancer weight gauge
+func UpdateProviderWeight(provider string, weight int) {
+	ProviderWeight.WithLabelValues(provider).Set(float64(weight))
+}
+
+// RecordHealthProbe records the result and latency of an active health probe
+func RecordHealthProbe(provider string, success bool, durationSeconds float64) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	HealthProbesTotal.WithLabelValues(provider, result).Inc()
+	HealthProbeDuration.WithLabelValues(provider).Observe(durationSeconds)
+}
+
+// UpdateConcurrency updates the in-flight and queue depth gauges for a bulkhead
+func UpdateConcurrency(bulkhead string, inFlight int, queued map[string]int) {
+	ConcurrencyInFlight.WithLabelValues(bulkhead).Set(float64(inFlight))
+	for priority, depth := range queued {
+		QueueDepth.WithLabelValues(bulkhead, priority).Set(float64(depth))
+	}
+}
+
+// RecordQueueWait records how long a request waited for a bulkhead slot
+func RecordQueueWait(bulkhead, priority string, durationSeconds float64) {
+	QueueWaitDuration.WithLabelValues(bulkhead, priority).Observe(durationSeconds)
+}
+
+// RecordQueueRejection records a request turned away by a bulkhead
+func RecordQueueRejection(bulkhead, priority, reason string) {
+	QueueRejectionsTotal.WithLabelValues(bulkhead, priority, reason).Inc()
+}
+
+// RecordRoutingRuleMatch records a request matched by a routing rule
+func RecordRoutingRuleMatch(rule, action string) {
+	RoutingRuleMatchesTotal.WithLabelValues(rule, action).Inc()
+}
+
+// RecordModelAliasRewrite records a request rewritten by a model alias
+func RecordModelAliasRewrite(alias, target string) {
+	ModelAliasRewritesTotal.WithLabelValues(alias, target).Inc()
+}
+
+// RecordContextOverflow records a request too large for the routed model
+func RecordContextOverflow(subagent, action string) {
+	if subagent == "" {
+		subagent = "main"
+	}
+	ContextOverflowsTotal.WithLabelValues(subagent, action).Inc()
+}
+
+// RecordProjectRoute records a request a routing.projects entry routed, or
+// moved to a provider the project allows
+func RecordProjectRoute(project, action string) {
+	ProjectRoutesTotal.WithLabelValues(project, action).Inc()
+}
+
+// RecordPluginApplied records a request a plugin changed
+func RecordPluginApplied(plugin string) {
+	PluginsAppliedTotal.WithLabelValues(plugin).Inc()
+}
+
+// RecordRedactions records matches a redaction detector masked
+func RecordRedactions(detector, source string, count int) {
+	RedactionsTotal.WithLabelValues(detector, source).Add(float64(count))
+}
+
+// RecordCacheBreakpoints records breakpoints added to a request
+func RecordCacheBreakpoints(provider string, count int) {
+	CacheBreakpointsTotal.WithLabelValues(provider).Add(float64(count))
+}
+
+// RecordToolPolicyHit records a tool call a tool policy matched
+func RecordToolPolicyHit(policy, action string) {
+	ToolPolicyHitsTotal.WithLabelValues(policy, action).Inc()
+}
+
+// RecordExperimentAssignment records a request assigned to an experiment arm
+func RecordExperimentAssignment(experiment, arm string) {
+	ExperimentAssignmentsTotal.WithLabelValues(experiment, arm).Inc()
+}
+
+// RecordRateLimitRejection records an inbound request rejected by a rate limit
+func RecordRateLimitRejection(scope, limit string) {
+	RateLimitRejectionsTotal.WithLabelValues(scope, limit).Inc()
+}
+
+// RecordConfigReload records a config.yaml reload attempt
+func RecordConfigReload(success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	ConfigReloadsTotal.WithLabelValues(result).Inc()
+}
+
 // RecordCircuitBreakerStateChange records a circuit breaker state transition
 func RecordCircuitBreakerStateChange(provider, fromState, toState string) {
 	CircuitBreakerStateChanges.WithLabelValues(provider, fromState, toState).Inc()
@@ -42,6 +42,42 @@ type RequestLog struct {
 	ContentType     string              `json:"contentType"`
 	PromptGrade     *PromptGrade        `json:"promptGrade,omitempty"`
 	Response        *ResponseLog        `json:"response,omitempty"`
+	Hedge           *HedgeInfo          `json:"hedge,omitempty"` // Set when a hedge request was sent
+	Queue           *QueueInfo          `json:"queue,omitempty"` // Set when the provider has concurrency limits
+	RateLimit       *RateLimitInfo      `json:"rateLimit,omitempty"` // Set when the proxy rejected the request for exceeding a rate limit
+	RoutingRule     string              `json:"routingRule,omitempty"` // ID of the routing rule that matched, if any
+	Experiment      string              `json:"experiment,omitempty"`    // ID of the experiment that assigned this request, if any
+	ExperimentArm   string              `json:"experimentArm,omitempty"` // Arm of that experiment
+	ProjectPath     string              `json:"projectPath,omitempty"`   // Claude Code working directory, if the request reported one
+	Plugins         []string            `json:"plugins,omitempty"`       // Plugins that changed the request, in the order they ran
+	Redactions      map[string]int      `json:"redactions,omitempty"`    // Matches masked per detector before the request and response were stored
+	Breakpoints     int                 `json:"cacheBreakpoints,omitempty"` // cache_control breakpoints the prompt-caching optimizer added
+}
+
+// HedgeInfo describes a hedged request: when the hedge was sent, where it
+// went, and which response was served
+type HedgeInfo struct {
+	DelayMs          int64  `json:"delayMs"`                    // Time waited for the primary before hedging
+	HedgeProvider    string `json:"hedgeProvider"`              // Provider the hedge was sent to
+	HedgeModel       string `json:"hedgeModel"`                 // Model the hedge was sent with
+	Winner           string `json:"winner"`                     // "primary" or "hedge"
+	ExtraInputTokens int    `json:"extraInputTokens,omitempty"` // Estimated input tokens spent on the discarded response
+}
+
+// QueueInfo describes a request's pass through a provider's concurrency
+// limits: how many requests were ahead of it and how long it waited
+type QueueInfo struct {
+	Priority string `json:"priority"` // "main" or "subagent"
+	Depth    int    `json:"depth"`    // Requests ahead in the queue when it arrived (0 = no wait)
+	WaitMs   int64  `json:"waitMs"`   // Time spent waiting for a slot
+}
+
+// RateLimitInfo describes an inbound rate limit rejection. It distinguishes
+// requests the proxy turned away from upstream 429 responses.
+type RateLimitInfo struct {
+	Scope        string `json:"scope"`        // "global", "client", or "session"
+	Limit        string `json:"limit"`        // "requests" or "tokens"
+	RetryAfterMs int64  `json:"retryAfterMs"` // Time until the request would fit in the bucket
 }
 
 // RequestSummary is a lightweight version of RequestLog for list views
@@ -61,6 +97,7 @@ type RequestSummary struct {
 	ResponseTime     int64           `json:"responseTime,omitempty"`
 	FirstByteTime    int64           `json:"firstByteTime,omitempty"` // Time to first token (streaming)
 	Usage            *AnthropicUsage `json:"usage,omitempty"`
+	ProjectPath      string          `json:"projectPath,omitempty"`
 }
 
 type ResponseLog struct {
@@ -150,9 +187,10 @@ type CacheControl struct {
 }
 
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"input_schema"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	InputSchema  InputSchema   `json:"input_schema"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 type InputSchema struct {
@@ -170,6 +208,13 @@ type AnthropicRequest struct {
 	Stream      bool                     `json:"stream,omitempty"`
 	Tools       []Tool                   `json:"tools,omitempty"`
 	ToolChoice  interface{}              `json:"tool_choice,omitempty"`
+	Metadata    *AnthropicMetadata       `json:"metadata,omitempty"`
+}
+
+// AnthropicMetadata is the request metadata object. Claude Code puts a
+// per-session identifier in user_id.
+type AnthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
 }
 
 type ModelsResponse struct {
@@ -191,8 +236,19 @@ type GradeRequest struct {
 }
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
+	Status    string              `json:"status"`
+	Config    *ConfigReloadStatus `json:"config,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// ConfigReloadStatus reports which config.yaml is live and whether the most
+// recent reload was rejected
+type ConfigReloadStatus struct {
+	Path        string     `json:"path"`
+	Generation  int        `json:"generation"`
+	LoadedAt    time.Time  `json:"loaded_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -263,6 +319,128 @@ type ModelTokens struct {
 	Requests int    `json:"requests"`
 }
 
+// ProviderHealthCheck is the result of one active health probe
+type ProviderHealthCheck struct {
+	ID         int64     `json:"id"`
+	Provider   string    `json:"provider"`
+	Method     string    `json:"method"`
+	CheckedAt  time.Time `json:"checkedAt"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	LatencyMs  int64     `json:"latencyMs"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ToolPolicyHit is a tool call a tool policy matched. Action is what the
+// policy did: block, confirm, or annotate, or confirmed when the user had
+// already approved the call.
+type ToolPolicyHit struct {
+	ID           int64           `json:"id"`
+	RequestID    string          `json:"requestId"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Policy       string          `json:"policy"`
+	Action       string          `json:"action"`
+	ToolName     string          `json:"toolName"`
+	ToolUseID    string          `json:"toolUseId"`
+	Input        json.RawMessage `json:"input"`
+	Provider     string          `json:"provider,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	SubagentName string          `json:"subagentName,omitempty"`
+	ProjectPath  string          `json:"projectPath,omitempty"`
+}
+
+// ToolPolicyHitFilter narrows a tool policy hit listing; empty fields match
+// everything
+type ToolPolicyHitFilter struct {
+	Policy    string
+	Action    string
+	RequestID string
+	StartTime string
+	EndTime   string
+	Limit     int
+}
+
+// ToolCall is one tool_use a model emitted, with the tool_result that
+// answered it once one is seen. Calls come from proxied traffic (Source
+// "proxy") or indexed conversations ("conversation").
+type ToolCall struct {
+	ID              int64           `json:"id"`
+	ToolUseID       string          `json:"toolUseId"`
+	RequestID       string          `json:"requestId,omitempty"`       // Request whose response emitted the call
+	ResultRequestID string          `json:"resultRequestId,omitempty"` // Request that carried the result
+	Timestamp       string          `json:"timestamp"`
+	SessionID       string          `json:"sessionId,omitempty"`
+	SubagentName    string          `json:"subagentName,omitempty"`
+	Provider        string          `json:"provider,omitempty"`
+	Model           string          `json:"model,omitempty"`
+	ProjectPath     string          `json:"projectPath,omitempty"`
+	ToolName        string          `json:"toolName"`
+	Input           json.RawMessage `json:"input,omitempty"`
+	HasResult       bool            `json:"hasResult"`
+	IsError         bool            `json:"isError"`
+	ResultSize      int             `json:"resultSize"` // Bytes of result content
+	ResultAt        string          `json:"resultAt,omitempty"`
+	Source          string          `json:"source"`
+}
+
+// ToolCallFilter narrows a tool call listing; empty fields match everything
+type ToolCallFilter struct {
+	ToolName     string
+	Provider     string
+	Model        string
+	SubagentName string
+	SessionID    string
+	ProjectPath  string
+	StartTime    string
+	EndTime      string
+	IsError      *bool
+	Offset       int
+	Limit        int
+}
+
+// ConfigRevision is one change made through the config write API. Content is
+// the full config.yaml after the change, so any revision can be restored.
+type ConfigRevision struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Author    string    `json:"author"`
+	Summary   string    `json:"summary"`
+	Content   string    `json:"content,omitempty"`
+}
+
+// ExperimentResults compares the arms of a traffic-split experiment
+type ExperimentResults struct {
+	ExperimentID string                 `json:"experimentId"`
+	Active       bool                   `json:"active"` // Whether the experiment is in the live config
+	Arms         []ExperimentArmResults `json:"arms"`
+	StartTime    string                 `json:"startTime,omitempty"`
+	EndTime      string                 `json:"endTime,omitempty"`
+}
+
+// ExperimentArmResults summarizes one arm. Averages are over completed
+// requests; latency only counts successful ones.
+type ExperimentArmResults struct {
+	Arm               string         `json:"arm"`
+	Target            string         `json:"target,omitempty"`
+	Requests          int            `json:"requests"`
+	Completed         int            `json:"completed"` // Requests with a recorded response
+	Errors            int            `json:"errors"`    // Responses with status 400 or above
+	ErrorRate         float64        `json:"errorRate"`
+	AvgResponseMs     int64          `json:"avgResponseMs"`
+	P50ResponseMs     int64          `json:"p50ResponseMs"`
+	P95ResponseMs     int64          `json:"p95ResponseMs"`
+	AvgFirstByteMs    int64          `json:"avgFirstByteMs"`
+	InputTokens       int64          `json:"inputTokens"`
+	OutputTokens      int64          `json:"outputTokens"`
+	AvgInputTokens    float64        `json:"avgInputTokens"`
+	AvgOutputTokens   float64        `json:"avgOutputTokens"`
+	ToolCalls         int64          `json:"toolCalls"`
+	AvgToolCalls      float64        `json:"avgToolCalls"`
+	StopReasons       map[string]int `json:"stopReasons"`
+	EstimatedCostUSD  *float64       `json:"estimatedCostUsd,omitempty"`  // Set when the arm has prices configured
+	CostPerRequestUSD *float64       `json:"costPerRequestUsd,omitempty"` // Estimated cost per completed request
+}
+
 // Provider analytics
 type ProviderStats struct {
 	Provider      string `json:"provider"`
@@ -274,6 +452,71 @@ type ProviderStats struct {
 	ErrorCount    int    `json:"errorCount"`
 }
 
+// PromptCachingStats sums prompt cache usage over a set of requests.
+// CacheReadRatio is the share of prompt tokens read from the cache.
+type PromptCachingStats struct {
+	Requests            int     `json:"requests"`
+	InputTokens         int64   `json:"inputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CacheReadRatio      float64 `json:"cacheReadRatio"`
+}
+
+// PromptCachingStatsResponse compares requests the prompt-caching optimizer
+// added breakpoints to with the rest
+type PromptCachingStatsResponse struct {
+	Optimized   PromptCachingStats `json:"optimized"`
+	Unoptimized PromptCachingStats `json:"unoptimized"`
+	StartTime   string             `json:"startTime"`
+	EndTime     string             `json:"endTime"`
+}
+
+// BodyStorageStats compares the space request bodies take in the database
+// with what storing every body in full would take. StoredBytes counts the
+// requests rows' body columns plus every blob they share.
+type BodyStorageStats struct {
+	Requests        int     `json:"requests"`
+	DedupedRequests int     `json:"dedupedRequests"` // Requests whose bodies are split into blobs
+	Blobs           int     `json:"blobs"`
+	BlobBytes       int64   `json:"blobBytes"` // Blob size before compression
+	FullBytes       int64   `json:"fullBytes"`
+	StoredBytes     int64   `json:"storedBytes"`
+	SavedBytes      int64   `json:"savedBytes"`
+	SavingsRatio    float64 `json:"savingsRatio"` // SavedBytes / FullBytes
+}
+
+// RetentionRun records one pass of the retention job
+type RetentionRun struct {
+	ID               int64  `json:"id"`
+	StartedAt        string `json:"startedAt"`
+	FinishedAt       string `json:"finishedAt"`
+	StrippedRequests int    `json:"strippedRequests"` // Bodies removed past body_days
+	ExpiredRequests  int    `json:"expiredRequests"`  // Deleted past row_days
+	EvictedRequests  int    `json:"evictedRequests"`  // Deleted to get under max_db_size_mb
+	ArchivedRequests int    `json:"archivedRequests"`
+	ArchiveFile      string `json:"archiveFile,omitempty"`
+	SizeBefore       int64  `json:"sizeBefore"` // Database file size in bytes
+	SizeAfter        int64  `json:"sizeAfter"`
+	Error            string `json:"error,omitempty"`
+}
+
+// RetentionStatus reports the retention settings, how much is stored, and
+// the last retention run
+type RetentionStatus struct {
+	Enabled          bool          `json:"enabled"`
+	BodyDays         int           `json:"bodyDays"`
+	RowDays          int           `json:"rowDays"`
+	MaxDBSizeMB      int           `json:"maxDbSizeMb"`
+	ArchiveDir       string        `json:"archiveDir,omitempty"`
+	Interval         string        `json:"interval"`
+	SizeBytes        int64         `json:"sizeBytes"` // Database file size
+	FreeBytes        int64         `json:"freeBytes"` // Unused pages a vacuum can return
+	Requests         int           `json:"requests"`
+	StrippedRequests int           `json:"strippedRequests"`
+	OldestRequest    string        `json:"oldestRequest,omitempty"`
+	LastRun          *RetentionRun `json:"lastRun,omitempty"`
+}
+
 type ProviderStatsResponse struct {
 	Providers []ProviderStats `json:"providers"`
 	StartTime string          `json:"startTime"`
@@ -1,11 +1,18 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
+// ErrCircuitOpen is returned by Call when the circuit is open, or when it is
+// half-open and every probe slot is already in use
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
 // CircuitState represents the state of a circuit breaker
 type CircuitState int
 
@@ -31,6 +38,39 @@ func (s CircuitState) String() string {
 	}
 }
 
+// CircuitMode selects how a closed circuit decides to open
+type CircuitMode string
+
+const (
+	// ModeConsecutive opens after MaxFailures failures in a row
+	ModeConsecutive CircuitMode = "consecutive"
+	// ModeErrorRate opens when the failure rate over Window reaches
+	// ErrorRateThreshold, once at least MinRequests calls were seen
+	ModeErrorRate CircuitMode = "error_rate"
+)
+
+// CircuitOverride is an administrative override of the breaker's state
+type CircuitOverride string
+
+const (
+	// OverrideAuto lets the breaker manage its own state
+	OverrideAuto CircuitOverride = "auto"
+	// OverrideOpen rejects every call until the override is lifted
+	OverrideOpen CircuitOverride = "open"
+	// OverrideClosed allows every call and ignores failures
+	OverrideClosed CircuitOverride = "closed"
+)
+
+// ParseCircuitOverride parses "auto", "open", or "closed"
+func ParseCircuitOverride(s string) (CircuitOverride, error) {
+	switch override := CircuitOverride(strings.ToLower(strings.TrimSpace(s))); override {
+	case OverrideAuto, OverrideOpen, OverrideClosed:
+		return override, nil
+	default:
+		return "", fmt.Errorf("invalid circuit breaker state %q (expected open, closed, or auto)", s)
+	}
+}
+
 // StateChangeCallback is called when the circuit breaker state changes
 type StateChangeCallback func(oldState, newState CircuitState)
 
@@ -40,6 +80,16 @@ type CircuitBreakerConfig struct {
 	MaxFailures int
 	// Timeout is how long to wait before transitioning from Open to HalfOpen
 	Timeout time.Duration
+	// Mode selects consecutive-failure or error-rate tripping (default: consecutive)
+	Mode CircuitMode
+	// Window is the sliding window used by ModeErrorRate
+	Window time.Duration
+	// ErrorRateThreshold is the failure ratio (0-1) that opens the circuit in ModeErrorRate
+	ErrorRateThreshold float64
+	// MinRequests is the number of calls in the window before ModeErrorRate can trip
+	MinRequests int
+	// HalfOpenMaxProbes caps concurrent calls while half-open (0 = unlimited)
+	HalfOpenMaxProbes int
 }
 
 // DefaultCircuitBreakerConfig returns sensible defaults
@@ -59,6 +109,18 @@ type CircuitBreaker struct {
 	lastStateTime       time.Time
 	config              CircuitBreakerConfig
 	stateChangeCallback StateChangeCallback
+
+	// outcomes holds the calls seen within Window (ModeErrorRate only)
+	outcomes []callOutcome
+	// probes is the number of half-open calls currently in flight
+	probes   int
+	override CircuitOverride
+}
+
+// callOutcome is one recorded call in the error-rate window
+type callOutcome struct {
+	at     time.Time
+	failed bool
 }
 
 // NewCircuitBreaker creates a new circuit breaker with the given configuration
@@ -68,6 +130,7 @@ func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
 		failures:      0,
 		lastStateTime: time.Now(),
 		config:        config,
+		override:      OverrideAuto,
 	}
 }
 
@@ -81,49 +144,77 @@ func (cb *CircuitBreaker) SetStateChangeCallback(callback StateChangeCallback) {
 // Call attempts to execute a function through the circuit breaker
 // Returns an error if the circuit is open
 func (cb *CircuitBreaker) Call(fn func() error) error {
-	if err := cb.beforeCall(); err != nil {
+	probe, err := cb.beforeCall()
+	if err != nil {
 		return err
 	}
 
-	err := fn()
-	cb.afterCall(err)
+	err = fn()
+	cb.afterCall(err, probe)
 	return err
 }
 
-// beforeCall checks if the circuit breaker allows the call
-func (cb *CircuitBreaker) beforeCall() error {
+// beforeCall checks if the circuit breaker allows the call. probe reports
+// whether the call took one of the half-open probe slots.
+func (cb *CircuitBreaker) beforeCall() (probe bool, err error) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
+	switch cb.override {
+	case OverrideOpen:
+		return false, ErrCircuitOpen
+	case OverrideClosed:
+		return false, nil
+	}
+
 	switch cb.state {
 	case StateClosed:
 		// Allow the call
-		return nil
+		return false, nil
 
 	case StateOpen:
 		// Check if it's time to try again
 		if time.Since(cb.lastStateTime) >= cb.config.Timeout {
 			// Transition to half-open to test if the service has recovered
 			cb.transitionState(StateHalfOpen)
-			return nil
+			return cb.acquireProbe()
 		}
 		// Circuit is still open, reject the call
-		return fmt.Errorf("circuit breaker is open")
+		return false, ErrCircuitOpen
 
 	case StateHalfOpen:
-		// Allow the call to test if service has recovered
-		return nil
+		// Allow a limited number of calls to test if service has recovered
+		return cb.acquireProbe()
 
 	default:
-		return fmt.Errorf("unknown circuit breaker state: %v", cb.state)
+		return false, fmt.Errorf("unknown circuit breaker state: %v", cb.state)
 	}
 }
 
+// acquireProbe reserves a half-open probe slot. Must be called with lock held.
+func (cb *CircuitBreaker) acquireProbe() (bool, error) {
+	if cb.config.HalfOpenMaxProbes > 0 && cb.probes >= cb.config.HalfOpenMaxProbes {
+		return false, ErrCircuitOpen
+	}
+	cb.probes++
+	return true, nil
+}
+
 // afterCall records the result of the call and updates circuit state
-func (cb *CircuitBreaker) afterCall(err error) {
+func (cb *CircuitBreaker) afterCall(err error, probe bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
+	if probe {
+		cb.probes--
+	}
+
+	// A forced-closed circuit ignores outcomes. A client going away, or a
+	// call rejected by a nested breaker, says nothing about the provider's health.
+	if cb.override == OverrideClosed || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+
 	if err == nil {
 		// Success - reset failures and close circuit if needed
 		cb.onSuccess()
@@ -136,6 +227,7 @@ func (cb *CircuitBreaker) afterCall(err error) {
 // onSuccess handles a successful call
 func (cb *CircuitBreaker) onSuccess() {
 	cb.failures = 0
+	cb.recordOutcome(false)
 
 	if cb.state == StateHalfOpen {
 		// Service has recovered, close the circuit
@@ -147,6 +239,7 @@ func (cb *CircuitBreaker) onSuccess() {
 func (cb *CircuitBreaker) onFailure() {
 	cb.failures++
 	cb.lastFailTime = time.Now()
+	cb.recordOutcome(true)
 
 	if cb.state == StateHalfOpen {
 		// Failed during recovery test, reopen the circuit
@@ -154,12 +247,66 @@ func (cb *CircuitBreaker) onFailure() {
 		return
 	}
 
-	if cb.failures >= cb.config.MaxFailures {
+	if cb.shouldTrip() {
 		// Too many failures, open the circuit
 		cb.transitionState(StateOpen)
 	}
 }
 
+// RecordProbe feeds the result of an out-of-band health probe into the
+// breaker. A failed probe counts like a failed call. A successful probe moves
+// an open circuit to half-open early, so live traffic can confirm recovery
+// without waiting out the timeout.
+func (cb *CircuitBreaker) RecordProbe(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.override != OverrideAuto {
+		return
+	}
+	if !success {
+		cb.onFailure()
+		return
+	}
+	if cb.state == StateOpen {
+		cb.transitionState(StateHalfOpen)
+	}
+}
+
+// shouldTrip reports whether a closed circuit should open. Must be called with lock held.
+func (cb *CircuitBreaker) shouldTrip() bool {
+	if cb.config.Mode != ModeErrorRate {
+		return cb.failures >= cb.config.MaxFailures
+	}
+
+	total, failed := len(cb.outcomes), 0
+	for _, outcome := range cb.outcomes {
+		if outcome.failed {
+			failed++
+		}
+	}
+	if total == 0 || total < cb.config.MinRequests {
+		return false
+	}
+	return float64(failed)/float64(total) >= cb.config.ErrorRateThreshold
+}
+
+// recordOutcome adds a call to the error-rate window and drops calls that
+// have aged out of it. Must be called with lock held.
+func (cb *CircuitBreaker) recordOutcome(failed bool) {
+	if cb.config.Mode != ModeErrorRate {
+		return
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-cb.config.Window)
+	keep := 0
+	for keep < len(cb.outcomes) && cb.outcomes[keep].at.Before(cutoff) {
+		keep++
+	}
+	cb.outcomes = append(cb.outcomes[keep:], callOutcome{at: now, failed: failed})
+}
+
 // transitionState changes the circuit breaker state and invokes the callback
 // Must be called with lock held
 func (cb *CircuitBreaker) transitionState(newState CircuitState) {
@@ -170,6 +317,10 @@ func (cb *CircuitBreaker) transitionState(newState CircuitState) {
 	oldState := cb.state
 	cb.state = newState
 	cb.lastStateTime = time.Now()
+	if newState == StateClosed {
+		// Start the error-rate window afresh so old failures can't re-trip it
+		cb.outcomes = nil
+	}
 
 	// Invoke callback if set (without holding the lock to avoid deadlocks)
 	if cb.stateChangeCallback != nil {
@@ -186,6 +337,51 @@ func (cb *CircuitBreaker) State() CircuitState {
 	return cb.state
 }
 
+// Override returns the administrative override currently in effect
+func (cb *CircuitBreaker) Override() CircuitOverride {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	return cb.override
+}
+
+// ForceState applies an administrative override. Forcing open or closed
+// moves the circuit to that state immediately; returning to auto keeps the
+// current state, so a forced-open circuit recovers through half-open probes.
+func (cb *CircuitBreaker) ForceState(override CircuitOverride) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.override = override
+	switch override {
+	case OverrideOpen:
+		cb.transitionState(StateOpen)
+	case OverrideClosed:
+		cb.failures = 0
+		cb.transitionState(StateClosed)
+	case OverrideAuto:
+		// Restart the open timeout from the moment automatic control resumes
+		if cb.state == StateOpen {
+			cb.lastStateTime = time.Now()
+		}
+	}
+}
+
+// Restore copies another breaker's state, window, and override, so a
+// breaker rebuilt on a config reload carries on where the old one was
+func (cb *CircuitBreaker) Restore(from *CircuitBreaker) {
+	from.mu.RLock()
+	state, failures, override := from.state, from.failures, from.override
+	lastFailTime, lastStateTime := from.lastFailTime, from.lastStateTime
+	outcomes := append([]callOutcome(nil), from.outcomes...)
+	from.mu.RUnlock()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.state, cb.failures, cb.override = state, failures, override
+	cb.lastFailTime, cb.lastStateTime = lastFailTime, lastStateTime
+	cb.outcomes = outcomes
+}
+
 // Failures returns the current failure count
 func (cb *CircuitBreaker) Failures() int {
 	cb.mu.RLock()
@@ -201,6 +397,7 @@ func (cb *CircuitBreaker) Reset() {
 	oldState := cb.state
 	cb.state = StateClosed
 	cb.failures = 0
+	cb.outcomes = nil
 	cb.lastStateTime = time.Now()
 
 	// Invoke callback if state changed
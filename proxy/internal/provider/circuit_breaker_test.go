@@ -1,9 +1,15 @@
 package provider
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
 )
 
 func TestCircuitBreaker_InitialState(t *testing.T) {
@@ -304,3 +310,248 @@ func TestCircuitBreaker_StateStringRepresentation(t *testing.T) {
 		}
 	}
 }
+
+func TestCircuitBreaker_ErrorRateModeTripsOnRatio(t *testing.T) {
+	config := CircuitBreakerConfig{
+		Timeout:            10 * time.Second,
+		Mode:               ModeErrorRate,
+		Window:             time.Minute,
+		ErrorRateThreshold: 0.5,
+		MinRequests:        6,
+	}
+	cb := NewCircuitBreaker(config)
+
+	testErr := errors.New("test error")
+
+	// Alternating failures never reach a consecutive streak, but do reach 50%
+	for i := 0; i < 5; i++ {
+		if i%2 == 0 {
+			cb.Call(func() error { return testErr })
+		} else {
+			cb.Call(func() error { return nil })
+		}
+	}
+	if cb.State() != StateClosed {
+		t.Fatalf("Expected circuit to stay closed below min_requests, got %v", cb.State())
+	}
+
+	cb.Call(func() error { return testErr })
+	if cb.State() != StateOpen {
+		t.Errorf("Expected circuit to open at 50%% error rate over 6 requests, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreaker_ErrorRateWindowExpires(t *testing.T) {
+	config := CircuitBreakerConfig{
+		Timeout:            10 * time.Second,
+		Mode:               ModeErrorRate,
+		Window:             50 * time.Millisecond,
+		ErrorRateThreshold: 0.5,
+		MinRequests:        2,
+	}
+	cb := NewCircuitBreaker(config)
+
+	cb.Call(func() error { return errors.New("old failure") })
+	time.Sleep(60 * time.Millisecond)
+
+	// The old failure has left the window, so one new failure out of two is
+	// measured against fresh traffic only
+	cb.Call(func() error { return nil })
+	cb.Call(func() error { return nil })
+	if cb.State() != StateClosed {
+		t.Errorf("Expected aged-out failures to be ignored, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbeLimit(t *testing.T) {
+	config := CircuitBreakerConfig{
+		MaxFailures:       1,
+		Timeout:           20 * time.Millisecond,
+		HalfOpenMaxProbes: 1,
+	}
+	cb := NewCircuitBreaker(config)
+
+	cb.Call(func() error { return errors.New("test error") })
+	time.Sleep(30 * time.Millisecond)
+
+	// Hold the single probe slot open while a second call arrives
+	release := make(chan struct{})
+	probeStarted := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cb.Call(func() error {
+			close(probeStarted)
+			<-release
+			return nil
+		})
+	}()
+	<-probeStarted
+
+	called := false
+	err := cb.Call(func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("Expected second half-open call to be rejected, got err=%v called=%v", err, called)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Expected probe to succeed, got %v", err)
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("Expected circuit to close after successful probe, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoresClientCancellation(t *testing.T) {
+	config := CircuitBreakerConfig{
+		MaxFailures: 1,
+		Timeout:     10 * time.Second,
+	}
+	cb := NewCircuitBreaker(config)
+
+	cb.Call(func() error { return context.Canceled })
+	cb.Call(func() error { return ErrCircuitOpen })
+
+	if cb.State() != StateClosed || cb.Failures() != 0 {
+		t.Errorf("Expected cancelled and rejected calls not to count, got %v with %d failures", cb.State(), cb.Failures())
+	}
+}
+
+func TestCircuitBreaker_ForceState(t *testing.T) {
+	config := CircuitBreakerConfig{
+		MaxFailures: 1,
+		Timeout:     10 * time.Second,
+	}
+	cb := NewCircuitBreaker(config)
+
+	cb.ForceState(OverrideOpen)
+	called := false
+	if err := cb.Call(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("Expected forced-open circuit to reject calls, got err=%v called=%v", err, called)
+	}
+	if cb.State() != StateOpen || cb.Override() != OverrideOpen {
+		t.Errorf("Expected forced open, got %v (%s)", cb.State(), cb.Override())
+	}
+
+	cb.ForceState(OverrideClosed)
+	for i := 0; i < 3; i++ {
+		cb.Call(func() error { return errors.New("test error") })
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("Expected forced-closed circuit to ignore failures, got %v", cb.State())
+	}
+
+	cb.ForceState(OverrideAuto)
+	cb.Call(func() error { return errors.New("test error") })
+	if cb.State() != StateOpen {
+		t.Errorf("Expected automatic control to resume, got %v", cb.State())
+	}
+}
+
+func TestParseCircuitOverride(t *testing.T) {
+	for _, input := range []string{"open", "Closed", " auto "} {
+		if _, err := ParseCircuitOverride(input); err != nil {
+			t.Errorf("Expected %q to parse, got %v", input, err)
+		}
+	}
+	if _, err := ParseCircuitOverride("half-open"); err == nil {
+		t.Error("Expected half-open to be rejected as an override")
+	}
+}
+
+// modelFailingProvider fails every request for one model
+type modelFailingProvider struct {
+	failModel string
+}
+
+func (p *modelFailingProvider) Name() string { return "primary" }
+
+func (p *modelFailingProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	if requestModel(body) == p.failModel {
+		return nil, errors.New("model unavailable")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+func TestResilientProvider_PerModelBreaker(t *testing.T) {
+	cfg := testResilientConfig(0)
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{
+		Enabled:            true,
+		TimeoutDuration:    10 * time.Second,
+		Mode:               "error_rate",
+		WindowDuration:     time.Minute,
+		ErrorRateThreshold: 0.5,
+		MinRequests:        4,
+		PerModel:           true,
+	}
+	rp := NewResilientProvider("primary", &modelFailingProvider{failModel: "bad"}, nil, cfg).(*ResilientProvider)
+
+	send := func(modelName string) error {
+		req, _ := http.NewRequest("POST", "http://localhost/v1/messages", strings.NewReader(`{"model":"`+modelName+`"}`))
+		_, err := rp.ForwardRequest(context.Background(), req)
+		return err
+	}
+
+	// One model failing on a minority of traffic trips only its own breaker
+	for i := 0; i < 6; i++ {
+		send("good")
+	}
+	for i := 0; i < 4; i++ {
+		send("bad")
+	}
+	if err := send("bad"); err == nil || !strings.Contains(err.Error(), "model 'bad'") {
+		t.Errorf("Expected the model breaker to reject the request, got %v", err)
+	}
+
+	// Rejections by the model breaker don't count against the provider
+	for i := 0; i < 5; i++ {
+		send("bad")
+	}
+	if state := rp.GetCircuitBreakerState(); *state != StateClosed {
+		t.Errorf("Expected provider breaker to stay closed, got %v", *state)
+	}
+	if err := send("good"); err != nil {
+		t.Errorf("Expected other models to keep flowing, got %v", err)
+	}
+
+	breakers := rp.GetModelCircuitBreakers()
+	if len(breakers) != 2 || breakers[0].Model != "bad" || breakers[0].State != "open" {
+		t.Errorf("Unexpected model breakers: %+v", breakers)
+	}
+
+	if err := rp.ForceCircuitBreaker("bad", OverrideClosed); err != nil {
+		t.Fatalf("Expected model override to succeed, got %v", err)
+	}
+	if breakers := rp.GetModelCircuitBreakers(); breakers[0].State != "closed" || breakers[0].Override != OverrideClosed {
+		t.Errorf("Expected forced-closed model breaker, got %+v", breakers[0])
+	}
+}
+
+func TestCircuitBreaker_RecordProbe(t *testing.T) {
+	config := CircuitBreakerConfig{
+		MaxFailures: 2,
+		Timeout:     time.Hour,
+	}
+	cb := NewCircuitBreaker(config)
+
+	cb.RecordProbe(false)
+	cb.RecordProbe(false)
+	if cb.State() != StateOpen {
+		t.Fatalf("Expected failed probes to open the circuit, got %v", cb.State())
+	}
+
+	cb.RecordProbe(true)
+	if cb.State() != StateHalfOpen {
+		t.Errorf("Expected a successful probe to half-open the circuit, got %v", cb.State())
+	}
+
+	cb.ForceState(OverrideOpen)
+	cb.RecordProbe(true)
+	if cb.State() != StateOpen {
+		t.Errorf("Expected probes to leave a forced-open circuit alone, got %v", cb.State())
+	}
+}
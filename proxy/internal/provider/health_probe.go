@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Health probe methods
+const (
+	// ProbeMethodModels lists the provider's models, the cheapest upstream call
+	ProbeMethodModels = "models"
+	// ProbeMethodCompletion sends a 1-token completion for a configured model
+	ProbeMethodCompletion = "completion"
+)
+
+// ModelLister is implemented by providers that can list their models
+type ModelLister interface {
+	ListModels(ctx context.Context) (*http.Response, error)
+}
+
+// ProbeResult is the outcome of one health probe
+type ProbeResult struct {
+	StatusCode int
+	Latency    time.Duration
+	Err        error
+}
+
+// Success reports whether the upstream answered healthily. 401 and 403 mean
+// the provider's credentials are wrong, so they count as failures; other 4xx
+// answers except 429 mean the upstream is up but didn't like the probe.
+func (r ProbeResult) Success() bool {
+	return r.Err == nil && r.StatusCode < 500 && r.StatusCode != http.StatusTooManyRequests && !r.Unauthorized()
+}
+
+// Unauthorized reports whether the upstream rejected the provider's credentials
+func (r ProbeResult) Unauthorized() bool {
+	return r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden
+}
+
+// Probe runs one health probe against p. Resilient providers are probed
+// directly at their primary, bypassing retries, breakers, and fallback.
+func Probe(ctx context.Context, p Provider, method, model string) ProbeResult {
+	if rp, ok := p.(*ResilientProvider); ok {
+		p = rp.primaryProvider
+	}
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	switch method {
+	case ProbeMethodModels:
+		lister, ok := p.(ModelLister)
+		if !ok {
+			return ProbeResult{Err: fmt.Errorf("provider '%s' does not support models probes", p.Name())}
+		}
+		resp, err = lister.ListModels(ctx)
+	case ProbeMethodCompletion:
+		resp, err = probeCompletion(ctx, p, model)
+	default:
+		return ProbeResult{Err: fmt.Errorf("unknown probe method '%s'", method)}
+	}
+
+	result := ProbeResult{Latency: time.Since(start), Err: err}
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		if result.Unauthorized() && result.Err == nil {
+			result.Err = fmt.Errorf("probe returned HTTP %d: check the provider's api_key", resp.StatusCode)
+		}
+		if !result.Success() && result.Err == nil {
+			result.Err = fmt.Errorf("probe returned HTTP %d", resp.StatusCode)
+		}
+	}
+	return result
+}
+
+// probeCompletion sends the smallest possible Messages request
+func probeCompletion(ctx context.Context, p Provider, model string) (*http.Response, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://probe/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.ForwardRequest(ctx, req)
+}
+
+// ListModels calls GET /v1/models on the upstream, authenticated with the
+// provider's api_key by ForwardRequest
+func (p *AnthropicProvider) ListModels(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://probe/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.ForwardRequest(ctx, req)
+}
+
+// ListModels calls GET /v1/models on the upstream
+func (p *OpenAIProvider) ListModels(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.config.BaseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+	return p.client.Do(req)
+}
@@ -2,7 +2,11 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
 )
 
 // Provider is the interface that all LLM providers must implement
@@ -13,3 +17,58 @@ type Provider interface {
 	// ForwardRequest forwards a request to the provider's API
 	ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error)
 }
+
+// BuildProviders creates a provider for every configured entry based on its
+// format, then wraps those needing resilience features (circuit breaker,
+// retry, fallback). It fails if no provider could be created.
+func BuildProviders(providerConfigs map[string]*config.ProviderConfig, logger *log.Logger) (map[string]Provider, error) {
+	// First pass: create all base providers
+	baseProviders := make(map[string]Provider)
+	for name, providerCfg := range providerConfigs {
+		switch providerCfg.Format {
+		case "anthropic":
+			baseProviders[name] = NewAnthropicProvider(name, providerCfg)
+			logger.Printf("📡 Initialized Anthropic-format provider: %s (%s)", name, providerCfg.BaseURL)
+		case "openai":
+			baseProviders[name] = NewOpenAIProvider(name, providerCfg)
+			logger.Printf("📡 Initialized OpenAI-format provider: %s (%s)", name, providerCfg.BaseURL)
+		default:
+			logger.Printf("⚠️  Unknown provider format '%s' for provider '%s', skipping", providerCfg.Format, name)
+		}
+	}
+
+	if len(baseProviders) == 0 {
+		return nil, fmt.Errorf("no providers configured. Please configure at least one provider in config.yaml")
+	}
+
+	// Second pass: wrap providers with resilience features (circuit breaker, retry, fallback)
+	providers := make(map[string]Provider)
+	for name, baseProvider := range baseProviders {
+		providerCfg := providerConfigs[name]
+
+		// Check if this provider has a fallback configured
+		var fallbackProvider Provider
+		if providerCfg.FallbackProvider != "" {
+			if fb, exists := baseProviders[providerCfg.FallbackProvider]; exists {
+				fallbackProvider = fb
+				logger.Printf("🔄 Provider '%s' configured with fallback to '%s'", name, providerCfg.FallbackProvider)
+			} else {
+				logger.Printf("⚠️  Provider '%s' has invalid fallback_provider '%s' (not found)", name, providerCfg.FallbackProvider)
+			}
+		}
+
+		// Wrap with resilient provider if circuit breaker, fallback, or a retry policy is configured
+		if providerCfg.CircuitBreaker.Enabled || fallbackProvider != nil || providerCfg.Retry.IsConfigured() {
+			providers[name] = NewResilientProvider(name, baseProvider, fallbackProvider, providerCfg)
+			if providerCfg.CircuitBreaker.Enabled {
+				logger.Printf("🛡️  Circuit breaker enabled for '%s' (mode: %s, max_failures: %d, timeout: %s)",
+					name, providerCfg.CircuitBreaker.Mode, providerCfg.CircuitBreaker.MaxFailures, providerCfg.CircuitBreaker.TimeoutDuration)
+			}
+		} else {
+			// No resilience features needed, use base provider directly
+			providers[name] = baseProvider
+		}
+	}
+
+	return providers, nil
+}
@@ -1,11 +1,18 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
@@ -20,6 +27,11 @@ type ResilientProvider struct {
 	circuitBreaker   *CircuitBreaker
 	retryConfig      RetryConfig
 	config           *config.ProviderConfig
+
+	// modelBreakers holds per-model breakers, created on first use when
+	// circuit_breaker.per_model is enabled
+	modelMu       sync.Mutex
+	modelBreakers map[string]*CircuitBreaker
 }
 
 // NewResilientProvider creates a provider with resilience features
@@ -39,43 +51,150 @@ func NewResilientProvider(
 
 	// Initialize circuit breaker if enabled
 	if cfg.CircuitBreaker.Enabled {
-		cbConfig := CircuitBreakerConfig{
-			MaxFailures: cfg.CircuitBreaker.MaxFailures,
-			Timeout:     cfg.CircuitBreaker.TimeoutDuration,
+		rp.circuitBreaker = rp.newCircuitBreaker(name)
+		if cfg.CircuitBreaker.PerModel {
+			rp.modelBreakers = make(map[string]*CircuitBreaker)
 		}
-		rp.circuitBreaker = NewCircuitBreaker(cbConfig)
+	}
 
-		// Set up circuit breaker state change callback to update metrics and log
-		rp.circuitBreaker.SetStateChangeCallback(func(oldState, newState CircuitState) {
-			// Update metrics
-			metrics.UpdateCircuitBreakerState(name, int(newState))
-			metrics.RecordCircuitBreakerStateChange(name, oldState.String(), newState.String())
+	// Initialize retry config
+	rp.retryConfig = NewRetryConfigFromProvider(cfg)
+	rp.retryConfig.OnRetry = func(class ErrorClass, backoff time.Duration) {
+		metrics.RecordRetry(name)
+		metrics.RecordRetryClass(name, string(class))
+	}
+	rp.retryConfig.OnBudgetExhausted = func(class ErrorClass) {
+		log.Printf("⚠️ Retry budget exhausted for provider '%s' (%s), not retrying", name, class)
+		metrics.RecordRetryBudgetExhausted(name, string(class))
+	}
 
-			// Structured logging for circuit breaker state changes
-			logEvent := map[string]interface{}{
-				"event":      "circuit_breaker_state_change",
-				"provider":   name,
-				"old_state":  oldState.String(),
-				"new_state":  newState.String(),
-				"timestamp":  time.Now().UTC().Format(time.RFC3339),
-			}
-			logJSON, _ := json.Marshal(logEvent)
-			log.Printf("%s", logJSON)
-		})
+	return rp
+}
 
-		// Initialize circuit breaker state metric
-		metrics.UpdateCircuitBreakerState(name, int(StateClosed))
+// newCircuitBreaker creates a breaker from the provider's config that reports
+// its state changes under label ("provider" or "provider:model")
+func (rp *ResilientProvider) newCircuitBreaker(label string) *CircuitBreaker {
+	cbCfg := rp.config.CircuitBreaker
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		MaxFailures:        cbCfg.MaxFailures,
+		Timeout:            cbCfg.TimeoutDuration,
+		Mode:               CircuitMode(cbCfg.Mode),
+		Window:             cbCfg.WindowDuration,
+		ErrorRateThreshold: cbCfg.ErrorRateThreshold,
+		MinRequests:        cbCfg.MinRequests,
+		HalfOpenMaxProbes:  cbCfg.HalfOpenMaxProbes,
+	})
+
+	// Set up circuit breaker state change callback to update metrics and log
+	cb.SetStateChangeCallback(func(oldState, newState CircuitState) {
+		// Update metrics
+		metrics.UpdateCircuitBreakerState(label, int(newState))
+		metrics.RecordCircuitBreakerStateChange(label, oldState.String(), newState.String())
+
+		// Structured logging for circuit breaker state changes
+		logEvent := map[string]interface{}{
+			"event":     "circuit_breaker_state_change",
+			"provider":  label,
+			"old_state": oldState.String(),
+			"new_state": newState.String(),
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		}
+		logJSON, _ := json.Marshal(logEvent)
+		log.Printf("%s", logJSON)
+	})
+
+	// Initialize circuit breaker state metric
+	metrics.UpdateCircuitBreakerState(label, int(StateClosed))
+	return cb
+}
+
+// modelBreaker returns the per-model breaker for model, creating it on
+// first use. Returns nil when per-model breakers are disabled.
+func (rp *ResilientProvider) modelBreaker(model string) *CircuitBreaker {
+	if rp.modelBreakers == nil || model == "" {
+		return nil
 	}
+	rp.modelMu.Lock()
+	defer rp.modelMu.Unlock()
 
-	// Initialize retry config
-	rp.retryConfig = RetryConfig{
+	cb, exists := rp.modelBreakers[model]
+	if !exists {
+		cb = rp.newCircuitBreaker(rp.name + ":" + model)
+		rp.modelBreakers[model] = cb
+	}
+	return cb
+}
+
+// InheritState carries the breakers' state and overrides over from the
+// provider this one replaces on a config reload
+func (rp *ResilientProvider) InheritState(previous *ResilientProvider) {
+	if rp.circuitBreaker == nil || previous.circuitBreaker == nil {
+		return
+	}
+	rp.circuitBreaker.Restore(previous.circuitBreaker)
+	metrics.UpdateCircuitBreakerState(rp.name, int(rp.circuitBreaker.State()))
+
+	if rp.modelBreakers == nil {
+		return
+	}
+	previous.modelMu.Lock()
+	models := maps.Clone(previous.modelBreakers)
+	previous.modelMu.Unlock()
+	for model, cb := range models {
+		next := rp.modelBreaker(model)
+		next.Restore(cb)
+		metrics.UpdateCircuitBreakerState(rp.name+":"+model, int(next.State()))
+	}
+}
+
+// NewRetryConfigFromProvider builds the retry policy for a provider from its config
+func NewRetryConfigFromProvider(cfg *config.ProviderConfig) RetryConfig {
+	retryCfg := cfg.Retry
+	rc := RetryConfig{
 		MaxRetries:        cfg.MaxRetries,
-		InitialBackoff:    1 * time.Second,
-		MaxBackoff:        30 * time.Second,
-		BackoffMultiplier: 2.0,
+		InitialBackoff:    retryCfg.InitialBackoffDuration,
+		MaxBackoff:        retryCfg.MaxBackoffDuration,
+		BackoffMultiplier: retryCfg.Multiplier,
+		Jitter:            retryCfg.Jitter != "none",
+		RespectRetryAfter: retryCfg.RespectRetryAfter == nil || *retryCfg.RespectRetryAfter,
+		MaxRetryAfter:     retryCfg.MaxRetryAfterDuration,
+		Rules:             make(map[ErrorClass]RetryRule),
 	}
 
-	return rp
+	// Fall back to the historical defaults if config.Load was bypassed
+	if rc.InitialBackoff == 0 {
+		rc.InitialBackoff = 1 * time.Second
+	}
+	if rc.MaxBackoff == 0 {
+		rc.MaxBackoff = 30 * time.Second
+	}
+	if rc.BackoffMultiplier == 0 {
+		rc.BackoffMultiplier = 2.0
+	}
+
+	rules := map[ErrorClass]config.RetryRuleConfig{
+		ErrorClassRateLimit:  retryCfg.RateLimit,
+		ErrorClassOverloaded: retryCfg.Overloaded,
+		ErrorClassServer:     retryCfg.ServerError,
+		ErrorClassConnect:    retryCfg.ConnectError,
+	}
+	for class, ruleCfg := range rules {
+		rule := RetryRule{
+			MaxRetries:     cfg.MaxRetries,
+			InitialBackoff: ruleCfg.InitialBackoffDuration,
+			MaxBackoff:     ruleCfg.MaxBackoffDuration,
+		}
+		if ruleCfg.MaxRetries != nil {
+			rule.MaxRetries = *ruleCfg.MaxRetries
+		}
+		rc.Rules[class] = rule
+	}
+
+	if retryCfg.BudgetPercent > 0 {
+		rc.Budget = NewRetryBudget(retryCfg.BudgetPercent, retryCfg.BudgetMinRetries, time.Minute)
+	}
+
+	return rc
 }
 
 // Name returns the provider name
@@ -83,12 +202,38 @@ func (rp *ResilientProvider) Name() string {
 	return rp.name
 }
 
+// allowedProvidersKey is the context key for WithAllowedProviders
+type allowedProvidersKey struct{}
+
+// WithAllowedProviders limits which providers a request forwarded with the
+// returned context may reach: fallbacks to any other provider are skipped
+func WithAllowedProviders(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, allowedProvidersKey{}, names)
+}
+
+// fallbackAllowed reports whether the request may be sent to the fallback
+func (rp *ResilientProvider) fallbackAllowed(ctx context.Context) bool {
+	names, limited := ctx.Value(allowedProvidersKey{}).([]string)
+	return !limited || slices.Contains(names, rp.fallbackProvider.Name())
+}
+
 // ForwardRequest forwards a request with circuit breaker, retry, and fallback logic
 func (rp *ResilientProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
 	startTime := time.Now()
 
+	// Buffer the body so every attempt (and the fallback) sends the full payload
+	bodyBytes, err := bufferRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	fa := &forwardAttempt{
+		bodyBytes: bodyBytes,
+		streaming: IsStreamingRequest(bodyBytes),
+		model:     requestModel(bodyBytes),
+	}
+
 	// Try primary provider with circuit breaker and retry
-	resp, err := rp.tryPrimaryProvider(ctx, req)
+	resp, err := rp.tryPrimaryProvider(ctx, req, fa)
 
 	// Record request metrics
 	status := "success"
@@ -106,9 +251,10 @@ func (rp *ResilientProvider) ForwardRequest(ctx context.Context, req *http.Reque
 	}
 	metrics.RecordRequest(rp.name, model, status, duration)
 
-	// If primary succeeded or we don't have a fallback, return the result
-	if err == nil || rp.fallbackProvider == nil {
-		return resp, err
+	// If primary succeeded, we don't have a fallback (or may not use it), or
+	// the client went away, return the result
+	if err == nil || rp.fallbackProvider == nil || ctx.Err() != nil || !rp.fallbackAllowed(ctx) {
+		return fa.finish(rp.name, resp, err)
 	}
 
 	// If circuit breaker is open or primary failed after retries, try fallback
@@ -130,12 +276,59 @@ func (rp *ResilientProvider) ForwardRequest(ctx context.Context, req *http.Reque
 	metrics.RecordFallback(rp.name, rp.fallbackProvider.Name())
 
 	// Try fallback provider (without circuit breaker to avoid cascading failures)
-	return rp.tryFallbackProvider(ctx, req)
+	resp, err = rp.tryFallbackProvider(ctx, req, fa)
+	return fa.finish(rp.name, resp, err)
+}
+
+// forwardAttempt carries the per-request state shared by every attempt
+// (primary retries and the fallback)
+type forwardAttempt struct {
+	bodyBytes []byte
+	// streaming requests are peeked until the first content event so that
+	// failures before any bytes reach the client can be retried
+	streaming      bool
+	streamFailures int
+	// model is the requested model, used to pick a per-model breaker
+	model string
+}
+
+// forward sends one attempt to a provider, rewinding the body first
+func (fa *forwardAttempt) forward(ctx context.Context, p Provider, req *http.Request) (*http.Response, error) {
+	resetRequestBody(req, fa.bodyBytes)
+	resp, err := p.ForwardRequest(ctx, req)
+	if err != nil || !fa.streaming {
+		return resp, err
+	}
+
+	resp, err = PeekStream(p.Name(), resp)
+	if err != nil {
+		fa.streamFailures++
+		log.Printf("⚠️ Provider '%s' stream failed before first content: %v", p.Name(), err)
+	}
+	return resp, err
+}
+
+// finish settles the outcome of a request. A stream that failed before its
+// first content event on every attempt is replayed to the client as the
+// upstream sent it, so the client still receives the SSE error event.
+func (fa *forwardAttempt) finish(providerName string, resp *http.Response, err error) (*http.Response, error) {
+	if err == nil {
+		if fa.streamFailures > 0 {
+			metrics.RecordStreamRecovery(providerName)
+		}
+		return resp, nil
+	}
+
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		return streamErr.Response(), nil
+	}
+	return resp, err
 }
 
 // tryPrimaryProvider attempts to forward the request through the primary provider
 // with circuit breaker protection and retry logic
-func (rp *ResilientProvider) tryPrimaryProvider(ctx context.Context, req *http.Request) (*http.Response, error) {
+func (rp *ResilientProvider) tryPrimaryProvider(ctx context.Context, req *http.Request, fa *forwardAttempt) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
@@ -144,17 +337,12 @@ func (rp *ResilientProvider) tryPrimaryProvider(ctx context.Context, req *http.R
 		// Retry with exponential backoff
 		var attempts int
 		resp, err, attempts = RetryWithBackoff(ctx, rp.retryConfig, func() (*http.Response, error) {
-			return rp.primaryProvider.ForwardRequest(ctx, req)
+			return fa.forward(ctx, rp.primaryProvider, req)
 		})
 
 		if attempts > 1 {
 			log.Printf("📊 Provider '%s' request completed after %d attempts", rp.name, attempts)
 
-			// Record retry attempts
-			for i := 1; i < attempts; i++ {
-				metrics.RecordRetry(rp.name)
-			}
-
 			// Structured logging for retry attempts
 			logEvent := map[string]interface{}{
 				"event":      "retry_attempts",
@@ -169,12 +357,25 @@ func (rp *ResilientProvider) tryPrimaryProvider(ctx context.Context, req *http.R
 		return err
 	}
 
-	// Execute through circuit breaker if enabled
+	// Execute through circuit breaker if enabled. A per-model breaker wraps
+	// the call inside the provider breaker, so both see every outcome.
 	if rp.circuitBreaker != nil {
-		cbErr := rp.circuitBreaker.Call(executeRequest)
+		call := executeRequest
+		if modelCB := rp.modelBreaker(fa.model); modelCB != nil {
+			call = func() error {
+				cbErr := modelCB.Call(executeRequest)
+				if errors.Is(cbErr, ErrCircuitOpen) {
+					log.Printf("🔴 Circuit breaker OPEN for model '%s' on provider '%s'", fa.model, rp.name)
+					return fmt.Errorf("circuit breaker is open for model '%s' on provider '%s': %w", fa.model, rp.name, cbErr)
+				}
+				return cbErr
+			}
+		}
+
+		cbErr := rp.circuitBreaker.Call(call)
 		if cbErr != nil {
 			// Circuit breaker error (circuit is open)
-			if cbErr.Error() == "circuit breaker is open" {
+			if cbErr == ErrCircuitOpen {
 				log.Printf("🔴 Circuit breaker OPEN for provider '%s' (too many failures)", rp.name)
 				return nil, fmt.Errorf("circuit breaker is open for provider '%s': recent failures detected", rp.name)
 			}
@@ -193,12 +394,12 @@ func (rp *ResilientProvider) tryPrimaryProvider(ctx context.Context, req *http.R
 
 // tryFallbackProvider attempts to forward the request through the fallback provider
 // This is called when the primary provider fails
-func (rp *ResilientProvider) tryFallbackProvider(ctx context.Context, req *http.Request) (*http.Response, error) {
+func (rp *ResilientProvider) tryFallbackProvider(ctx context.Context, req *http.Request, fa *forwardAttempt) (*http.Response, error) {
 	log.Printf("🔄 Routing to fallback provider '%s'", rp.fallbackProvider.Name())
 
 	// Forward to fallback provider
 	// Note: Fallback provider may itself be a ResilientProvider with its own fallback chain
-	resp, err := rp.fallbackProvider.ForwardRequest(ctx, req)
+	resp, err := fa.forward(ctx, rp.fallbackProvider, req)
 
 	if err != nil {
 		return nil, fmt.Errorf("fallback provider '%s' also failed: %w", rp.fallbackProvider.Name(), err)
@@ -207,6 +408,30 @@ func (rp *ResilientProvider) tryFallbackProvider(ctx context.Context, req *http.
 	return resp, nil
 }
 
+// bufferRequestBody reads the request body once so it can be replayed for
+// retries and fallbacks
+func bufferRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body.Close()
+	resetRequestBody(req, bodyBytes)
+	return bodyBytes, nil
+}
+
+// resetRequestBody rewinds the request body to the buffered bytes
+func resetRequestBody(req *http.Request, bodyBytes []byte) {
+	if bodyBytes == nil {
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	req.ContentLength = int64(len(bodyBytes))
+}
+
 // GetCircuitBreakerState returns the current circuit breaker state
 // Returns nil if circuit breaker is not enabled
 func (rp *ResilientProvider) GetCircuitBreakerState() *CircuitState {
@@ -216,3 +441,77 @@ func (rp *ResilientProvider) GetCircuitBreakerState() *CircuitState {
 	state := rp.circuitBreaker.State()
 	return &state
 }
+
+// RecordProbe feeds a health probe result into the provider breaker
+func (rp *ResilientProvider) RecordProbe(success bool) {
+	if rp.circuitBreaker != nil {
+		rp.circuitBreaker.RecordProbe(success)
+	}
+}
+
+// GetCircuitBreakerOverride returns the administrative override on the
+// provider breaker, or "" if circuit breaker is not enabled
+func (rp *ResilientProvider) GetCircuitBreakerOverride() CircuitOverride {
+	if rp.circuitBreaker == nil {
+		return ""
+	}
+	return rp.circuitBreaker.Override()
+}
+
+// ModelBreakerStatus is the state of one per-model circuit breaker
+type ModelBreakerStatus struct {
+	Model    string          `json:"model"`
+	State    string          `json:"state"`
+	Override CircuitOverride `json:"override"`
+}
+
+// GetModelCircuitBreakers returns the per-model breakers seen so far,
+// sorted by model
+func (rp *ResilientProvider) GetModelCircuitBreakers() []ModelBreakerStatus {
+	if rp.modelBreakers == nil {
+		return nil
+	}
+	rp.modelMu.Lock()
+	defer rp.modelMu.Unlock()
+
+	statuses := make([]ModelBreakerStatus, 0, len(rp.modelBreakers))
+	for model, cb := range rp.modelBreakers {
+		statuses = append(statuses, ModelBreakerStatus{
+			Model:    model,
+			State:    cb.State().String(),
+			Override: cb.Override(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Model < statuses[j].Model
+	})
+	return statuses
+}
+
+// ForceCircuitBreaker applies an administrative override to the provider
+// breaker, or to the breaker for model when model is non-empty
+func (rp *ResilientProvider) ForceCircuitBreaker(model string, override CircuitOverride) error {
+	if rp.circuitBreaker == nil {
+		return fmt.Errorf("circuit breaker is not enabled for provider '%s'", rp.name)
+	}
+
+	cb := rp.circuitBreaker
+	label := rp.name
+	if model != "" {
+		if cb = rp.modelBreaker(model); cb == nil {
+			return fmt.Errorf("per-model circuit breakers are not enabled for provider '%s'", rp.name)
+		}
+		label = rp.name + ":" + model
+	}
+	cb.ForceState(override)
+
+	logEvent := map[string]interface{}{
+		"event":     "circuit_breaker_override",
+		"provider":  label,
+		"override":  string(override),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	logJSON, _ := json.Marshal(logEvent)
+	log.Printf("%s", logJSON)
+	return nil
+}
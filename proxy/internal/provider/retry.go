@@ -2,12 +2,50 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// ErrorClass categorizes a failed attempt so that each kind of failure
+// can be retried under its own policy
+type ErrorClass string
+
+const (
+	// ErrorClassNone means the attempt succeeded
+	ErrorClassNone ErrorClass = ""
+	// ErrorClassRateLimit is a 429 from the upstream
+	ErrorClassRateLimit ErrorClass = "rate_limit"
+	// ErrorClassOverloaded is a 529 (Anthropic overloaded_error)
+	ErrorClassOverloaded ErrorClass = "overloaded"
+	// ErrorClassServer covers the remaining 5xx responses and 408
+	ErrorClassServer ErrorClass = "server_error"
+	// ErrorClassConnect covers transport errors (dial failures, resets, TLS errors, timeouts)
+	ErrorClassConnect ErrorClass = "connect_error"
+	// ErrorClassCanceled means the client went away - never retried
+	ErrorClassCanceled ErrorClass = "canceled"
+	// ErrorClassClient covers non-retryable 4xx responses
+	ErrorClassClient ErrorClass = "client_error"
+)
+
+// StatusOverloaded is the non-standard status Anthropic uses for overloaded_error
+const StatusOverloaded = 529
+
+// RetryRule holds the retry limits for a single error class
+type RetryRule struct {
+	// MaxRetries is the maximum number of retries for this class (0 = never retry)
+	MaxRetries int
+	// InitialBackoff overrides RetryConfig.InitialBackoff when non-zero
+	InitialBackoff time.Duration
+	// MaxBackoff overrides RetryConfig.MaxBackoff when non-zero
+	MaxBackoff time.Duration
+}
+
 // RetryConfig holds configuration for retry logic
 type RetryConfig struct {
 	// MaxRetries is the maximum number of retry attempts (0 = no retries)
@@ -18,6 +56,25 @@ type RetryConfig struct {
 	MaxBackoff time.Duration
 	// BackoffMultiplier is the multiplier for exponential backoff (default: 2.0)
 	BackoffMultiplier float64
+	// Jitter enables full jitter: each sleep is uniformly drawn from [0, backoff)
+	Jitter bool
+	// RespectRetryAfter makes the retry-after / retry-after-ms response headers
+	// take precedence over the computed backoff
+	RespectRetryAfter bool
+	// MaxRetryAfter caps server-provided delays. A hint longer than this stops
+	// retrying so the client sees the error instead of a stalled request (0 = no cap)
+	MaxRetryAfter time.Duration
+	// Rules holds per-class overrides. Classes without a rule use MaxRetries
+	// and the top-level backoff settings. A request never retries more often
+	// than the largest limit across MaxRetries and the rules, however its
+	// failures are spread over classes.
+	Rules map[ErrorClass]RetryRule
+	// Budget limits retries to a share of overall traffic (nil = unlimited)
+	Budget *RetryBudget
+	// OnRetry, if set, is called before sleeping ahead of each retry
+	OnRetry func(class ErrorClass, backoff time.Duration)
+	// OnBudgetExhausted, if set, is called when the budget denies a retry
+	OnBudgetExhausted func(class ErrorClass)
 }
 
 // DefaultRetryConfig returns sensible defaults for retry configuration
@@ -27,35 +84,77 @@ func DefaultRetryConfig() RetryConfig {
 		InitialBackoff:    1 * time.Second,
 		MaxBackoff:        30 * time.Second,
 		BackoffMultiplier: 2.0,
+		Jitter:            true,
+		RespectRetryAfter: true,
+		MaxRetryAfter:     60 * time.Second,
 	}
 }
 
-// IsRetryableError determines if an error should be retried
-// Only transient errors (5xx, timeout, connection errors) are retryable
-func IsRetryableError(err error, statusCode int) bool {
-	// Network/timeout errors are always retryable
-	if err != nil {
-		return true
+// ruleFor returns the effective retry rule for an error class
+func (c RetryConfig) ruleFor(class ErrorClass) RetryRule {
+	rule, ok := c.Rules[class]
+	if !ok {
+		rule = RetryRule{MaxRetries: c.MaxRetries}
+	}
+	if rule.InitialBackoff == 0 {
+		rule.InitialBackoff = c.InitialBackoff
 	}
+	if rule.MaxBackoff == 0 {
+		rule.MaxBackoff = c.MaxBackoff
+	}
+	return rule
+}
 
-	// 5xx errors are retryable (server errors)
-	if statusCode >= 500 && statusCode < 600 {
-		return true
+// totalRetries returns the overall retry cap shared by every error class
+func (c RetryConfig) totalRetries() int {
+	total := c.MaxRetries
+	for _, rule := range c.Rules {
+		total = max(total, rule.MaxRetries)
 	}
+	return total
+}
 
-	// 429 (rate limit) is retryable
-	if statusCode == http.StatusTooManyRequests {
-		return true
+// ClassifyError determines the error class of an attempt from the transport
+// error and the response status code
+func ClassifyError(err error, statusCode int) ErrorClass {
+	if err != nil {
+		// A deadline here is an upstream timeout; the caller's own deadline
+		// is caught by RetryWithBackoff checking its context first
+		if errors.Is(err, context.Canceled) {
+			return ErrorClassCanceled
+		}
+		var streamErr *StreamError
+		if errors.As(err, &streamErr) {
+			return streamErr.Class()
+		}
+		return ErrorClassConnect
 	}
 
-	// 408 (request timeout) is retryable
-	if statusCode == http.StatusRequestTimeout {
-		return true
+	switch {
+	case statusCode >= 200 && statusCode < 400:
+		return ErrorClassNone
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorClassRateLimit
+	case statusCode == StatusOverloaded:
+		return ErrorClassOverloaded
+	case statusCode >= 500 && statusCode < 600, statusCode == http.StatusRequestTimeout:
+		return ErrorClassServer
+	default:
+		return ErrorClassClient
 	}
+}
 
-	// 4xx errors (except above) are not retryable - they indicate client errors
-	// 2xx/3xx are success/redirect - no retry needed
-	return false
+// IsRetryableError determines if an error should be retried
+// Only transient errors (5xx, timeout, connection errors) are retryable.
+// Client cancellation is never retryable.
+func IsRetryableError(err error, statusCode int) bool {
+	switch ClassifyError(err, statusCode) {
+	case ErrorClassRateLimit, ErrorClassOverloaded, ErrorClassServer, ErrorClassConnect:
+		return true
+	default:
+		// 4xx client errors, cancellations, and 2xx/3xx responses
+		return false
+	}
 }
 
 // RetryWithBackoff retries a function with exponential backoff
@@ -69,8 +168,14 @@ func RetryWithBackoff(
 	var lastErr error
 	var lastResp *http.Response
 	attempts := 0
+	retries := 0
+	retriesByClass := make(map[ErrorClass]int)
+
+	if config.Budget != nil {
+		config.Budget.RecordRequest()
+	}
 
-	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
+	for {
 		attempts++
 
 		// Try the function
@@ -89,19 +194,54 @@ func RetryWithBackoff(
 			return resp, nil, attempts
 		}
 
+		// The client went away - retrying would only burn upstream quota
+		if ctx.Err() != nil {
+			return resp, ctx.Err(), attempts
+		}
+
 		// Check if we should retry
+		class := ClassifyError(err, statusCode)
 		if !IsRetryableError(err, statusCode) {
 			// Not retryable - return the error
 			return resp, err, attempts
 		}
 
-		// Don't retry if this was the last attempt
-		if attempt >= config.MaxRetries {
+		rule := config.ruleFor(class)
+		if retriesByClass[class] >= rule.MaxRetries || retries >= config.totalRetries() {
 			break
 		}
 
-		// Calculate backoff duration
-		backoff := calculateBackoff(attempt, config)
+		// Calculate backoff duration, letting a server hint take precedence
+		backoff := calculateBackoff(retriesByClass[class], RetryConfig{
+			InitialBackoff:    rule.InitialBackoff,
+			MaxBackoff:        rule.MaxBackoff,
+			BackoffMultiplier: config.BackoffMultiplier,
+		})
+		if config.Jitter {
+			backoff = applyFullJitter(backoff)
+		}
+		if config.RespectRetryAfter && resp != nil {
+			if hint, ok := ParseRetryAfter(resp.Header, time.Now()); ok {
+				if config.MaxRetryAfter > 0 && hint > config.MaxRetryAfter {
+					// Upstream wants us to wait longer than we are willing to hold the client
+					break
+				}
+				backoff = hint
+			}
+		}
+
+		// Stop retrying when the provider's retry budget is spent
+		if config.Budget != nil && !config.Budget.TryAcquire() {
+			if config.OnBudgetExhausted != nil {
+				config.OnBudgetExhausted(class)
+			}
+			break
+		}
+		retries++
+		retriesByClass[class]++
+		if config.OnRetry != nil {
+			config.OnRetry(class, backoff)
+		}
 
 		// Check context cancellation before sleeping
 		select {
@@ -129,12 +269,55 @@ func RetryWithBackoff(
 // calculateBackoff calculates the backoff duration for a given attempt
 // Uses exponential backoff: initialBackoff * (multiplier ^ attempt)
 func calculateBackoff(attempt int, config RetryConfig) time.Duration {
-	backoff := float64(config.InitialBackoff) * math.Pow(config.BackoffMultiplier, float64(attempt))
+	multiplier := config.BackoffMultiplier
+	if multiplier <= 0 {
+		multiplier = 2.0
+	}
+	backoff := float64(config.InitialBackoff) * math.Pow(multiplier, float64(attempt))
 
 	// Cap at max backoff
-	if backoff > float64(config.MaxBackoff) {
+	if config.MaxBackoff > 0 && backoff > float64(config.MaxBackoff) {
 		backoff = float64(config.MaxBackoff)
 	}
 
 	return time.Duration(backoff)
 }
+
+// applyFullJitter returns a random duration in [0, backoff)
+// See "Exponential Backoff And Jitter" (AWS Architecture Blog)
+func applyFullJitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// ParseRetryAfter extracts the server-requested delay from retry-after-ms
+// (milliseconds, used by Anthropic) or retry-after (seconds or HTTP date)
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	if v := strings.TrimSpace(header.Get("retry-after-ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+
+	v := strings.TrimSpace(header.Get("retry-after"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
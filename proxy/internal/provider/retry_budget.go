@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryBudget caps retries at a percentage of the requests seen over a
+// rolling window, so a struggling upstream is not hit with a retry storm.
+// A small fixed allowance keeps retries available at low traffic.
+type RetryBudget struct {
+	mu          sync.Mutex
+	percent     float64
+	minRetries  int
+	window      time.Duration
+	windowStart time.Time
+	requests    float64
+	retries     float64
+	now         func() time.Time
+}
+
+// NewRetryBudget creates a retry budget allowing retries up to percent% of
+// requests per window, plus minRetries retries per window regardless of traffic
+func NewRetryBudget(percent float64, minRetries int, window time.Duration) *RetryBudget {
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &RetryBudget{
+		percent:     percent,
+		minRetries:  minRetries,
+		window:      window,
+		windowStart: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// RecordRequest counts an original (non-retry) request against the budget
+func (b *RetryBudget) RecordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	b.requests++
+}
+
+// TryAcquire reserves one retry, returning false if the budget is spent
+func (b *RetryBudget) TryAcquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+
+	allowed := b.requests*b.percent/100 + float64(b.minRetries)
+	if b.retries+1 > allowed {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// Stats returns the request and retry counts for the current window
+func (b *RetryBudget) Stats() (requests, retries int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate()
+	return int(b.requests), int(b.retries)
+}
+
+// rotate decays the counters once per elapsed window so that old traffic
+// still counts for something but cannot fund retries indefinitely.
+// Must be called with lock held.
+func (b *RetryBudget) rotate() {
+	now := b.now()
+	for now.Sub(b.windowStart) >= b.window {
+		b.requests /= 2
+		b.retries /= 2
+		b.windowStart = b.windowStart.Add(b.window)
+		if b.requests < 1 && b.retries < 1 {
+			b.requests, b.retries = 0, 0
+			b.windowStart = now
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudget_PercentOfRequests(t *testing.T) {
+	budget := NewRetryBudget(20, 0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		budget.RecordRequest()
+	}
+
+	// 20% of 10 requests = 2 retries
+	if !budget.TryAcquire() || !budget.TryAcquire() {
+		t.Fatal("Expected two retries to be allowed")
+	}
+	if budget.TryAcquire() {
+		t.Error("Expected third retry to be denied")
+	}
+
+	requests, retries := budget.Stats()
+	if requests != 10 || retries != 2 {
+		t.Errorf("Expected 10 requests / 2 retries, got %d / %d", requests, retries)
+	}
+}
+
+func TestRetryBudget_MinRetries(t *testing.T) {
+	budget := NewRetryBudget(10, 3, time.Minute)
+
+	// No traffic yet, but the minimum allowance still applies
+	for i := 0; i < 3; i++ {
+		if !budget.TryAcquire() {
+			t.Fatalf("Expected retry %d to be allowed by min_retries", i+1)
+		}
+	}
+	if budget.TryAcquire() {
+		t.Error("Expected retry beyond min_retries to be denied")
+	}
+}
+
+func TestRetryBudget_WindowDecay(t *testing.T) {
+	budget := NewRetryBudget(50, 0, time.Minute)
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	budget.windowStart = now
+
+	for i := 0; i < 4; i++ {
+		budget.RecordRequest()
+	}
+	budget.TryAcquire()
+	budget.TryAcquire()
+	if budget.TryAcquire() {
+		t.Fatal("Expected budget to be spent")
+	}
+
+	// After a window the counters halve: 2 requests, 1 retry -> still spent
+	now = now.Add(time.Minute)
+	if budget.TryAcquire() {
+		t.Error("Expected budget to still be spent after one window")
+	}
+
+	// New traffic refills it
+	budget.RecordRequest()
+	budget.RecordRequest()
+	if !budget.TryAcquire() {
+		t.Error("Expected new traffic to allow another retry")
+	}
+}
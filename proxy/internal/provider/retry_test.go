@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
@@ -295,3 +296,307 @@ func TestRetryWithBackoff_Retries5xxErrors(t *testing.T) {
 		t.Errorf("Expected 3 attempts, got %d", attempts)
 	}
 }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		expected   ErrorClass
+	}{
+		{"success", nil, 200, ErrorClassNone},
+		{"rate limit", nil, 429, ErrorClassRateLimit},
+		{"overloaded", nil, 529, ErrorClassOverloaded},
+		{"server error", nil, 502, ErrorClassServer},
+		{"request timeout", nil, 408, ErrorClassServer},
+		{"bad request", nil, 400, ErrorClassClient},
+		{"transport error", errors.New("connection refused"), 0, ErrorClassConnect},
+		{"client canceled", context.Canceled, 0, ErrorClassCanceled},
+		{"wrapped cancel", fmt.Errorf("failed to forward request: %w", context.Canceled), 0, ErrorClassCanceled},
+		{"upstream timeout", fmt.Errorf("failed to forward request: %w", context.DeadlineExceeded), 0, ErrorClassConnect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err, tt.statusCode); got != tt.expected {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsRetryableError_ContextCanceled(t *testing.T) {
+	if IsRetryableError(context.Canceled, 0) {
+		t.Error("Client cancellation should NOT be retryable")
+	}
+	if !IsRetryableError(fmt.Errorf("wrapped: %w", context.DeadlineExceeded), 0) {
+		t.Error("An upstream timeout should be retryable")
+	}
+}
+
+func TestRetryWithBackoff_NoRetryAfterClientCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := RetryConfig{
+		MaxRetries:        3,
+		InitialBackoff:    10 * time.Millisecond,
+		MaxBackoff:        100 * time.Millisecond,
+		BackoffMultiplier: 2.0,
+	}
+
+	callCount := 0
+	_, err, attempts := RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		cancel()
+		return nil, fmt.Errorf("failed to forward request: %w", context.Canceled)
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if callCount != 1 || attempts != 1 {
+		t.Errorf("Expected a single attempt, got %d calls / %d attempts", callCount, attempts)
+	}
+}
+
+func TestRetryWithBackoff_PerClassRules(t *testing.T) {
+	ctx := context.Background()
+	config := RetryConfig{
+		MaxRetries:        3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		BackoffMultiplier: 2.0,
+		Rules: map[ErrorClass]RetryRule{
+			ErrorClassRateLimit: {MaxRetries: 0},
+		},
+	}
+
+	callCount := 0
+	resp, _, attempts := RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		return &http.Response{StatusCode: 429, Header: http.Header{}}, nil
+	})
+
+	if resp == nil || resp.StatusCode != 429 {
+		t.Fatal("Expected the 429 response to be returned")
+	}
+	if callCount != 1 || attempts != 1 {
+		t.Errorf("Rate limit rule disables retries, expected 1 call, got %d", callCount)
+	}
+
+	// Overloaded still uses the default MaxRetries
+	callCount = 0
+	RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		return &http.Response{StatusCode: 529, Header: http.Header{}}, nil
+	})
+	if callCount != 4 {
+		t.Errorf("Expected 4 calls for overloaded (1 + 3 retries), got %d", callCount)
+	}
+}
+
+func TestRetryWithBackoff_TotalCapAcrossClasses(t *testing.T) {
+	config := RetryConfig{
+		MaxRetries:        3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		BackoffMultiplier: 2.0,
+	}
+
+	// Alternating classes never hit a per-class limit, but share one overall cap
+	statuses := []int{429, 529, 502, 429, 529, 502, 429, 529}
+	callCount := 0
+	resp, _, attempts := RetryWithBackoff(context.Background(), config, func() (*http.Response, error) {
+		status := statuses[callCount%len(statuses)]
+		callCount++
+		return &http.Response{StatusCode: status, Header: http.Header{}}, nil
+	})
+
+	if callCount != 4 || attempts != 4 {
+		t.Errorf("Expected 4 calls (1 + 3 retries overall), got %d calls / %d attempts", callCount, attempts)
+	}
+	if resp == nil || resp.StatusCode != 429 {
+		t.Errorf("Expected the last response to be returned, got %+v", resp)
+	}
+
+	// A class rule above max_retries raises the overall cap to match
+	config.Rules = map[ErrorClass]RetryRule{ErrorClassRateLimit: {MaxRetries: 5}}
+	callCount = 0
+	RetryWithBackoff(context.Background(), config, func() (*http.Response, error) {
+		callCount++
+		return &http.Response{StatusCode: 429, Header: http.Header{}}, nil
+	})
+	if callCount != 6 {
+		t.Errorf("Expected 6 calls for rate limits (1 + 5 retries), got %d", callCount)
+	}
+}
+
+func TestRetryWithBackoff_RetriesUpstreamTimeout(t *testing.T) {
+	config := RetryConfig{
+		MaxRetries:        2,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		BackoffMultiplier: 2.0,
+	}
+
+	callCount := 0
+	resp, err, _ := RetryWithBackoff(context.Background(), config, func() (*http.Response, error) {
+		callCount++
+		if callCount == 1 {
+			return nil, fmt.Errorf("failed to forward request: %w", context.DeadlineExceeded)
+		}
+		return &http.Response{StatusCode: 200}, nil
+	})
+
+	if err != nil || resp == nil || callCount != 2 {
+		t.Errorf("Expected the upstream timeout to be retried, got %d calls, err %v", callCount, err)
+	}
+
+	// The caller's own deadline still stops retrying
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	callCount = 0
+	_, err, _ = RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		return nil, fmt.Errorf("failed to forward request: %w", ctx.Err())
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || callCount != 1 {
+		t.Errorf("Expected a single attempt once the caller's deadline passed, got %d calls, err %v", callCount, err)
+	}
+}
+
+func TestRetryWithBackoff_HonorsRetryAfterMs(t *testing.T) {
+	ctx := context.Background()
+	config := RetryConfig{
+		MaxRetries:        1,
+		InitialBackoff:    time.Second, // would make the test slow if the hint were ignored
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2.0,
+		RespectRetryAfter: true,
+		MaxRetryAfter:     time.Second,
+	}
+
+	var delays []time.Duration
+	config.OnRetry = func(class ErrorClass, backoff time.Duration) {
+		delays = append(delays, backoff)
+	}
+
+	callCount := 0
+	start := time.Now()
+	_, err, _ := RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		if callCount == 1 {
+			h := http.Header{}
+			h.Set("retry-after-ms", "20")
+			return &http.Response{StatusCode: 429, Header: h}, nil
+		}
+		return &http.Response{StatusCode: 200}, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	if len(delays) != 1 || delays[0] != 20*time.Millisecond {
+		t.Errorf("Expected a single 20ms delay from retry-after-ms, got %v", delays)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Retry took too long; server hint was not honored")
+	}
+}
+
+func TestRetryWithBackoff_GivesUpOnLongRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	config := RetryConfig{
+		MaxRetries:        3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		BackoffMultiplier: 2.0,
+		RespectRetryAfter: true,
+		MaxRetryAfter:     time.Second,
+	}
+
+	callCount := 0
+	resp, _, _ := RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		h := http.Header{}
+		h.Set("retry-after", "120")
+		return &http.Response{StatusCode: 429, Header: h}, nil
+	})
+
+	if callCount != 1 {
+		t.Errorf("Expected no retries when retry-after exceeds the cap, got %d calls", callCount)
+	}
+	if resp == nil || resp.StatusCode != 429 {
+		t.Error("Expected the 429 response to be passed through")
+	}
+}
+
+func TestRetryWithBackoff_BudgetLimitsRetries(t *testing.T) {
+	ctx := context.Background()
+	config := RetryConfig{
+		MaxRetries:        5,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		BackoffMultiplier: 2.0,
+		Budget:            NewRetryBudget(0, 2, time.Minute),
+	}
+
+	exhausted := 0
+	config.OnBudgetExhausted = func(class ErrorClass) { exhausted++ }
+
+	callCount := 0
+	RetryWithBackoff(ctx, config, func() (*http.Response, error) {
+		callCount++
+		return &http.Response{StatusCode: 503}, nil
+	})
+
+	if callCount != 3 {
+		t.Errorf("Expected 3 calls (1 + 2 budgeted retries), got %d", callCount)
+	}
+	if exhausted != 1 {
+		t.Errorf("Expected budget exhaustion to be reported once, got %d", exhausted)
+	}
+}
+
+func TestApplyFullJitter(t *testing.T) {
+	backoff := 100 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		d := applyFullJitter(backoff)
+		if d < 0 || d >= backoff {
+			t.Fatalf("Jittered backoff %v out of range [0, %v)", d, backoff)
+		}
+	}
+	if applyFullJitter(0) != 0 {
+		t.Error("Jitter of zero backoff should be zero")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected time.Duration
+		ok       bool
+	}{
+		{"none", map[string]string{}, 0, false},
+		{"seconds", map[string]string{"retry-after": "7"}, 7 * time.Second, true},
+		{"milliseconds preferred", map[string]string{"retry-after": "7", "retry-after-ms": "1500"}, 1500 * time.Millisecond, true},
+		{"http date", map[string]string{"retry-after": now.Add(3 * time.Second).Format(http.TimeFormat)}, 3 * time.Second, true},
+		{"garbage", map[string]string{"retry-after": "soon"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, ok := ParseRetryAfter(h, now)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("ParseRetryAfter() = (%v, %v), want (%v, %v)", got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+)
+
+// maxStreamPeekBytes bounds how much of a stream is buffered while waiting
+// for the first content event. Pre-content events (message_start, ping) are
+// small, so hitting this limit means the stream is healthy enough to pass on.
+const maxStreamPeekBytes = 1 << 20
+
+// Stream failure phases reported in metrics
+const (
+	StreamPhasePreStream = "pre_stream"
+	StreamPhaseMidStream = "mid_stream"
+)
+
+// StreamError describes a streaming response that failed before any content
+// reached the client: either an SSE error event or an early disconnect.
+// It keeps the bytes read so far so the original stream can be replayed to
+// the client if no retry or fallback succeeds.
+type StreamError struct {
+	// Reason is the Anthropic error type (e.g. "overloaded_error") or "early_disconnect"
+	Reason  string
+	Message string
+
+	statusCode int
+	header     http.Header
+	buffered   []byte
+}
+
+func (e *StreamError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("stream failed before first content: %s: %s", e.Reason, e.Message)
+	}
+	return fmt.Sprintf("stream failed before first content: %s", e.Reason)
+}
+
+// Class maps the stream failure onto a retry error class
+func (e *StreamError) Class() ErrorClass {
+	switch e.Reason {
+	case "overloaded_error":
+		return ErrorClassOverloaded
+	case "rate_limit_error":
+		return ErrorClassRateLimit
+	case "api_error", "timeout_error":
+		return ErrorClassServer
+	case "early_disconnect":
+		return ErrorClassConnect
+	default:
+		return ErrorClassClient
+	}
+}
+
+// Response rebuilds the response as the upstream sent it, so the client sees
+// the original error event when every attempt has failed
+func (e *StreamError) Response() *http.Response {
+	return &http.Response{
+		StatusCode:    e.statusCode,
+		Header:        e.header,
+		Body:          io.NopCloser(bytes.NewReader(e.buffered)),
+		ContentLength: -1,
+	}
+}
+
+// peekedBody replays the buffered prefix and then continues with the live stream
+type peekedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *peekedBody) Close() error {
+	return b.closer.Close()
+}
+
+// PeekStream reads a successful SSE response until the first content event.
+// If the stream carries a transient error event or ends before any content,
+// it is closed and a *StreamError is returned so the caller can retry or fall
+// back without the client having seen a byte. Otherwise, including for client
+// errors such as invalid_request_error, the returned response replays
+// everything that was read.
+func PeekStream(providerName string, resp *http.Response) (*http.Response, error) {
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var buffered bytes.Buffer
+
+	fail := func(reason, message string) (*http.Response, error) {
+		resp.Body.Close()
+		metrics.RecordStreamFailure(providerName, StreamPhasePreStream, reason)
+		streamErr := &StreamError{
+			Reason:     reason,
+			Message:    message,
+			statusCode: resp.StatusCode,
+			header:     resp.Header,
+			buffered:   buffered.Bytes(),
+		}
+		if streamErr.Class() == ErrorClassClient {
+			// The request itself was rejected; another attempt or provider
+			// would not help, so hand the error event straight to the client
+			return streamErr.Response(), nil
+		}
+		return nil, streamErr
+	}
+
+	for buffered.Len() < maxStreamPeekBytes {
+		line, err := reader.ReadBytes('\n')
+		buffered.Write(line)
+
+		if data, ok := sseData(line); ok {
+			var event struct {
+				Type  string `json:"type"`
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &event) == nil {
+				switch event.Type {
+				case "error":
+					reason := event.Error.Type
+					if reason == "" {
+						reason = "api_error"
+					}
+					// Keep the rest of the event so a replay is well-formed SSE
+					for err == nil && len(bytes.TrimSpace(line)) > 0 {
+						line, err = reader.ReadBytes('\n')
+						buffered.Write(line)
+					}
+					return fail(reason, event.Error.Message)
+				case "content_block_start", "content_block_delta", "message_delta", "message_stop":
+					// Content has started (or the message legitimately ended) - hand it over
+					return replay(resp, &buffered, reader), nil
+				}
+			}
+		}
+
+		if err != nil {
+			return fail("early_disconnect", err.Error())
+		}
+	}
+
+	return replay(resp, &buffered, reader), nil
+}
+
+// replay swaps the response body for one that yields the buffered prefix first
+func replay(resp *http.Response, buffered *bytes.Buffer, rest io.Reader) *http.Response {
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(buffered.Bytes()), rest),
+		closer: resp.Body,
+	}
+	return resp
+}
+
+// sseData returns the payload of an SSE "data:" line
+func sseData(line []byte) (string, bool) {
+	text := strings.TrimRight(string(line), "\r\n")
+	if !strings.HasPrefix(text, "data:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(text, "data:")), true
+}
+
+// IsStreamingRequest reports whether an Anthropic request body asks for SSE
+func IsStreamingRequest(bodyBytes []byte) bool {
+	if len(bodyBytes) == 0 {
+		return false
+	}
+	var body struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return false
+	}
+	return body.Stream
+}
+
+// requestModel returns the model named in a request body, or ""
+func requestModel(bodyBytes []byte) string {
+	if len(bodyBytes) == 0 {
+		return ""
+	}
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return ""
+	}
+	return body.Model
+}
@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+const (
+	sseMessageStart = "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n"
+	ssePing         = "event: ping\ndata: {\"type\":\"ping\"}\n\n"
+	sseContentStart = "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n"
+	sseTextDelta    = "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n"
+	sseMessageStop  = "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	sseOverloaded   = "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+)
+
+func sseResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestPeekStream_ReplaysHealthyStream(t *testing.T) {
+	body := sseMessageStart + ssePing + sseContentStart + sseTextDelta + sseMessageStop
+
+	resp, err := PeekStream("test", sseResponse(body))
+	if err != nil {
+		t.Fatalf("Expected healthy stream to pass, got %v", err)
+	}
+
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != body {
+		t.Errorf("Expected stream to be replayed unchanged.\nGot:  %q\nWant: %q", got, body)
+	}
+}
+
+func TestPeekStream_ErrorEventBeforeContent(t *testing.T) {
+	body := sseMessageStart + sseOverloaded
+
+	resp, err := PeekStream("test", sseResponse(body))
+	if resp != nil {
+		t.Error("Expected no response for a failed stream")
+	}
+
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("Expected StreamError, got %v", err)
+	}
+	if streamErr.Reason != "overloaded_error" {
+		t.Errorf("Expected reason overloaded_error, got %s", streamErr.Reason)
+	}
+	if ClassifyError(err, 0) != ErrorClassOverloaded {
+		t.Errorf("Expected overloaded class, got %s", ClassifyError(err, 0))
+	}
+
+	// The original stream can still be handed to the client
+	replayed, _ := io.ReadAll(streamErr.Response().Body)
+	if string(replayed) != body {
+		t.Errorf("Expected buffered stream to be replayable, got %q", replayed)
+	}
+}
+
+func TestPeekStream_ClientErrorReturnedAsResponse(t *testing.T) {
+	body := sseMessageStart + "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"invalid_request_error\",\"message\":\"bad\"}}\n\n"
+
+	resp, err := PeekStream("test", sseResponse(body))
+	if err != nil {
+		t.Fatalf("Client errors must not trigger retries or fallback, got %v", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the upstream response, got %+v", resp)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != body {
+		t.Errorf("Expected the error event to be replayed unchanged, got %q", got)
+	}
+}
+
+func TestPeekStream_EarlyDisconnect(t *testing.T) {
+	_, err := PeekStream("test", sseResponse(sseMessageStart))
+
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("Expected StreamError, got %v", err)
+	}
+	if streamErr.Reason != "early_disconnect" {
+		t.Errorf("Expected reason early_disconnect, got %s", streamErr.Reason)
+	}
+	if !IsRetryableError(err, 0) {
+		t.Error("Early disconnect should be retryable")
+	}
+}
+
+func TestPeekStream_ErrorAfterContentPassesThrough(t *testing.T) {
+	body := sseMessageStart + sseContentStart + sseOverloaded
+
+	resp, err := PeekStream("test", sseResponse(body))
+	if err != nil {
+		t.Fatalf("Mid-stream errors must not be retried, got %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != body {
+		t.Errorf("Expected stream to be replayed unchanged, got %q", got)
+	}
+}
+
+func TestPeekStream_IgnoresNonSuccess(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Body: io.NopCloser(strings.NewReader("{}"))}
+
+	got, err := PeekStream("test", resp)
+	if err != nil || got != resp {
+		t.Error("Non-200 responses should be returned untouched")
+	}
+}
+
+// scriptedProvider returns a fixed sequence of SSE bodies, one per call
+type scriptedProvider struct {
+	name   string
+	bodies []string
+	calls  int
+}
+
+func (p *scriptedProvider) Name() string { return p.name }
+
+func (p *scriptedProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	i := p.calls
+	if i >= len(p.bodies) {
+		i = len(p.bodies) - 1
+	}
+	p.calls++
+	return sseResponse(p.bodies[i]), nil
+}
+
+func newStreamRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequest("POST", "http://localhost/v1/messages", strings.NewReader(`{"model":"claude","stream":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func testResilientConfig(maxRetries int) *config.ProviderConfig {
+	return &config.ProviderConfig{
+		MaxRetries: maxRetries,
+		Retry: config.RetryConfig{
+			InitialBackoffDuration: time.Millisecond,
+			MaxBackoffDuration:     time.Millisecond,
+		},
+	}
+}
+
+func TestResilientProvider_RetriesPreStreamFailure(t *testing.T) {
+	healthy := sseMessageStart + sseContentStart + sseTextDelta + sseMessageStop
+	primary := &scriptedProvider{name: "primary", bodies: []string{sseMessageStart + sseOverloaded, healthy}}
+	rp := NewResilientProvider("primary", primary, nil, testResilientConfig(2))
+
+	resp, err := rp.ForwardRequest(context.Background(), newStreamRequest(t))
+	if err != nil {
+		t.Fatalf("Expected retry to recover, got %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != healthy {
+		t.Errorf("Expected client to only see the healthy stream, got %q", got)
+	}
+}
+
+func TestResilientProvider_FallsBackOnPreStreamFailure(t *testing.T) {
+	healthy := sseMessageStart + sseContentStart + sseTextDelta + sseMessageStop
+	primary := &scriptedProvider{name: "primary", bodies: []string{sseMessageStart}}
+	fallback := &scriptedProvider{name: "fallback", bodies: []string{healthy}}
+	rp := NewResilientProvider("primary", primary, fallback, testResilientConfig(0))
+
+	resp, err := rp.ForwardRequest(context.Background(), newStreamRequest(t))
+	if err != nil {
+		t.Fatalf("Expected fallback to recover, got %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != healthy {
+		t.Errorf("Expected fallback stream, got %q", got)
+	}
+}
+
+func TestResilientProvider_SkipsDisallowedFallback(t *testing.T) {
+	healthy := sseMessageStart + sseContentStart + sseTextDelta + sseMessageStop
+	primary := &scriptedProvider{name: "primary", bodies: []string{sseMessageStart}}
+	fallback := &scriptedProvider{name: "fallback", bodies: []string{healthy}}
+	rp := NewResilientProvider("primary", primary, fallback, testResilientConfig(0))
+
+	ctx := WithAllowedProviders(context.Background(), []string{"primary"})
+	rp.ForwardRequest(ctx, newStreamRequest(t))
+	if fallback.calls != 0 {
+		t.Errorf("Expected the fallback outside the allowed providers to be skipped, got %d calls", fallback.calls)
+	}
+}
+
+func TestResilientProvider_ReplaysErrorWhenExhausted(t *testing.T) {
+	failing := sseMessageStart + sseOverloaded
+	primary := &scriptedProvider{name: "primary", bodies: []string{failing}}
+	rp := NewResilientProvider("primary", primary, nil, testResilientConfig(1))
+
+	resp, err := rp.ForwardRequest(context.Background(), newStreamRequest(t))
+	if err != nil {
+		t.Fatalf("Expected the upstream error stream to be returned, got %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != failing {
+		t.Errorf("Expected client to receive the original error event, got %q", got)
+	}
+	if primary.calls != 2 {
+		t.Errorf("Expected 2 attempts (1 retry), got %d", primary.calls)
+	}
+}
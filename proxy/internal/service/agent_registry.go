@@ -0,0 +1,569 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// agentReloadDebounce batches the burst of events an editor save produces
+const agentReloadDebounce = 500 * time.Millisecond
+
+// maxUnmatchedLogged bounds the set of unmatched prompt hashes already logged
+const maxUnmatchedLogged = 1000
+
+// agentFrontmatter is the YAML header of a Claude Code agent file
+type agentFrontmatter struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// SubagentMatch is the result of matching a system prompt against the
+// loaded agent definitions
+type SubagentMatch struct {
+	Definition SubagentDefinition
+	Similarity float64 // 1 for an exact match
+}
+
+// AgentRegistry holds the mapped subagent definitions read from agent
+// directories. Definitions are reloaded when the files change, and prompts
+// are matched exactly by hash or, failing that, by word-shingle similarity.
+type AgentRegistry struct {
+	dirs      []string
+	mappings  map[string]SubagentMapping
+	threshold float64
+	logger    *log.Logger
+
+	mu          sync.RWMutex
+	byHash      map[string]SubagentDefinition
+	definitions []agentEntry
+	unmatched   map[string]bool // prompt hashes already logged as unmatched
+
+	watcher  *fsnotify.Watcher
+	watching map[string]bool // paths watched: agent directories, or the nearest existing parent of missing ones
+	timer    *time.Timer
+	done     chan struct{}
+}
+
+// agentEntry is a definition plus its precomputed shingles
+type agentEntry struct {
+	definition SubagentDefinition
+	shingles   map[string]struct{}
+}
+
+// NewAgentRegistry creates a registry for the mapped subagents and loads
+// their definitions
+func NewAgentRegistry(cfg config.SubagentsConfig, mappings map[string]SubagentMapping, logger *log.Logger) *AgentRegistry {
+	// Fall back to the config defaults when the config wasn't built by Load
+	dirs := cfg.AgentDirs
+	if len(dirs) == 0 {
+		dirs = []string{".claude/agents", "~/.claude/agents"}
+	}
+	threshold := cfg.SimilarityThreshold
+	if threshold <= 0 {
+		threshold = 0.9
+	}
+
+	a := &AgentRegistry{
+		mappings:  mappings,
+		threshold: threshold,
+		logger:    logger,
+		byHash:    make(map[string]SubagentDefinition),
+		unmatched: make(map[string]bool),
+		watching:  make(map[string]bool),
+		done:      make(chan struct{}),
+	}
+	for _, dir := range dirs {
+		a.dirs = append(a.dirs, expandHome(dir))
+	}
+	a.Load()
+	return a
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+// Load reads every agent directory and swaps in the mapped definitions.
+// When the same agent name appears in several directories, the earliest
+// directory wins.
+func (a *AgentRegistry) Load() {
+	found := make(map[string]SubagentDefinition)
+	for _, dir := range a.dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name, prompt, err := parseAgentFile(file)
+			if err != nil {
+				a.logger.Printf("⚠️  Skipping agent file %s: %v", file, err)
+				continue
+			}
+			mapping, mapped := a.mappings[name]
+			if _, seen := found[name]; !mapped || seen {
+				continue
+			}
+			found[name] = SubagentDefinition{
+				Name:           name,
+				TargetModel:    mapping.ModelName,
+				TargetProvider: mapping.ProviderName,
+				FullPrompt:     extractStaticPrompt(prompt),
+			}
+		}
+	}
+
+	// Log warning if subagent is mapped but definition not found
+	for name, mapping := range a.mappings {
+		if _, exists := found[name]; !exists {
+			a.logger.Printf("⚠️  Subagent '%s' is mapped to '%s:%s' but no agent file with that name was found in: %s",
+				name, mapping.ProviderName, mapping.ModelName, strings.Join(a.dirs, ", "))
+		}
+	}
+
+	byHash := make(map[string]SubagentDefinition, len(found))
+	definitions := make([]agentEntry, 0, len(found))
+	for _, def := range found {
+		byHash[hashPrompt(def.FullPrompt)] = def
+		definitions = append(definitions, agentEntry{definition: def, shingles: promptShingles(def.FullPrompt)})
+	}
+
+	a.mu.Lock()
+	a.byHash = byHash
+	a.definitions = definitions
+	a.unmatched = make(map[string]bool)
+	a.mu.Unlock()
+
+	// Pretty print loaded subagents
+	if len(found) > 0 {
+		a.logger.Println("")
+		a.logger.Println("🤖 Subagent Model Mappings:")
+		a.logger.Println("──────────────────────────────────────")
+
+		for _, def := range found {
+			a.logger.Printf("   \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+				def.Name, def.TargetProvider, def.TargetModel)
+		}
+
+		a.logger.Println("──────────────────────────────────────")
+		a.logger.Println("")
+	}
+}
+
+// register adds a definition directly (used by tests)
+func (a *AgentRegistry) register(def SubagentDefinition) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.byHash[hashPrompt(def.FullPrompt)] = def
+	a.definitions = append(a.definitions, agentEntry{definition: def, shingles: promptShingles(def.FullPrompt)})
+}
+
+// parseAgentFile returns the agent name from the YAML frontmatter (falling
+// back to the file name) and the system prompt body that follows it
+func parseAgentFile(path string) (name, prompt string, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	if !strings.HasPrefix(text, "---\n") {
+		return name, strings.TrimSpace(text), nil
+	}
+	rest := text[len("---\n"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return name, strings.TrimSpace(text), nil
+	}
+
+	var meta agentFrontmatter
+	if err := yaml.Unmarshal([]byte(rest[:end]), &meta); err != nil {
+		return "", "", err
+	}
+	if meta.Name != "" {
+		name = meta.Name
+	}
+
+	body := rest[end+len("\n---"):]
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+		body = body[nl+1:]
+	} else {
+		body = ""
+	}
+	return name, strings.TrimSpace(body), nil
+}
+
+// Match finds the definition for a subagent system prompt: an exact hash
+// match of the static part first, then the most similar definition at or
+// above the threshold. Near misses and sidechain prompts that match nothing
+// are logged once per prompt.
+func (a *AgentRegistry) Match(systemPrompt string) (SubagentMatch, bool) {
+	return a.match(systemPrompt, nil)
+}
+
+// match implements Match. With a trace it scores every definition and
+// records why each did or didn't match, instead of logging misses.
+func (a *AgentRegistry) match(systemPrompt string, trace *SubagentTrace) (SubagentMatch, bool) {
+	staticPrompt := extractStaticPrompt(systemPrompt)
+	hash := hashPrompt(staticPrompt)
+
+	a.mu.RLock()
+	if trace != nil {
+		a.explainLocked(staticPrompt, hash, trace)
+	}
+	if def, exists := a.byHash[hash]; exists {
+		a.mu.RUnlock()
+		return SubagentMatch{Definition: def, Similarity: 1}, true
+	}
+
+	var best SubagentMatch
+	if len(a.definitions) > 0 && a.threshold < 1 {
+		shingles := promptShingles(staticPrompt)
+		for _, entry := range a.definitions {
+			if score := shingleSimilarity(shingles, entry.shingles); score > best.Similarity {
+				best = SubagentMatch{Definition: entry.definition, Similarity: score}
+			}
+		}
+	}
+	a.mu.RUnlock()
+
+	if best.Similarity >= a.threshold {
+		return best, true
+	}
+
+	// Only log prompts that look like subagents: near misses or sidechain markers
+	if trace == nil && (best.Similarity >= a.threshold/2 || hasSidechainMarker(staticPrompt)) {
+		a.logUnmatched(hash, staticPrompt, best)
+	}
+	return SubagentMatch{}, false
+}
+
+// explainLocked records every definition's hash and similarity to the
+// prompt, and why it did or didn't match; a.mu must be held
+func (a *AgentRegistry) explainLocked(staticPrompt, hash string, trace *SubagentTrace) {
+	trace.StaticPromptHash = hash
+	trace.Threshold = a.threshold
+
+	shingles := promptShingles(staticPrompt)
+	for _, entry := range a.definitions {
+		def := entry.definition
+		candidate := AgentCandidate{
+			Name:       def.Name,
+			Target:     def.TargetProvider + ":" + def.TargetModel,
+			PromptHash: hashPrompt(def.FullPrompt),
+			Similarity: shingleSimilarity(shingles, entry.shingles),
+		}
+		if candidate.PromptHash == hash {
+			candidate.Similarity = 1
+		}
+		trace.Candidates = append(trace.Candidates, candidate)
+	}
+	// Stable, so ties keep the order Match breaks them in
+	sort.SliceStable(trace.Candidates, func(i, j int) bool {
+		return trace.Candidates[i].Similarity > trace.Candidates[j].Similarity
+	})
+
+	_, exact := a.byHash[hash]
+	winner := ""
+	for _, candidate := range trace.Candidates {
+		if (exact && candidate.PromptHash == hash) || (!exact && a.threshold < 1 && candidate.Similarity >= a.threshold) {
+			winner = candidate.Name
+			break
+		}
+	}
+
+	for i := range trace.Candidates {
+		candidate := &trace.Candidates[i]
+		switch {
+		case candidate.Name == winner && exact:
+			candidate.Matched = true
+			candidate.Reason = "prompt hash matches"
+		case candidate.Name == winner:
+			candidate.Matched = true
+			candidate.Reason = fmt.Sprintf("similarity %.2f meets the %.2f threshold", candidate.Similarity, a.threshold)
+		case exact:
+			candidate.Reason = "prompt hash differs; " + winner + " matches it exactly"
+		case a.threshold >= 1:
+			candidate.Reason = "prompt hash differs and similarity matching is off (threshold 1)"
+		case candidate.Similarity < a.threshold:
+			candidate.Reason = fmt.Sprintf("similarity %.2f is below the %.2f threshold", candidate.Similarity, a.threshold)
+		default:
+			candidate.Reason = fmt.Sprintf("similarity %.2f meets the threshold, but %s is more similar", candidate.Similarity, winner)
+		}
+	}
+	trace.Matched = winner
+
+	for _, name := range sortedKeys(a.mappings) {
+		loaded := false
+		for _, entry := range a.definitions {
+			if entry.definition.Name == name {
+				loaded = true
+				break
+			}
+		}
+		if !loaded {
+			trace.MissingAgents = append(trace.MissingAgents, name)
+		}
+	}
+}
+
+// logUnmatched logs a subagent-like prompt that matched no definition
+func (a *AgentRegistry) logUnmatched(hash, prompt string, best SubagentMatch) {
+	a.mu.Lock()
+	if a.unmatched[hash] || len(a.unmatched) >= maxUnmatchedLogged {
+		a.mu.Unlock()
+		return
+	}
+	a.unmatched[hash] = true
+	a.mu.Unlock()
+
+	preview := prompt
+	if len(preview) > 120 {
+		preview = preview[:120]
+	}
+	logEvent := map[string]interface{}{
+		"event":       "subagent_unmatched",
+		"prompt_hash": hash,
+		"preview":     preview,
+		"best_match":  best.Definition.Name,
+		"similarity":  best.Similarity,
+		"threshold":   a.threshold,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}
+	logJSON, _ := json.Marshal(logEvent)
+	a.logger.Printf("%s", logJSON)
+}
+
+// Start watches the agent directories and reloads definitions on change.
+// A directory that doesn't exist yet is picked up once it is created.
+func (a *AgentRegistry) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	a.watcher = watcher
+	a.watchDirs()
+
+	go a.watch()
+	return nil
+}
+
+// Stop halts the directory watcher and any pending reload
+func (a *AgentRegistry) Stop() {
+	close(a.done)
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+	a.mu.Lock()
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.mu.Unlock()
+}
+
+// watchDirs watches every agent directory that exists and, for one that
+// doesn't, its nearest existing parent, so its creation is seen. It reports
+// whether an agent directory was newly watched.
+func (a *AgentRegistry) watchDirs() bool {
+	wanted := make(map[string]bool)
+	added := false
+	for _, dir := range a.dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			wanted[dir] = true
+			if a.watching[dir] {
+				continue
+			}
+			if err := a.watcher.Add(dir); err != nil {
+				a.logger.Printf("⚠️  Failed to watch agent directory %s: %v", dir, err)
+				continue
+			}
+			a.watching[dir] = true
+			added = true
+			a.logger.Printf("👀 Watching agent definitions in %s", dir)
+			continue
+		}
+
+		parent := existingParent(dir)
+		if parent == "" {
+			continue
+		}
+		wanted[parent] = true
+		if a.watching[parent] {
+			continue
+		}
+		if err := a.watcher.Add(parent); err != nil {
+			a.logger.Printf("⚠️  Failed to watch %s for agent directory %s: %v", parent, dir, err)
+			continue
+		}
+		a.watching[parent] = true
+	}
+
+	// Drop parents no longer needed, and directories that were removed
+	for path := range a.watching {
+		if !wanted[path] {
+			a.watcher.Remove(path)
+			delete(a.watching, path)
+		}
+	}
+	return added
+}
+
+// existingParent returns the nearest ancestor of path that is a directory,
+// or "" if there is none
+func existingParent(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			return parent
+		}
+		path = parent
+	}
+}
+
+// isAgentDir reports whether dir is one of the agent directories
+func (a *AgentRegistry) isAgentDir(dir string) bool {
+	for _, agentDir := range a.dirs {
+		if agentDir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AgentRegistry) watch() {
+	for {
+		select {
+		case event, ok := <-a.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(event.Name) == ".md" && a.isAgentDir(filepath.Dir(event.Name)) {
+				a.scheduleReload()
+			} else if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// An agent directory (or one on its path) came or went; a new
+				// directory may already hold agent files
+				if a.watchDirs() {
+					a.scheduleReload()
+				}
+			}
+
+		case err, ok := <-a.watcher.Errors:
+			if !ok {
+				return
+			}
+			a.logger.Printf("⚠️  Agent directory watcher error: %v", err)
+
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// scheduleReload debounces reloads so a burst of events reloads once
+func (a *AgentRegistry) scheduleReload() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.done:
+		return
+	default:
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.timer = time.AfterFunc(agentReloadDebounce, func() {
+		a.logger.Println("🔄 Agent definitions changed, reloading")
+		a.Load()
+	})
+}
+
+// extractStaticPrompt extracts the portion before "Notes:" if it exists
+func extractStaticPrompt(systemPrompt string) string {
+	// Find the "Notes:" section
+	notesIndex := strings.Index(systemPrompt, "\nNotes:")
+	if notesIndex == -1 {
+		notesIndex = strings.Index(systemPrompt, "\n\nNotes:")
+	}
+
+	if notesIndex != -1 {
+		// Return only the part before "Notes:"
+		return strings.TrimSpace(systemPrompt[:notesIndex])
+	}
+
+	// If no "Notes:" section, return the whole prompt
+	return strings.TrimSpace(systemPrompt)
+}
+
+// hashPrompt returns a short SHA-256 of a prompt
+func hashPrompt(s string) string {
+	h := sha256.New()
+	h.Write([]byte(s))
+	fullHash := hex.EncodeToString(h.Sum(nil))
+	return fullHash[:16]
+}
+
+// promptShingles returns the set of lowercase 3-word sequences in a prompt.
+// Prompts shorter than three words yield their words joined as one shingle.
+func promptShingles(prompt string) map[string]struct{} {
+	words := strings.Fields(strings.ToLower(prompt))
+	shingles := make(map[string]struct{})
+	if len(words) < 3 {
+		if len(words) > 0 {
+			shingles[strings.Join(words, " ")] = struct{}{}
+		}
+		return shingles
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		shingles[strings.Join(words[i:i+3], " ")] = struct{}{}
+	}
+	return shingles
+}
+
+// shingleSimilarity is the Dice coefficient of two shingle sets: 1 for
+// identical prompts, falling as words are edited, added, or removed
+func shingleSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for shingle := range a {
+		if _, exists := b[shingle]; exists {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// hasSidechainMarker reports whether a prompt carries a Claude Code
+// subagent marker
+func hasSidechainMarker(prompt string) bool {
+	for _, marker := range sidechainPromptMarkers {
+		if strings.Contains(prompt, marker) {
+			return true
+		}
+	}
+	return false
+}
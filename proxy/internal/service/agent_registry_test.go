@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+const reviewerPrompt = `You are a meticulous code reviewer. Read the diff carefully, point out
+correctness bugs first, then readability problems, and finish with a short
+summary of the most important changes the author should make before merging.`
+
+func writeAgentFile(t *testing.T, dir, file, name, prompt string) {
+	t.Helper()
+	content := "---\nname: " + name + "\ndescription: test agent\ntools: Read, Grep\n---\n\n" + prompt + "\n"
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write agent file: %v", err)
+	}
+}
+
+func newTestAgentRegistry(t *testing.T, dirs []string, threshold float64) (*AgentRegistry, *bytes.Buffer) {
+	t.Helper()
+	var logs bytes.Buffer
+	registry := NewAgentRegistry(
+		config.SubagentsConfig{AgentDirs: dirs, SimilarityThreshold: threshold},
+		map[string]SubagentMapping{"code-reviewer": {ProviderName: "openai", ModelName: "gpt-4o"}},
+		log.New(&logs, "", 0),
+	)
+	return registry, &logs
+}
+
+func TestParseAgentFile(t *testing.T) {
+	dir := t.TempDir()
+	writeAgentFile(t, dir, "reviewer.md", "code-reviewer", "Body line one.\n---\nBody after a rule.")
+
+	name, prompt, err := parseAgentFile(filepath.Join(dir, "reviewer.md"))
+	if err != nil {
+		t.Fatalf("parseAgentFile() error = %v", err)
+	}
+	if name != "code-reviewer" {
+		t.Errorf("name = %q, want frontmatter name over file name", name)
+	}
+	if prompt != "Body line one.\n---\nBody after a rule." {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	// Files without frontmatter are named after the file
+	plain := filepath.Join(dir, "plain.md")
+	os.WriteFile(plain, []byte("Just a prompt."), 0644)
+	if name, prompt, _ := parseAgentFile(plain); name != "plain" || prompt != "Just a prompt." {
+		t.Errorf("Got %q / %q for a file without frontmatter", name, prompt)
+	}
+}
+
+func TestAgentRegistry_MatchExactAndSimilar(t *testing.T) {
+	projectDir, userDir := t.TempDir(), t.TempDir()
+	writeAgentFile(t, projectDir, "review.md", "code-reviewer", reviewerPrompt)
+	writeAgentFile(t, userDir, "code-reviewer.md", "code-reviewer", "An older user-level reviewer prompt.")
+	registry, logs := newTestAgentRegistry(t, []string{projectDir, userDir}, 0.8)
+
+	match, ok := registry.Match(reviewerPrompt + "\n\nNotes:\n- Use absolute paths")
+	if !ok || match.Definition.Name != "code-reviewer" || match.Similarity != 1 {
+		t.Fatalf("Expected exact match from the project directory, got %+v (ok=%v)", match, ok)
+	}
+
+	edited := strings.Replace(reviewerPrompt, "meticulous", "careful", 1)
+	match, ok = registry.Match(edited)
+	if !ok || match.Similarity >= 1 || match.Similarity < 0.8 {
+		t.Errorf("Expected a fuzzy match for a one-word edit, got %+v (ok=%v)", match, ok)
+	}
+
+	if _, ok := registry.Match("You are Claude Code's main interactive assistant for software engineering."); ok {
+		t.Error("Expected an unrelated prompt not to match")
+	}
+
+	// A sidechain prompt that matches nothing is logged, once
+	sidechain := "You are an agent for Claude Code. Search the codebase for the config loader."
+	registry.Match(sidechain)
+	registry.Match(sidechain)
+	if count := strings.Count(logs.String(), `"event":"subagent_unmatched"`); count != 1 {
+		t.Errorf("Expected one unmatched log entry, got %d:\n%s", count, logs.String())
+	}
+}
+
+func TestAgentRegistry_ExactOnlyThreshold(t *testing.T) {
+	dir := t.TempDir()
+	writeAgentFile(t, dir, "review.md", "code-reviewer", reviewerPrompt)
+	registry, _ := newTestAgentRegistry(t, []string{dir}, 1)
+
+	edited := strings.Replace(reviewerPrompt, "meticulous", "careful", 1)
+	if _, ok := registry.Match(edited); ok {
+		t.Error("Expected no fuzzy matching with a threshold of 1")
+	}
+}
+
+func TestAgentRegistry_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := newTestAgentRegistry(t, []string{dir}, 1)
+	if err := registry.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer registry.Stop()
+
+	if _, ok := registry.Match(reviewerPrompt); ok {
+		t.Fatal("Expected no match before the agent file exists")
+	}
+
+	writeAgentFile(t, dir, "review.md", "code-reviewer", reviewerPrompt)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := registry.Match(reviewerPrompt); ok {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("Expected the new agent file to be picked up by the watcher")
+}
+
+func TestAgentRegistry_WatchesDirectoryCreatedLater(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".claude", "agents")
+	registry, _ := newTestAgentRegistry(t, []string{dir}, 1)
+	if err := registry.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer registry.Stop()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeAgentFile(t, dir, "review.md", "code-reviewer", reviewerPrompt)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := registry.Match(reviewerPrompt); ok {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("Expected an agent directory created after startup to be watched")
+}
+
+func TestAgentRegistry_StopCancelsPendingReload(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := newTestAgentRegistry(t, []string{dir}, 1)
+
+	writeAgentFile(t, dir, "review.md", "code-reviewer", reviewerPrompt)
+	registry.scheduleReload()
+	registry.Stop()
+	registry.scheduleReload()
+
+	time.Sleep(agentReloadDebounce + 200*time.Millisecond)
+	if _, ok := registry.Match(reviewerPrompt); ok {
+		t.Error("Expected no reload after Stop")
+	}
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Claude Code resends the whole conversation, system prompt, and tool
+// definitions on every turn, so storing each body in full grows roughly
+// quadratically per session. With storage.bodies.dedup on, these fields are
+// split out of the body into content-addressed blobs, stored once and
+// shared by every request that sends them. The requests row keeps the rest
+// of the body plus references to its blobs, and reads put it back together.
+
+// dedupFields are the top-level body fields split into blobs
+var dedupFields = []string{"system", "tools", "messages"}
+
+// bodyRef points at the blobs one body field was split into: one blob per
+// element for arrays, a single blob for anything else
+type bodyRef struct {
+	Items []string `json:"items,omitempty"`
+	Value string   `json:"value,omitempty"`
+}
+
+// bodyBlob is one piece of a split body, keyed by the sha256 of its JSON
+type bodyBlob struct {
+	hash string
+	data []byte
+}
+
+func newBodyBlob(data []byte) bodyBlob {
+	sum := sha256.Sum256(data)
+	return bodyBlob{hash: hex.EncodeToString(sum[:]), data: data}
+}
+
+// splitBody splits a request body into a skeleton holding every field but
+// dedupFields, references to where those went, and the blobs themselves.
+// refs is empty when there is nothing to split.
+func splitBody(body []byte) (skeleton []byte, refs map[string]bodyRef, blobs []bodyBlob) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, nil, nil
+	}
+
+	refs = make(map[string]bodyRef)
+	for _, name := range dedupFields {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var items []json.RawMessage
+		if json.Unmarshal(value, &items) == nil {
+			if len(items) == 0 {
+				continue
+			}
+			ref := bodyRef{Items: make([]string, len(items))}
+			for i, item := range items {
+				blob := newBodyBlob(item)
+				ref.Items[i] = blob.hash
+				blobs = append(blobs, blob)
+			}
+			refs[name] = ref
+		} else {
+			blob := newBodyBlob(value)
+			refs[name] = bodyRef{Value: blob.hash}
+			blobs = append(blobs, blob)
+		}
+		delete(fields, name)
+	}
+	if len(refs) == 0 {
+		return body, nil, nil
+	}
+
+	skeleton, err := json.Marshal(fields)
+	if err != nil {
+		return body, nil, nil
+	}
+	return skeleton, refs, blobs
+}
+
+// saveBodyBlobs stores blobs not seen before, compressed with codec, and
+// counts one more reference to each
+func saveBodyBlobs(db sqlExecer, blobs []bodyBlob, codec string) error {
+	for _, blob := range blobs {
+		result, err := db.Exec("UPDATE body_blobs SET ref_count = ref_count + 1 WHERE hash = ?", blob.hash)
+		if err != nil {
+			return fmt.Errorf("failed to reference body blob: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			continue
+		}
+
+		stored, storedCodec := compressBlob(blob.data, codec)
+		_, err = db.Exec(`
+			INSERT INTO body_blobs (hash, codec, data, size, ref_count, created_at)
+			VALUES (?, ?, ?, ?, 1, ?)
+		`, blob.hash, storedCodec, stored, len(blob.data), time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("failed to insert body blob: %w", err)
+		}
+	}
+	return nil
+}
+
+// releaseBodyBlobs drops a requests row's references to its blobs and
+// deletes the blobs no row references anymore
+func releaseBodyBlobs(db sqlExecer, refsJSON string) error {
+	var refs map[string]bodyRef
+	if err := json.Unmarshal([]byte(refsJSON), &refs); err != nil {
+		return fmt.Errorf("failed to unmarshal body refs: %w", err)
+	}
+	for _, ref := range refs {
+		hashes := ref.Items
+		if ref.Value != "" {
+			hashes = []string{ref.Value}
+		}
+		for _, hash := range hashes {
+			if _, err := db.Exec("UPDATE body_blobs SET ref_count = ref_count - 1 WHERE hash = ?", hash); err != nil {
+				return fmt.Errorf("failed to release body blob: %w", err)
+			}
+			if _, err := db.Exec("DELETE FROM body_blobs WHERE hash = ? AND ref_count <= 0", hash); err != nil {
+				return fmt.Errorf("failed to delete body blob: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// compressBlob compresses data with codec, falling back to storing it as-is
+// when that does not make it smaller
+func compressBlob(data []byte, codec string) ([]byte, string) {
+	if codec != "gzip" {
+		return data, "none"
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil || buf.Len() >= len(data) {
+		return data, "none"
+	}
+	return buf.Bytes(), "gzip"
+}
+
+func decompressBlob(data []byte, codec string) ([]byte, error) {
+	switch codec {
+	case "none":
+		return data, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unknown body blob codec '%s'", codec)
+	}
+}
+
+// bodyAssembler puts split bodies back together. Blobs are cached, since
+// requests of one session share most of theirs.
+type bodyAssembler struct {
+	db    *sql.DB
+	blobs map[string][]byte
+}
+
+func newBodyAssembler(db *sql.DB) *bodyAssembler {
+	return &bodyAssembler{db: db, blobs: make(map[string][]byte)}
+}
+
+func (a *bodyAssembler) blob(hash string) ([]byte, error) {
+	if data, ok := a.blobs[hash]; ok {
+		return data, nil
+	}
+	var codec string
+	var stored []byte
+	err := a.db.QueryRow("SELECT codec, data FROM body_blobs WHERE hash = ?", hash).Scan(&codec, &stored)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("body blob %s not found", hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query body blob: %w", err)
+	}
+	data, err := decompressBlob(stored, codec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress body blob %s: %w", hash, err)
+	}
+	a.blobs[hash] = data
+	return data, nil
+}
+
+// assemble returns the full body for a requests row; bodies stored whole
+// are returned unchanged
+func (a *bodyAssembler) assemble(body string, refsJSON sql.NullString) ([]byte, error) {
+	if !refsJSON.Valid {
+		return []byte(body), nil
+	}
+	var refs map[string]bodyRef
+	if err := json.Unmarshal([]byte(refsJSON.String), &refs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body refs: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body: %w", err)
+	}
+
+	for name, ref := range refs {
+		if ref.Value != "" {
+			data, err := a.blob(ref.Value)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = data
+			continue
+		}
+		items := make([]json.RawMessage, len(ref.Items))
+		for i, hash := range ref.Items {
+			data, err := a.blob(hash)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = data
+		}
+		value, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
+
+// storeBody prepares a body for the requests row. With dedup on, it saves
+// the body's blobs and returns the skeleton and refs to store instead.
+func (s *SQLiteStorageService) storeBody(db sqlExecer, body []byte) (string, sql.NullString, error) {
+	if !s.config.Bodies.Dedup {
+		return string(body), sql.NullString{}, nil
+	}
+	skeleton, refs, blobs := splitBody(body)
+	if len(refs) == 0 {
+		return string(body), sql.NullString{}, nil
+	}
+	refsJSON, err := json.Marshal(refs)
+	if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("failed to marshal body refs: %w", err)
+	}
+	if err := saveBodyBlobs(db, blobs, s.config.Bodies.Compression); err != nil {
+		return "", sql.NullString{}, err
+	}
+	return string(skeleton), sql.NullString{String: string(refsJSON), Valid: true}, nil
+}
+
+// MigrateRequestBodies splits the bodies of requests stored whole, in
+// batches so the proxy keeps writing in between. It returns how many were
+// split; it does nothing unless storage.bodies.dedup is on.
+func (s *SQLiteStorageService) MigrateRequestBodies() (int, error) {
+	if !s.config.Bodies.Dedup {
+		return 0, nil
+	}
+
+	migrated := 0
+	lastID := ""
+	for {
+		rows, err := s.db.Query(`
+			SELECT id, body FROM requests
+			WHERE body_refs IS NULL AND id > ?
+			ORDER BY id
+			LIMIT 100
+		`, lastID)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to query requests: %w", err)
+		}
+		type pending struct{ id, body string }
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.body); err == nil {
+				batch = append(batch, p)
+			}
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			return migrated, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			split, err := s.migrateRequestBody(p.id, p.body)
+			if err != nil {
+				return migrated, err
+			}
+			if split {
+				migrated++
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// migrateRequestBody splits one stored body, unless it has nothing to
+// split or another process got to it first
+func (s *SQLiteStorageService) migrateRequestBody(id, body string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	skeleton, refs, blobs := splitBody([]byte(body))
+	if len(refs) == 0 {
+		return false, nil
+	}
+	refsJSON, err := json.Marshal(refs)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal body refs: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE requests SET body = ?, body_refs = ?, body_size = ?
+		WHERE id = ? AND body_refs IS NULL
+	`, string(skeleton), string(refsJSON), len(body), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to update request body: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := saveBodyBlobs(tx, blobs, s.config.Bodies.Compression); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit body migration: %w", err)
+	}
+	return true, nil
+}
+
+// StartBodyMigration splits existing request bodies in the background
+func (s *SQLiteStorageService) StartBodyMigration() {
+	if !s.config.Bodies.Dedup {
+		return
+	}
+	go func() {
+		migrated, err := s.MigrateRequestBodies()
+		if err != nil {
+			log.Printf("⚠️  Error deduplicating stored request bodies: %v", err)
+		}
+		if migrated > 0 {
+			log.Printf("📦 Deduplicated %d stored request bodies", migrated)
+		}
+	}()
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// sessionTurn builds the body of turn n of a session, which resends the
+// system prompt, tools, and every earlier message
+func sessionTurn(n int) model.AnthropicRequest {
+	req := model.AnthropicRequest{
+		Model:     "claude-sonnet-4",
+		MaxTokens: 1024,
+		System: []model.AnthropicSystemMessage{
+			{Text: strings.Repeat("You are a careful coding assistant. ", 50), Type: "text"},
+		},
+		Tools: []model.Tool{
+			{Name: "Bash", Description: strings.Repeat("Runs a shell command. ", 20), InputSchema: model.InputSchema{Type: "object"}},
+			{Name: "Read", Description: strings.Repeat("Reads a file. ", 20), InputSchema: model.InputSchema{Type: "object"}},
+		},
+	}
+	for i := 0; i <= n; i++ {
+		req.Messages = append(req.Messages,
+			model.AnthropicMessage{Role: "user", Content: fmt.Sprintf("step %d: %s", i, strings.Repeat("please continue ", 30))},
+			model.AnthropicMessage{Role: "assistant", Content: fmt.Sprintf("done with step %d", i)},
+		)
+	}
+	return req
+}
+
+// asJSONValue decodes v as the stored body is decoded
+func asJSONValue(t *testing.T, v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func TestBodyStore_DedupAndMigration(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+
+	save := func(id string, body model.AnthropicRequest) {
+		t.Helper()
+		_, err := storage.SaveRequest(&model.RequestLog{
+			RequestID: id,
+			Timestamp: "2024-01-15T10:00:0" + id[len(id)-1:] + "Z",
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{},
+			Body:      body,
+			Model:     body.Model,
+		})
+		if err != nil {
+			t.Fatalf("SaveRequest() error = %v", err)
+		}
+	}
+
+	// Stored whole before dedup is turned on
+	save("req-1", sessionTurn(0))
+	save("req-2", sessionTurn(1))
+
+	storage.GetConfig().Bodies.Dedup = true
+	storage.GetConfig().Bodies.Compression = "gzip"
+	save("req-3", sessionTurn(2))
+
+	migrated, err := sqliteStorage.MigrateRequestBodies()
+	if err != nil {
+		t.Fatalf("MigrateRequestBodies() error = %v", err)
+	}
+	if migrated != 2 {
+		t.Errorf("Expected 2 bodies migrated, got %d", migrated)
+	}
+	if again, _ := sqliteStorage.MigrateRequestBodies(); again != 0 {
+		t.Errorf("Expected nothing left to migrate, got %d", again)
+	}
+
+	for i, id := range []string{"req-1", "req-2", "req-3"} {
+		req, _, err := storage.GetRequestByShortID(id)
+		if err != nil {
+			t.Fatalf("GetRequestByShortID(%s) error = %v", id, err)
+		}
+		if want := asJSONValue(t, sessionTurn(i)); !reflect.DeepEqual(req.Body, want) {
+			t.Errorf("Body of %s not reassembled:\n got %v\nwant %v", id, req.Body, want)
+		}
+	}
+	requests, _, err := storage.GetRequests(1, 10)
+	if err != nil || len(requests) != 3 {
+		t.Fatalf("GetRequests() = %d requests, %v", len(requests), err)
+	}
+	if want := asJSONValue(t, sessionTurn(2)); !reflect.DeepEqual(requests[0].Body, want) {
+		t.Error("Expected GetRequests to reassemble bodies")
+	}
+
+	// One system block, two tools, and six distinct messages, shared by all three
+	var refs int
+	var blobs int
+	sqliteStorage.db.QueryRow("SELECT COUNT(*), SUM(ref_count) FROM body_blobs").Scan(&blobs, &refs)
+	if blobs != 9 {
+		t.Errorf("Expected 9 blobs, got %d", blobs)
+	}
+	if wantRefs := 3*3 + 2 + 4 + 6; refs != wantRefs {
+		t.Errorf("Expected %d blob references, got %d", wantRefs, refs)
+	}
+
+	stats, err := storage.GetBodyStorageStats()
+	if err != nil {
+		t.Fatalf("GetBodyStorageStats() error = %v", err)
+	}
+	if stats.Requests != 3 || stats.DedupedRequests != 3 || stats.Blobs != 9 {
+		t.Errorf("Unexpected counts %+v", stats)
+	}
+	if stats.SavedBytes <= 0 || stats.StoredBytes >= stats.FullBytes || stats.SavingsRatio <= 0.5 {
+		t.Errorf("Expected dedup and compression to save most of the space, got %+v", stats)
+	}
+
+	if _, err := storage.ClearRequests(); err != nil {
+		t.Fatalf("ClearRequests() error = %v", err)
+	}
+	sqliteStorage.db.QueryRow("SELECT COUNT(*) FROM body_blobs").Scan(&blobs)
+	if blobs != 0 {
+		t.Errorf("Expected blobs cleared with the requests, got %d", blobs)
+	}
+}
+
+func TestSplitBody(t *testing.T) {
+	body := []byte(`{"model":"m","system":"be brief","messages":[{"role":"user","content":"hi"}],"tools":[]}`)
+	skeleton, refs, blobs := splitBody(body)
+	if len(refs) != 2 || refs["system"].Value == "" || len(refs["messages"].Items) != 1 || len(blobs) != 2 {
+		t.Fatalf("Unexpected split %s %+v", skeleton, refs)
+	}
+	// Empty arrays stay in the skeleton
+	if string(skeleton) != `{"model":"m","tools":[]}` {
+		t.Errorf("Unexpected skeleton %s", skeleton)
+	}
+
+	if _, refs, _ := splitBody([]byte(`{"model":"m"}`)); len(refs) != 0 {
+		t.Error("Expected nothing to split without system, tools, or messages")
+	}
+	if skeleton, refs, _ := splitBody([]byte(`not json`)); len(refs) != 0 || string(skeleton) != "not json" {
+		t.Error("Expected invalid JSON to be kept as-is")
+	}
+}
+
+func TestCompressBlob(t *testing.T) {
+	data := []byte(strings.Repeat("compressible ", 100))
+	stored, codec := compressBlob(data, "gzip")
+	if codec != "gzip" || len(stored) >= len(data) {
+		t.Fatalf("Expected gzip to shrink the blob, got codec %s and %d bytes", codec, len(stored))
+	}
+	if out, err := decompressBlob(stored, codec); err != nil || string(out) != string(data) {
+		t.Errorf("decompressBlob() = %q, %v", out, err)
+	}
+
+	// Blobs compression would grow are stored as-is
+	if _, codec := compressBlob([]byte(`"x"`), "gzip"); codec != "none" {
+		t.Errorf("Expected a tiny blob stored uncompressed, got %s", codec)
+	}
+	if _, err := decompressBlob(stored, "brotli"); err == nil {
+		t.Error("Expected an unknown codec to fail")
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Priority orders requests waiting for a concurrency slot
+type Priority int
+
+const (
+	// PriorityMain is the interactive main-agent conversation
+	PriorityMain Priority = iota
+	// PrioritySubagent is a sidechain (Task tool / subagent) request
+	PrioritySubagent
+)
+
+func (p Priority) String() string {
+	if p == PriorityMain {
+		return "main"
+	}
+	return "subagent"
+}
+
+var (
+	// ErrQueueFull is returned when a bulkhead's wait queue has no room
+	ErrQueueFull = errors.New("provider concurrency queue is full")
+	// ErrQueueTimeout is returned when a request waited too long for a slot
+	ErrQueueTimeout = errors.New("timed out waiting for a provider concurrency slot")
+)
+
+// Bulkhead limits in-flight requests to one provider or model. Requests over
+// the limit wait in a bounded queue; a freed slot goes to the oldest main-agent
+// waiter first, then the oldest subagent waiter.
+type Bulkhead struct {
+	name     string
+	limit    int
+	maxQueue int
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	queues   [2][]chan struct{} // indexed by Priority
+}
+
+// NewBulkhead creates a bulkhead allowing limit concurrent requests
+func NewBulkhead(name string, limit, maxQueue int, timeout time.Duration) *Bulkhead {
+	return &Bulkhead{
+		name:     name,
+		limit:    limit,
+		maxQueue: maxQueue,
+		timeout:  timeout,
+	}
+}
+
+// Acquire takes a slot, waiting in the queue if none is free. depth is the
+// number of requests that were ahead of this one when it joined the queue.
+// Every successful Acquire must be paired with a Release.
+func (b *Bulkhead) Acquire(ctx context.Context, priority Priority) (wait time.Duration, depth int, err error) {
+	b.mu.Lock()
+	if b.inFlight < b.limit && b.queued() == 0 {
+		b.inFlight++
+		b.updateMetrics()
+		b.mu.Unlock()
+		return 0, 0, nil
+	}
+
+	if b.queued() >= b.maxQueue {
+		b.mu.Unlock()
+		metrics.RecordQueueRejection(b.name, priority.String(), "queue_full")
+		return 0, 0, ErrQueueFull
+	}
+
+	// Main-agent requests only wait behind other main-agent requests
+	depth = len(b.queues[PriorityMain])
+	if priority == PrioritySubagent {
+		depth += len(b.queues[PrioritySubagent])
+	}
+	ready := make(chan struct{})
+	b.queues[priority] = append(b.queues[priority], ready)
+	b.updateMetrics()
+	b.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		wait = time.Since(start)
+		metrics.RecordQueueWait(b.name, priority.String(), wait.Seconds())
+		return wait, depth, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	removed := b.remove(priority, ready)
+	b.updateMetrics()
+	b.mu.Unlock()
+	if !removed {
+		// The slot was handed over just as we gave up; pass it on
+		b.Release()
+	}
+	if err == ErrQueueTimeout {
+		metrics.RecordQueueRejection(b.name, priority.String(), "timeout")
+	}
+	return time.Since(start), depth, err
+}
+
+// TryAcquire takes a slot only if one is free without queueing, reporting
+// whether it did. A successful TryAcquire must be paired with a Release.
+func (b *Bulkhead) TryAcquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight >= b.limit || b.queued() > 0 {
+		return false
+	}
+	b.inFlight++
+	b.updateMetrics()
+	return true
+}
+
+// sameLimits reports whether two bulkheads were built from the same limits
+func (b *Bulkhead) sameLimits(other *Bulkhead) bool {
+	return b.name == other.name && b.limit == other.limit && b.maxQueue == other.maxQueue && b.timeout == other.timeout
+}
+
+// Release frees a slot, handing it straight to the next waiter if any
+func (b *Bulkhead) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, p := range []Priority{PriorityMain, PrioritySubagent} {
+		if len(b.queues[p]) > 0 {
+			next := b.queues[p][0]
+			b.queues[p] = b.queues[p][1:]
+			close(next)
+			b.updateMetrics()
+			return
+		}
+	}
+	b.inFlight--
+	b.updateMetrics()
+}
+
+// queued returns the number of waiters. Must be called with lock held.
+func (b *Bulkhead) queued() int {
+	return len(b.queues[PriorityMain]) + len(b.queues[PrioritySubagent])
+}
+
+// remove drops a waiter from its queue. Must be called with lock held.
+func (b *Bulkhead) remove(priority Priority, ready chan struct{}) bool {
+	queue := b.queues[priority]
+	for i, waiter := range queue {
+		if waiter == ready {
+			b.queues[priority] = append(queue[:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// updateMetrics publishes in-flight and queue depth. Must be called with lock held.
+func (b *Bulkhead) updateMetrics() {
+	metrics.UpdateConcurrency(b.name, b.inFlight, map[string]int{
+		PriorityMain.String():     len(b.queues[PriorityMain]),
+		PrioritySubagent.String(): len(b.queues[PrioritySubagent]),
+	})
+}
+
+// ConcurrencyLimiter holds the per-provider and per-model bulkheads
+type ConcurrencyLimiter struct {
+	providers map[string]*Bulkhead
+	models    map[string]map[string]*Bulkhead // provider -> model -> bulkhead
+}
+
+// NewConcurrencyLimiter creates bulkheads for every provider with
+// concurrency limits configured
+func NewConcurrencyLimiter(providerConfigs map[string]*config.ProviderConfig) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		providers: make(map[string]*Bulkhead),
+		models:    make(map[string]map[string]*Bulkhead),
+	}
+	for name, cfg := range providerConfigs {
+		cc := cfg.Concurrency
+		if cc.MaxInFlight > 0 {
+			l.providers[name] = NewBulkhead(name, cc.MaxInFlight, cc.MaxQueue, cc.QueueTimeoutDuration)
+		}
+		for modelName, limit := range cc.Models {
+			if l.models[name] == nil {
+				l.models[name] = make(map[string]*Bulkhead)
+			}
+			l.models[name][modelName] = NewBulkhead(name+":"+modelName, limit, cc.MaxQueue, cc.QueueTimeoutDuration)
+		}
+	}
+	return l
+}
+
+// Acquire takes a slot on the model bulkhead, then the provider bulkhead.
+// info is nil when the provider has no limits. release must be called once
+// the request (including any streamed body) is finished.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, providerName, modelName string, priority Priority) (release func(), info *model.QueueInfo, err error) {
+	var held []*Bulkhead
+	release = func() {
+		for _, b := range held {
+			b.Release()
+		}
+	}
+
+	for _, b := range []*Bulkhead{l.models[providerName][modelName], l.providers[providerName]} {
+		if b == nil {
+			continue
+		}
+		if info == nil {
+			info = &model.QueueInfo{Priority: priority.String()}
+		}
+		wait, depth, err := b.Acquire(ctx, priority)
+		info.WaitMs += wait.Milliseconds()
+		info.Depth += depth
+		if err != nil {
+			release()
+			return func() {}, info, err
+		}
+		held = append(held, b)
+	}
+	return release, info, nil
+}
+
+// TryAcquire takes a slot on the model bulkhead and the provider bulkhead
+// only if both are free without queueing. ok is false if either is busy;
+// otherwise release must be called once the request is finished.
+func (l *ConcurrencyLimiter) TryAcquire(providerName, modelName string) (release func(), ok bool) {
+	var held []*Bulkhead
+	release = func() {
+		for _, b := range held {
+			b.Release()
+		}
+	}
+
+	for _, b := range []*Bulkhead{l.models[providerName][modelName], l.providers[providerName]} {
+		if b == nil {
+			continue
+		}
+		if !b.TryAcquire() {
+			release()
+			return func() {}, false
+		}
+		held = append(held, b)
+	}
+	return release, true
+}
+
+// inherit takes over the bulkheads of the limiter this one replaces on a
+// config reload where their limits are unchanged, so requests in flight and
+// queued across the reload still count against them. A bulkhead whose
+// limits changed starts empty.
+func (l *ConcurrencyLimiter) inherit(previous *ConcurrencyLimiter) {
+	for name, b := range l.providers {
+		if old := previous.providers[name]; old != nil && old.sameLimits(b) {
+			l.providers[name] = old
+		}
+	}
+	for name, models := range l.models {
+		for modelName, b := range models {
+			if old := previous.models[name][modelName]; old != nil && old.sameLimits(b) {
+				models[modelName] = old
+			}
+		}
+	}
+}
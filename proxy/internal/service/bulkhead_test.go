@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBulkhead_MainAgentJumpsSubagentQueue(t *testing.T) {
+	b := NewBulkhead("test", 1, 10, time.Second)
+	if _, _, err := b.Acquire(context.Background(), PriorityMain); err != nil {
+		t.Fatalf("Expected a free slot, got %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name string, priority Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := b.Acquire(context.Background(), priority); err != nil {
+				t.Errorf("%s: unexpected error %v", name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			b.Release()
+		}()
+	}
+
+	// Queue a subagent first, then a main-agent request
+	enqueue("subagent", PrioritySubagent)
+	waitForQueued(t, b, 1)
+	enqueue("main", PriorityMain)
+	waitForQueued(t, b, 2)
+
+	b.Release()
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "main" {
+		t.Errorf("Expected main agent to be served first, got %v", order)
+	}
+}
+
+func TestBulkhead_QueueFullAndTimeout(t *testing.T) {
+	b := NewBulkhead("test", 1, 1, 30*time.Millisecond)
+	b.Acquire(context.Background(), PriorityMain)
+
+	done := make(chan error)
+	go func() {
+		_, _, err := b.Acquire(context.Background(), PrioritySubagent)
+		done <- err
+	}()
+	waitForQueued(t, b, 1)
+
+	if _, _, err := b.Acquire(context.Background(), PriorityMain); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected queue full, got %v", err)
+	}
+	if err := <-done; !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected queue timeout, got %v", err)
+	}
+
+	// The timed-out waiter must not have leaked a slot
+	b.Release()
+	if _, _, err := b.Acquire(context.Background(), PriorityMain); err != nil {
+		t.Errorf("Expected the slot to be free again, got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter_ReportsQueueInfo(t *testing.T) {
+	limiter := NewConcurrencyLimiter(map[string]*config.ProviderConfig{
+		"local": {Concurrency: config.ConcurrencyConfig{
+			MaxInFlight:          1,
+			MaxQueue:             5,
+			QueueTimeoutDuration: time.Second,
+		}},
+	})
+
+	release, info, err := limiter.Acquire(context.Background(), "local", "llama", PriorityMain)
+	if err != nil || info == nil || info.Depth != 0 {
+		t.Fatalf("Expected an immediate slot, got info=%+v err=%v", info, err)
+	}
+
+	result := make(chan *model.QueueInfo)
+	go func() {
+		release2, info2, _ := limiter.Acquire(context.Background(), "local", "llama", PrioritySubagent)
+		release2()
+		result <- info2
+	}()
+	waitForQueued(t, limiter.providers["local"], 1)
+	time.Sleep(20 * time.Millisecond)
+	release()
+
+	info2 := <-result
+	if info2.Priority != "subagent" || info2.Depth != 0 || info2.WaitMs < 10 {
+		t.Errorf("Expected a recorded wait for the queued subagent, got %+v", info2)
+	}
+
+	if _, info, _ := limiter.Acquire(context.Background(), "unlimited", "x", PriorityMain); info != nil {
+		t.Errorf("Expected no queue info for providers without limits, got %+v", info)
+	}
+}
+
+func TestConcurrencyLimiter_InheritKeepsUnchangedBulkheads(t *testing.T) {
+	limits := func(maxInFlight int) map[string]*config.ProviderConfig {
+		return map[string]*config.ProviderConfig{
+			"local": {Concurrency: config.ConcurrencyConfig{
+				MaxInFlight:          maxInFlight,
+				MaxQueue:             5,
+				QueueTimeoutDuration: time.Second,
+				Models:               map[string]int{"llama": 1},
+			}},
+		}
+	}
+	previous := NewConcurrencyLimiter(limits(2))
+	release, _, err := previous.Acquire(context.Background(), "local", "llama", PriorityMain)
+	if err != nil {
+		t.Fatalf("Expected an immediate slot, got %v", err)
+	}
+	defer release()
+
+	// The request in flight across the reload still counts
+	next := NewConcurrencyLimiter(limits(2))
+	next.inherit(previous)
+	if next.providers["local"] != previous.providers["local"] || next.models["local"]["llama"] != previous.models["local"]["llama"] {
+		t.Fatal("Expected bulkheads with unchanged limits to be carried over")
+	}
+	if _, ok := next.TryAcquire("local", "llama"); ok {
+		t.Error("Expected the model slot to still be taken after the reload")
+	}
+
+	// A changed limit gets a new bulkhead
+	resized := NewConcurrencyLimiter(limits(3))
+	resized.inherit(previous)
+	if resized.providers["local"] == previous.providers["local"] {
+		t.Error("Expected a bulkhead whose limit changed to be replaced")
+	}
+	if resized.models["local"]["llama"] != previous.models["local"]["llama"] {
+		t.Error("Expected the unchanged model bulkhead to be carried over")
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	mainReq := &model.AnthropicRequest{System: []model.AnthropicSystemMessage{
+		{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+	}}
+	sidechain := &model.AnthropicRequest{System: []model.AnthropicSystemMessage{
+		{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+		{Text: "You are an agent for Claude Code, Anthropic's official CLI for Claude."},
+	}}
+
+	if p := requestPriority(mainReq, &RoutingDecision{}); p != PriorityMain {
+		t.Errorf("Expected main priority, got %v", p)
+	}
+	if p := requestPriority(sidechain, &RoutingDecision{}); p != PrioritySubagent {
+		t.Errorf("Expected subagent priority from the system prompt, got %v", p)
+	}
+	if p := requestPriority(mainReq, &RoutingDecision{SubagentName: "code-reviewer"}); p != PrioritySubagent {
+		t.Errorf("Expected subagent priority from the subagent match, got %v", p)
+	}
+}
+
+// waitForQueued blocks until n requests are waiting on b
+func waitForQueued(t *testing.T, b *Bulkhead, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		queued := b.queued()
+		b.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d queued requests", n)
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"encoding/json"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxCacheBreakpoints is the most cache_control breakpoints a request may
+// carry
+const maxCacheBreakpoints = 4
+
+// sessionHistory is how many recent requests per session are remembered,
+// so a main agent's prefixes survive its subagents' requests in between
+const sessionHistory = 8
+
+// CacheOptimizer adds prompt-caching breakpoints to requests that have none.
+// It remembers the prefixes of each session's recent requests; once a
+// session resends one, the stable prefixes get breakpoints: tools, system, the
+// longest reused conversation prefix, and the end of the conversation so
+// the next turn can read it.
+type CacheOptimizer struct {
+	providers   map[string]bool
+	maxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*sessionPrefixes
+}
+
+// sessionPrefixes are the prefix hashes of a session's recent requests,
+// oldest first
+type sessionPrefixes struct {
+	recent   []map[uint64]bool
+	lastSeen time.Time
+}
+
+// seen reports whether any recent request had the prefix
+func (s *sessionPrefixes) seen(h uint64) bool {
+	for _, hashes := range s.recent {
+		if hashes[h] {
+			return true
+		}
+	}
+	return false
+}
+
+// requestPrefixes are the cumulative hashes of a request's prefixes: tools,
+// tools+system, and tools+system+messages[:i+1]
+type requestPrefixes struct {
+	tools    uint64
+	system   uint64
+	messages []uint64
+}
+
+// NewCacheOptimizer creates an optimizer from prompt_caching, or returns nil
+// if it is disabled
+func NewCacheOptimizer(cfg config.PromptCachingConfig, providers map[string]*config.ProviderConfig) *CacheOptimizer {
+	if !cfg.Enabled {
+		return nil
+	}
+	o := &CacheOptimizer{
+		providers:   make(map[string]bool),
+		maxSessions: cfg.MaxSessions,
+		sessions:    make(map[string]*sessionPrefixes),
+	}
+	if o.maxSessions <= 0 {
+		o.maxSessions = 10000
+	}
+	if len(cfg.Providers) > 0 {
+		for _, name := range cfg.Providers {
+			o.providers[name] = true
+		}
+	} else {
+		for name, provider := range providers {
+			if provider.Format == "anthropic" {
+				o.providers[name] = true
+			}
+		}
+	}
+	return o
+}
+
+// Optimize adds breakpoints to a request routed to providerName and
+// returns how many it added. Requests without a session, or that already
+// have breakpoints, are left alone.
+func (o *CacheOptimizer) Optimize(req *model.AnthropicRequest, providerName, sessionID string) int {
+	if o == nil || sessionID == "" || !o.providers[providerName] {
+		return 0
+	}
+
+	prefixes := hashPrefixes(req)
+	previous := o.observe(sessionID, prefixes)
+	if previous == nil || hasCacheBreakpoints(req) {
+		return 0
+	}
+
+	added := 0
+	if len(req.Tools) > 0 && previous.seen(prefixes.tools) {
+		tools := make([]model.Tool, len(req.Tools))
+		copy(tools, req.Tools)
+		tools[len(tools)-1].CacheControl = &model.CacheControl{Type: "ephemeral"}
+		req.Tools = tools
+		added++
+	}
+	if len(req.System) > 0 && previous.seen(prefixes.system) {
+		system := make([]model.AnthropicSystemMessage, len(req.System))
+		copy(system, req.System)
+		system[len(system)-1].CacheControl = &model.CacheControl{Type: "ephemeral"}
+		req.System = system
+		added++
+	}
+
+	// The longest conversation prefix the last request also sent is read
+	// from the cache; the end of this one is written for the next turn
+	reused := -1
+	for i := len(prefixes.messages) - 1; i >= 0; i-- {
+		if previous.seen(prefixes.messages[i]) {
+			reused = i
+			break
+		}
+	}
+	if reused >= 0 {
+		messages := make([]model.AnthropicMessage, len(req.Messages))
+		copy(messages, req.Messages)
+		targets := []int{reused}
+		if last := len(messages) - 1; last != reused {
+			targets = append(targets, last)
+		}
+		for _, i := range targets {
+			if added == maxCacheBreakpoints {
+				break
+			}
+			if marked, ok := withCacheControl(messages[i]); ok {
+				messages[i] = marked
+				added++
+			}
+		}
+		req.Messages = messages
+	}
+
+	if added > 0 {
+		metrics.RecordCacheBreakpoints(providerName, added)
+	}
+	return added
+}
+
+// observe records a request's prefixes for its session and returns a
+// snapshot of the session's earlier requests, or nil if there were none
+func (o *CacheOptimizer) observe(sessionID string, prefixes requestPrefixes) *sessionPrefixes {
+	hashes := make(map[uint64]bool, len(prefixes.messages)+2)
+	hashes[prefixes.tools] = true
+	hashes[prefixes.system] = true
+	for _, h := range prefixes.messages {
+		hashes[h] = true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	session, ok := o.sessions[sessionID]
+	if !ok {
+		if len(o.sessions) >= o.maxSessions {
+			o.evictOldest()
+		}
+		session = &sessionPrefixes{}
+		o.sessions[sessionID] = session
+	}
+
+	var previous *sessionPrefixes
+	if len(session.recent) > 0 {
+		previous = &sessionPrefixes{recent: session.recent}
+	}
+	// Append to a fresh slice so the snapshot stays unchanged
+	recent := append([]map[uint64]bool{}, session.recent...)
+	recent = append(recent, hashes)
+	if len(recent) > sessionHistory {
+		recent = recent[1:]
+	}
+	session.recent = recent
+	session.lastSeen = time.Now()
+	return previous
+}
+
+// evictOldest forgets the least recently seen session. Callers hold o.mu.
+func (o *CacheOptimizer) evictOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, session := range o.sessions {
+		if oldestID == "" || session.lastSeen.Before(oldest) {
+			oldestID, oldest = id, session.lastSeen
+		}
+	}
+	delete(o.sessions, oldestID)
+}
+
+// hashPrefixes hashes a request's prefixes in the order the provider
+// caches them: tools, then system, then messages
+func hashPrefixes(req *model.AnthropicRequest) requestPrefixes {
+	h := fnv.New64a()
+	var prefixes requestPrefixes
+	writeJSON(h, req.Tools)
+	prefixes.tools = h.Sum64()
+	writeJSON(h, req.System)
+	prefixes.system = h.Sum64()
+	for _, msg := range req.Messages {
+		writeJSON(h, msg)
+		prefixes.messages = append(prefixes.messages, h.Sum64())
+	}
+	return prefixes
+}
+
+func writeJSON(h hash.Hash64, v interface{}) {
+	data, _ := json.Marshal(v)
+	h.Write(data)
+	h.Write([]byte{0})
+}
+
+// hasCacheBreakpoints reports whether the client set any breakpoints itself
+func hasCacheBreakpoints(req *model.AnthropicRequest) bool {
+	for _, tool := range req.Tools {
+		if tool.CacheControl != nil {
+			return true
+		}
+	}
+	for _, block := range req.System {
+		if block.CacheControl != nil {
+			return true
+		}
+	}
+	for _, msg := range req.Messages {
+		if hasMessageBreakpoint(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMessageBreakpoint(msg model.AnthropicMessage) bool {
+	blocks, ok := msg.Content.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range blocks {
+		if block, ok := item.(map[string]interface{}); ok && block["cache_control"] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// withCacheControl returns a copy of msg with a breakpoint on its last
+// block that can carry one (thinking blocks cannot)
+func withCacheControl(msg model.AnthropicMessage) (model.AnthropicMessage, bool) {
+	breakpoint := map[string]interface{}{"type": "ephemeral"}
+	switch content := msg.Content.(type) {
+	case string:
+		if content == "" {
+			return msg, false
+		}
+		msg.Content = []interface{}{map[string]interface{}{"type": "text", "text": content, "cache_control": breakpoint}}
+		return msg, true
+	case []interface{}:
+		for i := len(content) - 1; i >= 0; i-- {
+			block, ok := content[i].(map[string]interface{})
+			if !ok || block["type"] == "thinking" || block["type"] == "redacted_thinking" {
+				continue
+			}
+			marked := make(map[string]interface{}, len(block)+1)
+			for k, v := range block {
+				marked[k] = v
+			}
+			marked["cache_control"] = breakpoint
+			blocks := make([]interface{}, len(content))
+			copy(blocks, content)
+			blocks[i] = marked
+			msg.Content = blocks
+			return msg, true
+		}
+	}
+	return msg, false
+}
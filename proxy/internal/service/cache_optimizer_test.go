@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func newTestCacheOptimizer(maxSessions int) *CacheOptimizer {
+	return NewCacheOptimizer(config.PromptCachingConfig{Enabled: true, MaxSessions: maxSessions}, map[string]*config.ProviderConfig{
+		"anthropic": {Format: "anthropic"},
+		"openai":    {Format: "openai"},
+	})
+}
+
+func conversation(turns ...string) *model.AnthropicRequest {
+	req := &model.AnthropicRequest{
+		Model:  "claude-sonnet-4",
+		System: []model.AnthropicSystemMessage{{Type: "text", Text: "You are Claude Code"}},
+		Tools:  []model.Tool{{Name: "Read"}, {Name: "Bash"}},
+	}
+	for i, text := range turns {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		req.Messages = append(req.Messages, model.AnthropicMessage{Role: role, Content: text})
+	}
+	return req
+}
+
+func TestCacheOptimizer_FollowUpTurn(t *testing.T) {
+	optimizer := newTestCacheOptimizer(0)
+
+	first := conversation("List the files")
+	if added := optimizer.Optimize(first, "anthropic", "session-1"); added != 0 {
+		t.Errorf("Expected no breakpoints on a session's first request, got %d", added)
+	}
+
+	next := conversation("List the files", "Here they are", "Now read main.go")
+	if added := optimizer.Optimize(next, "anthropic", "session-1"); added != 4 {
+		t.Fatalf("Expected four breakpoints, got %d", added)
+	}
+	if next.Tools[1].CacheControl == nil || next.Tools[0].CacheControl != nil {
+		t.Errorf("Expected a breakpoint on the last tool only, got %+v", next.Tools)
+	}
+	if next.System[0].CacheControl == nil {
+		t.Error("Expected a breakpoint on the system prompt")
+	}
+	if !hasMessageBreakpoint(next.Messages[0]) || hasMessageBreakpoint(next.Messages[1]) || !hasMessageBreakpoint(next.Messages[2]) {
+		t.Errorf("Expected breakpoints on the reused turn and the last turn, got %+v", next.Messages)
+	}
+
+	// The first request was not touched when the follow-up was marked
+	if first.Tools[1].CacheControl != nil || hasMessageBreakpoint(first.Messages[0]) {
+		t.Error("Expected the earlier request to be left alone")
+	}
+}
+
+func TestCacheOptimizer_LeavesRequestsAlone(t *testing.T) {
+	optimizer := newTestCacheOptimizer(0)
+
+	// Client breakpoints are respected
+	optimizer.Optimize(conversation("hi"), "anthropic", "session-1")
+	marked := conversation("hi", "hello", "again")
+	marked.System[0].CacheControl = &model.CacheControl{Type: "ephemeral"}
+	if added := optimizer.Optimize(marked, "anthropic", "session-1"); added != 0 {
+		t.Errorf("Expected client breakpoints to be kept as is, got %d added", added)
+	}
+
+	// Providers outside prompt_caching.providers, and requests without a
+	// session, are skipped
+	optimizer.Optimize(conversation("hi"), "openai", "session-2")
+	if added := optimizer.Optimize(conversation("hi", "hello", "again"), "openai", "session-2"); added != 0 {
+		t.Errorf("Expected no breakpoints for an openai-format provider, got %d", added)
+	}
+	optimizer.Optimize(conversation("hi"), "anthropic", "")
+	if added := optimizer.Optimize(conversation("hi", "hello", "again"), "anthropic", ""); added != 0 {
+		t.Errorf("Expected no breakpoints without a session, got %d", added)
+	}
+
+	// A nil optimizer is disabled prompt caching
+	if NewCacheOptimizer(config.PromptCachingConfig{}, nil) != nil {
+		t.Error("Expected a nil optimizer when prompt caching is disabled")
+	}
+	var disabled *CacheOptimizer
+	if added := disabled.Optimize(conversation("hi"), "anthropic", "session-1"); added != 0 {
+		t.Errorf("Expected a nil optimizer to add nothing, got %d", added)
+	}
+}
+
+func TestCacheOptimizer_EvictsOldestSession(t *testing.T) {
+	optimizer := newTestCacheOptimizer(1)
+
+	optimizer.Optimize(conversation("hi"), "anthropic", "session-1")
+	optimizer.Optimize(conversation("hi"), "anthropic", "session-2")
+	if len(optimizer.sessions) != 1 {
+		t.Fatalf("Expected one remembered session, got %d", len(optimizer.sessions))
+	}
+
+	// session-1 was forgotten, so its follow-up counts as a first request
+	if added := optimizer.Optimize(conversation("hi", "hello", "again"), "anthropic", "session-1"); added != 0 {
+		t.Errorf("Expected an evicted session to start over, got %d", added)
+	}
+}
@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ErrInvalidConfigChange is returned for config write API changes that fail
+// validation; config.yaml is left untouched
+var ErrInvalidConfigChange = errors.New("invalid config change")
+
+// ErrConfigRevisionNotFound is returned when rolling back to a revision that
+// does not exist
+var ErrConfigRevisionNotFound = errors.New("config revision not found")
+
+// SubagentsPatch changes subagent routing. A nil mapping target removes the
+// mapping.
+type SubagentsPatch struct {
+	Enable   *bool              `json:"enable"`
+	Mappings map[string]*string `json:"mappings"`
+}
+
+// RoutingPatch changes preference routing. A nil profile or task removes it.
+type RoutingPatch struct {
+	Preferences      *config.PreferencesConfig                `json:"preferences"`
+	ProviderProfiles map[string]*config.ProviderProfileConfig `json:"provider_profiles"`
+	Tasks            map[string]*config.TaskRoutingConfig     `json:"tasks"`
+}
+
+// ConfigEditor applies config write API changes to config.yaml, keeping its
+// comments and layout, then reloads it so the change takes effect. Every
+// change is recorded as a revision that can be rolled back to.
+type ConfigEditor struct {
+	reloader *ConfigReloader
+	storage  StorageService
+	logger   *log.Logger
+
+	mu sync.Mutex // serializes edits
+}
+
+// NewConfigEditor creates an editor for the reloader's config file
+func NewConfigEditor(reloader *ConfigReloader, storage StorageService, logger *log.Logger) *ConfigEditor {
+	return &ConfigEditor{
+		reloader: reloader,
+		storage:  storage,
+		logger:   logger,
+	}
+}
+
+// PatchSubagents enables or disables subagent routing and adds, changes, or
+// removes agent mappings
+func (e *ConfigEditor) PatchSubagents(patch SubagentsPatch, author string) (*model.ConfigRevision, error) {
+	cfg := e.reloader.Current().Config
+	var changes []string
+
+	return e.apply(author, func(doc *yaml.Node) error {
+		if patch.Enable != nil {
+			setMapValue(mappingAt(doc, "subagents"), "enable", scalarNode(fmt.Sprint(*patch.Enable), "!!bool"))
+			changes = append(changes, fmt.Sprintf("subagents.enable=%t", *patch.Enable))
+		}
+
+		if len(patch.Mappings) == 0 {
+			return nil
+		}
+		mappings := mappingAt(doc, "subagents", "mappings")
+		for _, name := range sortedKeys(patch.Mappings) {
+			target := patch.Mappings[name]
+			if target == nil {
+				if !deleteMapKey(mappings, name) {
+					return fmt.Errorf("no subagent mapping named '%s'", name)
+				}
+				changes = append(changes, "removed mapping "+name)
+				continue
+			}
+			if err := validateTarget(cfg, *target); err != nil {
+				return fmt.Errorf("subagent '%s': %w", name, err)
+			}
+			setMapValue(mappings, name, scalarNode(*target, "!!str"))
+			changes = append(changes, fmt.Sprintf("mapping %s=%s", name, *target))
+		}
+		return nil
+	}, func() string { return strings.Join(changes, ", ") })
+}
+
+// PatchRouting changes the default preference and adds, changes, or removes
+// provider profiles and task preferences
+func (e *ConfigEditor) PatchRouting(patch RoutingPatch, author string) (*model.ConfigRevision, error) {
+	var changes []string
+
+	return e.apply(author, func(doc *yaml.Node) error {
+		if patch.Preferences != nil {
+			if err := validatePreference(patch.Preferences.Default); err != nil {
+				return fmt.Errorf("preferences.default: %w", err)
+			}
+			setMapValue(mappingAt(doc, "routing", "preferences"), "default", scalarNode(patch.Preferences.Default, "!!str"))
+			changes = append(changes, "default preference="+patch.Preferences.Default)
+		}
+
+		for _, name := range sortedKeys(patch.ProviderProfiles) {
+			profiles := mappingAt(doc, "routing", "provider_profiles")
+			profile := patch.ProviderProfiles[name]
+			if profile == nil {
+				if !deleteMapKey(profiles, name) {
+					return fmt.Errorf("no provider profile named '%s'", name)
+				}
+				changes = append(changes, "removed profile "+name)
+				continue
+			}
+			for field, value := range map[string]int{"speed": profile.Speed, "cost": profile.Cost, "quality": profile.Quality} {
+				if value < 1 || value > 10 {
+					return fmt.Errorf("provider profile '%s': %s must be between 1 and 10", name, field)
+				}
+			}
+			if err := setMapValueFrom(profiles, name, profile); err != nil {
+				return err
+			}
+			changes = append(changes, "profile "+name)
+		}
+
+		for _, name := range sortedKeys(patch.Tasks) {
+			tasks := mappingAt(doc, "routing", "tasks")
+			task := patch.Tasks[name]
+			if task == nil {
+				if !deleteMapKey(tasks, name) {
+					return fmt.Errorf("no task named '%s'", name)
+				}
+				changes = append(changes, "removed task "+name)
+				continue
+			}
+			if err := validatePreference(task.Preference); err != nil {
+				return fmt.Errorf("task '%s': %w", name, err)
+			}
+			if err := setMapValueFrom(tasks, name, task); err != nil {
+				return err
+			}
+			changes = append(changes, "task "+name)
+		}
+		return nil
+	}, func() string { return strings.Join(changes, ", ") })
+}
+
+// ReplaceRules replaces the ordered routing.rules list
+func (e *ConfigEditor) ReplaceRules(rules []config.RoutingRuleConfig, author string) (*model.ConfigRevision, error) {
+	return e.apply(author, func(doc *yaml.Node) error {
+		if rules == nil {
+			rules = []config.RoutingRuleConfig{}
+		}
+		return setMapValueFrom(mappingAt(doc, "routing"), "rules", rules)
+	}, func() string { return fmt.Sprintf("routing rules (%d)", len(rules)) })
+}
+
+// Rollback restores config.yaml to the content of an earlier revision,
+// recorded as a new revision
+func (e *ConfigEditor) Rollback(id int64, author string) (*model.ConfigRevision, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	revision, err := e.storage.GetConfigRevision(id)
+	if err != nil {
+		return nil, err
+	}
+	if revision == nil {
+		return nil, ErrConfigRevisionNotFound
+	}
+
+	previous, err := e.readConfig()
+	if err != nil {
+		return nil, err
+	}
+	return e.write(previous, []byte(revision.Content), author, fmt.Sprintf("rollback to revision %d", id))
+}
+
+// Revisions returns recent revisions, newest first, without their content
+func (e *ConfigEditor) Revisions(limit int) ([]*model.ConfigRevision, error) {
+	return e.storage.GetConfigRevisions(limit)
+}
+
+// Revision returns a revision including the config.yaml content it recorded
+func (e *ConfigEditor) Revision(id int64) (*model.ConfigRevision, error) {
+	revision, err := e.storage.GetConfigRevision(id)
+	if err == nil && revision == nil {
+		err = ErrConfigRevisionNotFound
+	}
+	return revision, err
+}
+
+// apply edits the parsed config.yaml and writes it back. A change that leaves
+// the file as it was returns a nil revision.
+func (e *ConfigEditor) apply(author string, edit func(doc *yaml.Node) error, summary func() string) (*model.ConfigRevision, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	previous, err := e.readConfig()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(previous)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigChange, err)
+	}
+	if err := edit(doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigChange, err)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	encoder.Close()
+
+	return e.write(previous, buf.Bytes(), author, summary())
+}
+
+func (e *ConfigEditor) readConfig() ([]byte, error) {
+	data, err := os.ReadFile(e.reloader.Path())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// write validates content with the same checks as startup, replaces
+// config.yaml with it, and reloads. If the reload fails the previous file is
+// restored.
+func (e *ConfigEditor) write(previous, content []byte, author, summary string) (*model.ConfigRevision, error) {
+	if bytes.Equal(previous, content) {
+		return nil, nil
+	}
+
+	path := e.reloader.Path()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+
+	if _, err := config.LoadFile(tmp.Name()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigChange, err)
+	}
+
+	// The first change records the hand-written file, so it can be restored
+	if len(previous) > 0 {
+		existing, err := e.storage.GetConfigRevisions(1)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			baseline := &model.ConfigRevision{CreatedAt: time.Now(), Author: "config.yaml", Summary: "baseline", Content: string(previous)}
+			if err := e.storage.SaveConfigRevision(baseline); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	if err := e.reloader.Reload(); err != nil {
+		if restoreErr := os.WriteFile(path, previous, 0644); restoreErr != nil {
+			e.logger.Printf("❌ Failed to restore %s: %v", path, restoreErr)
+		}
+		e.reloader.Reload()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigChange, err)
+	}
+
+	revision := &model.ConfigRevision{
+		CreatedAt: time.Now(),
+		Author:    author,
+		Summary:   summary,
+		Content:   string(content),
+	}
+	if err := e.storage.SaveConfigRevision(revision); err != nil {
+		return nil, err
+	}
+	e.logger.Printf("📝 Config revision %d by %s: %s", revision.ID, author, summary)
+	return revision, nil
+}
+
+// validateTarget checks a "provider:model" target against the live config
+func validateTarget(cfg *config.Config, target string) error {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid target '%s' (expected 'provider:model')", target)
+	}
+	if _, exists := cfg.Providers[parts[0]]; !exists {
+		return fmt.Errorf("unknown provider '%s'", parts[0])
+	}
+	return nil
+}
+
+func validatePreference(preference string) error {
+	switch preference {
+	case "cost", "speed", "quality", "balanced":
+		return nil
+	}
+	return fmt.Errorf("invalid preference '%s' (must be cost, speed, quality, or balanced)", preference)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseDocument parses config.yaml into a node tree, so it can be edited
+// without losing comments. Empty input gives an empty mapping.
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config.yaml must be a mapping")
+	}
+	return &doc, nil
+}
+
+// mappingAt returns the mapping at path, creating it (or replacing a null
+// placeholder such as "mappings:") if needed
+func mappingAt(doc *yaml.Node, path ...string) *yaml.Node {
+	node := doc.Content[0]
+	for _, key := range path {
+		child := mapValue(node, key)
+		if child == nil || child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMapValue(node, key, child)
+		}
+		node = child
+	}
+	return node
+}
+
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMapValue replaces key's value, keeping the old value's trailing
+// comment (and quoting, for scalars), or appends the key
+func setMapValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			old := m.Content[i+1]
+			if value.LineComment == "" {
+				value.LineComment = old.LineComment
+			}
+			if value.Kind == yaml.ScalarNode && old.Kind == yaml.ScalarNode {
+				value.Style = old.Style
+			}
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, scalarNode(key, "!!str"), value)
+}
+
+func setMapValueFrom(m *yaml.Node, key string, v interface{}) error {
+	var value yaml.Node
+	if err := value.Encode(v); err != nil {
+		return err
+	}
+	setMapValue(m, key, &value)
+	return nil
+}
+
+func deleteMapKey(m *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func scalarNode(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
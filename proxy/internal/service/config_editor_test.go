@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+const editorTestConfig = `# Hand-written header comment
+providers:
+  anthropic:
+    format: anthropic
+    base_url: "https://api.anthropic.com"
+  openai:
+    format: openai
+    base_url: "https://api.openai.com"
+    api_key: "test"
+
+subagents:
+  enable: true
+  mappings:
+    # Route reviews to OpenAI
+    code-reviewer: "openai:gpt-4o" # keep this comment
+
+routing:
+  preferences:
+    default: balanced
+  provider_profiles:
+    openai:
+      speed: 8
+      cost: 5
+      quality: 9
+`
+
+func newTestConfigEditor(t *testing.T) (*ConfigEditor, string) {
+	t.Helper()
+	storage, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+
+	reloader, path, _ := newTestConfigReloader(t, editorTestConfig)
+	t.Cleanup(reloader.Stop)
+	return NewConfigEditor(reloader, storage, reloader.logger), path
+}
+
+func readConfigFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	return string(data)
+}
+
+func TestConfigEditorPatchSubagents(t *testing.T) {
+	editor, path := newTestConfigEditor(t)
+
+	target := "anthropic:claude-3-5-haiku-20241022"
+	revision, err := editor.PatchSubagents(SubagentsPatch{
+		Mappings: map[string]*string{"code-reviewer": nil, "janitor": &target},
+	}, "alice")
+	if err != nil {
+		t.Fatalf("PatchSubagents failed: %v", err)
+	}
+	if revision == nil || revision.Author != "alice" || !strings.Contains(revision.Summary, "removed mapping code-reviewer") {
+		t.Fatalf("Unexpected revision: %+v", revision)
+	}
+
+	// Applied live
+	mappings := editor.reloader.Current().Config.Subagents.Mappings
+	if mappings["janitor"] != target || mappings["code-reviewer"] != "" {
+		t.Errorf("Expected live mappings to be updated, got %v", mappings)
+	}
+
+	// Written back without losing the rest of the file
+	content := readConfigFile(t, path)
+	if !strings.Contains(content, "# Hand-written header comment") {
+		t.Errorf("Expected comments to be kept, got:\n%s", content)
+	}
+	if !strings.Contains(content, "janitor: anthropic:claude-3-5-haiku-20241022") {
+		t.Errorf("Expected new mapping in file, got:\n%s", content)
+	}
+
+	// The hand-written file is kept as a baseline revision
+	revisions, err := editor.Revisions(10)
+	if err != nil {
+		t.Fatalf("Revisions failed: %v", err)
+	}
+	if len(revisions) != 2 || revisions[1].Summary != "baseline" {
+		t.Fatalf("Expected the change and a baseline revision, got %+v", revisions)
+	}
+
+	// Repeating the change is a no-op
+	revision, err = editor.PatchSubagents(SubagentsPatch{Mappings: map[string]*string{"janitor": &target}}, "alice")
+	if err != nil || revision != nil {
+		t.Errorf("Expected no revision for an unchanged config, got %+v, %v", revision, err)
+	}
+}
+
+func TestConfigEditorRejectsInvalidChanges(t *testing.T) {
+	unknown := "groq:llama"
+	malformed := "gpt-4o"
+	stream := true
+
+	tests := []struct {
+		name  string
+		apply func(e *ConfigEditor) error
+	}{
+		{"unknown provider", func(e *ConfigEditor) error {
+			_, err := e.PatchSubagents(SubagentsPatch{Mappings: map[string]*string{"janitor": &unknown}}, "test")
+			return err
+		}},
+		{"malformed target", func(e *ConfigEditor) error {
+			_, err := e.PatchSubagents(SubagentsPatch{Mappings: map[string]*string{"janitor": &malformed}}, "test")
+			return err
+		}},
+		{"missing mapping", func(e *ConfigEditor) error {
+			_, err := e.PatchSubagents(SubagentsPatch{Mappings: map[string]*string{"nobody": nil}}, "test")
+			return err
+		}},
+		{"bad preference", func(e *ConfigEditor) error {
+			_, err := e.PatchRouting(RoutingPatch{Preferences: &config.PreferencesConfig{Default: "cheapest"}}, "test")
+			return err
+		}},
+		{"profile out of range", func(e *ConfigEditor) error {
+			_, err := e.PatchRouting(RoutingPatch{ProviderProfiles: map[string]*config.ProviderProfileConfig{
+				"openai": {Speed: 11, Cost: 5, Quality: 9},
+			}}, "test")
+			return err
+		}},
+		{"rule fails validation", func(e *ConfigEditor) error {
+			_, err := e.ReplaceRules([]config.RoutingRuleConfig{
+				{ID: "both", Match: config.RuleMatchConfig{Stream: &stream}, Target: "openai:gpt-4o", Preference: "cost"},
+			}, "test")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor, path := newTestConfigEditor(t)
+			initial := editor.reloader.Current()
+
+			err := tt.apply(editor)
+			if !errors.Is(err, ErrInvalidConfigChange) {
+				t.Fatalf("Expected ErrInvalidConfigChange, got %v", err)
+			}
+			if content := readConfigFile(t, path); content != editorTestConfig {
+				t.Errorf("Expected config.yaml to be untouched, got:\n%s", content)
+			}
+			if editor.reloader.Current() != initial {
+				t.Error("Expected the live config to be unchanged")
+			}
+			if revisions, _ := editor.Revisions(10); len(revisions) != 0 {
+				t.Errorf("Expected no revisions, got %d", len(revisions))
+			}
+		})
+	}
+}
+
+func TestConfigEditorRoutingAndRollback(t *testing.T) {
+	editor, path := newTestConfigEditor(t)
+
+	_, err := editor.PatchRouting(RoutingPatch{
+		Preferences:      &config.PreferencesConfig{Default: "cost"},
+		ProviderProfiles: map[string]*config.ProviderProfileConfig{"openai": nil},
+		Tasks:            map[string]*config.TaskRoutingConfig{"budget": {Preference: "cost", Providers: []string{"openai"}}},
+	}, "test")
+	if err != nil {
+		t.Fatalf("PatchRouting failed: %v", err)
+	}
+	_, err = editor.ReplaceRules([]config.RoutingRuleConfig{
+		{ID: "no-opus", Match: config.RuleMatchConfig{Models: []string{"*opus*"}}, Action: "reject"},
+	}, "test")
+	if err != nil {
+		t.Fatalf("ReplaceRules failed: %v", err)
+	}
+
+	routing := editor.reloader.Current().Config.Routing
+	if routing.Preferences.Default != "cost" || len(routing.ProviderProfiles) != 0 {
+		t.Errorf("Expected preference and profile changes to be live, got %+v", routing)
+	}
+	if routing.Tasks["budget"].Preference != "cost" || len(routing.Rules) != 1 || routing.Rules[0].ID != "no-opus" {
+		t.Errorf("Expected task and rule to be live, got %+v", routing)
+	}
+
+	revisions, _ := editor.Revisions(10)
+	baseline := revisions[len(revisions)-1]
+	revision, err := editor.Rollback(baseline.ID, "test")
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if revision.Summary != "rollback to revision 1" {
+		t.Errorf("Unexpected rollback summary %q", revision.Summary)
+	}
+	if content := readConfigFile(t, path); content != editorTestConfig {
+		t.Errorf("Expected the original file back, got:\n%s", content)
+	}
+	if editor.reloader.Current().Config.Routing.Preferences.Default != "balanced" {
+		t.Error("Expected the rollback to be applied live")
+	}
+
+	if _, err := editor.Rollback(999, "test"); !errors.Is(err, ErrConfigRevisionNotFound) {
+		t.Errorf("Expected ErrConfigRevisionNotFound, got %v", err)
+	}
+}
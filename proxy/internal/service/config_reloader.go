@@ -0,0 +1,271 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// configReloadDebounce coalesces the burst of events editors produce when
+// saving a file
+const configReloadDebounce = 500 * time.Millisecond
+
+// ConfigReloader re-reads config.yaml on SIGHUP or when the file changes and
+// atomically swaps in a Runtime built from it. If the new config fails to
+// load or validate, the current Runtime stays live and the error is logged
+// and reported through Status.
+type ConfigReloader struct {
+	path    string
+	storage StorageService
+	logger  *log.Logger
+
+	current atomic.Pointer[Runtime]
+	reload  sync.Mutex // serializes reloads
+	loaded  [sha256.Size]byte
+
+	mu      sync.RWMutex
+	status  model.ConfigReloadStatus
+	timer   *time.Timer
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// NewConfigReloader creates a reloader for the config at path, starting from
+// an already running Runtime
+func NewConfigReloader(path string, initial *Runtime, storage StorageService, logger *log.Logger) *ConfigReloader {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	c := &ConfigReloader{
+		path:    path,
+		storage: storage,
+		logger:  logger,
+		status: model.ConfigReloadStatus{
+			Path:       path,
+			Generation: 1,
+			LoadedAt:   time.Now(),
+		},
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	c.current.Store(initial)
+	if data, err := os.ReadFile(path); err == nil {
+		c.loaded = sha256.Sum256(data)
+	}
+	return c
+}
+
+// Path returns the config file being watched
+func (c *ConfigReloader) Path() string {
+	return c.path
+}
+
+// Current returns the live Runtime. Callers should fetch it once per request
+// so a reload mid-request doesn't mix old and new configuration.
+func (c *ConfigReloader) Current() *Runtime {
+	return c.current.Load()
+}
+
+// Status returns the generation of the live config and the last reload error
+func (c *ConfigReloader) Status() model.ConfigReloadStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// Reload loads config.yaml and, if it is valid, swaps in a new Runtime. The
+// old Runtime's background workers are stopped; its providers keep serving
+// requests that were already in flight.
+func (c *ConfigReloader) Reload() error {
+	return c.reloadFile(true)
+}
+
+// reloadFile reloads the config; unless force is set, a file whose content
+// is what was last loaded is left alone (so the write API's own reload isn't
+// repeated when the watcher sees the write)
+func (c *ConfigReloader) reloadFile(force bool) error {
+	c.reload.Lock()
+	defer c.reload.Unlock()
+
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	// LoadFile falls back to defaults for a missing file, which is right at
+	// startup but would silently wipe the config mid-rename here
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		c.recordFailure(err)
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if !force {
+		if sum == c.loaded {
+			return nil
+		}
+		c.logger.Printf("🔄 %s changed, reloading", c.path)
+	}
+
+	previous := c.current.Load()
+	cfg, err := config.LoadFile(c.path)
+	var next *Runtime
+	if err == nil {
+		next, err = previous.rebuild(cfg, c.storage)
+	}
+	if err != nil {
+		c.recordFailure(err)
+		return err
+	}
+
+	c.warnStaticChanges(previous.Config, cfg)
+
+	next.Start()
+	c.current.Store(next)
+	previous.Stop()
+	c.loaded = sum
+
+	c.mu.Lock()
+	c.status.Generation++
+	c.status.LoadedAt = time.Now()
+	c.status.LastError = ""
+	c.status.LastErrorAt = nil
+	generation := c.status.Generation
+	c.mu.Unlock()
+
+	metrics.RecordConfigReload(true)
+	c.logger.Printf("🔄 Reloaded %s (generation %d, %d providers)", c.path, generation, len(next.Providers))
+	event, _ := json.Marshal(map[string]interface{}{
+		"event":      "config_reloaded",
+		"timestamp":  time.Now().Format(time.RFC3339),
+		"path":       c.path,
+		"generation": generation,
+		"providers":  len(next.Providers),
+	})
+	c.logger.Println(string(event))
+	return nil
+}
+
+func (c *ConfigReloader) recordFailure(err error) {
+	now := time.Now()
+	c.mu.Lock()
+	c.status.LastError = err.Error()
+	c.status.LastErrorAt = &now
+	c.mu.Unlock()
+
+	metrics.RecordConfigReload(false)
+	c.logger.Printf("❌ Config reload failed, keeping the current config: %v", err)
+}
+
+// warnStaticChanges logs settings that only take effect on restart
+func (c *ConfigReloader) warnStaticChanges(previous, next *config.Config) {
+	if !reflect.DeepEqual(previous.Server, next.Server) {
+		c.logger.Printf("⚠️  Server settings changed in %s; restart to apply them", c.path)
+	}
+	if !reflect.DeepEqual(previous.Storage, next.Storage) {
+		c.logger.Printf("⚠️  Storage settings changed in %s; restart to apply them", c.path)
+	}
+}
+
+// Start reloads on SIGHUP and whenever the config file is written. The
+// file's directory is watched so editors that save by renaming still
+// trigger a reload.
+func (c *ConfigReloader) Start() error {
+	signal.Notify(c.signals, syscall.SIGHUP)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		go c.watch()
+		return err
+	}
+	c.watcher = watcher
+	if err := watcher.Add(filepath.Dir(c.path)); err != nil {
+		c.logger.Printf("⚠️  Failed to watch %s: %v", c.path, err)
+	} else {
+		c.logger.Printf("👀 Watching %s for changes (or send SIGHUP to reload)", c.path)
+	}
+
+	go c.watch()
+	return nil
+}
+
+// Stop halts the signal handler and file watcher, waits for any reload in
+// progress, then stops the live Runtime's background workers
+func (c *ConfigReloader) Stop() {
+	signal.Stop(c.signals)
+	close(c.done)
+	if c.watcher != nil {
+		c.watcher.Close()
+	}
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+
+	c.reload.Lock()
+	defer c.reload.Unlock()
+	c.current.Load().Stop()
+}
+
+func (c *ConfigReloader) watch() {
+	var events chan fsnotify.Event
+	var errs chan error
+	if c.watcher != nil {
+		events = c.watcher.Events
+		errs = c.watcher.Errors
+	}
+
+	for {
+		select {
+		case <-c.signals:
+			c.logger.Println("🔄 SIGHUP received, reloading config")
+			c.Reload()
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if filepath.Base(event.Name) == filepath.Base(c.path) &&
+				event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				c.scheduleReload()
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			c.logger.Printf("⚠️  Config watcher error: %v", err)
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *ConfigReloader) scheduleReload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(configReloadDebounce, func() {
+		c.reloadFile(false)
+	})
+}
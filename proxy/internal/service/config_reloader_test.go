@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+const reloadTestConfig = `providers:
+  anthropic:
+    format: anthropic
+    base_url: "https://api.anthropic.com"
+`
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func newTestConfigReloader(t *testing.T, content string) (*ConfigReloader, string, *bytes.Buffer) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, content)
+
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	rt, err := NewRuntime(cfg, nil, logger)
+	if err != nil {
+		t.Fatalf("Failed to build runtime: %v", err)
+	}
+	return NewConfigReloader(path, rt, nil, logger), path, &logs
+}
+
+func TestConfigReloaderSwapsRuntime(t *testing.T) {
+	reloader, path, logs := newTestConfigReloader(t, reloadTestConfig)
+	initial := reloader.Current()
+
+	writeConfigFile(t, path, reloadTestConfig+`  openai:
+    format: openai
+    base_url: "https://api.openai.com"
+    api_key: "test"
+`)
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	current := reloader.Current()
+	if current == initial {
+		t.Fatal("Expected a new runtime after reload")
+	}
+	if _, ok := current.Providers["openai"]; !ok {
+		t.Errorf("Expected reloaded runtime to have the openai provider")
+	}
+	if _, ok := initial.Providers["openai"]; ok {
+		t.Errorf("Previous runtime should be left untouched for in-flight requests")
+	}
+
+	status := reloader.Status()
+	if status.Generation != 2 || status.LastError != "" {
+		t.Errorf("Expected generation 2 with no error, got %+v", status)
+	}
+	if !strings.Contains(logs.String(), `"event":"config_reloaded"`) {
+		t.Errorf("Expected a config_reloaded event, got logs: %s", logs.String())
+	}
+}
+
+func TestConfigReloaderKeepsRuntimeOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		remove  bool
+	}{
+		{name: "invalid yaml", content: "providers: [not: valid"},
+		{name: "failed validation", content: reloadTestConfig + "    circuit_breaker:\n      enabled: true\n      mode: sometimes\n"},
+		{name: "no usable providers", content: "providers:\n  anthropic:\n    format: carrier-pigeon\n"},
+		{name: "file removed", remove: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader, path, logs := newTestConfigReloader(t, reloadTestConfig)
+			initial := reloader.Current()
+
+			if tt.remove {
+				os.Remove(path)
+			} else {
+				writeConfigFile(t, path, tt.content)
+			}
+			if err := reloader.Reload(); err == nil {
+				t.Fatal("Expected reload to fail")
+			}
+
+			if reloader.Current() != initial {
+				t.Error("Expected the previous runtime to stay live")
+			}
+			status := reloader.Status()
+			if status.Generation != 1 || status.LastError == "" || status.LastErrorAt == nil {
+				t.Errorf("Expected generation 1 with the error recorded, got %+v", status)
+			}
+			if !strings.Contains(logs.String(), "Config reload failed") {
+				t.Errorf("Expected the failure to be logged, got logs: %s", logs.String())
+			}
+
+			// Fixing the file clears the error
+			writeConfigFile(t, path, reloadTestConfig)
+			if err := reloader.Reload(); err != nil {
+				t.Fatalf("Reload of fixed config failed: %v", err)
+			}
+			if status := reloader.Status(); status.Generation != 2 || status.LastError != "" {
+				t.Errorf("Expected generation 2 with the error cleared, got %+v", status)
+			}
+		})
+	}
+}
+
+func TestConfigReloaderKeepsProviderState(t *testing.T) {
+	stateful := `providers:
+  anthropic:
+    format: anthropic
+    base_url: "https://api.anthropic.com"
+    circuit_breaker:
+      enabled: true
+      max_failures: 3
+      timeout: "1m"
+      per_model: true
+  openai:
+    format: openai
+    base_url: "https://api.openai.com"
+    api_key: "test"
+routing:
+  adaptive_weights:
+    enabled: true
+    interval: 1h
+    min_samples: 3
+rate_limits:
+  enabled: true
+  per_client:
+    requests_per_minute: 2
+`
+	reloader, path, _ := newTestConfigReloader(t, stateful)
+	initial := reloader.Current()
+
+	anthropic := initial.Providers["anthropic"].(*provider.ResilientProvider)
+	if err := anthropic.ForceCircuitBreaker("", provider.OverrideOpen); err != nil {
+		t.Fatalf("ForceCircuitBreaker failed: %v", err)
+	}
+	if err := anthropic.ForceCircuitBreaker("claude-sonnet-4", provider.OverrideClosed); err != nil {
+		t.Fatalf("ForceCircuitBreaker failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		initial.Router.WeightController().Observe("anthropic", 2*time.Second, time.Second, false)
+		initial.Router.WeightController().Observe("openai", 200*time.Millisecond, 100*time.Millisecond, false)
+	}
+	learned := initial.Router.WeightController().Recompute()
+	for i := 0; i < 2; i++ {
+		if err := initial.RateLimiter.Allow("client-a", "", nil); err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+	}
+
+	// Any write reloads, even one that changes nothing these depend on
+	writeConfigFile(t, path, stateful+"  per_session:\n    requests_per_minute: 100\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	current := reloader.Current()
+	if current == initial {
+		t.Fatal("Expected a new runtime after reload")
+	}
+
+	reloaded := current.Providers["anthropic"].(*provider.ResilientProvider)
+	if state := reloaded.GetCircuitBreakerState(); *state != provider.StateOpen || reloaded.GetCircuitBreakerOverride() != provider.OverrideOpen {
+		t.Errorf("Expected the forced-open breaker to stay open, got %s (%s)", state, reloaded.GetCircuitBreakerOverride())
+	}
+	if models := reloaded.GetModelCircuitBreakers(); len(models) != 1 || models[0].Override != provider.OverrideClosed {
+		t.Errorf("Expected the per-model override to carry over, got %+v", models)
+	}
+
+	weights := current.Router.WeightController().Recompute()
+	if weights["openai"] != learned["openai"] || weights["anthropic"] != learned["anthropic"] {
+		t.Errorf("Expected learned weights %v to carry over, got %v", learned, weights)
+	}
+
+	if err := current.RateLimiter.Allow("client-a", "", nil); err == nil {
+		t.Error("Expected the client's spent bucket to carry over")
+	}
+	if err := current.RateLimiter.Allow("client-b", "", nil); err != nil {
+		t.Errorf("Expected a new client to get a fresh bucket: %v", err)
+	}
+}
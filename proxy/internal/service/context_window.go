@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ContextOverflowError is returned by DetermineRoute when a request is too
+// large for the routed model and no overflow alternative fits
+type ContextOverflowError struct {
+	ProviderName    string
+	Model           string
+	EstimatedTokens int
+	MaxTokens       int
+}
+
+func (e *ContextOverflowError) Error() string {
+	return fmt.Sprintf("request is too large for %s:%s: about %d tokens (input plus max_tokens) but its context window is %d tokens",
+		e.ProviderName, e.Model, e.EstimatedTokens, e.MaxTokens)
+}
+
+// ContextWindows looks up routing.context_windows entries
+type ContextWindows struct {
+	windows []config.ContextWindowConfig
+}
+
+// NewContextWindows creates a lookup for already-validated entries
+func NewContextWindows(windows []config.ContextWindowConfig) *ContextWindows {
+	return &ContextWindows{windows: windows}
+}
+
+// Lookup returns the first entry matching a model on a provider, or nil if
+// the model's context window isn't configured
+func (c *ContextWindows) Lookup(providerName, modelName string) *config.ContextWindowConfig {
+	if c == nil {
+		return nil
+	}
+	for i := range c.windows {
+		window := &c.windows[i]
+		if strings.Contains(window.Match, ":") {
+			if matchPattern(window.Match, providerName+":"+modelName) {
+				return window
+			}
+		} else if matchPattern(window.Match, modelName) {
+			return window
+		}
+	}
+	return nil
+}
+
+// fits reports whether a request of the given size fits a model, treating
+// models with no configured window as large enough
+func (c *ContextWindows) fits(providerName, modelName string, tokens int) bool {
+	window := c.Lookup(providerName, modelName)
+	return window == nil || tokens <= window.MaxTokens
+}
+
+// estimateContextTokens estimates how much of the context window a request
+// needs: its input plus the output it may generate
+func estimateContextTokens(req *model.AnthropicRequest) int {
+	body, _ := json.Marshal(req)
+	return estimateInputTokens(body) + req.MaxTokens
+}
+
+// estimateInputTokens roughly estimates input tokens from the request size
+// (about 4 bytes per token)
+func estimateInputTokens(body []byte) int {
+	return len(body) / 4
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestContextWindowsLookup(t *testing.T) {
+	windows := NewContextWindows([]config.ContextWindowConfig{
+		{Match: "openrouter:gpt-4o", MaxTokens: 64000},
+		{Match: "gpt-4o*", MaxTokens: 128000},
+	})
+
+	tests := []struct {
+		provider string
+		model    string
+		want     int
+	}{
+		{"openai", "gpt-4o", 128000},
+		{"openai", "gpt-4o-mini", 128000},
+		{"openrouter", "gpt-4o", 64000},
+		{"anthropic", "claude-sonnet-4", 0},
+	}
+	for _, tt := range tests {
+		got := 0
+		if window := windows.Lookup(tt.provider, tt.model); window != nil {
+			got = window.MaxTokens
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%s, %s) = %d, want %d", tt.provider, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestDetermineRoute_ContextWindow(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"openai":    {Format: "openai", BaseURL: "https://api.openai.com"},
+		},
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{ID: "reviews", Match: config.RuleMatchConfig{Models: []string{"claude-*"}}, Target: "openai:gpt-4o", Action: "route"},
+			},
+			ContextWindows: []config.ContextWindowConfig{
+				{Match: "gpt-4o*", MaxTokens: 128000, Overflow: []string{"openai:gpt-4o-mini", "anthropic:claude-sonnet-4"}},
+				{Match: "claude-sonnet-4", MaxTokens: 200000},
+			},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	request := func(inputTokens int) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:     "claude-sonnet-4",
+			MaxTokens: 8000,
+			Messages:  []model.AnthropicMessage{{Role: "user", Content: strings.Repeat("a", inputTokens*4)}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		inputTokens  int
+		wantProvider string
+		wantModel    string
+		wantOverflow bool
+	}{
+		{"fits", 100000, "openai", "gpt-4o", false},
+		{"overflows to larger model", 150000, "anthropic", "claude-sonnet-4", false},
+		{"too large for every model", 250000, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(request(tt.inputTokens), nil)
+
+			var overflowErr *ContextOverflowError
+			if tt.wantOverflow {
+				if !errors.As(err, &overflowErr) {
+					t.Fatalf("Expected *ContextOverflowError, got %v", err)
+				}
+				if overflowErr.ProviderName != "openai" || overflowErr.Model != "gpt-4o" || overflowErr.MaxTokens != 128000 {
+					t.Errorf("Unexpected overflow error: %+v", overflowErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetermineRoute() error = %v", err)
+			}
+			if decision.ProviderName != tt.wantProvider || decision.TargetModel != tt.wantModel {
+				t.Errorf("Got %s:%s, want %s:%s", decision.ProviderName, decision.TargetModel, tt.wantProvider, tt.wantModel)
+			}
+			if decision.RuleID != "reviews" {
+				t.Errorf("Expected the rule to still be recorded, got %q", decision.RuleID)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ExperimentAssignment is the experiment arm a request was assigned to
+type ExperimentAssignment struct {
+	ExperimentID string
+	Arm          *config.ExperimentArmConfig
+}
+
+// Experiments assigns requests to the arms of routing.experiments
+type Experiments struct {
+	experiments []config.ExperimentConfig
+	matcher     *RuleEngine // evaluates experiment match conditions
+}
+
+// NewExperiments creates an assigner for already-validated experiments
+func NewExperiments(experiments []config.ExperimentConfig) *Experiments {
+	return &Experiments{experiments: experiments, matcher: &RuleEngine{now: time.Now}}
+}
+
+// Assign returns the arm of the first experiment matching the request, or
+// nil. Requests from the same session land on the same arm; requests with
+// no session are assigned at random.
+func (x *Experiments) Assign(in RuleInput, sessionID string) *ExperimentAssignment {
+	return x.assign(in, sessionID, nil)
+}
+
+// assign implements Assign, recording each experiment tried in trace
+func (x *Experiments) assign(in RuleInput, sessionID string, trace *RouteTrace) *ExperimentAssignment {
+	if x == nil || len(x.experiments) == 0 {
+		return nil
+	}
+
+	tokens := lazyTokenEstimate(in.Request)
+	for i := range x.experiments {
+		experiment := &x.experiments[i]
+		reason := x.matcher.mismatch(&experiment.Match, in, tokens)
+		if reason != "" {
+			if trace != nil {
+				trace.Experiments = append(trace.Experiments, Evaluation{ID: experiment.ID, Reason: reason})
+			}
+			continue
+		}
+
+		arm := pickArm(experiment, sessionID)
+		if trace != nil {
+			result := "arm " + arm.ID
+			if sessionID == "" {
+				result += " (no session, picked at random)"
+			}
+			trace.Experiments = append(trace.Experiments, Evaluation{ID: experiment.ID, Matched: true, Result: result})
+		}
+		return &ExperimentAssignment{ExperimentID: experiment.ID, Arm: arm}
+	}
+	return nil
+}
+
+// Experiment returns the configured experiment with the given ID, or nil
+func (x *Experiments) Experiment(id string) *config.ExperimentConfig {
+	if x == nil {
+		return nil
+	}
+	for i := range x.experiments {
+		if x.experiments[i].ID == id {
+			return &x.experiments[i]
+		}
+	}
+	return nil
+}
+
+// pickArm chooses an arm by weight, hashing the session so the choice is
+// stable across requests and config reloads
+func pickArm(experiment *config.ExperimentConfig, sessionID string) *config.ExperimentArmConfig {
+	total := 0
+	for _, arm := range experiment.Arms {
+		total += arm.Weight
+	}
+
+	var bucket int
+	if sessionID == "" {
+		bucket = rand.Intn(total)
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(experiment.ID))
+		h.Write([]byte{0})
+		h.Write([]byte(sessionID))
+		bucket = int(h.Sum32() % uint32(total))
+	}
+
+	for i := range experiment.Arms {
+		bucket -= experiment.Arms[i].Weight
+		if bucket < 0 {
+			return &experiment.Arms[i]
+		}
+	}
+	return &experiment.Arms[len(experiment.Arms)-1]
+}
+
+// AddExperimentCosts fills in each arm's target and estimated cost from the
+// experiment's config, and lists configured arms that have no traffic yet
+func AddExperimentCosts(results *model.ExperimentResults, experiment *config.ExperimentConfig) {
+	if experiment == nil {
+		return
+	}
+
+	byArm := make(map[string]*model.ExperimentArmResults, len(results.Arms))
+	for i := range results.Arms {
+		byArm[results.Arms[i].Arm] = &results.Arms[i]
+	}
+	for _, arm := range experiment.Arms {
+		if byArm[arm.ID] == nil {
+			results.Arms = append(results.Arms, model.ExperimentArmResults{Arm: arm.ID, StopReasons: map[string]int{}})
+		}
+	}
+
+	for i := range results.Arms {
+		result := &results.Arms[i]
+		for _, arm := range experiment.Arms {
+			if arm.ID != result.Arm {
+				continue
+			}
+			result.Target = arm.Target
+			if arm.InputCostPerMTok == 0 && arm.OutputCostPerMTok == 0 {
+				break
+			}
+			cost := (float64(result.InputTokens)*arm.InputCostPerMTok + float64(result.OutputTokens)*arm.OutputCostPerMTok) / 1e6
+			result.EstimatedCostUSD = &cost
+			if result.Completed > 0 {
+				perRequest := cost / float64(result.Completed)
+				result.CostPerRequestUSD = &perRequest
+			}
+		}
+	}
+}
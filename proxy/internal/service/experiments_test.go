@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func reviewerExperiment() config.ExperimentConfig {
+	return config.ExperimentConfig{
+		ID:    "reviewer-gpt4o",
+		Match: config.RuleMatchConfig{Models: []string{"claude-*"}},
+		Arms: []config.ExperimentArmConfig{
+			{ID: "gpt-4o", Target: "openai:gpt-4o", Weight: 20, InputCostPerMTok: 2.5, OutputCostPerMTok: 10},
+			{ID: "control", Weight: 80},
+		},
+	}
+}
+
+func TestExperimentsAssign(t *testing.T) {
+	experiments := NewExperiments([]config.ExperimentConfig{reviewerExperiment()})
+	req := &model.AnthropicRequest{Model: "claude-sonnet-4"}
+
+	if got := experiments.Assign(RuleInput{Request: &model.AnthropicRequest{Model: "gpt-4o"}}, "session"); got != nil {
+		t.Errorf("Expected no assignment for an unmatched request, got %+v", got)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		sessionID := fmt.Sprintf("session-%d", i)
+		first := experiments.Assign(RuleInput{Request: req}, sessionID)
+		if first == nil || first.ExperimentID != "reviewer-gpt4o" {
+			t.Fatalf("Expected an assignment, got %+v", first)
+		}
+		// Sticky per session
+		if again := experiments.Assign(RuleInput{Request: req}, sessionID); again.Arm.ID != first.Arm.ID {
+			t.Fatalf("Session %s moved from arm %s to %s", sessionID, first.Arm.ID, again.Arm.ID)
+		}
+		counts[first.Arm.ID]++
+	}
+
+	// Roughly 20/80
+	if share := float64(counts["gpt-4o"]) / 2000; share < 0.15 || share > 0.25 {
+		t.Errorf("Expected about 20%% of sessions on gpt-4o, got %.1f%% (%v)", share*100, counts)
+	}
+}
+
+func TestDetermineRoute_Experiment(t *testing.T) {
+	experiment := reviewerExperiment()
+	experiment.Arms[0].Weight = 1
+	experiment.Arms[1].Weight = 0 // not allowed by config validation, but pins every session to gpt-4o
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"openai":    {Format: "openai", BaseURL: "https://api.openai.com"},
+		},
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{ID: "haiku", Match: config.RuleMatchConfig{Models: []string{"*haiku*"}}, Target: "anthropic:claude-3-5-haiku-20241022", Action: "route"},
+			},
+			Experiments: []config.ExperimentConfig{experiment},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	decision, err := router.DetermineRoute(&model.AnthropicRequest{
+		Model:    "claude-sonnet-4",
+		Metadata: &model.AnthropicMetadata{UserID: "user_abc_session_123"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ExperimentID != "reviewer-gpt4o" || decision.ExperimentArm != "gpt-4o" {
+		t.Errorf("Expected the gpt-4o arm, got %q/%q", decision.ExperimentID, decision.ExperimentArm)
+	}
+	if decision.ProviderName != "openai" || decision.TargetModel != "gpt-4o" {
+		t.Errorf("Got %s:%s, want openai:gpt-4o", decision.ProviderName, decision.TargetModel)
+	}
+
+	// Routing rules take precedence
+	decision, err = router.DetermineRoute(&model.AnthropicRequest{Model: "claude-3-5-haiku-latest"}, nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ExperimentID != "" || decision.RuleID != "haiku" {
+		t.Errorf("Expected the rule to win over the experiment, got %+v", decision)
+	}
+}
+
+func TestGetExperimentResults(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	save := func(id, arm string, status, inputTokens, outputTokens int, stopReason string, responseMs int64, toolCalls int) {
+		request := &model.RequestLog{
+			RequestID:     id,
+			Timestamp:     "2024-01-15T10:30:00Z",
+			Method:        "POST",
+			Endpoint:      "/v1/messages",
+			Headers:       map[string][]string{},
+			Body:          map[string]interface{}{},
+			Model:         "claude-sonnet-4",
+			Experiment:    "reviewer-gpt4o",
+			ExperimentArm: arm,
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() error = %v", err)
+		}
+		if status == 0 {
+			return // still in flight
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"stop_reason": stopReason,
+			"usage":       model.AnthropicUsage{InputTokens: inputTokens, OutputTokens: outputTokens},
+		})
+		request.Response = &model.ResponseLog{StatusCode: status, Body: body, ResponseTime: responseMs, ToolCallCount: toolCalls}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() error = %v", err)
+		}
+	}
+	save("a1", "gpt-4o", 200, 1000000, 100000, "tool_use", 1000, 2)
+	save("a2", "gpt-4o", 500, 0, 0, "", 50, 0)
+	save("a3", "gpt-4o", 0, 0, 0, "", 0, 0)
+	save("b1", "control", 200, 2000, 500, "end_turn", 3000, 1)
+
+	results, err := storage.GetExperimentResults("reviewer-gpt4o", "", "")
+	if err != nil {
+		t.Fatalf("GetExperimentResults() error = %v", err)
+	}
+	experiment := reviewerExperiment()
+	experiment.Arms = append(experiment.Arms, config.ExperimentArmConfig{ID: "unused", Weight: 1})
+	AddExperimentCosts(results, &experiment)
+
+	arms := make(map[string]model.ExperimentArmResults)
+	for _, arm := range results.Arms {
+		arms[arm.Arm] = arm
+	}
+	if len(arms) != 3 {
+		t.Fatalf("Expected gpt-4o, control, and unused arms, got %+v", results.Arms)
+	}
+
+	treatment := arms["gpt-4o"]
+	if treatment.Requests != 3 || treatment.Completed != 2 || treatment.Errors != 1 || treatment.ErrorRate != 0.5 {
+		t.Errorf("Unexpected request counts: %+v", treatment)
+	}
+	if treatment.AvgResponseMs != 1000 || treatment.StopReasons["tool_use"] != 1 || treatment.ToolCalls != 2 {
+		t.Errorf("Expected latency and stop reasons from successful responses only, got %+v", treatment)
+	}
+	// 1M input tokens at $2.50 plus 100k output tokens at $10
+	if treatment.Target != "openai:gpt-4o" || treatment.EstimatedCostUSD == nil || *treatment.EstimatedCostUSD != 3.5 {
+		t.Errorf("Unexpected cost estimate: %+v", treatment)
+	}
+
+	if control := arms["control"]; control.InputTokens != 2000 || control.StopReasons["end_turn"] != 1 || control.EstimatedCostUSD != nil {
+		t.Errorf("Unexpected control arm: %+v", control)
+	}
+	if unused := arms["unused"]; unused.Requests != 0 {
+		t.Errorf("Unexpected unused arm: %+v", unused)
+	}
+
+	// Time range excludes everything
+	results, err = storage.GetExperimentResults("reviewer-gpt4o", "2025-01-01T00:00:00Z", "")
+	if err != nil || len(results.Arms) != 0 {
+		t.Errorf("Expected no arms outside the time range, got %+v, %v", results, err)
+	}
+}
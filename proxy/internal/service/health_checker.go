@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// ProbeStatus is the latest active health probe state for a provider
+type ProbeStatus struct {
+	LastCheck           *time.Time `json:"last_check,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastLatencyMs       int64      `json:"last_latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Healthy             bool       `json:"healthy"`
+}
+
+// HealthChecker probes providers on a schedule. Results are kept in memory
+// for routing decisions, written to the provider_health_checks history
+// table, and fed to each provider's circuit breaker.
+type HealthChecker struct {
+	configs   map[string]config.HealthCheckConfig
+	providers map[string]provider.Provider
+	storage   StorageService
+	logger    *log.Logger
+
+	mu     sync.RWMutex
+	status map[string]*ProbeStatus
+	done   chan struct{}
+}
+
+// NewHealthChecker creates a checker for every provider with health_check
+// enabled. storage may be nil, in which case no history is recorded.
+func NewHealthChecker(providerConfigs map[string]*config.ProviderConfig, providers map[string]provider.Provider, storage StorageService, logger *log.Logger) *HealthChecker {
+	hc := &HealthChecker{
+		configs:   make(map[string]config.HealthCheckConfig),
+		providers: providers,
+		storage:   storage,
+		logger:    logger,
+		status:    make(map[string]*ProbeStatus),
+		done:      make(chan struct{}),
+	}
+	for name, cfg := range providerConfigs {
+		if _, exists := providers[name]; exists && cfg.HealthCheck.Enabled {
+			hc.configs[name] = cfg.HealthCheck
+		}
+	}
+	return hc
+}
+
+// Enabled reports whether any provider is being probed
+func (hc *HealthChecker) Enabled() bool {
+	return len(hc.configs) > 0
+}
+
+// Start launches one probe loop per provider. Each provider is probed
+// immediately so routing has a signal before the first interval elapses.
+func (hc *HealthChecker) Start() {
+	for name, cfg := range hc.configs {
+		hc.logger.Printf("🩺 Health probes enabled for '%s' (method: %s, interval: %s)", name, cfg.Method, cfg.IntervalDuration)
+		go hc.loop(name, cfg)
+	}
+}
+
+// Stop halts all probe loops
+func (hc *HealthChecker) Stop() {
+	close(hc.done)
+}
+
+func (hc *HealthChecker) loop(name string, cfg config.HealthCheckConfig) {
+	ticker := time.NewTicker(cfg.IntervalDuration)
+	defer ticker.Stop()
+
+	hc.CheckNow(name)
+	for {
+		select {
+		case <-ticker.C:
+			hc.CheckNow(name)
+		case <-hc.done:
+			return
+		}
+	}
+}
+
+// CheckNow probes one provider and records the result
+func (hc *HealthChecker) CheckNow(name string) ProbeStatus {
+	cfg := hc.configs[name]
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TimeoutDuration)
+	defer cancel()
+
+	result := provider.Probe(ctx, hc.providers[name], cfg.Method, cfg.Model)
+	return hc.record(name, cfg, result)
+}
+
+// record updates in-memory state, metrics, history, and the circuit breaker
+func (hc *HealthChecker) record(name string, cfg config.HealthCheckConfig, result provider.ProbeResult) ProbeStatus {
+	now := time.Now()
+	success := result.Success()
+
+	hc.mu.Lock()
+	status, exists := hc.status[name]
+	if !exists {
+		status = &ProbeStatus{Healthy: true}
+		hc.status[name] = status
+	}
+	wasHealthy := status.Healthy
+	status.LastCheck = &now
+	status.LastLatencyMs = result.Latency.Milliseconds()
+	if success {
+		status.LastSuccess = &now
+		status.LastError = ""
+		status.ConsecutiveFailures = 0
+		status.Healthy = true
+	} else {
+		status.LastFailure = &now
+		status.LastError = result.Err.Error()
+		status.ConsecutiveFailures++
+		if status.ConsecutiveFailures >= cfg.FailureThreshold {
+			status.Healthy = false
+		}
+	}
+	snapshot := *status
+	hc.mu.Unlock()
+
+	metrics.RecordHealthProbe(name, success, result.Latency.Seconds())
+
+	if resilient, ok := hc.providers[name].(*provider.ResilientProvider); ok {
+		resilient.RecordProbe(success)
+	}
+
+	if hc.storage != nil {
+		check := &model.ProviderHealthCheck{
+			Provider:   name,
+			Method:     cfg.Method,
+			CheckedAt:  now,
+			Success:    success,
+			StatusCode: result.StatusCode,
+			LatencyMs:  result.Latency.Milliseconds(),
+			Error:      snapshot.LastError,
+		}
+		if err := hc.storage.SaveHealthCheck(check); err != nil {
+			hc.logger.Printf("❌ Failed to save health check for '%s': %v", name, err)
+		}
+	}
+
+	if wasHealthy != snapshot.Healthy {
+		logEvent := map[string]interface{}{
+			"event":     "provider_health_changed",
+			"provider":  name,
+			"healthy":   snapshot.Healthy,
+			"error":     snapshot.LastError,
+			"timestamp": now.UTC().Format(time.RFC3339),
+		}
+		logJSON, _ := json.Marshal(logEvent)
+		hc.logger.Printf("%s", logJSON)
+	}
+
+	return snapshot
+}
+
+// Status returns the latest probe state for a provider. ok is false if the
+// provider isn't probed or hasn't been probed yet.
+func (hc *HealthChecker) Status(name string) (status ProbeStatus, ok bool) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if s, exists := hc.status[name]; exists {
+		return *s, true
+	}
+	return ProbeStatus{}, false
+}
+
+// IsHealthy reports whether probes consider a provider healthy. Providers
+// without probes, or not yet probed, are assumed healthy.
+func (hc *HealthChecker) IsHealthy(name string) bool {
+	status, ok := hc.Status(name)
+	return !ok || status.Healthy
+}
+
+// History returns recent probe results for a provider, newest first
+func (hc *HealthChecker) History(name string, limit int) ([]*model.ProviderHealthCheck, error) {
+	if hc.storage == nil {
+		return []*model.ProviderHealthCheck{}, nil
+	}
+	return hc.storage.GetHealthChecks(name, limit)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// newProbedProvider returns an Anthropic-format provider whose upstream
+// answers /v1/models with the status held in status, checking that the
+// probe carries the provider's api_key
+func newProbedProvider(t *testing.T, status *atomic.Int32) (*config.ProviderConfig, provider.Provider) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("Unexpected probe path %s", r.URL.Path)
+		}
+		if key := r.Header.Get("x-api-key"); key != "probe-key" {
+			t.Errorf("Expected the probe to send the provider's api_key, got %q", key)
+		}
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.ProviderConfig{
+		Format:  "anthropic",
+		BaseURL: server.URL,
+		APIKey:  "probe-key",
+		HealthCheck: config.HealthCheckConfig{
+			Enabled:          true,
+			Method:           "models",
+			TimeoutDuration:  time.Second,
+			IntervalDuration: time.Hour,
+			FailureThreshold: 2,
+		},
+	}
+	return cfg, provider.NewAnthropicProvider("anthropic", cfg)
+}
+
+func TestHealthChecker_TracksSuccessAndFailure(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	cfg, prov := newProbedProvider(t, &status)
+	providers := map[string]provider.Provider{"anthropic": prov}
+	hc := NewHealthChecker(map[string]*config.ProviderConfig{"anthropic": cfg}, providers, storage, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	if s := hc.CheckNow("anthropic"); !s.Healthy || s.LastSuccess == nil {
+		t.Fatalf("Expected a healthy first probe, got %+v", s)
+	}
+
+	// One failure stays under the threshold; the second marks it unhealthy
+	status.Store(http.StatusServiceUnavailable)
+	if s := hc.CheckNow("anthropic"); !s.Healthy || s.LastFailure == nil {
+		t.Errorf("Expected provider to stay healthy below failure_threshold, got %+v", s)
+	}
+	if s := hc.CheckNow("anthropic"); s.Healthy || s.ConsecutiveFailures != 2 {
+		t.Errorf("Expected provider to be unhealthy after 2 failures, got %+v", s)
+	}
+	if hc.IsHealthy("anthropic") {
+		t.Error("Expected IsHealthy to report the failing provider")
+	}
+
+	checks, err := hc.History("anthropic", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(checks) != 3 || checks[0].Success || checks[0].StatusCode != 503 || !checks[2].Success {
+		t.Errorf("Unexpected history (newest first): %+v", checks)
+	}
+	if checks[0].CheckedAt.IsZero() {
+		t.Error("Expected checked_at to round-trip")
+	}
+}
+
+func TestHealthChecker_ClientErrors(t *testing.T) {
+	tests := []struct {
+		status      int32
+		wantSuccess bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(int(tt.status)), func(t *testing.T) {
+			var status atomic.Int32
+			status.Store(tt.status)
+			cfg, prov := newProbedProvider(t, &status)
+			hc := NewHealthChecker(map[string]*config.ProviderConfig{"anthropic": cfg}, map[string]provider.Provider{"anthropic": prov}, nil, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+			s := hc.CheckNow("anthropic")
+			if success := s.ConsecutiveFailures == 0; success != tt.wantSuccess {
+				t.Errorf("Expected success %v for HTTP %d, got %+v", tt.wantSuccess, tt.status, s)
+			}
+			if !tt.wantSuccess && !strings.Contains(s.LastError, "api_key") {
+				t.Errorf("Expected the error to point at the api_key, got %q", s.LastError)
+			}
+		})
+	}
+}
+
+func TestHealthChecker_FeedsRoutingAndBreaker(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	cfg, base := newProbedProvider(t, &status)
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{Enabled: true, MaxFailures: 2, TimeoutDuration: time.Hour}
+	resilient := provider.NewResilientProvider("anthropic", base, nil, cfg)
+
+	providers := map[string]provider.Provider{"anthropic": resilient, "openai": &delayedProvider{name: "openai"}}
+	appCfg := &config.Config{Providers: map[string]*config.ProviderConfig{"anthropic": cfg, "openai": {}}}
+	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
+	router := NewModelRouter(appCfg, providers, logger)
+	hc := NewHealthChecker(appCfg.Providers, providers, nil, logger)
+	router.SetHealthChecker(hc)
+
+	hc.CheckNow("anthropic")
+	hc.CheckNow("anthropic")
+
+	if state := resilient.(*provider.ResilientProvider).GetCircuitBreakerState(); *state != provider.StateOpen {
+		t.Errorf("Expected failed probes to open the breaker, got %v", *state)
+	}
+
+	for _, health := range router.GetProviderHealth() {
+		if health.Name == "anthropic" && (health.Healthy || health.LastFailure == nil || health.LastSuccess != nil) {
+			t.Errorf("Expected anthropic to be reported unhealthy with only a last failure, got %+v", health)
+		}
+	}
+
+	pr := NewPreferenceRouter(&RoutingConfig{}, router, providers, logger)
+	if healthy := pr.filterHealthyProviders([]string{"anthropic", "openai"}); len(healthy) != 1 || healthy[0] != "openai" {
+		t.Errorf("Expected only openai to pass the health filter, got %v", healthy)
+	}
+
+	// A successful probe lets the open breaker move to half-open early
+	status.Store(http.StatusOK)
+	hc.CheckNow("anthropic")
+	if state := resilient.(*provider.ResilientProvider).GetCircuitBreakerState(); *state != provider.StateHalfOpen {
+		t.Errorf("Expected a successful probe to half-open the breaker, got %v", *state)
+	}
+}
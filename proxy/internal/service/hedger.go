@@ -0,0 +1,398 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// Hedge winners recorded on the request log and in metrics
+const (
+	HedgeWinnerPrimary = "primary"
+	HedgeWinnerHedge   = "hedge"
+)
+
+// Hedger cuts tail latency for small requests: if the routed provider has
+// not produced a first byte within a percentile of its recent TTFB, the same
+// request is sent to a second provider and whichever responds first is served.
+// The loser is cancelled. A hedge is only sent if the hedge target has a free
+// concurrency slot, which it holds like any other request.
+type Hedger struct {
+	config    config.HedgingConfig
+	providers map[string]provider.Provider
+	targets   map[string]SubagentMapping // routed provider -> hedge provider:model
+	limiter   *ConcurrencyLimiter
+	logger    *log.Logger
+
+	mu   sync.Mutex
+	ttfb map[string]*latencyWindow // provider -> recent time to first byte
+}
+
+// NewHedger creates a hedger from the routing.hedging config
+func NewHedger(cfg config.HedgingConfig, providers map[string]provider.Provider, limiter *ConcurrencyLimiter, logger *log.Logger) *Hedger {
+	targets := make(map[string]SubagentMapping)
+	for providerName, target := range cfg.Targets {
+		parts := strings.SplitN(target, ":", 2)
+		if len(parts) != 2 {
+			logger.Printf("⚠️  Invalid hedge target for '%s': '%s' (expected format: 'provider:model')", providerName, target)
+			continue
+		}
+		hedgeProvider := strings.TrimSpace(parts[0])
+		if _, exists := providers[hedgeProvider]; !exists {
+			logger.Printf("⚠️  Hedge target for '%s' references unknown provider '%s'", providerName, hedgeProvider)
+			continue
+		}
+		targets[providerName] = SubagentMapping{
+			ProviderName: hedgeProvider,
+			ModelName:    strings.TrimSpace(parts[1]),
+		}
+	}
+
+	if cfg.Enabled {
+		for providerName, target := range targets {
+			logger.Printf("⏱️  Hedging %s requests to %s:%s after p%.0f TTFB", providerName, target.ProviderName, target.ModelName, cfg.Percentile)
+		}
+	}
+
+	return &Hedger{
+		config:    cfg,
+		providers: providers,
+		targets:   targets,
+		limiter:   limiter,
+		logger:    logger,
+		ttfb:      make(map[string]*latencyWindow),
+	}
+}
+
+// hedgeResult is the outcome of one side of a hedged request
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	winner  string
+	elapsed time.Duration
+}
+
+// Forward sends the request to the routed provider, hedging it when eligible.
+// The returned HedgeInfo is nil unless a hedge request was actually sent.
+func (h *Hedger) Forward(ctx context.Context, decision *RoutingDecision, req *http.Request) (*http.Response, *model.HedgeInfo, error) {
+	target, eligible := h.target(decision)
+	if !eligible {
+		resp, err := decision.Provider.ForwardRequest(ctx, req)
+		return resp, nil, err
+	}
+
+	bodyBytes, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(bodyBytes) > h.config.MaxRequestBytes {
+		resp, err := decision.Provider.ForwardRequest(ctx, withBody(ctx, req, bodyBytes))
+		return resp, nil, err
+	}
+
+	hedgeProvider := h.providers[target.ProviderName]
+	hedgeBody, err := rewriteModel(bodyBytes, target.ModelName)
+	if err != nil {
+		resp, err := decision.Provider.ForwardRequest(ctx, withBody(ctx, req, bodyBytes))
+		return resp, nil, err
+	}
+	streaming := provider.IsStreamingRequest(bodyBytes)
+	metrics.RecordHedgeEligible(decision.ProviderName)
+
+	results := make(chan hedgeResult, 2)
+	start := time.Now()
+
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	go func() {
+		resp, err := forwardFirstByte(primaryCtx, decision.Provider, withBody(primaryCtx, req, bodyBytes), streaming)
+		results <- hedgeResult{resp: resp, err: err, winner: HedgeWinnerPrimary, elapsed: time.Since(start)}
+	}()
+
+	delay := h.hedgeDelay(decision.ProviderName)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		// The primary answered before the hedge deadline - no hedge needed
+		if result.err == nil {
+			h.recordTTFB(decision.ProviderName, result.elapsed)
+		}
+		return settle(result, cancelPrimary), nil, result.err
+	case <-timer.C:
+	}
+
+	// The primary is slow: send the hedge, unless its target is at its
+	// concurrency limit, in which case the primary is left to finish alone
+	releaseHedge, ok := h.limiter.TryAcquire(target.ProviderName, target.ModelName)
+	if !ok {
+		h.logger.Printf("⏱️  No first byte from %s after %dms, but %s:%s has no free slot; not hedging",
+			decision.ProviderName, delay.Milliseconds(), target.ProviderName, target.ModelName)
+		result := <-results
+		if result.err == nil {
+			h.recordTTFB(decision.ProviderName, result.elapsed)
+		}
+		return settle(result, cancelPrimary), nil, result.err
+	}
+	metrics.RecordHedgeFired(decision.ProviderName, target.ProviderName)
+	h.logger.Printf("⏱️  No first byte from %s after %dms, hedging to %s:%s",
+		decision.ProviderName, delay.Milliseconds(), target.ProviderName, target.ModelName)
+
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	go func() {
+		resp, err := forwardFirstByte(hedgeCtx, hedgeProvider, withBody(hedgeCtx, req, hedgeBody), streaming)
+		// The slot is held until the hedge's response is done with, whether
+		// it is served or discarded
+		if resp != nil && resp.Body != nil {
+			resp.Body = &observedBody{ReadCloser: resp.Body, onClose: releaseHedge}
+		} else {
+			releaseHedge()
+		}
+		results <- hedgeResult{resp: resp, err: err, winner: HedgeWinnerHedge}
+	}()
+
+	info := &model.HedgeInfo{
+		DelayMs:       delay.Milliseconds(),
+		HedgeProvider: target.ProviderName,
+		HedgeModel:    target.ModelName,
+	}
+	cancels := map[string]context.CancelFunc{
+		HedgeWinnerPrimary: cancelPrimary,
+		HedgeWinnerHedge:   cancelHedge,
+	}
+
+	// Serve the first success; if one side fails, wait for the other
+	first := <-results
+	winner := first
+	pending := true
+	if first.err != nil || !isSuccess(first.resp) {
+		second := <-results
+		pending = false
+		// Prefer a success; if both failed, report the primary's outcome
+		if (second.err == nil && isSuccess(second.resp)) || second.winner == HedgeWinnerPrimary {
+			closeResult(first)
+			winner = second
+		} else {
+			closeResult(second)
+		}
+	}
+
+	loser := HedgeWinnerHedge
+	if winner.winner == HedgeWinnerHedge {
+		loser = HedgeWinnerPrimary
+		// The primary never answered; its wait so far is a lower bound on its TTFB
+		h.recordTTFB(decision.ProviderName, time.Since(start))
+	} else if winner.err == nil {
+		h.recordTTFB(decision.ProviderName, winner.elapsed)
+	}
+	cancels[loser]()
+	if pending {
+		go func() { closeResult(<-results) }()
+	}
+
+	info.Winner = winner.winner
+	loserProvider := target.ProviderName
+	if winner.winner == HedgeWinnerHedge {
+		loserProvider = decision.ProviderName
+	}
+	info.ExtraInputTokens = estimateInputTokens(bodyBytes)
+	metrics.RecordHedgeOutcome(decision.ProviderName, info.Winner, loserProvider, info.ExtraInputTokens)
+
+	resp := settle(winner, cancels[winner.winner])
+	return resp, info, winner.err
+}
+
+// target returns the hedge target for a routing decision and whether the
+// request qualifies for hedging at all
+func (h *Hedger) target(decision *RoutingDecision) (SubagentMapping, bool) {
+	if !h.config.Enabled || decision.Provider == nil {
+		return SubagentMapping{}, false
+	}
+	target, exists := h.targets[decision.ProviderName]
+	if !exists {
+		return SubagentMapping{}, false
+	}
+	// Never hedge to a provider the request's project doesn't allow
+	if decision.AllowedProviders != nil && !slices.Contains(decision.AllowedProviders, target.ProviderName) {
+		return SubagentMapping{}, false
+	}
+
+	modelLower := strings.ToLower(decision.TargetModel)
+	for _, pattern := range h.config.Models {
+		if strings.Contains(modelLower, strings.ToLower(pattern)) {
+			return target, true
+		}
+	}
+	return SubagentMapping{}, false
+}
+
+// hedgeDelay returns how long to wait for the primary before hedging
+func (h *Hedger) hedgeDelay(providerName string) time.Duration {
+	h.mu.Lock()
+	window := h.ttfb[providerName]
+	delay := h.config.InitialDelayDuration
+	if window != nil && window.Len() >= h.config.MinSamples {
+		delay = window.Percentile(h.config.Percentile)
+	}
+	h.mu.Unlock()
+
+	if delay < h.config.MinDelayDuration {
+		delay = h.config.MinDelayDuration
+	}
+	if h.config.MaxDelayDuration > 0 && delay > h.config.MaxDelayDuration {
+		delay = h.config.MaxDelayDuration
+	}
+	return delay
+}
+
+// recordTTFB adds a time-to-first-byte sample for a provider
+func (h *Hedger) recordTTFB(providerName string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	window, exists := h.ttfb[providerName]
+	if !exists {
+		window = newLatencyWindow(h.config.WindowSize)
+		h.ttfb[providerName] = window
+	}
+	window.Add(d)
+}
+
+// forwardFirstByte forwards a request and, for streams, waits for the first
+// content event so that a stream that stalls or errors early does not win
+func forwardFirstByte(ctx context.Context, p provider.Provider, req *http.Request, streaming bool) (*http.Response, error) {
+	resp, err := p.ForwardRequest(ctx, req)
+	if err != nil || !streaming {
+		return resp, err
+	}
+	resp, err = provider.PeekStream(p.Name(), resp)
+	var streamErr *provider.StreamError
+	if errors.As(err, &streamErr) {
+		// Keep the upstream error so it can be served if both sides fail
+		return streamErr.Response(), nil
+	}
+	return resp, err
+}
+
+// settle ties the winner's context to its response body, so the upstream
+// request is only cancelled once the caller is done reading
+func settle(result hedgeResult, cancel context.CancelFunc) *http.Response {
+	if result.resp == nil || result.resp.Body == nil {
+		cancel()
+		return result.resp
+	}
+	result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancel}
+	return result.resp
+}
+
+// closeResult discards the response of a hedge loser
+func closeResult(result hedgeResult) {
+	if result.resp != nil && result.resp.Body != nil {
+		result.resp.Body.Close()
+	}
+}
+
+// cancelOnClose cancels a request context when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func isSuccess(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// withBody clones a request with its own copy of the body
+func withBody(ctx context.Context, req *http.Request, body []byte) *http.Request {
+	clone := req.Clone(ctx)
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.ContentLength = int64(len(body))
+	clone.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return clone
+}
+
+// rewriteModel replaces the model in a request body, keeping every other field as-is
+func rewriteModel(body []byte, modelName string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(modelName)
+	if err != nil {
+		return nil, err
+	}
+	fields["model"] = encoded
+	return json.Marshal(fields)
+}
+
+// latencyWindow keeps the most recent latency samples in a ring buffer
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	if size <= 0 {
+		size = 100
+	}
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+// Add records a sample, evicting the oldest when the window is full
+func (w *latencyWindow) Add(d time.Duration) {
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// Len returns the number of samples held
+func (w *latencyWindow) Len() int {
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+// Percentile returns the p-th percentile (0-100) of the held samples
+func (w *latencyWindow) Percentile(p float64) time.Duration {
+	n := w.Len()
+	if n == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(p/100*float64(n)+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= n {
+		idx = n - 1
+	}
+	return sorted[idx]
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// delayedProvider answers after a fixed delay, or fails if cancelled first
+type delayedProvider struct {
+	name   string
+	delay  time.Duration
+	status int
+
+	mu        sync.Mutex
+	calls     int
+	cancelled bool
+	lastModel string
+}
+
+func (p *delayedProvider) Name() string { return p.name }
+
+func (p *delayedProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	var parsed struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &parsed)
+
+	p.mu.Lock()
+	p.calls++
+	p.lastModel = parsed.Model
+	p.mu.Unlock()
+
+	select {
+	case <-time.After(p.delay):
+		return &http.Response{
+			StatusCode: p.status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(`{"provider":"` + p.name + `"}`)),
+		}, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.cancelled = true
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func newTestHedger(providers map[string]provider.Provider) *Hedger {
+	cfg := config.HedgingConfig{
+		Enabled:              true,
+		Models:               []string{"haiku"},
+		MaxRequestBytes:      64 * 1024,
+		Percentile:           95,
+		WindowSize:           50,
+		MinSamples:           20,
+		InitialDelayDuration: 20 * time.Millisecond,
+		MinDelayDuration:     time.Millisecond,
+		MaxDelayDuration:     time.Second,
+		Targets:              map[string]string{"anthropic": "backup:claude-3-5-haiku-backup"},
+	}
+	return NewHedger(cfg, providers, NewConcurrencyLimiter(nil), log.New(os.Stdout, "test: ", log.LstdFlags))
+}
+
+func newHedgeRequest(t *testing.T, modelName string) *http.Request {
+	body := `{"model":"` + modelName + `","max_tokens":10,"messages":[]}`
+	req, err := http.NewRequest("POST", "http://localhost/v1/messages", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHedger_SlowPrimaryLosesToHedge(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: time.Second, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 200}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-3-5-haiku-20241022"}
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), "backup") {
+		t.Errorf("Expected the hedge response to be served, got %s", body)
+	}
+	if info == nil || info.Winner != HedgeWinnerHedge {
+		t.Fatalf("Expected hedge to win, got %+v", info)
+	}
+	if info.HedgeProvider != "backup" || info.ExtraInputTokens == 0 {
+		t.Errorf("Expected hedge details to be recorded, got %+v", info)
+	}
+	if backup.lastModel != "claude-3-5-haiku-backup" {
+		t.Errorf("Expected hedge to use the target model, got %s", backup.lastModel)
+	}
+
+	// The losing primary must be cancelled
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		primary.mu.Lock()
+		cancelled := primary.cancelled
+		primary.mu.Unlock()
+		if cancelled {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected the losing primary request to be cancelled")
+}
+
+func TestHedger_FastPrimaryIsNotHedged(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: 0, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 200}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-3-5-haiku-20241022"}
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if info != nil {
+		t.Errorf("Expected no hedge, got %+v", info)
+	}
+	if backup.calls != 0 {
+		t.Errorf("Expected backup not to be called, got %d calls", backup.calls)
+	}
+}
+
+func TestHedger_IneligibleModelIsNotHedged(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: 50 * time.Millisecond, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 200}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-opus-4"}
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-opus-4"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if info != nil || backup.calls != 0 {
+		t.Error("Expected non-haiku requests never to be hedged")
+	}
+}
+
+func TestHedger_DisallowedTargetIsNotHedged(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: 50 * time.Millisecond, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 200}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-3-5-haiku-20241022", AllowedProviders: []string{"anthropic"}}
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if info != nil || backup.calls != 0 {
+		t.Error("Expected no hedge to a provider the project doesn't allow")
+	}
+}
+
+func TestHedger_FailedHedgeFallsBackToPrimary(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: 60 * time.Millisecond, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 529}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-3-5-haiku-20241022"}
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected the primary's success to be served, got %d", resp.StatusCode)
+	}
+	if info == nil || info.Winner != HedgeWinnerPrimary {
+		t.Errorf("Expected primary to win after the hedge failed, got %+v", info)
+	}
+}
+
+func TestHedger_HedgeTakesConcurrencySlot(t *testing.T) {
+	primary := &delayedProvider{name: "anthropic", delay: 60 * time.Millisecond, status: 200}
+	backup := &delayedProvider{name: "backup", delay: 0, status: 200}
+	hedger := newTestHedger(map[string]provider.Provider{"anthropic": primary, "backup": backup})
+	hedger.limiter = NewConcurrencyLimiter(map[string]*config.ProviderConfig{
+		"backup": {Concurrency: config.ConcurrencyConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeoutDuration: time.Second}},
+	})
+	bulkhead := hedger.limiter.providers["backup"]
+	decision := &RoutingDecision{Provider: primary, ProviderName: "anthropic", TargetModel: "claude-3-5-haiku-20241022"}
+
+	// The hedge holds the backup's slot until its response is closed
+	resp, info, err := hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info == nil || info.Winner != HedgeWinnerHedge {
+		t.Fatalf("Expected hedge to win, got %+v", info)
+	}
+	if bulkhead.TryAcquire() {
+		t.Error("Expected the served hedge to hold the backup's slot")
+	}
+	resp.Body.Close()
+
+	// With the slot taken the primary is left to answer alone
+	if !bulkhead.TryAcquire() {
+		t.Fatal("Expected closing the hedge response to free the backup's slot")
+	}
+	defer bulkhead.Release()
+	resp, info, err = hedger.Forward(context.Background(), decision, newHedgeRequest(t, "claude-3-5-haiku-20241022"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if info != nil || backup.calls != 1 {
+		t.Errorf("Expected no hedge to a backup with no free slot, got %+v after %d backup calls", info, backup.calls)
+	}
+	if !strings.Contains(string(body), "anthropic") {
+		t.Errorf("Expected the primary response to be served, got %s", body)
+	}
+}
+
+func TestHedger_DelayUsesRecentTTFBPercentile(t *testing.T) {
+	hedger := newTestHedger(map[string]provider.Provider{})
+
+	if d := hedger.hedgeDelay("anthropic"); d != 20*time.Millisecond {
+		t.Errorf("Expected initial delay before min_samples, got %v", d)
+	}
+
+	for i := 1; i <= 20; i++ {
+		hedger.recordTTFB("anthropic", time.Duration(i)*10*time.Millisecond)
+	}
+	if d := hedger.hedgeDelay("anthropic"); d != 190*time.Millisecond {
+		t.Errorf("Expected p95 of samples (190ms), got %v", d)
+	}
+}
+
+func TestLatencyWindow_EvictsOldest(t *testing.T) {
+	w := newLatencyWindow(3)
+	for _, ms := range []int{100, 200, 300, 1} {
+		w.Add(time.Duration(ms) * time.Millisecond)
+	}
+	if w.Len() != 3 {
+		t.Errorf("Expected 3 samples, got %d", w.Len())
+	}
+	if p := w.Percentile(100); p != 300*time.Millisecond {
+		t.Errorf("Expected max 300ms, got %v", p)
+	}
+	if p := w.Percentile(0); p != time.Millisecond {
+		t.Errorf("Expected min 1ms (100ms evicted), got %v", p)
+	}
+}
@@ -248,9 +248,13 @@ func (ci *ConversationIndexer) indexFile(filePath string) error {
 			continue
 		}
 
-		// Extract content for FTS
+		// Extract content for FTS, masking secrets so they are neither stored
+		// nor searchable
 		text, toolNames, _ := ExtractMessageContent(msg)
 		toolNamesStr := strings.Join(toolNames, " ")
+		text, _ = ci.storage.redactor.Redact(text)
+		content, counts := ci.storage.redactor.RedactJSON(msg.Message)
+		recordRedactions("conversation", counts)
 
 		// Insert into FTS if there's content and FTS5 is enabled
 		if fts5Enabled() && (text != "" || len(toolNames) > 0) {
@@ -309,12 +313,22 @@ func (ci *ConversationIndexer) indexFile(filePath string) error {
 			outputTokens,
 			cacheRead,
 			cacheCreation,
-			string(msg.Message),
+			string(content),
 		)
 		if err != nil {
 			log.Printf("⚠️  Error inserting message %s: %v", msg.UUID, err)
 			continue
 		}
+
+		// Feed the tool call audit; calls the proxy already recorded only
+		// have their blank fields filled in
+		uses, results := toolCallsFromConversation(msg, content)
+		if err := saveToolUses(tx, uses); err != nil {
+			log.Printf("⚠️  Error saving tool calls for message %s: %v", msg.UUID, err)
+		}
+		if err := saveToolResults(tx, results); err != nil {
+			log.Printf("⚠️  Error saving tool results for message %s: %v", msg.UUID, err)
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -24,7 +24,26 @@ func NewLoadBalancer(weights map[string]int) *LoadBalancer {
 func (lb *LoadBalancer) SelectProvider(available []string) string {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
+	return lb.selectLocked(available)
+}
+
+// Peek returns the provider SelectProvider would choose next without
+// counting the selection (for dry runs)
+func (lb *LoadBalancer) Peek(available []string) string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	saved := make(map[string]int, len(lb.current))
+	for provider, count := range lb.current {
+		saved[provider] = count
+	}
+	selected := lb.selectLocked(available)
+	lb.current = saved
+	return selected
+}
 
+// selectLocked implements SelectProvider; lb.mu must be held
+func (lb *LoadBalancer) selectLocked(available []string) string {
 	if len(available) == 0 {
 		return ""
 	}
@@ -134,6 +153,19 @@ func (lb *LoadBalancer) UpdateWeights(weights map[string]int) {
 	}
 }
 
+// GetWeights returns the current weight for each provider
+func (lb *LoadBalancer) GetWeights() map[string]int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	weights := make(map[string]int)
+	for provider, weight := range lb.weights {
+		weights[provider] = weight
+	}
+
+	return weights
+}
+
 // GetStats returns current request counts for each provider
 func (lb *LoadBalancer) GetStats() map[string]int {
 	lb.mu.Lock()
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// AliasMatch is the model_aliases entry that rewrote a request's model
+type AliasMatch struct {
+	Pattern       string
+	OriginalModel string
+	Provider      string // empty when routing picks the provider
+	Model         string
+}
+
+// AliasInput is everything a model alias can match on
+type AliasInput struct {
+	Model     string
+	Headers   http.Header
+	ClientKey string
+}
+
+// ModelAliaser resolves the model_aliases section
+type ModelAliaser struct {
+	aliases []config.ModelAliasConfig
+	now     func() time.Time
+}
+
+// NewModelAliaser creates an aliaser for already-validated aliases
+func NewModelAliaser(aliases []config.ModelAliasConfig) *ModelAliaser {
+	return &ModelAliaser{aliases: aliases, now: time.Now}
+}
+
+// Resolve returns the alias for the request's model, or nil. Entries naming
+// the model exactly are tried before glob entries.
+func (a *ModelAliaser) Resolve(in AliasInput) *AliasMatch {
+	return a.resolve(in, nil)
+}
+
+// resolve implements Resolve, recording each entry tried in trace
+func (a *ModelAliaser) resolve(in AliasInput, trace *RouteTrace) *AliasMatch {
+	if a == nil {
+		return nil
+	}
+	for _, exact := range []bool{true, false} {
+		for i := range a.aliases {
+			alias := &a.aliases[i]
+			if isGlob(alias.Match) == exact {
+				continue
+			}
+			reason := a.mismatch(alias, in)
+			if trace != nil {
+				trace.Aliases = append(trace.Aliases, Evaluation{ID: alias.Match, Matched: reason == "", Reason: reason, Result: alias.Target})
+			}
+			if reason != "" {
+				continue
+			}
+			return &AliasMatch{
+				Pattern:       alias.Match,
+				OriginalModel: in.Model,
+				Provider:      alias.Provider,
+				Model:         alias.Model,
+			}
+		}
+	}
+	return nil
+}
+
+// mismatch returns why an alias doesn't apply to the request, or "" if it does
+func (a *ModelAliaser) mismatch(alias *config.ModelAliasConfig, in AliasInput) string {
+	if !matchPattern(alias.Match, in.Model) {
+		return "model does not match"
+	}
+	if reason := headersMismatch(alias.Headers, in.Headers); reason != "" {
+		return reason
+	}
+	if len(alias.Clients) > 0 && (in.ClientKey == "" || !matchAny(alias.Clients, in.ClientKey)) {
+		return "client is not listed"
+	}
+	if alias.TimeOfDay != "" && !inTimeWindow(a.now(), alias.StartMinute, alias.EndMinute) {
+		return "outside time_of_day " + alias.TimeOfDay
+	}
+	return ""
+}
+
+// isGlob reports whether pattern has glob metacharacters
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
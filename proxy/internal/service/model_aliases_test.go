@@ -0,0 +1,124 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestModelAliaser_Resolve(t *testing.T) {
+	aliases := []config.ModelAliasConfig{
+		{Match: "claude-3-5-haiku-*", Provider: "zai", Model: "glm-4.5-air"},
+		{Match: "claude-3-5-haiku-20241022", Model: "claude-3-5-haiku-latest"},
+		{Match: "claude-opus-*", Model: "claude-sonnet-4", TimeOfDay: "18:00-09:00", StartMinute: 18 * 60, EndMinute: 9 * 60},
+		{Match: "claude-sonnet-*", Provider: "openai", Model: "gpt-4o", Headers: map[string]string{"X-Team": "ml-*"}},
+		{Match: "claude-sonnet-*", Provider: "openai", Model: "gpt-4o-mini", Clients: []string{"sk-ci-*"}},
+	}
+	aliaser := NewModelAliaser(aliases)
+	aliaser.now = func() time.Time { return time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name      string
+		in        AliasInput
+		wantModel string
+	}{
+		{"glob", AliasInput{Model: "claude-3-5-haiku-20250101"}, "glm-4.5-air"},
+		{"exact beats earlier glob", AliasInput{Model: "claude-3-5-haiku-20241022"}, "claude-3-5-haiku-latest"},
+		{"outside time window", AliasInput{Model: "claude-opus-4"}, ""},
+		{"header scoped", AliasInput{Model: "claude-sonnet-4", Headers: http.Header{"X-Team": []string{"ml-research"}}}, "gpt-4o"},
+		{"client scoped", AliasInput{Model: "claude-sonnet-4", ClientKey: "sk-ci-123"}, "gpt-4o-mini"},
+		{"scope not met", AliasInput{Model: "claude-sonnet-4", ClientKey: "sk-dev"}, ""},
+		{"no alias", AliasInput{Model: "gpt-4o"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := aliaser.Resolve(tt.in)
+			got := ""
+			if match != nil {
+				got = match.Model
+				if match.OriginalModel != tt.in.Model {
+					t.Errorf("OriginalModel = %q, want %q", match.OriginalModel, tt.in.Model)
+				}
+			}
+			if got != tt.wantModel {
+				t.Errorf("Resolve() model = %q, want %q", got, tt.wantModel)
+			}
+		})
+	}
+
+	aliaser.now = func() time.Time { return time.Date(2025, 1, 1, 22, 0, 0, 0, time.Local) }
+	if match := aliaser.Resolve(AliasInput{Model: "claude-opus-4"}); match == nil || match.Model != "claude-sonnet-4" {
+		t.Errorf("Expected opus to be downgraded at night, got %+v", match)
+	}
+}
+
+func TestDetermineRoute_AliasedModel(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"zai":       {Format: "anthropic", BaseURL: "https://api.z.ai/api/anthropic"},
+		},
+		ModelAliases: []config.ModelAliasConfig{
+			{Match: "claude-3-5-haiku-*", Target: "zai:glm-4.5-air", Provider: "zai", Model: "glm-4.5-air"},
+			{Match: "claude-opus-*", Target: "zai:claude-sonnet-4", Provider: "zai", Model: "claude-sonnet-4", Headers: map[string]string{"X-Team": "ml-*"}},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"zai":       &mockProvider{name: "zai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	mlTeam := http.Header{"X-Team": []string{"ml-research"}}
+	tests := []struct {
+		name    string
+		model   string
+		headers http.Header
+		want    string
+	}{
+		{"pinned alias", "claude-3-5-haiku-20241022", nil, "zai:glm-4.5-air"},
+		{"scoped alias matched", "claude-opus-4", mlTeam, "zai:claude-sonnet-4"},
+		{"scoped alias not matched", "claude-opus-4", nil, "anthropic:claude-opus-4"},
+		// Only requests the alias matched go to its provider, not every
+		// request for its target model
+		{"alias target requested directly", "claude-sonnet-4", mlTeam, "anthropic:claude-sonnet-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &model.AnthropicRequest{Model: tt.model}
+			routeReq := req
+			alias := router.ResolveAlias(req, tt.headers, "")
+			if alias != nil {
+				aliased := *req
+				aliased.Model = alias.Model
+				routeReq = &aliased
+			}
+
+			decision, err := router.DetermineAliasedRoute(routeReq, tt.headers, alias)
+			if err != nil {
+				t.Fatalf("DetermineAliasedRoute() error = %v", err)
+			}
+			if got := decision.ProviderName + ":" + decision.TargetModel; got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+			if req.Model != tt.model {
+				t.Errorf("ResolveAlias must not modify the request, got model %q", req.Model)
+			}
+
+			explained := router.Explain(req, tt.headers, "")
+			if explained.Decision == nil {
+				t.Fatalf("Explain() error = %s", explained.Error)
+			}
+			if got := explained.Decision.Provider + ":" + explained.Decision.TargetModel; got != tt.want {
+				t.Errorf("Explain() got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
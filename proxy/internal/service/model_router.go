@@ -1,25 +1,53 @@
 package service
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
 	"github.com/seifghazi/claude-code-monitor/internal/provider"
 )
 
+// ErrUnknownProvider is returned when an admin action names a provider that isn't configured
+var ErrUnknownProvider = errors.New("unknown provider")
+
 // RoutingDecision contains the result of routing analysis
 type RoutingDecision struct {
 	Provider      provider.Provider
 	ProviderName  string // Name of the provider (e.g., "anthropic", "openai")
 	OriginalModel string
 	TargetModel   string
-	SubagentName  string // Name of matched subagent, if any
+	SubagentName  string   // Name of matched subagent, if any
+	Priority      Priority // Main agent or subagent, for concurrency queueing
+	RuleID        string   // ID of the routing rule that chose this route, if any
+	ExperimentID  string   // Experiment that assigned this request, if any
+	ExperimentArm string   // Arm of that experiment
+	ProjectPath   string   // Claude Code working directory, if the request reports one
+	// Providers the request may be forwarded to, fallbacks and hedges
+	// included; nil means any
+	AllowedProviders []string
+}
+
+// ForwardMeta describes how a request was forwarded, for the request log
+type ForwardMeta struct {
+	Hedge *model.HedgeInfo // Set when a hedge request was sent
+	Queue *model.QueueInfo // Set when the provider has concurrency limits
+}
+
+// sidechainPromptMarkers identify Claude Code subagent (Task tool) system
+// prompts, so unmapped subagents still queue behind the main agent
+var sidechainPromptMarkers = []string{
+	"You are an agent for Claude Code",
 }
 
 // SubagentMapping contains the parsed provider:model mapping
@@ -29,11 +57,22 @@ type SubagentMapping struct {
 }
 
 type ModelRouter struct {
-	config             *config.Config
-	providers          map[string]provider.Provider
-	subagentMappings   map[string]SubagentMapping    // agentName -> {provider, model}
-	customAgentPrompts map[string]SubagentDefinition // promptHash -> definition
-	logger             *log.Logger
+	config           *config.Config
+	providers        map[string]provider.Provider
+	subagentMappings map[string]SubagentMapping // agentName -> {provider, model}
+	agents           *AgentRegistry             // nil unless subagents are enabled
+	hedger           *Hedger
+	loadBalancer     *LoadBalancer
+	weightController *WeightController // nil unless routing.adaptive_weights is enabled
+	healthChecker    *HealthChecker    // nil until SetHealthChecker is called
+	limiter          *ConcurrencyLimiter
+	rules            *RuleEngine
+	aliases          *ModelAliaser
+	contextWindows   *ContextWindows
+	experiments      *Experiments
+	projects         *Projects
+	preferenceRouter *PreferenceRouter // picks providers for preference rules
+	logger           *log.Logger
 }
 
 type SubagentDefinition struct {
@@ -45,10 +84,15 @@ type SubagentDefinition struct {
 
 // ProviderHealth contains health information for a provider
 type ProviderHealth struct {
-	Name              string  `json:"name"`
-	CircuitBreakerState string `json:"circuit_breaker_state,omitempty"`
-	FallbackProvider  string  `json:"fallback_provider,omitempty"`
-	Healthy           bool    `json:"healthy"`
+	Name                   string                        `json:"name"`
+	CircuitBreakerState    string                        `json:"circuit_breaker_state,omitempty"`
+	CircuitBreakerOverride string                        `json:"circuit_breaker_override,omitempty"`
+	ModelCircuitBreakers   []provider.ModelBreakerStatus `json:"model_circuit_breakers,omitempty"`
+	FallbackProvider       string                        `json:"fallback_provider,omitempty"`
+	Healthy                bool                          `json:"healthy"`
+	Probe                  *ProbeStatus                  `json:"probe,omitempty"`
+	LastSuccess            *time.Time                    `json:"last_success,omitempty"`
+	LastFailure            *time.Time                    `json:"last_failure,omitempty"`
 }
 
 func NewModelRouter(cfg *config.Config, providers map[string]provider.Provider, logger *log.Logger) *ModelRouter {
@@ -75,17 +119,37 @@ func NewModelRouter(cfg *config.Config, providers map[string]provider.Provider,
 		}
 	}
 
+	limiter := NewConcurrencyLimiter(cfg.Providers)
 	router := &ModelRouter{
-		config:             cfg,
-		providers:          providers,
-		subagentMappings:   parsedMappings,
-		customAgentPrompts: make(map[string]SubagentDefinition),
-		logger:             logger,
+		config:           cfg,
+		providers:        providers,
+		subagentMappings: parsedMappings,
+		hedger:           NewHedger(cfg.Routing.Hedging, providers, limiter, logger),
+		limiter:          limiter,
+		rules:            NewRuleEngine(cfg.Routing.Rules),
+		aliases:          NewModelAliaser(cfg.ModelAliases),
+		contextWindows:   NewContextWindows(cfg.Routing.ContextWindows),
+		experiments:      NewExperiments(cfg.Routing.Experiments),
+		projects:         NewProjects(cfg.Routing.Projects),
+		logger:           logger,
 	}
 
+	// Load balancer weights start from provider_profiles; the weight
+	// controller (if enabled) then adjusts them from live traffic
+	baseWeights := baseWeightsFromProfiles(cfg.Routing.ProviderProfiles, providers)
+	lbWeights := make(map[string]int, len(baseWeights))
+	for name, weight := range baseWeights {
+		lbWeights[name] = weight
+	}
+	router.loadBalancer = NewLoadBalancer(lbWeights)
+	if cfg.Routing.AdaptiveWeights.Enabled {
+		router.weightController = NewWeightController(cfg.Routing.AdaptiveWeights, router.loadBalancer, baseWeights, logger)
+	}
+	router.preferenceRouter = NewPreferenceRouter(preferenceRoutingConfig(cfg.Routing), router, providers, logger)
+
 	// Only load custom agents if subagents are enabled
 	if cfg.Subagents.Enable {
-		router.loadCustomAgents()
+		router.agents = NewAgentRegistry(cfg.Subagents, parsedMappings, logger)
 	} else {
 		logger.Println("")
 		logger.Println("ℹ️  Subagent routing is disabled")
@@ -95,95 +159,539 @@ func NewModelRouter(cfg *config.Config, providers map[string]provider.Provider,
 	return router
 }
 
+// Forward sends a routed request to its provider, hedging it when
+// configured, and feeds the outcome to the adaptive weight controller. If the
+// provider has concurrency limits the request first waits for a slot, which
+// is held until the response body is closed.
+func (r *ModelRouter) Forward(ctx context.Context, decision *RoutingDecision, req *http.Request) (*http.Response, ForwardMeta, error) {
+	var meta ForwardMeta
+	release, queue, err := r.limiter.Acquire(ctx, decision.ProviderName, decision.TargetModel, decision.Priority)
+	meta.Queue = queue
+	if err != nil {
+		return nil, meta, err
+	}
+
+	if decision.AllowedProviders != nil {
+		ctx = provider.WithAllowedProviders(ctx, decision.AllowedProviders)
+	}
+
+	start := time.Now()
+	resp, hedge, err := r.hedger.Forward(ctx, decision, req)
+	meta.Hedge = hedge
+	if err != nil || resp == nil {
+		release()
+		if r.weightController != nil && ctx.Err() == nil {
+			// A client that went away says nothing about the provider
+			r.weightController.Observe(r.servedBy(decision, hedge), 0, 0, true)
+		}
+		return resp, meta, err
+	}
+	resp.Body = &observedBody{ReadCloser: resp.Body, onClose: release}
+
+	if r.weightController == nil {
+		return resp, meta, nil
+	}
+
+	// Attribute the outcome to whichever provider actually served it
+	providerName := r.servedBy(decision, hedge)
+	ttfb := time.Since(start)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		r.weightController.Observe(providerName, 0, 0, true)
+	} else {
+		resp.Body = &observedBody{ReadCloser: resp.Body, onClose: func() {
+			r.weightController.Observe(providerName, time.Since(start), ttfb, false)
+		}}
+	}
+
+	return resp, meta, nil
+}
+
+// servedBy returns the provider whose response was served
+func (r *ModelRouter) servedBy(decision *RoutingDecision, hedge *model.HedgeInfo) string {
+	if hedge != nil && hedge.Winner == HedgeWinnerHedge {
+		return hedge.HedgeProvider
+	}
+	return decision.ProviderName
+}
+
+// LoadBalancer returns the load balancer shared by preference-based routing
+func (r *ModelRouter) LoadBalancer() *LoadBalancer {
+	return r.loadBalancer
+}
+
+// WeightController returns the adaptive weight controller, or nil if disabled
+func (r *ModelRouter) WeightController() *WeightController {
+	return r.weightController
+}
+
+// SetHealthChecker attaches the active health prober whose results feed
+// provider health and preference-based routing
+func (r *ModelRouter) SetHealthChecker(hc *HealthChecker) {
+	r.healthChecker = hc
+}
+
+// HealthChecker returns the active health prober, or nil if none is attached
+func (r *ModelRouter) HealthChecker() *HealthChecker {
+	return r.healthChecker
+}
+
+// SetCircuitBreakerOverride forces a provider's breaker (or one of its
+// per-model breakers) open or closed, or hands it back to automatic control
+func (r *ModelRouter) SetCircuitBreakerOverride(providerName, model string, override provider.CircuitOverride) error {
+	prov, exists := r.providers[providerName]
+	if !exists {
+		return fmt.Errorf("%w: '%s'", ErrUnknownProvider, providerName)
+	}
+	resilient, ok := prov.(*provider.ResilientProvider)
+	if !ok {
+		return fmt.Errorf("circuit breaker is not enabled for provider '%s'", providerName)
+	}
+	return resilient.ForceCircuitBreaker(model, override)
+}
+
+// ProviderWeights returns base and effective load balancer weights per
+// provider, on the weight controller's scale whether or not it is enabled
+func (r *ModelRouter) ProviderWeights() []ProviderWeightStats {
+	if r.weightController != nil {
+		return r.weightController.Stats()
+	}
+
+	// Static weights from provider_profiles
+	weights := r.loadBalancer.GetWeights()
+	stats := make([]ProviderWeightStats, 0, len(weights))
+	for name, weight := range weights {
+		stats = append(stats, ProviderWeightStats{
+			Provider:        name,
+			BaseWeight:      weight * weightScale,
+			EffectiveWeight: weight * weightScale,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Provider < stats[j].Provider
+	})
+	return stats
+}
+
+// observedBody runs onClose once when the response body is closed
+type observedBody struct {
+	io.ReadCloser
+	onClose func()
+	once    sync.Once
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
 // extractStaticPrompt extracts the portion before "Notes:" if it exists
 func (r *ModelRouter) extractStaticPrompt(systemPrompt string) string {
-	// Find the "Notes:" section
-	notesIndex := strings.Index(systemPrompt, "\nNotes:")
-	if notesIndex == -1 {
-		notesIndex = strings.Index(systemPrompt, "\n\nNotes:")
+	return extractStaticPrompt(systemPrompt)
+}
+
+// AgentRegistry returns the subagent definitions (nil if subagents are disabled)
+func (r *ModelRouter) AgentRegistry() *AgentRegistry {
+	return r.agents
+}
+
+// DetermineRoute analyzes the request and returns routing information without modifying the request.
+// The subagent or model-name route is worked out first; the first matching
+// routing rule then overrides it. A matching reject rule returns a *RuleRejectError.
+// Otherwise a routing.projects entry with a target or preference picks the
+// route, and failing that the request may be assigned to an experiment arm.
+// A project's provider list is then enforced whichever step chose the route.
+// Finally a request too large for the chosen model's context window moves to
+// an overflow alternative, or a *ContextOverflowError is returned.
+func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest, headers http.Header) (*RoutingDecision, error) {
+	return r.route(req, headers, "", nil)
+}
+
+// DetermineAliasedRoute is DetermineRoute for a request ResolveAlias has
+// rewritten to alias.Model: the provider the alias names, if any, stands in
+// for the model's default provider. alias may be nil.
+func (r *ModelRouter) DetermineAliasedRoute(req *model.AnthropicRequest, headers http.Header, alias *AliasMatch) (*RoutingDecision, error) {
+	return r.route(req, headers, aliasProvider(alias), nil)
+}
+
+// Explain works out the route for a request, model aliases included, without
+// forwarding it or counting it in metrics, and returns every step taken
+func (r *ModelRouter) Explain(req *model.AnthropicRequest, headers http.Header, clientKey string) *RouteTrace {
+	trace := &RouteTrace{RequestedModel: req.Model}
+
+	routeReq := req
+	alias := r.aliases.resolve(AliasInput{Model: req.Model, Headers: headers, ClientKey: clientKey}, trace)
+	if alias != nil {
+		aliased := *req
+		aliased.Model = alias.Model
+		routeReq = &aliased
+		trace.AliasedModel = alias.Model
 	}
 
-	if notesIndex != -1 {
-		// Return only the part before "Notes:"
-		return strings.TrimSpace(systemPrompt[:notesIndex])
+	decision, err := r.route(routeReq, headers, aliasProvider(alias), trace)
+	if err != nil {
+		trace.Error = err.Error()
+		return trace
 	}
+	trace.Decision = &RouteDecisionTrace{
+		Provider:      decision.ProviderName,
+		OriginalModel: req.Model,
+		TargetModel:   decision.TargetModel,
+		SubagentName:  decision.SubagentName,
+		RuleID:        decision.RuleID,
+		ExperimentID:  decision.ExperimentID,
+		ExperimentArm: decision.ExperimentArm,
+		Priority:      decision.Priority.String(),
+	}
+	for _, health := range r.GetProviderHealth() {
+		if health.Name == decision.ProviderName {
+			health := health
+			trace.ProviderHealth = &health
+		}
+	}
+	return trace
+}
+
+// route implements DetermineRoute; pinned is the provider a matched alias
+// names, and a non-nil trace makes it a dry run
+func (r *ModelRouter) route(req *model.AnthropicRequest, headers http.Header, pinned string, trace *RouteTrace) (*RoutingDecision, error) {
+	decision, err := r.determineRoute(req, pinned, trace)
 
-	// If no "Notes:" section, return the whole prompt
-	return strings.TrimSpace(systemPrompt)
+	subagentName := ""
+	if decision != nil {
+		subagentName = decision.SubagentName
+	}
+	in := RuleInput{
+		Request:      req,
+		Headers:      headers,
+		SubagentName: subagentName,
+		ProjectPath:  RequestProjectPath(req),
+	}
+	project := r.projects.Lookup(in.ProjectPath)
+	if trace != nil {
+		trace.ProjectPath = in.ProjectPath
+	}
+
+	if rule := r.rules.match(in, trace); rule != nil {
+		decision, err = r.applyRule(rule, req, subagentName, project, trace)
+	} else if projectRoutes(project) {
+		decision, err = r.applyProject(project, req, subagentName, trace)
+	} else if err == nil {
+		r.applyExperiment(in, decision, trace)
+	}
+	if err == nil {
+		err = r.restrictToProject(project, req, pinned, decision, trace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if decision, err = r.fitContextWindow(req, decision, project, trace); err != nil {
+		return nil, err
+	}
+
+	decision.ProjectPath = in.ProjectPath
+	if project != nil && len(project.Providers) > 0 {
+		decision.AllowedProviders = project.Providers
+	}
+
+	decision.Priority = requestPriority(req, decision)
+	return decision, nil
 }
 
-func (r *ModelRouter) loadCustomAgents() {
-	for agentName, mapping := range r.subagentMappings {
-		// Try loading from project level first, then user level
-		paths := []string{
-			fmt.Sprintf(".claude/agents/%s.md", agentName),
-			fmt.Sprintf("%s/.claude/agents/%s.md", os.Getenv("HOME"), agentName),
-		}
+// applyExperiment assigns the request to an experiment arm, if one matches,
+// and routes it to the arm's target
+func (r *ModelRouter) applyExperiment(in RuleInput, decision *RoutingDecision, trace *RouteTrace) {
+	sessionID := ""
+	if in.Request.Metadata != nil {
+		sessionID = in.Request.Metadata.UserID
+	}
+	assignment := r.experiments.assign(in, sessionID, trace)
+	if assignment == nil {
+		return
+	}
 
-		found := false
-		for _, path := range paths {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				continue
+	arm := assignment.Arm
+	if arm.Target != "" {
+		parts := strings.SplitN(arm.Target, ":", 2)
+		target := r.providers[parts[0]]
+		if target == nil {
+			if trace != nil {
+				last := &trace.Experiments[len(trace.Experiments)-1]
+				last.Result += "; not assigned, provider " + parts[0] + " is unavailable"
+			} else {
+				r.logger.Printf("⚠️  Experiment '%s' arm '%s' targets unavailable provider '%s'; not assigning", assignment.ExperimentID, arm.ID, parts[0])
 			}
+			return
+		}
+		decision.Provider = target
+		decision.ProviderName = parts[0]
+		decision.TargetModel = parts[1]
+	}
+	decision.ExperimentID = assignment.ExperimentID
+	decision.ExperimentArm = arm.ID
+	if trace != nil {
+		return
+	}
 
-			// Parse agent file: metadata\n---\nsystem prompt
-			parts := strings.Split(string(content), "\n---\n")
+	metrics.RecordExperimentAssignment(assignment.ExperimentID, arm.ID)
+	r.logger.Printf("🧪 Experiment '%s' arm '%s': \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+		assignment.ExperimentID, arm.ID, in.Request.Model, decision.ProviderName, decision.TargetModel)
+}
 
-			if len(parts) >= 2 {
-				systemPrompt := strings.TrimSpace(parts[1])
+// Experiments returns the configured traffic-split experiments
+func (r *ModelRouter) Experiments() *Experiments {
+	return r.experiments
+}
 
-				// Extract only the static part (before "Notes:" if it exists)
-				staticPrompt := r.extractStaticPrompt(systemPrompt)
-				hash := r.hashString(staticPrompt)
+// fitContextWindow moves a request too large for the routed model's context
+// window to the first overflow alternative it fits
+func (r *ModelRouter) fitContextWindow(req *model.AnthropicRequest, decision *RoutingDecision, project *config.ProjectConfig, trace *RouteTrace) (*RoutingDecision, error) {
+	window := r.contextWindows.Lookup(decision.ProviderName, decision.TargetModel)
+	if window == nil {
+		return decision, nil
+	}
+	tokens := estimateContextTokens(req)
+	var explained *ContextWindowTrace
+	if trace != nil {
+		explained = &ContextWindowTrace{Match: window.Match, MaxTokens: window.MaxTokens, EstimatedTokens: tokens, Fits: tokens <= window.MaxTokens}
+		trace.ContextWindow = explained
+	}
+	if tokens <= window.MaxTokens {
+		return decision, nil
+	}
 
-				r.customAgentPrompts[hash] = SubagentDefinition{
-					Name:           agentName,
-					TargetModel:    mapping.ModelName,
-					TargetProvider: mapping.ProviderName,
-					FullPrompt:     staticPrompt,
-				}
-				found = true
-				break
+	for _, target := range window.Overflow {
+		parts := strings.SplitN(target, ":", 2)
+		overflow := r.providers[parts[0]]
+		allowed := projectAllows(project, parts[0])
+		fits := r.contextWindows.fits(parts[0], parts[1], tokens)
+		if explained != nil {
+			evaluation := Evaluation{ID: target, Matched: overflow != nil && allowed && fits}
+			if overflow == nil {
+				evaluation.Reason = "provider is not available"
+			} else if !allowed {
+				evaluation.Reason = "provider is not allowed for the project"
+			} else if !fits {
+				evaluation.Reason = "context window is too small"
 			}
+			explained.Overflow = append(explained.Overflow, evaluation)
+		}
+		if overflow == nil || !allowed || !fits {
+			continue
 		}
+		if trace == nil {
+			metrics.RecordContextOverflow(decision.SubagentName, "rerouted")
+			r.logger.Printf("📐 ~%d tokens exceed %s:%s's %d-token context window → \033[33m%s\033[0m:\033[32m%s\033[0m",
+				tokens, decision.ProviderName, decision.TargetModel, window.MaxTokens, parts[0], parts[1])
+		}
+		decision.Provider = overflow
+		decision.ProviderName = parts[0]
+		decision.TargetModel = parts[1]
+		return decision, nil
+	}
 
-		// Log warning if subagent is mapped but definition not found
-		if !found {
-			r.logger.Printf("⚠️  Subagent '%s' is mapped to '%s:%s' but definition file not found in:\n", agentName, mapping.ProviderName, mapping.ModelName)
-			for _, path := range paths {
-				r.logger.Printf("      - %s\n", path)
-			}
+	if trace == nil {
+		metrics.RecordContextOverflow(decision.SubagentName, "rejected")
+		r.logger.Printf("📐 ~%d tokens exceed %s:%s's %d-token context window and no overflow model fits",
+			tokens, decision.ProviderName, decision.TargetModel, window.MaxTokens)
+	}
+	return nil, &ContextOverflowError{
+		ProviderName:    decision.ProviderName,
+		Model:           decision.TargetModel,
+		EstimatedTokens: tokens,
+		MaxTokens:       window.MaxTokens,
+	}
+}
+
+// ResolveAlias returns the model_aliases entry for the request, if any. It
+// runs before DetermineRoute, which should be given the aliased model.
+func (r *ModelRouter) ResolveAlias(req *model.AnthropicRequest, headers http.Header, clientKey string) *AliasMatch {
+	alias := r.aliases.Resolve(AliasInput{Model: req.Model, Headers: headers, ClientKey: clientKey})
+	if alias == nil {
+		return nil
+	}
+
+	target := alias.Model
+	if alias.Provider != "" {
+		target = alias.Provider + ":" + alias.Model
+	}
+	metrics.RecordModelAliasRewrite(alias.Pattern, target)
+	r.logger.Printf("🏷️  Alias '%s': \033[36m%s\033[0m → \033[32m%s\033[0m", alias.Pattern, req.Model, target)
+	return alias
+}
+
+// applyRule builds the routing decision for a matched rule
+func (r *ModelRouter) applyRule(rule *config.RoutingRuleConfig, req *model.AnthropicRequest, subagentName string, project *config.ProjectConfig, trace *RouteTrace) (*RoutingDecision, error) {
+	if trace == nil {
+		metrics.RecordRoutingRuleMatch(rule.ID, rule.Action)
+	}
+
+	if rule.Action == "reject" {
+		if trace == nil {
+			r.logger.Printf("🚫 Rule '%s' rejected request for %s", rule.ID, req.Model)
 		}
+		return nil, &RuleRejectError{RuleID: rule.ID, Message: rule.Message}
 	}
 
-	// Pretty print loaded subagents
-	if len(r.customAgentPrompts) > 0 {
-		r.logger.Println("")
-		r.logger.Println("🤖 Subagent Model Mappings:")
-		r.logger.Println("──────────────────────────────────────")
+	decision := &RoutingDecision{
+		OriginalModel: req.Model,
+		TargetModel:   req.Model,
+		SubagentName:  subagentName,
+		RuleID:        rule.ID,
+	}
 
-		for _, def := range r.customAgentPrompts {
-			r.logger.Printf("   \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
-				def.Name, def.TargetProvider, def.TargetModel)
+	if rule.Target != "" {
+		parts := strings.SplitN(rule.Target, ":", 2)
+		decision.ProviderName = parts[0]
+		decision.TargetModel = parts[1]
+	} else {
+		candidates := rule.Providers
+		if len(candidates) == 0 {
+			candidates = r.preferenceRouter.getAllHealthyProviders()
 		}
+		candidates = projectCandidates(project, candidates)
+		decision.ProviderName = r.preferenceRouter.selectFrom(candidates, Preference(rule.Preference), trace)
+	}
+
+	decision.Provider = r.providers[decision.ProviderName]
+	if decision.Provider == nil {
+		return nil, fmt.Errorf("routing rule '%s' found no available provider", rule.ID)
+	}
 
-		r.logger.Println("──────────────────────────────────────")
-		r.logger.Println("")
+	if trace == nil {
+		r.logger.Printf("📏 Rule '%s': \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+			rule.ID, req.Model, decision.ProviderName, decision.TargetModel)
 	}
+	return decision, nil
 }
 
-// DetermineRoute analyzes the request and returns routing information without modifying the request
-func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecision, error) {
+// applyProject routes a request the way its routing.projects entry says:
+// to the entry's target, or by its preference keeping the model
+func (r *ModelRouter) applyProject(project *config.ProjectConfig, req *model.AnthropicRequest, subagentName string, trace *RouteTrace) (*RoutingDecision, error) {
+	decision := &RoutingDecision{
+		OriginalModel: req.Model,
+		TargetModel:   req.Model,
+		SubagentName:  subagentName,
+	}
+
+	result := ""
+	if project.Target != "" {
+		parts := strings.SplitN(project.Target, ":", 2)
+		decision.ProviderName = parts[0]
+		decision.TargetModel = parts[1]
+		result = "target " + project.Target
+	} else {
+		candidates := project.Providers
+		if len(candidates) == 0 {
+			candidates = r.preferenceRouter.getAllHealthyProviders()
+		}
+		decision.ProviderName = r.preferenceRouter.selectFrom(candidates, Preference(project.Preference), trace)
+		result = "preference " + project.Preference
+	}
+
+	decision.Provider = r.providers[decision.ProviderName]
+	if decision.Provider == nil {
+		return nil, fmt.Errorf("project '%s' found no available provider", project.Path)
+	}
+
+	if trace != nil {
+		trace.Project = &Evaluation{ID: project.Path, Matched: true, Result: result}
+		return decision, nil
+	}
+	metrics.RecordProjectRoute(project.Path, "routed")
+	r.logger.Printf("📁 Project '%s': \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+		project.Path, req.Model, decision.ProviderName, decision.TargetModel)
+	return decision, nil
+}
+
+// restrictToProject moves a request routed to a provider its project doesn't
+// allow back to an allowed one, with the model the client asked for: the
+// model's default provider if allowed, else the first allowed provider
+func (r *ModelRouter) restrictToProject(project *config.ProjectConfig, req *model.AnthropicRequest, pinned string, decision *RoutingDecision, trace *RouteTrace) error {
+	if project == nil {
+		return nil
+	}
+	if trace != nil && trace.Project == nil {
+		trace.Project = &Evaluation{ID: project.Path, Matched: true, Result: "allowed " + decision.ProviderName}
+	}
+	if projectAllows(project, decision.ProviderName) {
+		return nil
+	}
+
+	providerName := r.getDefaultProviderForModel(req.Model, pinned)
+	if !projectAllows(project, providerName) || r.providers[providerName] == nil {
+		providerName = ""
+		for _, name := range project.Providers {
+			if r.providers[name] != nil {
+				providerName = name
+				break
+			}
+		}
+	}
+	if providerName == "" {
+		return fmt.Errorf("project '%s' allows no available provider", project.Path)
+	}
+
+	if trace != nil {
+		trace.Project.Result = fmt.Sprintf("moved from %s (not allowed) to %s:%s", decision.ProviderName, providerName, req.Model)
+	} else {
+		metrics.RecordProjectRoute(project.Path, "restricted")
+		r.logger.Printf("📁 Project '%s' does not allow %s: \033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+			project.Path, decision.ProviderName, req.Model, providerName, req.Model)
+	}
+	decision.Provider = r.providers[providerName]
+	decision.ProviderName = providerName
+	decision.TargetModel = req.Model
+	// The arm's route wasn't taken, so its results shouldn't count it
+	decision.ExperimentID = ""
+	decision.ExperimentArm = ""
+	return nil
+}
+
+// preferenceRoutingConfig converts the routing section of config.yaml for the
+// PreferenceRouter
+func preferenceRoutingConfig(cfg config.RoutingConfig) *RoutingConfig {
+	routing := &RoutingConfig{
+		DefaultPreference: Preference(cfg.Preferences.Default),
+		Tasks:             make(map[string]TaskPreference, len(cfg.Tasks)),
+		ProviderProfiles:  make(map[string]ProviderProfile, len(cfg.ProviderProfiles)),
+	}
+	for name, task := range cfg.Tasks {
+		routing.Tasks[name] = TaskPreference{Preference: Preference(task.Preference), Providers: task.Providers}
+	}
+	for name, profile := range cfg.ProviderProfiles {
+		routing.ProviderProfiles[name] = ProviderProfile{Speed: profile.Speed, Cost: profile.Cost, Quality: profile.Quality}
+	}
+	return routing
+}
+
+// requestPriority classifies a request as main agent or subagent, from the
+// subagent match or, failing that, the system prompt
+func requestPriority(req *model.AnthropicRequest, decision *RoutingDecision) Priority {
+	if decision.SubagentName != "" {
+		return PrioritySubagent
+	}
+	for _, block := range req.System {
+		if hasSidechainMarker(block.Text) {
+			return PrioritySubagent
+		}
+	}
+	return PriorityMain
+}
+
+func (r *ModelRouter) determineRoute(req *model.AnthropicRequest, pinned string, trace *RouteTrace) (*RoutingDecision, error) {
 	decision := &RoutingDecision{
 		OriginalModel: req.Model,
 		TargetModel:   req.Model, // default to original
 	}
+	if trace != nil {
+		trace.Subagents = &SubagentTrace{Enabled: r.config.Subagents.Enable}
+	}
 
 	// Check if subagents are enabled
 	if !r.config.Subagents.Enable {
 		// Subagents disabled, use default provider based on model name
-		providerName := r.getDefaultProviderForModel(decision.TargetModel)
+		providerName := r.getDefaultProviderForModel(decision.TargetModel, pinned)
 		decision.Provider = r.providers[providerName]
 		decision.ProviderName = providerName
 		if decision.Provider == nil {
@@ -197,20 +705,27 @@ func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecis
 
 		// First should be "You are Claude Code..."
 		if strings.Contains(req.System[0].Text, "You are Claude Code") {
+			var explained *SubagentTrace
+			if trace != nil {
+				explained = trace.Subagents
+				explained.ClaudeCodePrompt = true
+			}
+
 			// Second message could be either:
 			// 1. A regular Claude Code prompt (no Notes: section)
 			// 2. A subagent prompt (may have Notes: section)
 
-			fullPrompt := req.System[1].Text
-
-			// Extract static portion (before "Notes:" if it exists)
-			staticPrompt := r.extractStaticPrompt(fullPrompt)
-			promptHash := r.hashString(staticPrompt)
-
-			// Check if this matches a known custom agent
-			if definition, exists := r.customAgentPrompts[promptHash]; exists {
-				r.logger.Printf("\033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
-					req.Model, definition.TargetProvider, definition.TargetModel)
+			// Check if this matches a known custom agent (exactly, or
+			// closely enough that a small edit doesn't break routing)
+			if match, ok := r.agents.match(req.System[1].Text, explained); ok {
+				definition := match.Definition
+				if trace == nil && match.Similarity < 1 {
+					r.logger.Printf("\033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m (%s, similarity %.2f)",
+						req.Model, definition.TargetProvider, definition.TargetModel, definition.Name, match.Similarity)
+				} else if trace == nil {
+					r.logger.Printf("\033[36m%s\033[0m → \033[33m%s\033[0m:\033[32m%s\033[0m",
+						req.Model, definition.TargetProvider, definition.TargetModel)
+				}
 
 				decision.TargetModel = definition.TargetModel
 				decision.Provider = r.providers[definition.TargetProvider]
@@ -227,7 +742,7 @@ func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecis
 	}
 
 	// Default: use the original model and find a provider for it
-	providerName := r.getDefaultProviderForModel(decision.TargetModel)
+	providerName := r.getDefaultProviderForModel(decision.TargetModel, pinned)
 	decision.Provider = r.providers[providerName]
 	decision.ProviderName = providerName
 	if decision.Provider == nil {
@@ -238,16 +753,25 @@ func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecis
 }
 
 func (r *ModelRouter) hashString(s string) string {
-	h := sha256.New()
-	h.Write([]byte(s))
-	fullHash := hex.EncodeToString(h.Sum(nil))
-	shortHash := fullHash[:16]
-	return shortHash
+	return hashPrompt(s)
+}
+
+// aliasProvider returns the provider a matched alias pins its model to, or ""
+func aliasProvider(alias *AliasMatch) string {
+	if alias == nil {
+		return ""
+	}
+	return alias.Provider
 }
 
 // getDefaultProviderForModel returns the default provider name for a model
 // when no explicit provider is specified. This is used for non-subagent requests.
-func (r *ModelRouter) getDefaultProviderForModel(model string) string {
+// pinned, the provider of the alias the request matched, wins if available.
+func (r *ModelRouter) getDefaultProviderForModel(model, pinned string) string {
+	if _, exists := r.providers[pinned]; exists && pinned != "" {
+		return pinned
+	}
+
 	modelLower := strings.ToLower(model)
 
 	// Look for a provider with anthropic format for Claude models
@@ -313,6 +837,8 @@ func (r *ModelRouter) GetProviderHealth() []ProviderHealth {
 		if resilient, ok := prov.(*provider.ResilientProvider); ok {
 			if state := resilient.GetCircuitBreakerState(); state != nil {
 				providerHealth.CircuitBreakerState = state.String()
+				providerHealth.CircuitBreakerOverride = string(resilient.GetCircuitBreakerOverride())
+				providerHealth.ModelCircuitBreakers = resilient.GetModelCircuitBreakers()
 				if *state == provider.StateOpen {
 					providerHealth.Healthy = false
 				}
@@ -324,6 +850,18 @@ func (r *ModelRouter) GetProviderHealth() []ProviderHealth {
 			}
 		}
 
+		// Active probes can mark a provider unhealthy even with a closed breaker
+		if r.healthChecker != nil {
+			if status, ok := r.healthChecker.Status(name); ok {
+				providerHealth.Probe = &status
+				providerHealth.LastSuccess = status.LastSuccess
+				providerHealth.LastFailure = status.LastFailure
+				if !status.Healthy {
+					providerHealth.Healthy = false
+				}
+			}
+		}
+
 		health = append(health, providerHealth)
 	}
 
@@ -252,15 +252,14 @@ func TestRoutingDecision_ProviderNameAndSubagentName(t *testing.T) {
 	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
 	router := NewModelRouter(cfg, providers, logger)
 
-	// Manually add a test agent prompt hash for testing
+	// Manually add a test agent definition for testing
 	testPrompt := "You are a test agent for unit testing."
-	hash := router.hashString(testPrompt)
-	router.customAgentPrompts[hash] = SubagentDefinition{
+	router.agents.register(SubagentDefinition{
 		Name:           "test-agent",
 		TargetModel:    "gpt-4o",
 		TargetProvider: "openai",
 		FullPrompt:     testPrompt,
-	}
+	})
 
 	tests := []struct {
 		name                 string
@@ -308,7 +307,7 @@ func TestRoutingDecision_ProviderNameAndSubagentName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			decision, err := router.DetermineRoute(tt.request)
+			decision, err := router.DetermineRoute(tt.request, nil)
 			if err != nil {
 				t.Fatalf("DetermineRoute() error = %v", err)
 			}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Plugin is one step of the /v1/messages pipeline. A plugin takes part in
+// a stage by also implementing RequestPlugin, ResponseEventPlugin, or
+// CompletePlugin.
+type Plugin interface {
+	Name() string
+}
+
+// RequestPlugin transforms a request after routing, before it is logged
+// and forwarded. OnRequest reports whether it changed the request; it must
+// not change the model, which routing owns.
+type RequestPlugin interface {
+	Plugin
+	OnRequest(req *model.AnthropicRequest) bool
+}
+
+// ResponseEventPlugin sees each response event before the client does and
+// may rewrite its data
+type ResponseEventPlugin interface {
+	Plugin
+	OnResponseEvent(event *ResponseEvent)
+}
+
+// CompletePlugin is told about a request once its response is logged
+type CompletePlugin interface {
+	Plugin
+	OnComplete(requestLog *model.RequestLog)
+}
+
+// ResponseEvent is the JSON of one server-sent event of a streaming
+// response, or the whole body of a non-streaming one (Type "message")
+type ResponseEvent struct {
+	Type string
+	Data []byte
+}
+
+// PluginPipeline holds the configured plugins in order
+type PluginPipeline struct {
+	entries []pluginEntry
+	matcher *RuleEngine // evaluates plugin match conditions
+}
+
+type pluginEntry struct {
+	config *config.PluginConfig
+	plugin Plugin
+}
+
+// NewPluginPipeline creates a pipeline of already-validated plugins
+func NewPluginPipeline(plugins []config.PluginConfig) *PluginPipeline {
+	p := &PluginPipeline{matcher: &RuleEngine{now: time.Now}}
+	for i := range plugins {
+		cfg := &plugins[i]
+		p.entries = append(p.entries, pluginEntry{config: cfg, plugin: newBuiltinPlugin(cfg)})
+	}
+	return p
+}
+
+// Start picks the plugins that apply to a routed request. route is the
+// "provider:model" the request was routed to.
+func (p *PluginPipeline) Start(in RuleInput, route string) *PluginRun {
+	if p == nil || len(p.entries) == 0 {
+		return nil
+	}
+
+	run := &PluginRun{}
+	tokens := lazyTokenEstimate(in.Request)
+	for _, entry := range p.entries {
+		if len(entry.config.Routes) > 0 && !matchAny(entry.config.Routes, route) {
+			continue
+		}
+		if !p.matcher.matches(&entry.config.Match, in, tokens) {
+			continue
+		}
+		run.plugins = append(run.plugins, entry.plugin)
+	}
+	if len(run.plugins) == 0 {
+		return nil
+	}
+	return run
+}
+
+// PluginRun is the plugins applying to one request. A nil run has no
+// plugins, so callers don't need to check.
+type PluginRun struct {
+	plugins []Plugin
+}
+
+// NewPluginRun creates a run of the given plugins, in order, for callers
+// that pick the plugins for a request themselves
+func NewPluginRun(plugins ...Plugin) *PluginRun {
+	if len(plugins) == 0 {
+		return nil
+	}
+	return &PluginRun{plugins: plugins}
+}
+
+// OnRequest runs the request plugins in order and returns the names of
+// those that changed the request
+func (r *PluginRun) OnRequest(req *model.AnthropicRequest) []string {
+	if r == nil {
+		return nil
+	}
+	var applied []string
+	for _, plugin := range r.plugins {
+		if p, ok := plugin.(RequestPlugin); ok && p.OnRequest(req) {
+			applied = append(applied, p.Name())
+			metrics.RecordPluginApplied(p.Name())
+		}
+	}
+	return applied
+}
+
+// OnResponseEvent runs the response event plugins in order
+func (r *PluginRun) OnResponseEvent(event *ResponseEvent) {
+	if r == nil {
+		return
+	}
+	for _, plugin := range r.plugins {
+		if p, ok := plugin.(ResponseEventPlugin); ok {
+			p.OnResponseEvent(event)
+		}
+	}
+}
+
+// OnComplete runs the completion plugins in order
+func (r *PluginRun) OnComplete(requestLog *model.RequestLog) {
+	if r == nil {
+		return
+	}
+	for _, plugin := range r.plugins {
+		if p, ok := plugin.(CompletePlugin); ok {
+			p.OnComplete(requestLog)
+		}
+	}
+}
+
+// newBuiltinPlugin creates the plugin for a config entry's type
+func newBuiltinPlugin(cfg *config.PluginConfig) Plugin {
+	switch cfg.Type {
+	case "system_prompt":
+		return &systemPromptPlugin{name: cfg.Name, text: cfg.Text}
+	case "remove_tools":
+		return &removeToolsPlugin{name: cfg.Name, tools: cfg.Tools}
+	case "max_tokens":
+		return &maxTokensPlugin{name: cfg.Name, limit: cfg.MaxTokens}
+	default:
+		return &metadataPlugin{name: cfg.Name, userID: cfg.UserID}
+	}
+}
+
+// The built-in plugins replace the slices and pointers they change rather
+// than modifying them, since the request may share them with a copy.
+
+// systemPromptPlugin appends a snippet to the system prompt
+type systemPromptPlugin struct {
+	name string
+	text string
+}
+
+func (p *systemPromptPlugin) Name() string { return p.name }
+
+func (p *systemPromptPlugin) OnRequest(req *model.AnthropicRequest) bool {
+	system := make([]model.AnthropicSystemMessage, len(req.System), len(req.System)+1)
+	copy(system, req.System)
+	req.System = append(system, model.AnthropicSystemMessage{Type: "text", Text: p.text})
+	return true
+}
+
+// removeToolsPlugin drops tools by name or glob
+type removeToolsPlugin struct {
+	name  string
+	tools []string
+}
+
+func (p *removeToolsPlugin) Name() string { return p.name }
+
+func (p *removeToolsPlugin) OnRequest(req *model.AnthropicRequest) bool {
+	kept := make([]model.Tool, 0, len(req.Tools))
+	for _, tool := range req.Tools {
+		if !matchAny(p.tools, tool.Name) {
+			kept = append(kept, tool)
+		}
+	}
+	if len(kept) == len(req.Tools) {
+		return false
+	}
+	req.Tools = kept
+	if len(kept) == 0 {
+		// tool_choice is only valid alongside tools
+		req.ToolChoice = nil
+	}
+	return true
+}
+
+// maxTokensPlugin caps max_tokens
+type maxTokensPlugin struct {
+	name  string
+	limit int
+}
+
+func (p *maxTokensPlugin) Name() string { return p.name }
+
+func (p *maxTokensPlugin) OnRequest(req *model.AnthropicRequest) bool {
+	if req.MaxTokens <= p.limit {
+		return false
+	}
+	req.MaxTokens = p.limit
+	return true
+}
+
+// metadataPlugin fills in metadata.user_id when the client sent none
+type metadataPlugin struct {
+	name   string
+	userID string
+}
+
+func (p *metadataPlugin) Name() string { return p.name }
+
+func (p *metadataPlugin) OnRequest(req *model.AnthropicRequest) bool {
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		return false
+	}
+	req.Metadata = &model.AnthropicMetadata{UserID: p.userID}
+	return true
+}
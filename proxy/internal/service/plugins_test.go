@@ -0,0 +1,133 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestPluginPipeline_BuiltinsRunInOrder(t *testing.T) {
+	pipeline := NewPluginPipeline([]config.PluginConfig{
+		{Name: "team-prompt", Type: "system_prompt", Text: "Follow the team style guide."},
+		{Name: "no-web", Type: "remove_tools", Tools: []string{"Web*"}},
+		{Name: "cap", Type: "max_tokens", MaxTokens: 4096},
+		{Name: "team-id", Type: "metadata", UserID: "team-platform"},
+	})
+
+	system := []model.AnthropicSystemMessage{{Type: "text", Text: "You are Claude Code"}}
+	req := &model.AnthropicRequest{
+		Model:      "claude-sonnet-4",
+		MaxTokens:  32000,
+		System:     system,
+		Tools:      []model.Tool{{Name: "Read"}, {Name: "WebFetch"}, {Name: "WebSearch"}},
+		ToolChoice: map[string]string{"type": "auto"},
+	}
+
+	run := pipeline.Start(RuleInput{Request: req}, "anthropic:claude-sonnet-4")
+	applied := run.OnRequest(req)
+
+	if want := []string{"team-prompt", "no-web", "cap", "team-id"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("Expected applied plugins %v, got %v", want, applied)
+	}
+	if len(req.System) != 2 || req.System[1].Text != "Follow the team style guide." {
+		t.Errorf("Expected the snippet appended to the system prompt, got %+v", req.System)
+	}
+	if len(system) != 1 {
+		t.Error("Expected the original system slice to be left alone")
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Name != "Read" {
+		t.Errorf("Expected only Read to remain, got %+v", req.Tools)
+	}
+	if req.ToolChoice == nil {
+		t.Error("Expected tool_choice kept while tools remain")
+	}
+	if req.MaxTokens != 4096 {
+		t.Errorf("Expected max_tokens capped at 4096, got %d", req.MaxTokens)
+	}
+	if req.Metadata == nil || req.Metadata.UserID != "team-platform" {
+		t.Errorf("Expected metadata.user_id to be injected, got %+v", req.Metadata)
+	}
+
+	// Running again changes nothing but the system prompt
+	again := &model.AnthropicRequest{
+		Model:     "claude-sonnet-4",
+		MaxTokens: 1024,
+		Tools:     []model.Tool{{Name: "Read"}},
+		Metadata:  &model.AnthropicMetadata{UserID: "session-1"},
+	}
+	if applied := run.OnRequest(again); !reflect.DeepEqual(applied, []string{"team-prompt"}) {
+		t.Errorf("Expected only team-prompt to apply, got %v", applied)
+	}
+	if again.Metadata.UserID != "session-1" {
+		t.Errorf("Expected the client's user_id to be kept, got %q", again.Metadata.UserID)
+	}
+}
+
+func TestPluginPipeline_Match(t *testing.T) {
+	pipeline := NewPluginPipeline([]config.PluginConfig{
+		{Name: "cap-subagents", Type: "max_tokens", MaxTokens: 1000, Match: config.RuleMatchConfig{Subagents: []string{"*"}}},
+		{Name: "zai-no-web", Type: "remove_tools", Tools: []string{"WebSearch"}, Routes: []string{"zai:*"}},
+	})
+	newReq := func() *model.AnthropicRequest {
+		return &model.AnthropicRequest{Model: "claude-sonnet-4", MaxTokens: 8000, Tools: []model.Tool{{Name: "WebSearch"}}}
+	}
+
+	req := newReq()
+	if run := pipeline.Start(RuleInput{Request: req}, "anthropic:claude-sonnet-4"); run != nil {
+		t.Errorf("Expected no plugins for the main agent on anthropic, got %v", run.OnRequest(req))
+	}
+
+	req = newReq()
+	run := pipeline.Start(RuleInput{Request: req, SubagentName: "code-reviewer"}, "zai:glm-4.6")
+	if applied := run.OnRequest(req); !reflect.DeepEqual(applied, []string{"cap-subagents", "zai-no-web"}) {
+		t.Errorf("Expected both plugins for a subagent routed to zai, got %v", applied)
+	}
+	if req.ToolChoice != nil || len(req.Tools) != 0 {
+		t.Errorf("Expected all tools removed, got %+v", req.Tools)
+	}
+
+	// A nil run and a nil pipeline are no-ops
+	var empty *PluginPipeline
+	req = newReq()
+	if applied := empty.Start(RuleInput{Request: req}, "zai:glm-4.6").OnRequest(req); applied != nil || req.MaxTokens != 8000 {
+		t.Errorf("Expected a nil pipeline to change nothing, got %v", applied)
+	}
+}
+
+type redactingPlugin struct {
+	completed *model.RequestLog
+}
+
+func (p *redactingPlugin) Name() string { return "redact" }
+
+func (p *redactingPlugin) OnResponseEvent(event *ResponseEvent) {
+	if event.Type == "content_block_delta" {
+		event.Data = []byte(`{"type":"content_block_delta","delta":{"type":"text_delta","text":"[redacted]"}}`)
+	}
+}
+
+func (p *redactingPlugin) OnComplete(requestLog *model.RequestLog) { p.completed = requestLog }
+
+func TestPluginRun_ResponseHooks(t *testing.T) {
+	plugin := &redactingPlugin{}
+	run := &PluginRun{plugins: []Plugin{plugin}}
+
+	event := &ResponseEvent{Type: "content_block_delta", Data: []byte(`{"type":"content_block_delta","delta":{"type":"text_delta","text":"secret"}}`)}
+	run.OnResponseEvent(event)
+	if string(event.Data) != `{"type":"content_block_delta","delta":{"type":"text_delta","text":"[redacted]"}}` {
+		t.Errorf("Expected the event to be rewritten, got %s", event.Data)
+	}
+
+	// Response-only plugins never count as changing the request
+	if applied := run.OnRequest(&model.AnthropicRequest{}); applied != nil {
+		t.Errorf("Expected no applied plugins, got %v", applied)
+	}
+
+	requestLog := &model.RequestLog{RequestID: "abc"}
+	run.OnComplete(requestLog)
+	if plugin.completed != requestLog {
+		t.Error("Expected OnComplete to receive the request log")
+	}
+}
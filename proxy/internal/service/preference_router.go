@@ -66,11 +66,17 @@ func NewPreferenceRouter(
 		}
 	}
 
+	// Share the model router's load balancer so adaptive weights apply here too
+	loadBalancer := NewLoadBalancer(weights)
+	if modelRouter != nil {
+		loadBalancer = modelRouter.LoadBalancer()
+	}
+
 	return &PreferenceRouter{
 		config:       cfg,
 		modelRouter:  modelRouter,
 		providers:    providers,
-		loadBalancer: NewLoadBalancer(weights),
+		loadBalancer: loadBalancer,
 		logger:       logger,
 	}
 }
@@ -91,11 +97,31 @@ func (r *PreferenceRouter) SelectProvider(task string, preference Preference, mo
 		candidateProviders = r.getAllHealthyProviders()
 	}
 
+	selectedProvider := r.selectFrom(candidateProviders, preference, nil)
+	if selectedProvider == "" {
+		return "", ""
+	}
+	return selectedProvider, model
+}
+
+// selectFrom picks a healthy provider from candidates, load balancing across
+// the top-ranked ones for the preference. Returns "" if none are healthy.
+// With a trace it records the filtering and ranking, and peeks at the load
+// balancer instead of counting the selection.
+func (r *PreferenceRouter) selectFrom(candidates []string, preference Preference, trace *RouteTrace) string {
+	var explained *PreferenceTrace
+	if trace != nil {
+		explained = &PreferenceTrace{Preference: string(preference), Candidates: candidates}
+		trace.Preference = explained
+	}
+
 	// Filter out unhealthy providers
-	healthyProviders := r.filterHealthyProviders(candidateProviders)
+	healthyProviders := r.filterHealthy(candidates, explained)
 	if len(healthyProviders) == 0 {
-		r.logger.Printf("⚠️ No healthy providers available for preference '%s'", preference)
-		return "", ""
+		if explained == nil {
+			r.logger.Printf("⚠️ No healthy providers available for preference '%s'", preference)
+		}
+		return ""
 	}
 
 	// Rank providers by preference
@@ -109,10 +135,17 @@ func (r *PreferenceRouter) SelectProvider(task string, preference Preference, mo
 	}
 	topProviders := rankedProviders[:topN]
 
-	// Load balance across top providers
-	selectedProvider := r.loadBalancer.SelectProvider(topProviders)
+	if explained != nil {
+		for _, name := range rankedProviders {
+			explained.Ranking = append(explained.Ranking, ProviderScore{Provider: name, Score: r.calculateScore(r.profile(name), preference)})
+		}
+		explained.Top = topProviders
+		explained.Selected = r.loadBalancer.Peek(topProviders)
+		return explained.Selected
+	}
 
-	return selectedProvider, model
+	// Load balance across top providers
+	return r.loadBalancer.SelectProvider(topProviders)
 }
 
 // GetTaskPreference returns the preference for a given task type
@@ -142,13 +175,30 @@ func (r *PreferenceRouter) getAllHealthyProviders() []string {
 	return providers
 }
 
-// filterHealthyProviders excludes providers with open circuit breakers
+// filterHealthyProviders excludes providers with open circuit breakers or
+// failing active health probes
 func (r *PreferenceRouter) filterHealthyProviders(candidates []string) []string {
+	return r.filterHealthy(candidates, nil)
+}
+
+// filterHealthy implements filterHealthyProviders, recording exclusions in
+// trace instead of logging them
+func (r *PreferenceRouter) filterHealthy(candidates []string, trace *PreferenceTrace) []string {
 	healthy := make([]string, 0, len(candidates))
+	exclude := func(name, reason string) {
+		if trace != nil {
+			trace.Excluded = append(trace.Excluded, ExcludedProvider{Provider: name, Reason: reason})
+		} else {
+			r.logger.Printf("⚠️ Excluding provider '%s' (%s)", name, reason)
+		}
+	}
 
 	for _, name := range candidates {
 		prov, exists := r.providers[name]
 		if !exists {
+			if trace != nil {
+				exclude(name, "provider is not available")
+			}
 			continue
 		}
 
@@ -157,12 +207,17 @@ func (r *PreferenceRouter) filterHealthyProviders(candidates []string) []string
 			if state := resilient.GetCircuitBreakerState(); state != nil {
 				// Exclude providers with open circuit breakers
 				if *state == provider.StateOpen {
-					r.logger.Printf("⚠️ Excluding provider '%s' (circuit breaker is open)", name)
+					exclude(name, "circuit breaker is open")
 					continue
 				}
 			}
 		}
 
+		if r.modelRouter != nil && r.modelRouter.HealthChecker() != nil && !r.modelRouter.HealthChecker().IsHealthy(name) {
+			exclude(name, "failing health probes")
+			continue
+		}
+
 		healthy = append(healthy, name)
 	}
 
@@ -180,17 +235,7 @@ func (r *PreferenceRouter) rankProviders(providers []string, preference Preferen
 	scored := make([]scoredProvider, 0, len(providers))
 
 	for _, name := range providers {
-		profile, exists := r.config.ProviderProfiles[name]
-		if !exists {
-			// Default profile for providers without configuration
-			profile = ProviderProfile{
-				Speed:   5,
-				Cost:    5,
-				Quality: 5,
-			}
-		}
-
-		score := r.calculateScore(profile, preference)
+		score := r.calculateScore(r.profile(name), preference)
 		scored = append(scored, scoredProvider{name: name, score: score})
 	}
 
@@ -212,6 +257,19 @@ func (r *PreferenceRouter) rankProviders(providers []string, preference Preferen
 	return result
 }
 
+// profile returns a provider's profile, defaulting to the middle of every
+// scale for providers without one
+func (r *PreferenceRouter) profile(name string) ProviderProfile {
+	if profile, exists := r.config.ProviderProfiles[name]; exists {
+		return profile
+	}
+	return ProviderProfile{
+		Speed:   5,
+		Cost:    5,
+		Quality: 5,
+	}
+}
+
 // calculateScore computes a provider's score for a given preference
 func (r *PreferenceRouter) calculateScore(profile ProviderProfile, preference Preference) int {
 	switch preference {
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// Projects looks up routing.projects entries
+type Projects struct {
+	projects []config.ProjectConfig
+}
+
+// NewProjects creates a lookup for already-validated entries
+func NewProjects(projects []config.ProjectConfig) *Projects {
+	return &Projects{projects: projects}
+}
+
+// Lookup returns the first entry matching a project directory, or nil if
+// the project has no overrides
+func (p *Projects) Lookup(projectPath string) *config.ProjectConfig {
+	if p == nil || projectPath == "" {
+		return nil
+	}
+	for i := range p.projects {
+		if underAnyPath([]string{p.projects[i].Path}, projectPath) {
+			return &p.projects[i]
+		}
+	}
+	return nil
+}
+
+// projectRoutes reports whether a project picks the route itself, rather
+// than only restricting providers
+func projectRoutes(project *config.ProjectConfig) bool {
+	return project != nil && (project.Target != "" || project.Preference != "")
+}
+
+// projectAllows reports whether a project's requests may be sent to a
+// provider. Requests from no project, or one without a provider list, may
+// go anywhere.
+func projectAllows(project *config.ProjectConfig, providerName string) bool {
+	return project == nil || len(project.Providers) == 0 || slices.Contains(project.Providers, providerName)
+}
+
+// projectCandidates narrows preference candidates to the providers a project
+// allows. If none are allowed the candidates are kept, and restrictToProject
+// moves the request afterwards.
+func projectCandidates(project *config.ProjectConfig, candidates []string) []string {
+	if project == nil || len(project.Providers) == 0 {
+		return candidates
+	}
+	allowed := make([]string, 0, len(candidates))
+	for _, name := range candidates {
+		if projectAllows(project, name) {
+			allowed = append(allowed, name)
+		}
+	}
+	if len(allowed) == 0 {
+		return candidates
+	}
+	return allowed
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestProjects_Lookup(t *testing.T) {
+	projects := NewProjects([]config.ProjectConfig{
+		{Path: "/work/client", Providers: []string{"anthropic"}},
+		{Path: "/work/sandbox-*", Preference: "cost"},
+	})
+
+	for projectPath, expected := range map[string]string{
+		"/work/client":        "/work/client",
+		"/work/client/api":    "/work/client",
+		"/work/clientele":     "",
+		"/work/sandbox-try":   "/work/sandbox-*",
+		"/home/dev/elsewhere": "",
+		"":                    "",
+	} {
+		got := ""
+		if project := projects.Lookup(projectPath); project != nil {
+			got = project.Path
+		}
+		if got != expected {
+			t.Errorf("Lookup(%q) = %q, want %q", projectPath, got, expected)
+		}
+	}
+}
+
+func projectRequest(projectPath string) *model.AnthropicRequest {
+	return &model.AnthropicRequest{
+		Model: "claude-sonnet-4",
+		System: []model.AnthropicSystemMessage{
+			{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+			{Text: "<env>\nWorking directory: " + projectPath + "\nIs directory a git repo: Yes\n</env>"},
+		},
+	}
+}
+
+func TestDetermineRoute_Projects(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"openai":    {Format: "openai", BaseURL: "https://api.openai.com"},
+			"zai":       {Format: "anthropic", BaseURL: "https://api.z.ai/api/anthropic"},
+		},
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{ID: "gpt", Match: config.RuleMatchConfig{Headers: map[string]string{"X-Route": "gpt"}}, Action: "route", Target: "openai:gpt-4o"},
+			},
+			Projects: []config.ProjectConfig{
+				{Path: "/work/client", Providers: []string{"anthropic"}},
+				{Path: "/work/sandbox", Target: "zai:glm-4.5-air"},
+			},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+		"zai":       &mockProvider{name: "zai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+	gpt := http.Header{"X-Route": []string{"gpt"}}
+
+	// A rule may not take a restricted project's request off its providers
+	decision, err := router.DetermineRoute(projectRequest("/work/client/api"), gpt)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "anthropic" || decision.TargetModel != "claude-sonnet-4" {
+		t.Errorf("Restricted project: got %s:%s, want anthropic:claude-sonnet-4", decision.ProviderName, decision.TargetModel)
+	}
+	if !reflect.DeepEqual(decision.AllowedProviders, []string{"anthropic"}) || decision.ProjectPath != "/work/client/api" {
+		t.Errorf("Restricted project: allowed %v, project %q", decision.AllowedProviders, decision.ProjectPath)
+	}
+
+	decision, err = router.DetermineRoute(projectRequest("/work/sandbox"), nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "zai" || decision.TargetModel != "glm-4.5-air" || decision.AllowedProviders != nil {
+		t.Errorf("Project target: got %s:%s (allowed %v)", decision.ProviderName, decision.TargetModel, decision.AllowedProviders)
+	}
+
+	// Rules take precedence over a project's target
+	decision, err = router.DetermineRoute(projectRequest("/work/sandbox"), gpt)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "openai" || decision.RuleID != "gpt" {
+		t.Errorf("Rule in project: got %s (rule %q), want the gpt rule", decision.ProviderName, decision.RuleID)
+	}
+
+	decision, err = router.DetermineRoute(projectRequest("/work/other"), nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "anthropic" || decision.ProjectPath != "/work/other" || decision.AllowedProviders != nil {
+		t.Errorf("Unconfigured project: got %s (project %q, allowed %v)", decision.ProviderName, decision.ProjectPath, decision.AllowedProviders)
+	}
+}
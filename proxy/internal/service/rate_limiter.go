@@ -0,0 +1,285 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+)
+
+// Rate limit scopes, in the order they are checked
+const (
+	RateLimitScopeGlobal  = "global"
+	RateLimitScopeClient  = "client"
+	RateLimitScopeSession = "session"
+)
+
+// rateLimitIdleTTL is how long an idle client or session bucket is kept.
+// Buckets refill completely within a minute, so an idle bucket older than
+// this is indistinguishable from a new one.
+const rateLimitIdleTTL = 2 * time.Minute
+
+// RateLimitError is returned when a request doesn't fit in a bucket
+type RateLimitError struct {
+	Scope      string        // RateLimitScopeGlobal, RateLimitScopeClient, or RateLimitScopeSession
+	Limit      string        // "requests" or "tokens"
+	RetryAfter time.Duration // Time until the request would fit
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s %s per minute rate limit exceeded; retry after %ds", e.Scope, e.Limit, e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds for the
+// retry-after header
+func (e *RateLimitError) RetryAfterSeconds() int {
+	seconds := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// tokenBucket holds up to one minute's allowance and refills continuously
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	updated  time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{capacity: float64(perMinute), tokens: float64(perMinute), updated: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += b.capacity * elapsed.Minutes()
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.updated = now
+}
+
+// wait returns how long until n tokens are available (0 if they are now).
+// Requests larger than the bucket only need a full bucket, so a single
+// oversized request can't be rejected forever.
+func (b *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	if n > b.capacity {
+		n = b.capacity
+	}
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.capacity * float64(time.Minute))
+}
+
+// inherit starts the bucket at previous's level; either may be nil when
+// that limit is not configured
+func (b *tokenBucket) inherit(previous *tokenBucket, now time.Time) {
+	if b == nil || previous == nil {
+		return
+	}
+	previous.refill(now)
+	b.tokens = min(previous.tokens, b.capacity)
+	b.updated = now
+}
+
+func (b *tokenBucket) take(n float64) {
+	if n > b.capacity {
+		n = b.capacity
+	}
+	b.tokens -= n
+}
+
+// rateLimitBuckets is the request and token bucket pair for one key
+type rateLimitBuckets struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+	lastUsed time.Time
+}
+
+func newRateLimitBuckets(rule config.RateLimitRule, now time.Time) *rateLimitBuckets {
+	return &rateLimitBuckets{
+		requests: newTokenBucket(rule.RequestsPerMinute, now),
+		tokens:   newTokenBucket(rule.TokensPerMinute, now),
+		lastUsed: now,
+	}
+}
+
+func (b *rateLimitBuckets) inherit(previous *rateLimitBuckets, now time.Time) {
+	b.requests.inherit(previous.requests, now)
+	b.tokens.inherit(previous.tokens, now)
+	b.lastUsed = previous.lastUsed
+}
+
+// RateLimiter applies token-bucket limits to inbound requests globally, per
+// client API key, and per Claude Code session. Requests per minute and
+// estimated input tokens per minute are tracked separately.
+type RateLimiter struct {
+	cfg config.RateLimitConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	global    *rateLimitBuckets
+	clients   map[string]*rateLimitBuckets
+	sessions  map[string]*rateLimitBuckets
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a limiter from the rate_limits config
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		cfg:       cfg,
+		now:       time.Now,
+		global:    newRateLimitBuckets(cfg.Global, now),
+		clients:   make(map[string]*rateLimitBuckets),
+		sessions:  make(map[string]*rateLimitBuckets),
+		lastSweep: now,
+	}
+}
+
+// Enabled reports whether any limit applies
+func (l *RateLimiter) Enabled() bool {
+	if l == nil || !l.cfg.Enabled {
+		return false
+	}
+	if l.cfg.Global.IsConfigured() || l.cfg.PerClient.IsConfigured() || l.cfg.PerSession.IsConfigured() {
+		return true
+	}
+	for _, rule := range l.cfg.Clients {
+		if rule.IsConfigured() {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow checks a request against every scope and consumes from the buckets
+// only if it fits in all of them. clientKey or sessionID may be empty, in
+// which case that scope is skipped. On rejection the error is a
+// *RateLimitError for the scope with the longest wait.
+func (l *RateLimiter) Allow(clientKey, sessionID string, body []byte) error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	estimatedTokens := float64(estimateInputTokens(body))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	type scoped struct {
+		scope   string
+		buckets *rateLimitBuckets
+	}
+	checks := []scoped{{RateLimitScopeGlobal, l.global}}
+	if clientKey != "" {
+		rule, exists := l.cfg.Clients[clientKey]
+		if !exists {
+			rule = l.cfg.PerClient
+		}
+		if rule.IsConfigured() {
+			checks = append(checks, scoped{RateLimitScopeClient, l.bucketsFor(l.clients, clientKey, rule, now)})
+		}
+	}
+	if sessionID != "" && l.cfg.PerSession.IsConfigured() {
+		checks = append(checks, scoped{RateLimitScopeSession, l.bucketsFor(l.sessions, sessionID, l.cfg.PerSession, now)})
+	}
+
+	var rejection *RateLimitError
+	reject := func(scope, limit string, wait time.Duration) {
+		if wait > 0 && (rejection == nil || wait > rejection.RetryAfter) {
+			rejection = &RateLimitError{Scope: scope, Limit: limit, RetryAfter: wait}
+		}
+	}
+	for _, c := range checks {
+		if c.buckets.requests != nil {
+			reject(c.scope, "requests", c.buckets.requests.wait(1, now))
+		}
+		if c.buckets.tokens != nil {
+			reject(c.scope, "tokens", c.buckets.tokens.wait(estimatedTokens, now))
+		}
+	}
+	if rejection != nil {
+		metrics.RecordRateLimitRejection(rejection.Scope, rejection.Limit)
+		return rejection
+	}
+
+	for _, c := range checks {
+		if c.buckets.requests != nil {
+			c.buckets.requests.take(1)
+		}
+		if c.buckets.tokens != nil {
+			c.buckets.tokens.take(estimatedTokens)
+		}
+		c.buckets.lastUsed = now
+	}
+	return nil
+}
+
+// inherit carries bucket levels over from the limiter this one replaces on
+// a config reload, so rewriting config.yaml doesn't refill every bucket.
+// Buckets keep what they had left, up to their new capacity.
+func (l *RateLimiter) inherit(previous *RateLimiter) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.global.inherit(previous.global, now)
+	for key, buckets := range previous.clients {
+		rule, exists := l.cfg.Clients[key]
+		if !exists {
+			rule = l.cfg.PerClient
+		}
+		if rule.IsConfigured() {
+			l.bucketsFor(l.clients, key, rule, now).inherit(buckets, now)
+		}
+	}
+	if l.cfg.PerSession.IsConfigured() {
+		for key, buckets := range previous.sessions {
+			l.bucketsFor(l.sessions, key, l.cfg.PerSession, now).inherit(buckets, now)
+		}
+	}
+}
+
+// bucketsFor returns the buckets for key, creating them if needed. Must be
+// called with lock held.
+func (l *RateLimiter) bucketsFor(set map[string]*rateLimitBuckets, key string, rule config.RateLimitRule, now time.Time) *rateLimitBuckets {
+	buckets, exists := set[key]
+	if !exists {
+		buckets = newRateLimitBuckets(rule, now)
+		set[key] = buckets
+	}
+	return buckets
+}
+
+// sweep drops idle client and session buckets so the maps don't grow with
+// every session ever seen. Must be called with lock held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for _, set := range []map[string]*rateLimitBuckets{l.clients, l.sessions} {
+		for key, buckets := range set {
+			if now.Sub(buckets.lastUsed) > rateLimitIdleTTL {
+				delete(set, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// newTestRateLimiter returns a limiter on a clock the test controls
+func newTestRateLimiter(cfg config.RateLimitConfig) (*RateLimiter, *time.Time) {
+	l := NewRateLimiter(cfg)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	l.global = newRateLimitBuckets(cfg.Global, now)
+	l.lastSweep = now
+	return l, &now
+}
+
+func TestRateLimiter_RequestsPerMinute(t *testing.T) {
+	l, now := newTestRateLimiter(config.RateLimitConfig{
+		Enabled:    true,
+		PerSession: config.RateLimitRule{RequestsPerMinute: 2},
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := l.Allow("key", "session-a", nil); err != nil {
+			t.Fatalf("Request %d: unexpected error %v", i, err)
+		}
+	}
+
+	err := l.Allow("key", "session-a", nil)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected RateLimitError, got %v", err)
+	}
+	if limitErr.Scope != RateLimitScopeSession || limitErr.Limit != "requests" {
+		t.Errorf("Got scope=%s limit=%s, want session/requests", limitErr.Scope, limitErr.Limit)
+	}
+	if limitErr.RetryAfterSeconds() != 30 {
+		t.Errorf("RetryAfterSeconds() = %d, want 30", limitErr.RetryAfterSeconds())
+	}
+
+	// Other sessions have their own bucket
+	if err := l.Allow("key", "session-b", nil); err != nil {
+		t.Errorf("Other session: unexpected error %v", err)
+	}
+
+	// Half a minute refills one request
+	*now = now.Add(30 * time.Second)
+	if err := l.Allow("key", "session-a", nil); err != nil {
+		t.Errorf("After refill: unexpected error %v", err)
+	}
+}
+
+func TestRateLimiter_TokensPerMinute(t *testing.T) {
+	l, now := newTestRateLimiter(config.RateLimitConfig{
+		Enabled:   true,
+		PerClient: config.RateLimitRule{TokensPerMinute: 1000},
+	})
+	body := []byte(strings.Repeat("x", 2400)) // ~600 estimated tokens
+
+	if err := l.Allow("key-a", "", body); err != nil {
+		t.Fatalf("First request: unexpected error %v", err)
+	}
+	err := l.Allow("key-a", "", body)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) || limitErr.Scope != RateLimitScopeClient || limitErr.Limit != "tokens" {
+		t.Fatalf("Expected client tokens rejection, got %v", err)
+	}
+	if err := l.Allow("key-b", "", body); err != nil {
+		t.Errorf("Other client: unexpected error %v", err)
+	}
+
+	// A request larger than the bucket only needs a full bucket
+	*now = now.Add(time.Minute)
+	if err := l.Allow("key-a", "", []byte(strings.Repeat("x", 8000))); err != nil {
+		t.Errorf("Oversized request with a full bucket: unexpected error %v", err)
+	}
+}
+
+func TestRateLimiter_RejectionConsumesNothing(t *testing.T) {
+	l, _ := newTestRateLimiter(config.RateLimitConfig{
+		Enabled:    true,
+		Global:     config.RateLimitRule{RequestsPerMinute: 10},
+		PerSession: config.RateLimitRule{RequestsPerMinute: 1},
+	})
+
+	if err := l.Allow("", "session", nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := l.Allow("", "session", nil); err == nil {
+			t.Fatalf("Expected session rejection")
+		}
+	}
+
+	// Rejected requests must not have drained the global bucket
+	for i := 0; i < 9; i++ {
+		if err := l.Allow("", "other-"+string(rune('a'+i)), nil); err != nil {
+			t.Fatalf("Global request %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestRateLimiter_ClientOverrideAndDisabled(t *testing.T) {
+	l, _ := newTestRateLimiter(config.RateLimitConfig{
+		Enabled:   true,
+		PerClient: config.RateLimitRule{RequestsPerMinute: 1},
+		Clients:   map[string]config.RateLimitRule{"ci-key": {RequestsPerMinute: 3}},
+	})
+	for i := 0; i < 3; i++ {
+		if err := l.Allow("ci-key", "", nil); err != nil {
+			t.Fatalf("Override request %d: unexpected error %v", i, err)
+		}
+	}
+	if err := l.Allow("ci-key", "", nil); err == nil {
+		t.Error("Expected rejection after the override limit")
+	}
+
+	disabled := NewRateLimiter(config.RateLimitConfig{PerClient: config.RateLimitRule{RequestsPerMinute: 1}})
+	for i := 0; i < 3; i++ {
+		if err := disabled.Allow("key", "", nil); err != nil {
+			t.Fatalf("Disabled limiter rejected a request: %v", err)
+		}
+	}
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	l, now := newTestRateLimiter(config.RateLimitConfig{
+		Enabled:    true,
+		PerSession: config.RateLimitRule{RequestsPerMinute: 5},
+	})
+	l.Allow("", "old-session", nil)
+
+	*now = now.Add(3 * time.Minute)
+	l.Allow("", "new-session", nil)
+
+	if _, exists := l.sessions["old-session"]; exists {
+		t.Error("Expected idle session bucket to be swept")
+	}
+	if _, exists := l.sessions["new-session"]; !exists {
+		t.Error("Expected active session bucket to be kept")
+	}
+}
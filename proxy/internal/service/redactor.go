@@ -0,0 +1,246 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+)
+
+// builtinRedactionPatterns are the regexes behind the built-in detectors.
+// Where a regex has a capture group, only the group is redacted.
+var builtinRedactionPatterns = map[string]string{
+	"private_key":    `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	"jwt":            `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`,
+	"aws_access_key": `\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`,
+	"aws_secret_key": `(?i)aws_?secret_?access_?key[\s"'\\]*[:=][\s"'\\]*([A-Za-z0-9/+]{40})`,
+	"gcp_api_key":    `\bAIza[0-9A-Za-z_-]{35}`,
+	"github_token":   `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`,
+	"slack_token":    `\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+	"api_key":        `\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`,
+	"email":          `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	"high_entropy":   `[A-Za-z0-9+/_=-]{32,}`,
+}
+
+// Redactor masks secrets and personal data before they are stored. A nil
+// Redactor leaves everything as is.
+type Redactor struct {
+	detectors []redactionDetector
+}
+
+type redactionDetector struct {
+	name string
+	re   *regexp.Regexp
+	// accept filters matches further; nil accepts every match
+	accept func(match string) bool
+}
+
+// NewRedactor builds a redactor from storage.redaction, or returns nil if
+// redaction is disabled
+func NewRedactor(cfg config.RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	detectors := cfg.Detectors
+	if len(detectors) == 0 {
+		detectors = config.RedactionDetectors
+	}
+	minEntropy := cfg.MinEntropy
+	if minEntropy == 0 {
+		minEntropy = 4.5
+	}
+
+	r := &Redactor{}
+	// Built-in detectors run in a fixed order, so specific ones label a
+	// secret before high_entropy can
+	for _, name := range config.RedactionDetectors {
+		if !slices.Contains(detectors, name) {
+			continue
+		}
+		detector := redactionDetector{name: name, re: regexp.MustCompile(builtinRedactionPatterns[name])}
+		if name == "high_entropy" {
+			detector.accept = func(match string) bool { return looksRandom(match, minEntropy) }
+		}
+		r.detectors = append(r.detectors, detector)
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, err
+		}
+		r.detectors = append(r.detectors, redactionDetector{name: pattern.Name, re: re})
+	}
+	return r, nil
+}
+
+// Redact masks every detected secret in text with "[REDACTED:<detector>]"
+// and returns the new text with the number of matches per detector
+func (r *Redactor) Redact(text string) (string, map[string]int) {
+	if r == nil {
+		return text, nil
+	}
+	var counts map[string]int
+	for _, detector := range r.detectors {
+		var n int
+		text, n = detector.redact(text)
+		if n > 0 {
+			if counts == nil {
+				counts = make(map[string]int)
+			}
+			counts[detector.name] += n
+		}
+	}
+	return text, counts
+}
+
+// RedactJSON redacts every string value in a JSON document, leaving its
+// structure intact, except encoded data (see opaqueField). Documents that
+// are not valid JSON are redacted as text.
+func (r *Redactor) RedactJSON(data []byte) ([]byte, map[string]int) {
+	if r == nil || len(data) == 0 {
+		return data, nil
+	}
+	// Most documents have nothing to redact; only decode those that might
+	redacted, counts := r.Redact(string(data))
+	if len(counts) == 0 {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return []byte(redacted), counts
+	}
+
+	counts = make(map[string]int)
+	doc = r.redactValue(doc, counts)
+	if len(counts) == 0 {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return []byte(redacted), counts
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), counts
+}
+
+// redactValue redacts the strings in a decoded JSON value, adding to counts
+func (r *Redactor) redactValue(value interface{}, counts map[string]int) interface{} {
+	switch v := value.(type) {
+	case string:
+		redacted, found := r.Redact(v)
+		for name, n := range found {
+			counts[name] += n
+		}
+		return redacted
+	case map[string]interface{}:
+		for key, item := range v {
+			if opaqueField(v, key) {
+				continue
+			}
+			v[key] = r.redactValue(item, counts)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item, counts)
+		}
+	}
+	return value
+}
+
+// opaqueField reports whether obj[key] holds encoded data rather than text:
+// thinking block signatures, redacted thinking, and the base64 data of image
+// and document sources. It looks random by nature, so high_entropy would
+// mangle it, and a stored request replayed with it would be rejected.
+func opaqueField(obj map[string]interface{}, key string) bool {
+	switch key {
+	case "signature":
+		return true
+	case "data":
+		return obj["type"] == "base64" || obj["type"] == "redacted_thinking"
+	}
+	return false
+}
+
+// redact replaces the detector's matches (or their first capture group)
+func (d *redactionDetector) redact(text string) (string, int) {
+	matches := d.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	var out strings.Builder
+	last, count := 0, 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if d.accept != nil && !d.accept(text[start:end]) {
+			continue
+		}
+		out.WriteString(text[last:start])
+		out.WriteString("[REDACTED:" + d.name + "]")
+		last = end
+		count++
+	}
+	if count == 0 {
+		return text, 0
+	}
+	out.WriteString(text[last:])
+	return out.String(), count
+}
+
+// looksRandom reports whether a token mixes letters and digits and has at
+// least minEntropy bits of Shannon entropy per character
+func looksRandom(token string, minEntropy float64) bool {
+	if !strings.ContainsAny(token, "0123456789") || strings.IndexFunc(token, isLetter) < 0 {
+		return false
+	}
+	freq := make(map[rune]int)
+	for _, c := range token {
+		freq[c]++
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, count := range freq {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minEntropy
+}
+
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// recordRedactions counts what a redaction masked, by where it was stored
+func recordRedactions(source string, counts map[string]int) {
+	for name, n := range counts {
+		metrics.RecordRedactions(name, source, n)
+	}
+}
+
+// mergeRedactions adds counts to a request's running totals
+func mergeRedactions(totals map[string]int, counts map[string]int) map[string]int {
+	if len(counts) == 0 {
+		return totals
+	}
+	if totals == nil {
+		totals = make(map[string]int, len(counts))
+	}
+	for name, n := range counts {
+		totals[name] += n
+	}
+	return totals
+}
@@ -0,0 +1,624 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// retentionBatch is how many requests one retention transaction handles,
+// so the proxy keeps writing in between
+const retentionBatch = 200
+
+// archivedJSONColumns are requests columns holding JSON, written to the
+// archive as JSON rather than as strings
+var archivedJSONColumns = []string{"headers", "body", "response", "prompt_grade", "tools_used", "hedge", "queue", "rate_limit", "plugins", "redactions"}
+
+// RetentionJob applies storage.retention: it strips bodies and responses
+// from old requests, deletes requests past row_days or over the size cap
+// (archiving them first when archive_dir is set), and vacuums the freed
+// space back to the filesystem.
+type RetentionJob struct {
+	storage *SQLiteStorageService
+	config  config.RetentionConfig
+	done    chan struct{}
+}
+
+// NewRetentionJob returns nil when retention is disabled; a nil job does
+// nothing. Otherwise it first switches the database to incremental
+// auto-vacuum, which takes one full VACUUM of an existing database, so call
+// it at startup before serving traffic.
+func NewRetentionJob(storage *SQLiteStorageService) *RetentionJob {
+	if !storage.config.Retention.Enabled {
+		return nil
+	}
+	if err := storage.enableIncrementalVacuum(); err != nil {
+		log.Printf("⚠️  Retention: freed space stays in the database file: %v", err)
+	}
+	return &RetentionJob{
+		storage: storage,
+		config:  storage.config.Retention,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the job now and then every interval
+func (j *RetentionJob) Start() {
+	if j == nil {
+		return
+	}
+	log.Printf("🗑️  Retention: bodies %s, requests %s, size cap %s, every %v",
+		retentionDays(j.config.BodyDays), retentionDays(j.config.RowDays), retentionSizeCap(j.config.MaxDBSizeMB), j.config.IntervalDuration)
+
+	go func() {
+		ticker := time.NewTicker(j.config.IntervalDuration)
+		defer ticker.Stop()
+		for {
+			j.Run(time.Now())
+			select {
+			case <-ticker.C:
+			case <-j.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background runs; a run in progress finishes its batch
+func (j *RetentionJob) Stop() {
+	if j == nil {
+		return
+	}
+	close(j.done)
+}
+
+func retentionDays(days int) string {
+	if days == 0 {
+		return "kept forever"
+	}
+	return fmt.Sprintf("kept %d days", days)
+}
+
+func retentionSizeCap(mb int) string {
+	if mb == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d MB", mb)
+}
+
+// Run applies retention once and records the run
+func (j *RetentionJob) Run(now time.Time) *model.RetentionRun {
+	run := &model.RetentionRun{StartedAt: now.UTC().Format(time.RFC3339)}
+	run.SizeBefore, _, _ = j.storage.databaseSize()
+
+	if err := j.apply(now, run); err != nil {
+		run.Error = err.Error()
+		log.Printf("❌ Retention run failed: %v", err)
+	}
+	run.SizeAfter, _, _ = j.storage.databaseSize()
+	run.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := j.storage.saveRetentionRun(run); err != nil {
+		log.Printf("⚠️  Error saving retention run: %v", err)
+	}
+	if run.StrippedRequests+run.ExpiredRequests+run.EvictedRequests > 0 {
+		log.Printf("🗑️  Retention: stripped %d, expired %d, evicted %d requests (%d archived); database %d → %d bytes",
+			run.StrippedRequests, run.ExpiredRequests, run.EvictedRequests, run.ArchivedRequests, run.SizeBefore, run.SizeAfter)
+	}
+	return run
+}
+
+func (j *RetentionJob) apply(now time.Time, run *model.RetentionRun) error {
+	archive, err := j.openArchive(now)
+	if err != nil {
+		return err
+	}
+	defer archive.close()
+
+	if j.config.BodyDays > 0 {
+		cutoff := now.AddDate(0, 0, -j.config.BodyDays).UTC().Format(time.RFC3339)
+		for {
+			n, err := j.processBatch(archive, "body_stripped = 0 AND datetime(timestamp) < datetime(?)", []interface{}{cutoff}, retentionBatch, j.strip)
+			run.StrippedRequests += n
+			if err != nil {
+				return err
+			}
+			if n < retentionBatch {
+				break
+			}
+		}
+	}
+
+	if j.config.RowDays > 0 {
+		cutoff := now.AddDate(0, 0, -j.config.RowDays).UTC().Format(time.RFC3339)
+		for {
+			n, err := j.processBatch(archive, "datetime(timestamp) < datetime(?)", []interface{}{cutoff}, retentionBatch, j.delete)
+			run.ExpiredRequests += n
+			if err != nil {
+				return err
+			}
+			if n < retentionBatch {
+				break
+			}
+		}
+	}
+
+	if j.config.MaxDBSizeMB > 0 {
+		// Only requests and their bodies count towards the cap: evicting
+		// requests can't shrink the conversation index or other tables
+		limit := int64(j.config.MaxDBSizeMB) * 1024 * 1024
+		used, err := j.storage.requestDataSize()
+		if err != nil {
+			return err
+		}
+		for used > limit {
+			count, err := j.storage.oldestRequestsOver(used - limit)
+			if err != nil {
+				return err
+			}
+			n, err := j.processBatch(archive, "1 = 1", nil, count, j.delete)
+			run.EvictedRequests += n
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			remaining, err := j.storage.requestDataSize()
+			if err != nil {
+				return err
+			}
+			if remaining >= used {
+				log.Printf("⚠️  Retention: evicting requests freed no space; stopping at %d bytes over the size cap", remaining-limit)
+				break
+			}
+			used = remaining
+		}
+	}
+
+	run.ArchivedRequests = archive.count
+	if archive.count > 0 {
+		run.ArchiveFile = archive.path
+	}
+	if err := archive.close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return j.vacuum()
+}
+
+// processBatch archives and then strips or deletes up to limit of the
+// oldest requests matching where, returning how many it handled
+func (j *RetentionJob) processBatch(archive *requestArchive, where string, args []interface{}, limit int, apply func(tx *sql.Tx, row map[string]interface{}) error) (int, error) {
+	db := j.storage.db
+	rows, err := db.Query("SELECT * FROM requests WHERE "+where+" ORDER BY datetime(timestamp) LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query requests: %w", err)
+	}
+	batch, err := scanRowMaps(rows)
+	if err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	// Stripped requests were archived in full when their bodies went
+	bodies := newBodyAssembler(db)
+	for _, row := range batch {
+		if asInt(row["body_stripped"]) == 0 {
+			if err := archive.write(row, bodies); err != nil {
+				return 0, fmt.Errorf("failed to archive request: %w", err)
+			}
+		}
+	}
+	if err := archive.flush(); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, row := range batch {
+		if err := apply(tx, row); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit retention batch: %w", err)
+	}
+	return len(batch), nil
+}
+
+// strip keeps a request's summary columns and drops its body and response
+// content. The body keeps its scalar fields (model, max_tokens, ...) with no
+// messages; the response keeps its status and timings.
+func (j *RetentionJob) strip(tx *sql.Tx, row map[string]interface{}) error {
+	if refs := asString(row["body_refs"]); refs != "" {
+		if err := releaseBodyBlobs(tx, refs); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		UPDATE requests
+		SET body = ?, body_refs = NULL, body_stripped = 1,
+			response = json_remove(response, '$.body', '$.bodyText', '$.streamingChunks')
+		WHERE id = ?
+	`, strippedBody(asString(row["body"])), row["id"])
+	if err != nil {
+		return fmt.Errorf("failed to strip request: %w", err)
+	}
+	return nil
+}
+
+func (j *RetentionJob) delete(tx *sql.Tx, row map[string]interface{}) error {
+	if refs := asString(row["body_refs"]); refs != "" {
+		if err := releaseBodyBlobs(tx, refs); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM requests WHERE id = ?", row["id"]); err != nil {
+		return fmt.Errorf("failed to delete request: %w", err)
+	}
+	// Tool calls made by the request, and results it carried for calls that
+	// were never seen being made, go with it
+	if _, err := tx.Exec("DELETE FROM tool_calls WHERE request_id = ? OR (COALESCE(request_id, '') = '' AND result_request_id = ?)", row["id"], row["id"]); err != nil {
+		return fmt.Errorf("failed to delete tool calls: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM tool_policy_hits WHERE request_id = ?", row["id"]); err != nil {
+		return fmt.Errorf("failed to delete tool policy hits: %w", err)
+	}
+	return nil
+}
+
+// strippedBody drops the system prompt, tools, and messages from a body
+func strippedBody(body string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return "{}"
+	}
+	for _, name := range dedupFields {
+		delete(fields, name)
+	}
+	fields["messages"] = json.RawMessage("[]")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// vacuum returns free pages to the filesystem and refreshes the query
+// planner's statistics
+func (j *RetentionJob) vacuum() error {
+	ctx := context.Background()
+	conn, err := j.storage.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return fmt.Errorf("failed to run incremental vacuum: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA analysis_limit = 1000"); err != nil {
+		return fmt.Errorf("failed to set analysis_limit: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("failed to analyze: %w", err)
+	}
+	return nil
+}
+
+// requestArchive appends requests to a gzipped JSONL file per day. Each run
+// adds a gzip member, which gzip readers read as one stream.
+type requestArchive struct {
+	path  string
+	file  *os.File
+	gz    *gzip.Writer
+	count int
+}
+
+// openArchive returns an archive that discards everything when no
+// archive_dir is set; the file is only created once something is written
+func (j *RetentionJob) openArchive(now time.Time) (*requestArchive, error) {
+	if j.config.ArchiveDir == "" {
+		return &requestArchive{}, nil
+	}
+	if err := os.MkdirAll(j.config.ArchiveDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	name := fmt.Sprintf("requests-%s.jsonl.gz", now.UTC().Format("2006-01-02"))
+	return &requestArchive{path: filepath.Join(j.config.ArchiveDir, name)}, nil
+}
+
+func (a *requestArchive) write(row map[string]interface{}, bodies *bodyAssembler) error {
+	if a.path == "" {
+		return nil
+	}
+	record, err := archiveRecord(row, bodies)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if a.file == nil {
+		a.file, err = os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		a.gz = gzip.NewWriter(a.file)
+	}
+	if _, err := a.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// flush makes sure archived requests are on disk before they are removed
+// from the database
+func (a *requestArchive) flush() error {
+	if a.gz == nil {
+		return nil
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *requestArchive) close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file, a.gz = nil, nil
+	return err
+}
+
+// archiveRecord turns a requests row into an archive line, with the body
+// put back together and JSON columns kept as JSON
+func archiveRecord(row map[string]interface{}, bodies *bodyAssembler) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		record[column] = value
+	}
+	delete(record, "body_refs")
+
+	body, err := bodies.assemble(asString(row["body"]), sql.NullString{String: asString(row["body_refs"]), Valid: row["body_refs"] != nil})
+	if err != nil {
+		return nil, err
+	}
+	record["body"] = string(body)
+
+	for _, column := range archivedJSONColumns {
+		if text := asString(record[column]); text != "" && json.Valid([]byte(text)) {
+			record[column] = json.RawMessage(text)
+		}
+	}
+	return record, nil
+}
+
+// scanRowMaps reads every row into a map of column name to value
+func scanRowMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan request: %w", err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if data, ok := values[i].([]byte); ok {
+				values[i] = string(data)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func asString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func asInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// databaseSize returns the database file size and how much of it holds data
+// rather than free pages
+func (s *SQLiteStorageService) databaseSize() (size, used int64, err error) {
+	var pageCount, freePages, pageSize int64
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, 0, fmt.Errorf("failed to read page_count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return 0, 0, fmt.Errorf("failed to read freelist_count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, 0, fmt.Errorf("failed to read page_size: %w", err)
+	}
+	return pageCount * pageSize, (pageCount - freePages) * pageSize, nil
+}
+
+// enableIncrementalVacuum switches the database to incremental auto-vacuum,
+// so retention runs can return freed pages with PRAGMA incremental_vacuum.
+// Changing the mode of a database that has tables takes a full VACUUM.
+func (s *SQLiteStorageService) enableIncrementalVacuum() error {
+	var mode int
+	if err := s.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return fmt.Errorf("failed to read auto_vacuum: %w", err)
+	}
+	if mode == 2 {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	log.Println("🧹 Switching the database to incremental vacuum (one-time full VACUUM)")
+	if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return fmt.Errorf("failed to set auto_vacuum: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum: %w", err)
+	}
+	return nil
+}
+
+// requestDataSize returns about how many bytes requests and their body blobs
+// take up, the part of the database the size cap evicts requests to bound
+func (s *SQLiteStorageService) requestDataSize() (int64, error) {
+	var size int64
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COALESCE(SUM(length(CAST(body AS BLOB)) + COALESCE(length(CAST(response AS BLOB)), 0) + length(CAST(headers AS BLOB))), 0) FROM requests) +
+			(SELECT COALESCE(SUM(length(data)), 0) FROM body_blobs)
+	`).Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure request data: %w", err)
+	}
+	return size, nil
+}
+
+// oldestRequestsOver returns how many of the oldest requests it takes to
+// free about bytes, up to retentionBatch. Shared body blobs are not
+// counted, so this can fall short; the caller checks the size again.
+func (s *SQLiteStorageService) oldestRequestsOver(bytes int64) (int, error) {
+	rows, err := s.db.Query(`
+		SELECT length(CAST(body AS BLOB)) + COALESCE(length(CAST(response AS BLOB)), 0) + length(CAST(headers AS BLOB))
+		FROM requests
+		ORDER BY datetime(timestamp)
+		LIMIT ?
+	`, retentionBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query request sizes: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	var freed int64
+	for rows.Next() && freed < bytes {
+		var size int64
+		if err := rows.Scan(&size); err != nil {
+			return 0, fmt.Errorf("failed to scan request size: %w", err)
+		}
+		freed += size
+		count++
+	}
+	return max(count, 1), rows.Err()
+}
+
+func (s *SQLiteStorageService) saveRetentionRun(run *model.RetentionRun) error {
+	result, err := s.db.Exec(`
+		INSERT INTO retention_runs (started_at, finished_at, stripped_requests, expired_requests, evicted_requests, archived_requests, archive_file, size_before, size_after, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.StartedAt, run.FinishedAt, run.StrippedRequests, run.ExpiredRequests, run.EvictedRequests, run.ArchivedRequests,
+		sql.NullString{String: run.ArchiveFile, Valid: run.ArchiveFile != ""}, run.SizeBefore, run.SizeAfter,
+		sql.NullString{String: run.Error, Valid: run.Error != ""})
+	if err != nil {
+		return fmt.Errorf("failed to insert retention run: %w", err)
+	}
+	run.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetRetentionStatus reports the retention settings, how much is stored,
+// and the last retention run
+func (s *SQLiteStorageService) GetRetentionStatus() (*model.RetentionStatus, error) {
+	retention := s.config.Retention
+	status := &model.RetentionStatus{
+		Enabled:     retention.Enabled,
+		BodyDays:    retention.BodyDays,
+		RowDays:     retention.RowDays,
+		MaxDBSizeMB: retention.MaxDBSizeMB,
+		ArchiveDir:  retention.ArchiveDir,
+		Interval:    retention.IntervalDuration.String(),
+	}
+
+	size, used, err := s.databaseSize()
+	if err != nil {
+		return nil, err
+	}
+	status.SizeBytes = size
+	status.FreeBytes = size - used
+
+	var oldest sql.NullString
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(body_stripped), 0), MIN(timestamp)
+		FROM requests
+	`).Scan(&status.Requests, &status.StrippedRequests, &oldest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count requests: %w", err)
+	}
+	status.OldestRequest = oldest.String
+
+	var run model.RetentionRun
+	var archiveFile, runError sql.NullString
+	err = s.db.QueryRow(`
+		SELECT id, started_at, finished_at, stripped_requests, expired_requests, evicted_requests, archived_requests, archive_file, size_before, size_after, error
+		FROM retention_runs
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&run.ID, &run.StartedAt, &run.FinishedAt, &run.StrippedRequests, &run.ExpiredRequests, &run.EvictedRequests,
+		&run.ArchivedRequests, &archiveFile, &run.SizeBefore, &run.SizeAfter, &runError)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get last retention run: %w", err)
+	}
+	if err == nil {
+		run.ArchiveFile = archiveFile.String
+		run.Error = runError.String
+		status.LastRun = &run
+	}
+
+	return status, nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestRetentionJob_StripExpireArchive(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+
+	archiveDir := t.TempDir()
+	cfg := storage.GetConfig()
+	cfg.Bodies = config.BodyStoreConfig{Dedup: true, Compression: "gzip"}
+	cfg.Retention = config.RetentionConfig{Enabled: true, BodyDays: 7, RowDays: 30, ArchiveDir: archiveDir, IntervalDuration: time.Hour}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, age := range []int{40, 10, 1} {
+		request := &model.RequestLog{
+			RequestID: []string{"req-old", "req-mid", "req-new"}[i],
+			Timestamp: now.AddDate(0, 0, -age).Format(time.RFC3339),
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{},
+			Body:      sessionTurn(i),
+			Model:     "claude-sonnet-4",
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() error = %v", err)
+		}
+		request.Response = &model.ResponseLog{
+			StatusCode:   200,
+			Body:         json.RawMessage(`{"content":[{"type":"text","text":"done"}],"usage":{"input_tokens":100,"output_tokens":5}}`),
+			ResponseTime: 1500,
+		}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() error = %v", err)
+		}
+	}
+
+	// Tool call audit rows for the oldest and newest requests
+	for _, requestID := range []string{"req-old", "req-new"} {
+		sqliteStorage.db.Exec(`INSERT INTO tool_calls (tool_use_id, request_id, timestamp, tool_name, source) VALUES (?, ?, ?, 'Bash', 'proxy')`, "use-"+requestID, requestID, now.Format(time.RFC3339))
+		sqliteStorage.db.Exec(`INSERT INTO tool_calls (tool_use_id, result_request_id, timestamp, tool_name, has_result, source) VALUES (?, ?, ?, 'Read', 1, 'proxy')`, "result-"+requestID, requestID, now.Format(time.RFC3339))
+		sqliteStorage.db.Exec(`INSERT INTO tool_policy_hits (request_id, timestamp, policy, action, tool_name) VALUES (?, ?, 'no-rm', 'block', 'Bash')`, requestID, now.Format(time.RFC3339))
+	}
+
+	job := NewRetentionJob(sqliteStorage)
+	run := job.Run(now)
+	if run.Error != "" {
+		t.Fatalf("Retention run failed: %s", run.Error)
+	}
+	// The old request is stripped (and archived) on its way to being deleted
+	if run.StrippedRequests != 2 || run.ExpiredRequests != 1 || run.ArchivedRequests != 2 || run.EvictedRequests != 0 {
+		t.Errorf("Unexpected run %+v", run)
+	}
+
+	if _, _, err := storage.GetRequestByShortID("req-old"); err == nil {
+		t.Error("Expected the request past row_days to be deleted")
+	}
+
+	var toolCalls, policyHits int
+	sqliteStorage.db.QueryRow("SELECT COUNT(*) FROM tool_calls WHERE request_id = 'req-old' OR result_request_id = 'req-old'").Scan(&toolCalls)
+	sqliteStorage.db.QueryRow("SELECT COUNT(*) FROM tool_policy_hits WHERE request_id = 'req-old'").Scan(&policyHits)
+	if toolCalls != 0 || policyHits != 0 {
+		t.Errorf("Expected the deleted request's tool calls and policy hits to go, got %d and %d", toolCalls, policyHits)
+	}
+	sqliteStorage.db.QueryRow("SELECT COUNT(*) FROM tool_calls WHERE request_id = 'req-new' OR result_request_id = 'req-new'").Scan(&toolCalls)
+	sqliteStorage.db.QueryRow("SELECT COUNT(*) FROM tool_policy_hits WHERE request_id = 'req-new'").Scan(&policyHits)
+	if toolCalls != 2 || policyHits != 1 {
+		t.Errorf("Expected the kept request's tool calls and policy hits to stay, got %d and %d", toolCalls, policyHits)
+	}
+
+	mid, _, err := storage.GetRequestByShortID("req-mid")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() error = %v", err)
+	}
+	body := mid.Body.(map[string]interface{})
+	if body["model"] != "claude-sonnet-4" || len(body["messages"].([]interface{})) != 0 || body["system"] != nil {
+		t.Errorf("Expected only the body's scalar fields kept, got %v", body)
+	}
+	if mid.Response == nil || mid.Response.StatusCode != 200 || mid.Response.ResponseTime != 1500 || mid.Response.Body != nil {
+		t.Errorf("Expected only the response status and timings kept, got %+v", mid.Response)
+	}
+
+	recent, _, err := storage.GetRequestByShortID("req-new")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() error = %v", err)
+	}
+	if len(recent.Body.(map[string]interface{})["messages"].([]interface{})) != 6 {
+		t.Error("Expected the recent request to keep its full body")
+	}
+
+	// Only the blobs the recent request uses are left
+	var blobs, unreferenced int
+	sqliteStorage.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(ref_count <= 0), 0) FROM body_blobs").Scan(&blobs, &unreferenced)
+	if blobs != 9 || unreferenced != 0 {
+		t.Errorf("Expected 9 referenced blobs, got %d (%d unreferenced)", blobs, unreferenced)
+	}
+
+	// The archive has both removed requests in full
+	file, err := os.Open(run.ArchiveFile)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	var archived []map[string]interface{}
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid archive line: %v", err)
+		}
+		archived = append(archived, record)
+	}
+	if len(archived) != 2 || archived[0]["id"] != "req-old" || archived[1]["id"] != "req-mid" {
+		t.Fatalf("Unexpected archive %v", archived)
+	}
+	archivedBody := archived[1]["body"].(map[string]interface{})
+	if len(archivedBody["messages"].([]interface{})) != 4 {
+		t.Errorf("Expected the archived body in full, got %v", archivedBody)
+	}
+	if response := archived[1]["response"].(map[string]interface{}); response["body"] == nil {
+		t.Errorf("Expected the archived response in full, got %v", response)
+	}
+	if !strings.HasSuffix(run.ArchiveFile, "requests-2024-03-01.jsonl.gz") {
+		t.Errorf("Unexpected archive file %s", run.ArchiveFile)
+	}
+
+	// Nothing is left to do
+	if again := job.Run(now); again.StrippedRequests+again.ExpiredRequests+again.ArchivedRequests != 0 {
+		t.Errorf("Expected a second run to change nothing, got %+v", again)
+	}
+
+	var autoVacuum int
+	sqliteStorage.db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum)
+	if autoVacuum != 2 {
+		t.Errorf("Expected incremental auto_vacuum, got %d", autoVacuum)
+	}
+
+	status, err := storage.GetRetentionStatus()
+	if err != nil {
+		t.Fatalf("GetRetentionStatus() error = %v", err)
+	}
+	if !status.Enabled || status.Requests != 2 || status.StrippedRequests != 1 || status.Interval != "1h0m0s" || status.SizeBytes == 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.LastRun == nil || status.LastRun.ID != 2 || status.LastRun.StrippedRequests != 0 {
+		t.Errorf("Expected the second run as the last run, got %+v", status.LastRun)
+	}
+}
+
+func TestRetentionJob_SizeCap(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+	storage.GetConfig().Retention = config.RetentionConfig{Enabled: true, MaxDBSizeMB: 1, IntervalDuration: time.Hour}
+
+	// About 400 KB each, so the cap fits two of them at most
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		var content strings.Builder
+		for content.Len() < 400*1024 {
+			content.WriteString(time.Duration(content.Len() * (i + 1)).String())
+		}
+		_, err := storage.SaveRequest(&model.RequestLog{
+			RequestID: "req-" + string(rune('a'+i)),
+			Timestamp: now.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{},
+			Body:      model.AnthropicRequest{Model: "m", Messages: []model.AnthropicMessage{{Role: "user", Content: content.String()}}},
+		})
+		if err != nil {
+			t.Fatalf("SaveRequest() error = %v", err)
+		}
+	}
+
+	run := NewRetentionJob(sqliteStorage).Run(now)
+	if run.Error != "" {
+		t.Fatalf("Retention run failed: %s", run.Error)
+	}
+	if run.EvictedRequests < 3 || run.EvictedRequests == 5 {
+		t.Errorf("Expected the oldest requests evicted down to the cap, got %+v", run)
+	}
+	if _, _, err := storage.GetRequestByShortID("req-e"); err != nil {
+		t.Error("Expected the newest request to be kept")
+	}
+	if _, _, err := storage.GetRequestByShortID("req-a"); err == nil {
+		t.Error("Expected the oldest request to be evicted")
+	}
+	// The cap bounds the requests, not the rest of the file
+	if used, _ := sqliteStorage.requestDataSize(); used > 1024*1024 {
+		t.Errorf("Expected the requests to fit the cap, got %d bytes", used)
+	}
+	if run.SizeAfter >= run.SizeBefore {
+		t.Errorf("Expected vacuum to shrink the file, got %d → %d", run.SizeBefore, run.SizeAfter)
+	}
+}
+
+func TestRetentionJob_SizeCapEvictsByTime(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+	storage.GetConfig().Retention = config.RetentionConfig{Enabled: true, MaxDBSizeMB: 1, IntervalDuration: time.Hour}
+
+	// The oldest request was logged with a UTC offset, so it sorts last as
+	// a string
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	timestamps := []string{
+		now.In(time.FixedZone("", 5*60*60)).Format(time.RFC3339),
+		now.Add(time.Minute).Format(time.RFC3339),
+		now.Add(2 * time.Minute).Format(time.RFC3339),
+	}
+	for i, timestamp := range timestamps {
+		var content strings.Builder
+		for content.Len() < 400*1024 {
+			content.WriteString(time.Duration(content.Len() * (i + 1)).String())
+		}
+		_, err := storage.SaveRequest(&model.RequestLog{
+			RequestID: "req-" + string(rune('a'+i)),
+			Timestamp: timestamp,
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{},
+			Body:      model.AnthropicRequest{Model: "m", Messages: []model.AnthropicMessage{{Role: "user", Content: content.String()}}},
+		})
+		if err != nil {
+			t.Fatalf("SaveRequest() error = %v", err)
+		}
+	}
+
+	run := NewRetentionJob(sqliteStorage).Run(now)
+	if run.Error != "" {
+		t.Fatalf("Retention run failed: %s", run.Error)
+	}
+	if run.EvictedRequests != 1 {
+		t.Errorf("Expected one request evicted, got %+v", run)
+	}
+	if _, _, err := storage.GetRequestByShortID("req-a"); err == nil {
+		t.Error("Expected the oldest request to be evicted")
+	}
+	if _, _, err := storage.GetRequestByShortID("req-b"); err != nil {
+		t.Error("Expected the second oldest request to be kept")
+	}
+}
+
+func TestRetentionJob_SizeCapCountsOnlyRequests(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+	storage.GetConfig().Retention = config.RetentionConfig{Enabled: true, MaxDBSizeMB: 1, IntervalDuration: time.Hour}
+
+	// Another table alone is over the cap; evicting requests can't help
+	if _, err := sqliteStorage.db.Exec("CREATE TABLE padding (data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqliteStorage.db.Exec("INSERT INTO padding VALUES (randomblob(2 * 1024 * 1024))"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	_, err := storage.SaveRequest(&model.RequestLog{
+		RequestID: "req-small",
+		Timestamp: now.Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Headers:   map[string][]string{},
+		Body:      model.AnthropicRequest{Model: "m", Messages: []model.AnthropicMessage{{Role: "user", Content: "hi"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveRequest() error = %v", err)
+	}
+
+	run := NewRetentionJob(sqliteStorage).Run(now)
+	if run.Error != "" {
+		t.Fatalf("Retention run failed: %s", run.Error)
+	}
+	if run.EvictedRequests != 0 {
+		t.Errorf("Expected no requests evicted, got %+v", run)
+	}
+	if _, _, err := storage.GetRequestByShortID("req-small"); err != nil {
+		t.Error("Expected the request to be kept")
+	}
+}
+
+func TestNewRetentionJob_Disabled(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	job := NewRetentionJob(storage.(*SQLiteStorageService))
+	if job != nil {
+		t.Fatal("Expected no job when retention is disabled")
+	}
+	// A nil job is safe to start and stop
+	job.Start()
+	job.Stop()
+}
@@ -0,0 +1,94 @@
+package service
+
+// RouteTrace records each step of a routing decision, for the routing
+// explain endpoint. Routing code takes a *RouteTrace (or one of its parts)
+// that is nil for real traffic; a non-nil trace means a dry run, which
+// records every evaluation but skips metrics and logs.
+type RouteTrace struct {
+	RequestedModel string              `json:"requested_model"`
+	Aliases        []Evaluation        `json:"aliases,omitempty"`
+	AliasedModel   string              `json:"aliased_model,omitempty"`
+	Subagents      *SubagentTrace      `json:"subagents"`
+	Rules          []Evaluation        `json:"rules,omitempty"`
+	Experiments    []Evaluation        `json:"experiments,omitempty"`
+	ProjectPath    string              `json:"project_path,omitempty"`
+	Project        *Evaluation         `json:"project,omitempty"` // routing.projects entry that applied
+	Preference     *PreferenceTrace    `json:"preference,omitempty"`
+	ContextWindow  *ContextWindowTrace `json:"context_window,omitempty"`
+	ProviderHealth *ProviderHealth     `json:"provider_health,omitempty"`
+	Decision       *RouteDecisionTrace `json:"decision,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// Evaluation is whether one alias, rule, experiment, or overflow target
+// matched and, if not, the first condition that failed
+type Evaluation struct {
+	ID      string `json:"id"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason,omitempty"`
+	Result  string `json:"result,omitempty"` // What a match does: target, action, or arm
+}
+
+// SubagentTrace explains subagent detection from the system prompt
+type SubagentTrace struct {
+	Enabled          bool             `json:"enabled"`
+	ClaudeCodePrompt bool             `json:"claude_code_prompt"` // Two system blocks, the first Claude Code's
+	StaticPromptHash string           `json:"static_prompt_hash,omitempty"`
+	Threshold        float64          `json:"similarity_threshold,omitempty"`
+	Candidates       []AgentCandidate `json:"candidates,omitempty"`
+	MissingAgents    []string         `json:"missing_agents,omitempty"` // Mapped subagents with no agent file loaded
+	Matched          string           `json:"matched,omitempty"`
+}
+
+// AgentCandidate is one loaded agent definition compared with the prompt
+type AgentCandidate struct {
+	Name       string  `json:"name"`
+	Target     string  `json:"target"`
+	PromptHash string  `json:"prompt_hash"`
+	Similarity float64 `json:"similarity"`
+	Matched    bool    `json:"matched"`
+	Reason     string  `json:"reason"`
+}
+
+// PreferenceTrace explains a preference-based provider choice
+type PreferenceTrace struct {
+	Preference string             `json:"preference"`
+	Candidates []string           `json:"candidates"`
+	Excluded   []ExcludedProvider `json:"excluded,omitempty"`
+	Ranking    []ProviderScore    `json:"ranking"`
+	Top        []string           `json:"top"` // Load balanced between
+	Selected   string             `json:"selected"`
+}
+
+// ExcludedProvider is a candidate filtered out before ranking
+type ExcludedProvider struct {
+	Provider string `json:"provider"`
+	Reason   string `json:"reason"`
+}
+
+// ProviderScore is a candidate's score for the preference
+type ProviderScore struct {
+	Provider string `json:"provider"`
+	Score    int    `json:"score"`
+}
+
+// ContextWindowTrace explains the context window check
+type ContextWindowTrace struct {
+	Match           string       `json:"match"`
+	MaxTokens       int          `json:"max_tokens"`
+	EstimatedTokens int          `json:"estimated_tokens"`
+	Fits            bool         `json:"fits"`
+	Overflow        []Evaluation `json:"overflow,omitempty"`
+}
+
+// RouteDecisionTrace is the final RoutingDecision
+type RouteDecisionTrace struct {
+	Provider      string `json:"provider"`
+	OriginalModel string `json:"original_model"`
+	TargetModel   string `json:"target_model"`
+	SubagentName  string `json:"subagent_name,omitempty"`
+	RuleID        string `json:"rule_id,omitempty"`
+	ExperimentID  string `json:"experiment_id,omitempty"`
+	ExperimentArm string `json:"experiment_arm,omitempty"`
+	Priority      string `json:"priority"`
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func newExplainRouter() *ModelRouter {
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"openai":    {Format: "openai", BaseURL: "https://api.openai.com"},
+			"local":     {Format: "openai", BaseURL: "http://localhost:11434"},
+		},
+		ModelAliases: []config.ModelAliasConfig{
+			{Match: "fast", Target: "claude-3-5-haiku", Model: "claude-3-5-haiku"},
+		},
+		Routing: config.RoutingConfig{
+			ProviderProfiles: map[string]config.ProviderProfileConfig{
+				"openai": {Speed: 5, Cost: 3, Quality: 8},
+				"local":  {Speed: 4, Cost: 10, Quality: 4},
+			},
+			Rules: []config.RoutingRuleConfig{
+				{ID: "no-opus", Match: config.RuleMatchConfig{Models: []string{"*opus*"}}, Action: "reject", Message: "opus is disabled"},
+				{ID: "cheap-haiku", Match: config.RuleMatchConfig{Models: []string{"*haiku*"}}, Action: "route", Preference: "cost", Providers: []string{"openai", "local"}},
+			},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+		"local":     &mockProvider{name: "local"},
+	}
+	return NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+}
+
+func TestExplain_TracesAliasRuleAndPreference(t *testing.T) {
+	router := newExplainRouter()
+	statsBefore := router.LoadBalancer().GetStats()
+
+	trace := router.Explain(&model.AnthropicRequest{Model: "fast"}, nil, "")
+
+	if trace.Error != "" {
+		t.Fatalf("Unexpected error: %s", trace.Error)
+	}
+	if len(trace.Aliases) != 1 || !trace.Aliases[0].Matched || trace.AliasedModel != "claude-3-5-haiku" {
+		t.Errorf("Alias trace = %+v (aliased model %q)", trace.Aliases, trace.AliasedModel)
+	}
+	if len(trace.Rules) != 2 || trace.Rules[0].Matched || trace.Rules[0].Reason == "" || !trace.Rules[1].Matched {
+		t.Errorf("Rule trace = %+v, want no-opus missed with a reason and cheap-haiku matched", trace.Rules)
+	}
+
+	pref := trace.Preference
+	if pref == nil {
+		t.Fatal("Expected a preference trace")
+	}
+	if len(pref.Ranking) != 2 || pref.Ranking[0].Provider != "local" || pref.Ranking[0].Score <= pref.Ranking[1].Score {
+		t.Errorf("Ranking = %+v, want local first for cost", pref.Ranking)
+	}
+	if pref.Selected == "" || pref.Selected != trace.Decision.Provider {
+		t.Errorf("Selected %q but decided %+v", pref.Selected, trace.Decision)
+	}
+
+	if trace.Decision.OriginalModel != "fast" || trace.Decision.TargetModel != "claude-3-5-haiku" || trace.Decision.RuleID != "cheap-haiku" {
+		t.Errorf("Decision = %+v", trace.Decision)
+	}
+	if trace.ProviderHealth == nil || trace.ProviderHealth.Name != trace.Decision.Provider {
+		t.Errorf("Provider health = %+v, want the chosen provider's", trace.ProviderHealth)
+	}
+
+	// A dry run must not count as traffic
+	if statsAfter := router.LoadBalancer().GetStats(); !reflect.DeepEqual(statsBefore, statsAfter) {
+		t.Errorf("Load balancer stats changed from %v to %v", statsBefore, statsAfter)
+	}
+}
+
+func TestExplain_RecordsRejection(t *testing.T) {
+	router := newExplainRouter()
+
+	trace := router.Explain(&model.AnthropicRequest{Model: "claude-opus-4"}, nil, "")
+
+	if trace.Error != "opus is disabled" || trace.Decision != nil {
+		t.Errorf("Got error %q and decision %+v, want the no-opus rejection", trace.Error, trace.Decision)
+	}
+	if len(trace.Rules) != 1 || !trace.Rules[0].Matched || trace.Rules[0].Result != "reject" {
+		t.Errorf("Rule trace = %+v", trace.Rules)
+	}
+}
+
+func TestExplain_SubagentCandidates(t *testing.T) {
+	router := newExplainRouter()
+	router.config.Subagents.Enable = true
+	router.agents = NewAgentRegistry(config.SubagentsConfig{AgentDirs: []string{t.TempDir()}}, nil, router.logger)
+	router.agents.register(SubagentDefinition{Name: "reviewer", TargetProvider: "openai", TargetModel: "gpt-4o", FullPrompt: "You review code."})
+
+	req := &model.AnthropicRequest{
+		Model: "claude-sonnet-4",
+		System: []model.AnthropicSystemMessage{
+			{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+			{Text: "You review code."},
+		},
+	}
+	trace := router.Explain(req, nil, "")
+
+	agents := trace.Subagents
+	if agents == nil || !agents.Enabled || !agents.ClaudeCodePrompt || agents.StaticPromptHash == "" {
+		t.Fatalf("Subagent trace = %+v", agents)
+	}
+	if len(agents.Candidates) != 1 || !agents.Candidates[0].Matched || agents.Matched != "reviewer" {
+		t.Errorf("Candidates = %+v, matched %q", agents.Candidates, agents.Matched)
+	}
+	if trace.Decision == nil || trace.Decision.SubagentName != "reviewer" || trace.Decision.Provider != "openai" {
+		t.Errorf("Decision = %+v, want the reviewer subagent on openai", trace.Decision)
+	}
+}
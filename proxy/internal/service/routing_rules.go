@@ -0,0 +1,231 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// RuleRejectError is returned by DetermineRoute when a reject rule matches
+type RuleRejectError struct {
+	RuleID  string
+	Message string
+}
+
+func (e *RuleRejectError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("request rejected by routing rule '%s'", e.RuleID)
+}
+
+// RuleInput is everything a routing rule can match on
+type RuleInput struct {
+	Request      *model.AnthropicRequest
+	Headers      http.Header
+	SubagentName string
+	ProjectPath  string
+}
+
+// RuleEngine evaluates the ordered routing.rules list
+type RuleEngine struct {
+	rules []config.RoutingRuleConfig
+	now   func() time.Time
+}
+
+// NewRuleEngine creates an engine for already-validated rules
+func NewRuleEngine(rules []config.RoutingRuleConfig) *RuleEngine {
+	return &RuleEngine{rules: rules, now: time.Now}
+}
+
+// Match returns the first rule whose conditions all hold, or nil
+func (e *RuleEngine) Match(in RuleInput) *config.RoutingRuleConfig {
+	return e.match(in, nil)
+}
+
+// match implements Match, recording each rule tried in trace
+func (e *RuleEngine) match(in RuleInput, trace *RouteTrace) *config.RoutingRuleConfig {
+	if e == nil || len(e.rules) == 0 {
+		return nil
+	}
+
+	tokens := lazyTokenEstimate(in.Request)
+	for i := range e.rules {
+		rule := &e.rules[i]
+		reason := e.mismatch(&rule.Match, in, tokens)
+		if trace != nil {
+			trace.Rules = append(trace.Rules, Evaluation{ID: rule.ID, Matched: reason == "", Reason: reason, Result: ruleResult(rule)})
+		}
+		if reason == "" {
+			return rule
+		}
+	}
+	return nil
+}
+
+// ruleResult describes what a rule does when it matches
+func ruleResult(rule *config.RoutingRuleConfig) string {
+	switch {
+	case rule.Action == "reject":
+		return "reject"
+	case rule.Target != "":
+		return rule.Target
+	default:
+		return "preference " + rule.Preference
+	}
+}
+
+// lazyTokenEstimate returns a function estimating the request's input
+// tokens. The estimate needs the serialized body, so it is only computed
+// once, and only if some condition asks.
+func lazyTokenEstimate(req *model.AnthropicRequest) func() int {
+	estimatedTokens := -1
+	return func() int {
+		if estimatedTokens < 0 {
+			body, _ := json.Marshal(req)
+			estimatedTokens = estimateInputTokens(body)
+		}
+		return estimatedTokens
+	}
+}
+
+func (e *RuleEngine) matches(m *config.RuleMatchConfig, in RuleInput, tokens func() int) bool {
+	return e.mismatch(m, in, tokens) == ""
+}
+
+// mismatch returns the first condition the request fails, or "" if it meets
+// them all
+func (e *RuleEngine) mismatch(m *config.RuleMatchConfig, in RuleInput, tokens func() int) string {
+	req := in.Request
+	if len(m.Models) > 0 && !matchAny(m.Models, req.Model) {
+		return "model does not match"
+	}
+	if len(m.Subagents) > 0 && (in.SubagentName == "" || !matchAny(m.Subagents, in.SubagentName)) {
+		return "subagent does not match"
+	}
+	if len(m.Tools) > 0 && !hasAllTools(req, m.Tools) {
+		return "request does not offer all tools"
+	}
+	if m.Stream != nil && *m.Stream != req.Stream {
+		return fmt.Sprintf("stream is not %t", *m.Stream)
+	}
+	if reason := headersMismatch(m.Headers, in.Headers); reason != "" {
+		return reason
+	}
+	if len(m.ProjectPaths) > 0 && !underAnyPath(m.ProjectPaths, in.ProjectPath) {
+		return "project path does not match"
+	}
+	if m.TimeOfDay != "" && !inTimeWindow(e.now(), m.StartMinute, m.EndMinute) {
+		return "outside time_of_day " + m.TimeOfDay
+	}
+	if m.MinInputTokens > 0 && tokens() < m.MinInputTokens {
+		return fmt.Sprintf("about %d input tokens, below min_input_tokens", tokens())
+	}
+	if m.MaxInputTokens > 0 && tokens() > m.MaxInputTokens {
+		return fmt.Sprintf("about %d input tokens, above max_input_tokens", tokens())
+	}
+	return ""
+}
+
+// headersMismatch returns the first header that is missing or doesn't match
+// its pattern, or "" if all match
+func headersMismatch(patterns map[string]string, headers http.Header) string {
+	for _, name := range sortedKeys(patterns) {
+		pattern := patterns[name]
+		value := headers.Get(name)
+		if value == "" {
+			return "header " + name + " is missing"
+		}
+		if !matchPattern(pattern, value) {
+			return "header " + name + " does not match"
+		}
+	}
+	return ""
+}
+
+// matchPattern reports whether value matches a glob pattern. Malformed
+// patterns only match themselves.
+func matchPattern(pattern, value string) bool {
+	matched, err := path.Match(pattern, value)
+	if err != nil {
+		return pattern == value
+	}
+	return matched
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAllTools(req *model.AnthropicRequest, tools []string) bool {
+	offered := make(map[string]bool, len(req.Tools))
+	for _, tool := range req.Tools {
+		offered[tool.Name] = true
+	}
+	for _, name := range tools {
+		if !offered[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// underAnyPath reports whether projectPath matches a glob or lies under one
+// of the directories
+func underAnyPath(paths []string, projectPath string) bool {
+	if projectPath == "" {
+		return false
+	}
+	for _, dir := range paths {
+		if matchPattern(dir, projectPath) {
+			return true
+		}
+		dir = strings.TrimSuffix(dir, "/")
+		if projectPath == dir || strings.HasPrefix(projectPath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// inTimeWindow reports whether now falls in [start, end) minutes after
+// midnight, where the window may wrap past midnight
+func inTimeWindow(now time.Time, start, end int) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// workingDirectoryPrefix introduces the project directory in Claude Code's
+// environment block
+const workingDirectoryPrefix = "Working directory: "
+
+// RequestProjectPath returns the project directory Claude Code reports in
+// its system prompt, or "" if there is none
+func RequestProjectPath(req *model.AnthropicRequest) string {
+	for _, block := range req.System {
+		idx := strings.Index(block.Text, workingDirectoryPrefix)
+		if idx < 0 {
+			continue
+		}
+		rest := block.Text[idx+len(workingDirectoryPrefix):]
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			rest = rest[:end]
+		}
+		return strings.TrimSpace(rest)
+	}
+	return ""
+}
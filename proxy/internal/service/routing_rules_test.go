@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestRuleEngine_Conditions(t *testing.T) {
+	stream := true
+	rules := []config.RoutingRuleConfig{
+		{ID: "haiku-stream", Match: config.RuleMatchConfig{Models: []string{"claude-*-haiku-*"}, Stream: &stream}},
+		{ID: "web", Match: config.RuleMatchConfig{Tools: []string{"WebSearch", "WebFetch"}}},
+		{ID: "big", Match: config.RuleMatchConfig{MinInputTokens: 1000}},
+		{ID: "ci", Match: config.RuleMatchConfig{Headers: map[string]string{"X-Client": "ci-*"}}},
+		{ID: "project", Match: config.RuleMatchConfig{ProjectPaths: []string{"/work/secret"}}},
+		{ID: "reviewer", Match: config.RuleMatchConfig{Subagents: []string{"code-reviewer"}}},
+	}
+	engine := NewRuleEngine(rules)
+
+	tests := []struct {
+		name     string
+		input    RuleInput
+		expected string
+	}{
+		{
+			name:     "model glob and stream flag",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "claude-3-5-haiku-20241022", Stream: true}},
+			expected: "haiku-stream",
+		},
+		{
+			name:     "stream flag must match",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "claude-3-5-haiku-20241022"}},
+			expected: "",
+		},
+		{
+			name: "all tools must be offered",
+			input: RuleInput{Request: &model.AnthropicRequest{Model: "m", Tools: []model.Tool{
+				{Name: "WebSearch"}, {Name: "WebFetch"}, {Name: "Read"},
+			}}},
+			expected: "web",
+		},
+		{
+			name:     "one tool is not enough",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "m", Tools: []model.Tool{{Name: "WebSearch"}}}},
+			expected: "",
+		},
+		{
+			name: "estimated input tokens",
+			input: RuleInput{Request: &model.AnthropicRequest{Model: "m", Messages: []model.AnthropicMessage{
+				{Role: "user", Content: strings.Repeat("x", 5000)},
+			}}},
+			expected: "big",
+		},
+		{
+			name:     "header pattern",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "m"}, Headers: http.Header{"X-Client": []string{"ci-nightly"}}},
+			expected: "ci",
+		},
+		{
+			name:     "project subdirectory",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "m"}, ProjectPath: "/work/secret/api"},
+			expected: "project",
+		},
+		{
+			name:     "project prefix is not a parent directory",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "m"}, ProjectPath: "/work/secrets"},
+			expected: "",
+		},
+		{
+			name:     "subagent name",
+			input:    RuleInput{Request: &model.AnthropicRequest{Model: "m"}, SubagentName: "code-reviewer"},
+			expected: "reviewer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if rule := engine.Match(tt.input); rule != nil {
+				got = rule.ID
+			}
+			if got != tt.expected {
+				t.Errorf("Matched rule %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuleEngine_TimeOfDay(t *testing.T) {
+	// 22:00-06:00 wraps past midnight
+	engine := NewRuleEngine([]config.RoutingRuleConfig{
+		{ID: "night", Match: config.RuleMatchConfig{TimeOfDay: "22:00-06:00", StartMinute: 22 * 60, EndMinute: 6 * 60}},
+	})
+	req := RuleInput{Request: &model.AnthropicRequest{Model: "m"}}
+
+	for hour, expected := range map[int]bool{23: true, 3: true, 6: false, 12: false, 22: true} {
+		engine.now = func() time.Time { return time.Date(2024, 1, 1, hour, 0, 0, 0, time.Local) }
+		if matched := engine.Match(req) != nil; matched != expected {
+			t.Errorf("At %02d:00 matched = %v, want %v", hour, matched, expected)
+		}
+	}
+}
+
+func TestRequestProjectPath(t *testing.T) {
+	req := &model.AnthropicRequest{System: []model.AnthropicSystemMessage{
+		{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+		{Text: "<env>\nWorking directory: /home/dev/project\nIs directory a git repo: Yes\n</env>"},
+	}}
+	if got := RequestProjectPath(req); got != "/home/dev/project" {
+		t.Errorf("RequestProjectPath() = %q, want /home/dev/project", got)
+	}
+	if got := RequestProjectPath(&model.AnthropicRequest{}); got != "" {
+		t.Errorf("RequestProjectPath() = %q, want empty", got)
+	}
+}
+
+func TestDetermineRoute_Rules(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]*config.ProviderConfig{
+			"anthropic": {Format: "anthropic", BaseURL: "https://api.anthropic.com"},
+			"openai":    {Format: "openai", BaseURL: "https://api.openai.com"},
+			"local":     {Format: "openai", BaseURL: "http://localhost:11434"},
+		},
+		Routing: config.RoutingConfig{
+			ProviderProfiles: map[string]config.ProviderProfileConfig{
+				"openai": {Speed: 5, Cost: 3, Quality: 8},
+				"local":  {Speed: 4, Cost: 10, Quality: 4},
+			},
+			Rules: []config.RoutingRuleConfig{
+				{ID: "no-opus", Match: config.RuleMatchConfig{Models: []string{"*opus*"}}, Action: "reject", Message: "opus is disabled"},
+				{ID: "cheap-haiku", Match: config.RuleMatchConfig{Models: []string{"*haiku*"}}, Action: "route", Preference: "cost", Providers: []string{"openai", "local"}},
+				{ID: "gpt", Match: config.RuleMatchConfig{Headers: map[string]string{"X-Route": "gpt"}}, Action: "route", Target: "openai:gpt-4o"},
+			},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+		"local":     &mockProvider{name: "local"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	decision, err := router.DetermineRoute(&model.AnthropicRequest{Model: "claude-sonnet-4"}, http.Header{"X-Route": []string{"gpt"}})
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "openai" || decision.TargetModel != "gpt-4o" || decision.RuleID != "gpt" {
+		t.Errorf("Target rule: got %s:%s (rule %q)", decision.ProviderName, decision.TargetModel, decision.RuleID)
+	}
+
+	decision, err = router.DetermineRoute(&model.AnthropicRequest{Model: "claude-3-5-haiku"}, nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	// Preference rules load balance across the top-ranked candidates
+	if decision.ProviderName == "anthropic" || decision.TargetModel != "claude-3-5-haiku" || decision.RuleID != "cheap-haiku" {
+		t.Errorf("Preference rule: got %s:%s (rule %q)", decision.ProviderName, decision.TargetModel, decision.RuleID)
+	}
+
+	_, err = router.DetermineRoute(&model.AnthropicRequest{Model: "claude-opus-4"}, nil)
+	var rejectErr *RuleRejectError
+	if !errors.As(err, &rejectErr) || rejectErr.RuleID != "no-opus" || rejectErr.Error() != "opus is disabled" {
+		t.Errorf("Expected rejection by no-opus, got %v", err)
+	}
+
+	decision, err = router.DetermineRoute(&model.AnthropicRequest{Model: "claude-sonnet-4"}, nil)
+	if err != nil {
+		t.Fatalf("DetermineRoute() error = %v", err)
+	}
+	if decision.ProviderName != "anthropic" || decision.RuleID != "" {
+		t.Errorf("Unmatched request: got %s (rule %q), want default route", decision.ProviderName, decision.RuleID)
+	}
+}
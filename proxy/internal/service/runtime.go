@@ -0,0 +1,114 @@
+package service
+
+import (
+	"log"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// Runtime is everything built from one config.yaml: the providers (with
+// their resilience wrappers), the model router, health probes, inbound
+// rate limits, the /v1/messages plugins, the prompt-caching optimizer, and
+// the tool policies.
+// A config reload builds a new Runtime and swaps it in whole; requests
+// already in flight keep using the one they started with.
+type Runtime struct {
+	Config        *config.Config
+	Providers     map[string]provider.Provider
+	Router        *ModelRouter
+	HealthChecker *HealthChecker
+	RateLimiter   *RateLimiter
+	Plugins       *PluginPipeline
+	Caching       *CacheOptimizer // nil unless prompt_caching is enabled
+	ToolPolicies  *ToolPolicyEngine
+
+	logger        *log.Logger
+	agentsWatched bool
+}
+
+// NewRuntime builds a Runtime from a loaded config. storage receives health
+// probe history and may be nil.
+func NewRuntime(cfg *config.Config, storage StorageService, logger *log.Logger) (*Runtime, error) {
+	providers, err := provider.BuildProviders(cfg.Providers, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	router := NewModelRouter(cfg, providers, logger)
+	healthChecker := NewHealthChecker(cfg.Providers, providers, storage, logger)
+	router.SetHealthChecker(healthChecker)
+
+	return &Runtime{
+		Config:        cfg,
+		Providers:     providers,
+		Router:        router,
+		HealthChecker: healthChecker,
+		RateLimiter:   NewRateLimiter(cfg.RateLimits),
+		Plugins:       NewPluginPipeline(cfg.Plugins),
+		Caching:       NewCacheOptimizer(cfg.PromptCaching, cfg.Providers),
+		ToolPolicies:  NewToolPolicyEngine(cfg.ToolPolicies),
+		logger:        logger,
+	}, nil
+}
+
+// rebuild builds the Runtime for a reloaded config.
+// Breaker state and overrides, learned weights, and rate limit buckets carry
+// over for the providers and clients that still exist.
+func (rt *Runtime) rebuild(cfg *config.Config, storage StorageService) (*Runtime, error) {
+	next, err := NewRuntime(cfg, storage, rt.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, prov := range next.Providers {
+		resilient, ok := prov.(*provider.ResilientProvider)
+		if !ok {
+			continue
+		}
+		if previous, ok := rt.Providers[name].(*provider.ResilientProvider); ok {
+			resilient.InheritState(previous)
+		}
+	}
+	if controller, previous := next.Router.WeightController(), rt.Router.WeightController(); controller != nil && previous != nil {
+		controller.Inherit(previous)
+	}
+	next.Router.limiter.inherit(rt.Router.limiter)
+	next.RateLimiter.inherit(rt.RateLimiter)
+	return next, nil
+}
+
+// Start launches the background workers: adaptive weights, the agent
+// directory watcher, and health probes
+func (rt *Runtime) Start() {
+	if rt.RateLimiter.Enabled() {
+		rt.logger.Printf("🚦 Inbound rate limits enabled")
+	}
+	if weightController := rt.Router.WeightController(); weightController != nil {
+		weightController.Start()
+	}
+	if agents := rt.Router.AgentRegistry(); agents != nil {
+		if err := agents.Start(); err != nil {
+			rt.logger.Printf("⚠️  Failed to watch agent definitions: %v", err)
+		} else {
+			rt.agentsWatched = true
+		}
+	}
+	if rt.HealthChecker.Enabled() {
+		rt.HealthChecker.Start()
+	}
+}
+
+// Stop halts the background workers. Providers are left alone so requests
+// still using this Runtime can finish.
+func (rt *Runtime) Stop() {
+	if weightController := rt.Router.WeightController(); weightController != nil {
+		weightController.Stop()
+	}
+	if rt.agentsWatched {
+		rt.Router.AgentRegistry().Stop()
+	}
+	if rt.HealthChecker.Enabled() {
+		rt.HealthChecker.Stop()
+	}
+}
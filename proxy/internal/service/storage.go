@@ -18,18 +18,21 @@ type StorageService interface {
 	GetConfig() *config.StorageConfig
 	GetAllRequests(modelFilter string) ([]*model.RequestLog, error)
 	GetRequestsSummary(modelFilter string) ([]*model.RequestSummary, error)
-	GetRequestsSummaryPaginated(modelFilter, startTime, endTime string, offset, limit int) ([]*model.RequestSummary, int, error)
-	GetStats(startDate, endDate string) (*model.DashboardStats, error)
-	GetHourlyStats(startTime, endTime string) (*model.HourlyStatsResponse, error)
-	GetModelStats(startTime, endTime string) (*model.ModelStatsResponse, error)
+	GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project string, offset, limit int) ([]*model.RequestSummary, int, error)
+	GetStats(startDate, endDate, project string) (*model.DashboardStats, error)
+	GetHourlyStats(startTime, endTime, project string) (*model.HourlyStatsResponse, error)
+	GetModelStats(startTime, endTime, project string) (*model.ModelStatsResponse, error)
 	GetLatestRequestDate() (*time.Time, error)
 	Close() error
 
 	// New analytics endpoints
-	GetProviderStats(startTime, endTime string) (*model.ProviderStatsResponse, error)
-	GetSubagentStats(startTime, endTime string) (*model.SubagentStatsResponse, error)
-	GetToolStats(startTime, endTime string) (*model.ToolStatsResponse, error)
-	GetPerformanceStats(startTime, endTime string) (*model.PerformanceStatsResponse, error)
+	GetProviderStats(startTime, endTime, project string) (*model.ProviderStatsResponse, error)
+	GetPromptCachingStats(startTime, endTime, project string) (*model.PromptCachingStatsResponse, error)
+	GetBodyStorageStats() (*model.BodyStorageStats, error)
+	GetSubagentStats(startTime, endTime, project string) (*model.SubagentStatsResponse, error)
+	GetToolStats(startTime, endTime, project string) (*model.ToolStatsResponse, error)
+	GetPerformanceStats(startTime, endTime, project string) (*model.PerformanceStatsResponse, error)
+	GetExperimentResults(experimentID, startTime, endTime string) (*model.ExperimentResults, error)
 
 	// Conversation search
 	SearchConversations(opts model.SearchOptions) (*model.SearchResults, error)
@@ -48,4 +51,23 @@ type StorageService interface {
 
 	// ReindexConversations triggers a full re-index of all conversations
 	ReindexConversations() error
+
+	// Provider health probe history
+	SaveHealthCheck(check *model.ProviderHealthCheck) error
+	GetHealthChecks(provider string, limit int) ([]*model.ProviderHealthCheck, error)
+
+	// Config write API revision history
+	SaveConfigRevision(revision *model.ConfigRevision) error
+	GetConfigRevisions(limit int) ([]*model.ConfigRevision, error)
+	GetConfigRevision(id int64) (*model.ConfigRevision, error)
+
+	// Tool calls matched by tool policies
+	SaveToolPolicyHits(hits []*model.ToolPolicyHit) error
+	GetToolPolicyHits(filter model.ToolPolicyHitFilter) ([]*model.ToolPolicyHit, error)
+
+	// Tool call audit, from proxied traffic and indexed conversations
+	GetToolCalls(filter model.ToolCallFilter) ([]*model.ToolCall, int, error)
+
+	// Retention settings, stored data size, and the last retention run
+	GetRetentionStatus() (*model.RetentionStatus, error)
 }
@@ -0,0 +1,819 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ErrNotSupported is returned by the jsonl backend for analytics, search,
+// and audit queries, which need the sqlite backend
+var ErrNotSupported = errors.New("not supported by the jsonl storage backend")
+
+// jsonlHealthChecksKept is how many probe results per provider the jsonl
+// backend keeps in memory
+const jsonlHealthChecksKept = 200
+
+// jsonlStateFile holds health checks and config revisions, which outlive
+// ClearRequests
+const jsonlStateFile = "state.jsonl"
+
+// JSONLStorageService stores requests as append-only JSON lines in
+// storage.requests_dir, one requests-YYYY-MM-DD.jsonl file per day. A
+// request is written when it arrives; its response, grade, and other later
+// updates are written as further lines for the same requestId. An in-memory
+// index of summaries and file offsets, rebuilt from the files at startup,
+// serves reads. Health checks and config revisions go to state.jsonl
+// instead, so clearing requests keeps them.
+type JSONLStorageService struct {
+	config   *config.StorageConfig
+	redactor *Redactor // nil when storage.redaction is disabled
+
+	mu        sync.RWMutex
+	file      *os.File
+	fileDay   string
+	fileSize  int64
+	stateFile *os.File
+
+	requests     map[string]*jsonlEntry
+	order        []*jsonlEntry // oldest first
+	healthChecks map[string][]*model.ProviderHealthCheck
+	revisions    []*model.ConfigRevision
+}
+
+// jsonlRecord is one line of a requests file
+type jsonlRecord struct {
+	Type      string    `json:"type"` // request, response, grade, health_check, config_revision, or tool_policy_hit
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+
+	Request        *jsonlRequest              `json:"request,omitempty"`
+	Response       *model.ResponseLog         `json:"response,omitempty"`
+	Provider       string                     `json:"provider,omitempty"`
+	RoutedModel    string                     `json:"routedModel,omitempty"`
+	Hedge          *model.HedgeInfo           `json:"hedge,omitempty"`
+	Queue          *model.QueueInfo           `json:"queue,omitempty"`
+	Redactions     map[string]int             `json:"redactions,omitempty"`
+	Grade          *model.PromptGrade         `json:"grade,omitempty"`
+	HealthCheck    *model.ProviderHealthCheck `json:"healthCheck,omitempty"`
+	ConfigRevision *model.ConfigRevision      `json:"configRevision,omitempty"`
+	ToolPolicyHit  *model.ToolPolicyHit       `json:"toolPolicyHit,omitempty"`
+}
+
+// jsonlRequest is a RequestLog with its body kept as raw JSON, so the index
+// can be rebuilt without decoding every body
+type jsonlRequest struct {
+	model.RequestLog
+	Body json.RawMessage `json:"body"`
+}
+
+// jsonlEntry is the index entry for one request
+type jsonlEntry struct {
+	summary  model.RequestSummary
+	request  jsonlLocation
+	response *jsonlLocation // latest response line, if any
+	grade    *model.PromptGrade
+}
+
+// jsonlLocation is where a line is in the requests files
+type jsonlLocation struct {
+	path   string
+	offset int64
+	length int
+}
+
+func NewJSONLStorageService(cfg *config.StorageConfig) (StorageService, error) {
+	redactor, err := NewRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build redactor: %w", err)
+	}
+	if redactor != nil {
+		log.Printf("🔒 Redacting secrets before storage")
+	}
+
+	service := &JSONLStorageService{
+		config:       cfg,
+		redactor:     redactor,
+		requests:     make(map[string]*jsonlEntry),
+		healthChecks: make(map[string][]*model.ProviderHealthCheck),
+	}
+	if err := service.EnsureDirectoryExists(); err != nil {
+		return nil, err
+	}
+	if err := service.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", cfg.RequestsDir, err)
+	}
+	return service, nil
+}
+
+// NewStorageService opens the backend storage.backend selects
+func NewStorageService(cfg *config.StorageConfig) (StorageService, error) {
+	if cfg.Backend == "jsonl" {
+		return NewJSONLStorageService(cfg)
+	}
+	return NewSQLiteStorageService(cfg)
+}
+
+// requestFiles lists the requests files, oldest first
+func (s *JSONLStorageService) requestFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.config.RequestsDir, "requests-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadIndex rebuilds the in-memory index from the requests files
+func (s *JSONLStorageService) loadIndex() error {
+	files, err := s.requestFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if err := s.indexFile(path); err != nil {
+			return err
+		}
+	}
+	// Older versions wrote state to the requests files, so it is read last
+	if err := s.indexFile(s.statePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	sort.SliceStable(s.order, func(i, j int) bool {
+		return s.order[i].summary.Timestamp < s.order[j].summary.Timestamp
+	})
+	if len(s.order) > 0 {
+		log.Printf("📄 Indexed %d requests from %d files in %s", len(s.order), len(files), s.config.RequestsDir)
+	}
+	return nil
+}
+
+func (s *JSONLStorageService) indexFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			location := jsonlLocation{path: path, offset: offset, length: len(line) - 1}
+			var record jsonlRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr == nil {
+				s.applyRecord(&record, location)
+			} else {
+				log.Printf("⚠️  Skipping unreadable line at %s:%d: %v", path, offset, jsonErr)
+			}
+		}
+		// A line without a newline was cut short by a crash; it is skipped
+		offset += int64(len(line))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// applyRecord adds a record to the index; callers hold the write lock or
+// are still loading
+func (s *JSONLStorageService) applyRecord(record *jsonlRecord, location jsonlLocation) {
+	switch record.Type {
+	case "request":
+		if record.Request == nil {
+			return
+		}
+		request := &record.Request.RequestLog
+		entry := &jsonlEntry{
+			summary: model.RequestSummary{
+				RequestID:     request.RequestID,
+				Timestamp:     request.Timestamp,
+				Method:        request.Method,
+				Endpoint:      request.Endpoint,
+				Model:         request.Model,
+				OriginalModel: request.OriginalModel,
+				RoutedModel:   request.RoutedModel,
+				Provider:      request.Provider,
+				SubagentName:  request.SubagentName,
+				ToolsUsed:     request.ToolsUsed,
+				ToolCallCount: request.ToolCallCount,
+				ProjectPath:   request.ProjectPath,
+			},
+			request: location,
+		}
+		if _, exists := s.requests[request.RequestID]; !exists {
+			s.order = append(s.order, entry)
+		} else {
+			for i, existing := range s.order {
+				if existing.summary.RequestID == request.RequestID {
+					s.order[i] = entry
+				}
+			}
+		}
+		s.requests[request.RequestID] = entry
+	case "response":
+		entry, ok := s.requests[record.RequestID]
+		if !ok || record.Response == nil {
+			return
+		}
+		entry.response = &location
+		entry.summary.StatusCode = record.Response.StatusCode
+		entry.summary.ResponseTime = record.Response.ResponseTime
+		entry.summary.FirstByteTime = record.Response.FirstByteTime
+		entry.summary.ToolCallCount = record.Response.ToolCallCount
+		entry.summary.Usage = responseUsage(record.Response)
+		if record.Provider != "" {
+			// A hedge may have served the request instead of the routed provider
+			entry.summary.Provider = record.Provider
+			entry.summary.RoutedModel = record.RoutedModel
+		}
+	case "grade":
+		if entry, ok := s.requests[record.RequestID]; ok {
+			entry.grade = record.Grade
+		}
+	case "health_check":
+		if check := record.HealthCheck; check != nil {
+			checks := append(s.healthChecks[check.Provider], check)
+			if len(checks) > jsonlHealthChecksKept {
+				checks = checks[len(checks)-jsonlHealthChecksKept:]
+			}
+			s.healthChecks[check.Provider] = checks
+		}
+	case "config_revision":
+		if record.ConfigRevision != nil {
+			s.revisions = append(s.revisions, record.ConfigRevision)
+		}
+	}
+}
+
+// responseUsage returns the token usage reported in a response body
+func responseUsage(response *model.ResponseLog) *model.AnthropicUsage {
+	if response == nil || response.Body == nil {
+		return nil
+	}
+	var body struct {
+		Usage *model.AnthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(response.Body, &body); err != nil {
+		return nil
+	}
+	return body.Usage
+}
+
+// appendRecord writes a record to today's file and indexes it
+func (s *JSONLStorageService) appendRecord(record *jsonlRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeRecord(record)
+}
+
+// writeRecord is appendRecord for callers that hold the lock
+func (s *JSONLStorageService) writeRecord(record *jsonlRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s record: %w", record.Type, err)
+	}
+
+	if isStateRecord(record.Type) {
+		if err := s.writeState(line); err != nil {
+			return fmt.Errorf("failed to write %s record: %w", record.Type, err)
+		}
+		s.applyRecord(record, jsonlLocation{})
+		return nil
+	}
+
+	day := record.Time.Format("2006-01-02")
+	if s.file == nil || day != s.fileDay {
+		if err := s.openFile(day); err != nil {
+			return err
+		}
+	}
+
+	location := jsonlLocation{path: s.file.Name(), offset: s.fileSize, length: len(line)}
+	n, err := s.file.Write(append(line, '\n'))
+	s.fileSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write %s record: %w", record.Type, err)
+	}
+	s.applyRecord(record, location)
+	return nil
+}
+
+// openFile switches writes to the file for day; callers hold the lock
+func (s *JSONLStorageService) openFile(day string) error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	path := filepath.Join(s.config.RequestsDir, "requests-"+day+".jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	s.file, s.fileDay, s.fileSize = file, day, info.Size()
+	return nil
+}
+
+// isStateRecord reports whether a record type belongs in the state file
+func isStateRecord(recordType string) bool {
+	return recordType == "health_check" || recordType == "config_revision"
+}
+
+func (s *JSONLStorageService) statePath() string {
+	return filepath.Join(s.config.RequestsDir, jsonlStateFile)
+}
+
+// writeState appends a line to the state file; callers hold the lock
+func (s *JSONLStorageService) writeState(line []byte) error {
+	if s.stateFile == nil {
+		file, err := os.OpenFile(s.statePath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		s.stateFile = file
+	}
+	_, err := s.stateFile.Write(append(line, '\n'))
+	return err
+}
+
+// rewriteState replaces the state file with the health checks and config
+// revisions held in memory, which also moves any that older versions wrote
+// to the requests files; callers hold the lock
+func (s *JSONLStorageService) rewriteState() error {
+	if s.stateFile != nil {
+		s.stateFile.Close()
+		s.stateFile = nil
+	}
+
+	var records []*jsonlRecord
+	for _, revision := range s.revisions {
+		records = append(records, &jsonlRecord{Type: "config_revision", Time: revision.CreatedAt, ConfigRevision: revision})
+	}
+	for _, checks := range s.healthChecks {
+		for _, check := range checks {
+			records = append(records, &jsonlRecord{Type: "health_check", Time: check.CheckedAt, HealthCheck: check})
+		}
+	}
+
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s record: %w", record.Type, err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := s.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath())
+}
+
+// readRecord reads one indexed line back
+func readRecord(location jsonlLocation) (*jsonlRecord, error) {
+	file, err := os.Open(location.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	line := make([]byte, location.length)
+	if _, err := file.ReadAt(line, location.offset); err != nil {
+		return nil, fmt.Errorf("failed to read %s at %d: %w", location.path, location.offset, err)
+	}
+	var record jsonlRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %d: %w", location.path, location.offset, err)
+	}
+	return &record, nil
+}
+
+// loadRequest reads a request and its latest response from disk
+func (s *JSONLStorageService) loadRequest(entry jsonlEntry) (*model.RequestLog, error) {
+	record, err := readRecord(entry.request)
+	if err != nil {
+		return nil, err
+	}
+	if record.Request == nil {
+		return nil, fmt.Errorf("request record for %s has no request", entry.summary.RequestID)
+	}
+	request := record.Request.RequestLog
+
+	var body interface{}
+	if err := json.Unmarshal(record.Request.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body: %w", err)
+	}
+	request.Body = body
+	request.PromptGrade = entry.grade
+
+	if entry.response != nil {
+		response, err := readRecord(*entry.response)
+		if err != nil {
+			return nil, err
+		}
+		request.Response = response.Response
+		if response.Provider != "" {
+			request.Provider = response.Provider
+			request.RoutedModel = response.RoutedModel
+		}
+		request.Hedge = response.Hedge
+		request.Queue = response.Queue
+		if response.Redactions != nil {
+			request.Redactions = response.Redactions
+		}
+		request.ToolCallCount = entry.summary.ToolCallCount
+	}
+	return &request, nil
+}
+
+// entries returns copies of the indexed requests, newest first, that keep
+// returns true for. Copies are taken under the lock, so callers can read
+// them while responses and grades are written.
+func (s *JSONLStorageService) entries(keep func(summary *model.RequestSummary) bool) []jsonlEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []jsonlEntry
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if keep == nil || keep(&s.order[i].summary) {
+			result = append(result, *s.order[i])
+		}
+	}
+	return result
+}
+
+func (s *JSONLStorageService) SaveRequest(request *model.RequestLog) (string, error) {
+	bodyJSON, err := json.Marshal(request.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	// Mask secrets in the body before it reaches disk
+	bodyJSON, counts := s.redactor.RedactJSON(bodyJSON)
+	recordRedactions("request", counts)
+	request.Redactions = mergeRedactions(request.Redactions, counts)
+
+	stored := jsonlRequest{RequestLog: *request, Body: bodyJSON}
+	stored.Response = nil
+	err = s.appendRecord(&jsonlRecord{Type: "request", Time: time.Now(), RequestID: request.RequestID, Request: &stored})
+	if err != nil {
+		return "", err
+	}
+	return request.RequestID, nil
+}
+
+func (s *JSONLStorageService) UpdateRequestWithResponse(request *model.RequestLog) error {
+	responseJSON, err := json.Marshal(request.Response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	// Mask secrets in the response (and tool calls) before it reaches disk
+	responseJSON, counts := s.redactor.RedactJSON(responseJSON)
+	recordRedactions("response", counts)
+	request.Redactions = mergeRedactions(request.Redactions, counts)
+
+	var response model.ResponseLog
+	if err := json.Unmarshal(responseJSON, &response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return s.appendRecord(&jsonlRecord{
+		Type:        "response",
+		Time:        time.Now(),
+		RequestID:   request.RequestID,
+		Response:    &response,
+		Provider:    request.Provider,
+		RoutedModel: request.RoutedModel,
+		Hedge:       request.Hedge,
+		Queue:       request.Queue,
+		Redactions:  request.Redactions,
+	})
+}
+
+func (s *JSONLStorageService) UpdateRequestWithGrading(requestID string, grade *model.PromptGrade) error {
+	return s.appendRecord(&jsonlRecord{Type: "grade", Time: time.Now(), RequestID: requestID, Grade: grade})
+}
+
+func (s *JSONLStorageService) GetRequests(page, limit int) ([]model.RequestLog, int, error) {
+	entries := s.entries(nil)
+	start := (page - 1) * limit
+	if start < 0 || start >= len(entries) {
+		return []model.RequestLog{}, len(entries), nil
+	}
+	end := min(start+limit, len(entries))
+
+	var requests []model.RequestLog
+	for _, entry := range entries[start:end] {
+		request, err := s.loadRequest(entry)
+		if err != nil {
+			log.Printf("⚠️  Error reading request %s: %v", entry.summary.RequestID, err)
+			continue
+		}
+		requests = append(requests, *request)
+	}
+	return requests, len(entries), nil
+}
+
+// ClearRequests deletes every requests file, keeping health checks and
+// config revisions
+func (s *JSONLStorageService) ClearRequests() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := s.rewriteState(); err != nil {
+		return 0, fmt.Errorf("failed to rewrite %s: %w", jsonlStateFile, err)
+	}
+	files, err := s.requestFiles()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list requests files: %w", err)
+	}
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	cleared := len(s.order)
+	s.requests = make(map[string]*jsonlEntry)
+	s.order = nil
+	return cleared, nil
+}
+
+func (s *JSONLStorageService) EnsureDirectoryExists() error {
+	if err := os.MkdirAll(s.config.RequestsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.config.RequestsDir, err)
+	}
+	return nil
+}
+
+func (s *JSONLStorageService) GetRequestByShortID(shortID string) (*model.RequestLog, string, error) {
+	entries := s.entries(func(summary *model.RequestSummary) bool {
+		return strings.HasSuffix(summary.RequestID, shortID)
+	})
+	if len(entries) == 0 {
+		return nil, "", fmt.Errorf("request with ID %s not found", shortID)
+	}
+	request, err := s.loadRequest(entries[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return request, request.RequestID, nil
+}
+
+func (s *JSONLStorageService) GetConfig() *config.StorageConfig {
+	return s.config
+}
+
+func (s *JSONLStorageService) GetAllRequests(modelFilter string) ([]*model.RequestLog, error) {
+	var requests []*model.RequestLog
+	for _, entry := range s.entries(modelMatcher(modelFilter)) {
+		request, err := s.loadRequest(entry)
+		if err != nil {
+			log.Printf("⚠️  Error reading request %s: %v", entry.summary.RequestID, err)
+			continue
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// modelMatcher matches summaries whose model contains modelFilter; "" and
+// "all" match everything
+func modelMatcher(modelFilter string) func(summary *model.RequestSummary) bool {
+	if modelFilter == "" || modelFilter == "all" {
+		return nil
+	}
+	modelFilter = strings.ToLower(modelFilter)
+	return func(summary *model.RequestSummary) bool {
+		return strings.Contains(strings.ToLower(summary.Model), modelFilter)
+	}
+}
+
+func (s *JSONLStorageService) GetRequestsSummary(modelFilter string) ([]*model.RequestSummary, error) {
+	summaries, _, err := s.GetRequestsSummaryPaginated(modelFilter, "", "", "", 0, 0)
+	return summaries, err
+}
+
+func (s *JSONLStorageService) GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project string, offset, limit int) ([]*model.RequestSummary, int, error) {
+	matchModel := modelMatcher(modelFilter)
+	entries := s.entries(func(summary *model.RequestSummary) bool {
+		if matchModel != nil && !matchModel(summary) {
+			return false
+		}
+		if startTime != "" && endTime != "" && (summary.Timestamp < startTime || summary.Timestamp >= endTime) {
+			return false
+		}
+		return project == "" || summary.ProjectPath == project
+	})
+
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+	entries = entries[offset:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+
+	summaries := make([]*model.RequestSummary, len(entries))
+	for i, entry := range entries {
+		summary := entry.summary
+		summaries[i] = &summary
+	}
+	return summaries, total, nil
+}
+
+func (s *JSONLStorageService) GetLatestRequestDate() (*time.Time, error) {
+	entries := s.entries(nil)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, entries[0].summary.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+	return &t, nil
+}
+
+func (s *JSONLStorageService) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stateFile != nil {
+		s.stateFile.Close()
+		s.stateFile = nil
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *JSONLStorageService) SaveHealthCheck(check *model.ProviderHealthCheck) error {
+	return s.appendRecord(&jsonlRecord{Type: "health_check", Time: time.Now(), HealthCheck: check})
+}
+
+func (s *JSONLStorageService) GetHealthChecks(provider string, limit int) ([]*model.ProviderHealthCheck, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	checks := s.healthChecks[provider]
+	result := make([]*model.ProviderHealthCheck, 0, min(limit, len(checks)))
+	for i := len(checks) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, checks[i])
+	}
+	return result, nil
+}
+
+func (s *JSONLStorageService) SaveConfigRevision(revision *model.ConfigRevision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revision.ID = int64(len(s.revisions)) + 1
+	return s.writeRecord(&jsonlRecord{Type: "config_revision", Time: time.Now(), ConfigRevision: revision})
+}
+
+func (s *JSONLStorageService) GetConfigRevisions(limit int) ([]*model.ConfigRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*model.ConfigRevision, 0, min(limit, len(s.revisions)))
+	for i := len(s.revisions) - 1; i >= 0 && len(result) < limit; i-- {
+		// Listings leave out the file content, as in the sqlite backend
+		revision := *s.revisions[i]
+		revision.Content = ""
+		result = append(result, &revision)
+	}
+	return result, nil
+}
+
+func (s *JSONLStorageService) GetConfigRevision(id int64) (*model.ConfigRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, revision := range s.revisions {
+		if revision.ID == id {
+			return revision, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveToolPolicyHits writes hits to the log; they cannot be queried back
+func (s *JSONLStorageService) SaveToolPolicyHits(hits []*model.ToolPolicyHit) error {
+	for _, hit := range hits {
+		if len(hit.Input) > 0 {
+			redacted, counts := s.redactor.RedactJSON(hit.Input)
+			recordRedactions("tool_policy", counts)
+			hit.Input = redacted
+		}
+		if err := s.appendRecord(&jsonlRecord{Type: "tool_policy_hit", Time: time.Now(), RequestID: hit.RequestID, ToolPolicyHit: hit}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Analytics, search, and audit queries need the sqlite backend
+
+func (s *JSONLStorageService) GetStats(startDate, endDate, project string) (*model.DashboardStats, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetHourlyStats(startTime, endTime, project string) (*model.HourlyStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetModelStats(startTime, endTime, project string) (*model.ModelStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetProviderStats(startTime, endTime, project string) (*model.ProviderStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetPromptCachingStats(startTime, endTime, project string) (*model.PromptCachingStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetBodyStorageStats() (*model.BodyStorageStats, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetSubagentStats(startTime, endTime, project string) (*model.SubagentStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetToolStats(startTime, endTime, project string) (*model.ToolStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetPerformanceStats(startTime, endTime, project string) (*model.PerformanceStatsResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetExperimentResults(experimentID, startTime, endTime string) (*model.ExperimentResults, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) SearchConversations(opts model.SearchOptions) (*model.SearchResults, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetIndexedConversations(limit int) ([]*model.IndexedConversation, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetConversationFilePath(conversationID string) (string, string, error) {
+	return "", "", ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetConversationMessages(conversationID string, limit, offset int) ([]*model.DBConversationMessage, int, error) {
+	return nil, 0, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetConversationMessagesWithSubagents(conversationID string, limit, offset int) ([]*model.DBConversationMessage, int, error) {
+	return nil, 0, ErrNotSupported
+}
+
+func (s *JSONLStorageService) ReindexConversations() error {
+	return ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetToolPolicyHits(filter model.ToolPolicyHitFilter) ([]*model.ToolPolicyHit, error) {
+	return nil, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetToolCalls(filter model.ToolCallFilter) ([]*model.ToolCall, int, error) {
+	return nil, 0, ErrNotSupported
+}
+
+func (s *JSONLStorageService) GetRetentionStatus() (*model.RetentionStatus, error) {
+	return nil, ErrNotSupported
+}
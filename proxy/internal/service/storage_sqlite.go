@@ -15,8 +15,9 @@ import (
 )
 
 type SQLiteStorageService struct {
-	db     *sql.DB
-	config *config.StorageConfig
+	db       *sql.DB
+	config   *config.StorageConfig
+	redactor *Redactor // nil when storage.redaction is disabled
 }
 
 func NewSQLiteStorageService(cfg *config.StorageConfig) (StorageService, error) {
@@ -28,9 +29,18 @@ func NewSQLiteStorageService(cfg *config.StorageConfig) (StorageService, error)
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	redactor, err := NewRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build redactor: %w", err)
+	}
+	if redactor != nil {
+		log.Printf("🔒 Redacting secrets before storage")
+	}
+
 	service := &SQLiteStorageService{
-		db:     db,
-		config: cfg,
+		db:       db,
+		config:   cfg,
+		redactor: redactor,
 	}
 
 	if err := service.createTables(); err != nil {
@@ -75,6 +85,19 @@ func (s *SQLiteStorageService) createTables() error {
 			cache_creation_tokens INTEGER DEFAULT 0,
 			response_time_ms INTEGER DEFAULT 0,
 			first_byte_time_ms INTEGER DEFAULT 0,
+			hedge TEXT,
+			queue TEXT,
+			rate_limit TEXT,
+			routing_rule TEXT,
+			experiment_id TEXT,
+			experiment_arm TEXT,
+			project_path TEXT,
+			plugins TEXT,
+			redactions TEXT,
+			cache_breakpoints INTEGER DEFAULT 0,
+			body_refs TEXT,
+			body_size INTEGER DEFAULT 0,
+			body_stripped INTEGER DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
 
@@ -84,6 +107,8 @@ func (s *SQLiteStorageService) createTables() error {
 		CREATE INDEX idx_provider ON requests(provider);
 		CREATE INDEX idx_subagent ON requests(subagent_name);
 		CREATE INDEX idx_timestamp_provider ON requests(timestamp DESC, provider);
+		CREATE INDEX idx_experiment ON requests(experiment_id, experiment_arm);
+		CREATE INDEX idx_project_path ON requests(project_path, timestamp DESC);
 		`
 		_, err := s.db.Exec(schema)
 		if err != nil {
@@ -105,6 +130,181 @@ func (s *SQLiteStorageService) createTables() error {
 		return err
 	}
 
+	// ALWAYS run provider health check migrations
+	if err := s.runHealthCheckMigrations(); err != nil {
+		return err
+	}
+
+	// ALWAYS run config revision migrations
+	if err := s.runConfigRevisionMigrations(); err != nil {
+		return err
+	}
+
+	// ALWAYS run tool policy hit migrations
+	if err := s.runToolPolicyHitMigrations(); err != nil {
+		return err
+	}
+
+	// ALWAYS run tool call audit migrations
+	if err := s.runToolCallMigrations(); err != nil {
+		return err
+	}
+
+	// ALWAYS run body blob migrations
+	if err := s.runBodyBlobMigrations(); err != nil {
+		return err
+	}
+
+	// ALWAYS run retention run history migrations
+	if err := s.runRetentionMigrations(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// runHealthCheckMigrations creates the provider health probe history table
+func (s *SQLiteStorageService) runHealthCheckMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS provider_health_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		method TEXT NOT NULL,
+		checked_at DATETIME NOT NULL,
+		success INTEGER NOT NULL,
+		status_code INTEGER DEFAULT 0,
+		latency_ms INTEGER DEFAULT 0,
+		error TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_health_checks_provider ON provider_health_checks(provider, checked_at DESC);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create provider_health_checks table: %w", err)
+	}
+	return nil
+}
+
+// runConfigRevisionMigrations creates the config write API revision table
+func (s *SQLiteStorageService) runConfigRevisionMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS config_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		author TEXT,
+		summary TEXT,
+		content TEXT NOT NULL
+	);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create config_revisions table: %w", err)
+	}
+	return nil
+}
+
+// runToolPolicyHitMigrations creates the table of tool calls matched by
+// tool policies
+func (s *SQLiteStorageService) runToolPolicyHitMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS tool_policy_hits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		policy TEXT NOT NULL,
+		action TEXT NOT NULL,
+		tool_name TEXT NOT NULL,
+		tool_use_id TEXT,
+		input TEXT,
+		provider TEXT,
+		model TEXT,
+		subagent_name TEXT,
+		project_path TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_tool_policy_hits_timestamp ON tool_policy_hits(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_tool_policy_hits_policy ON tool_policy_hits(policy, timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_tool_policy_hits_request ON tool_policy_hits(request_id);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create tool_policy_hits table: %w", err)
+	}
+	return nil
+}
+
+// runToolCallMigrations creates the tool call audit table: one row per
+// tool_use, updated with its tool_result
+func (s *SQLiteStorageService) runToolCallMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS tool_calls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tool_use_id TEXT NOT NULL UNIQUE,
+		request_id TEXT,
+		result_request_id TEXT,
+		timestamp DATETIME NOT NULL,
+		session_id TEXT,
+		subagent_name TEXT,
+		provider TEXT,
+		model TEXT,
+		project_path TEXT,
+		tool_name TEXT NOT NULL DEFAULT '',
+		input TEXT,
+		has_result INTEGER NOT NULL DEFAULT 0,
+		is_error INTEGER NOT NULL DEFAULT 0,
+		result_size INTEGER NOT NULL DEFAULT 0,
+		result_at DATETIME,
+		source TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_tool_calls_timestamp ON tool_calls(timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_tool_calls_tool ON tool_calls(tool_name, timestamp DESC);
+	CREATE INDEX IF NOT EXISTS idx_tool_calls_session ON tool_calls(session_id);
+	CREATE INDEX IF NOT EXISTS idx_tool_calls_request ON tool_calls(request_id);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create tool_calls table: %w", err)
+	}
+	return nil
+}
+
+// runBodyBlobMigrations creates the table of content-addressed request body
+// pieces. ref_count is how many times requests rows reference each blob.
+func (s *SQLiteStorageService) runBodyBlobMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS body_blobs (
+		hash TEXT PRIMARY KEY,
+		codec TEXT NOT NULL,
+		data BLOB NOT NULL,
+		size INTEGER NOT NULL,
+		ref_count INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create body_blobs table: %w", err)
+	}
+	return nil
+}
+
+// runRetentionMigrations creates the retention job's run history table
+func (s *SQLiteStorageService) runRetentionMigrations() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS retention_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		stripped_requests INTEGER NOT NULL DEFAULT 0,
+		expired_requests INTEGER NOT NULL DEFAULT 0,
+		evicted_requests INTEGER NOT NULL DEFAULT 0,
+		archived_requests INTEGER NOT NULL DEFAULT 0,
+		archive_file TEXT,
+		size_before INTEGER NOT NULL DEFAULT 0,
+		size_after INTEGER NOT NULL DEFAULT 0,
+		error TEXT
+	);
+	`
+	if _, err := s.db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create retention_runs table: %w", err)
+	}
 	return nil
 }
 
@@ -121,6 +321,19 @@ func (s *SQLiteStorageService) runMigrations() error {
 		"ALTER TABLE requests ADD COLUMN cache_creation_tokens INTEGER DEFAULT 0",
 		"ALTER TABLE requests ADD COLUMN response_time_ms INTEGER DEFAULT 0",
 		"ALTER TABLE requests ADD COLUMN first_byte_time_ms INTEGER DEFAULT 0",
+		"ALTER TABLE requests ADD COLUMN hedge TEXT",
+		"ALTER TABLE requests ADD COLUMN queue TEXT",
+		"ALTER TABLE requests ADD COLUMN rate_limit TEXT",
+		"ALTER TABLE requests ADD COLUMN routing_rule TEXT",
+		"ALTER TABLE requests ADD COLUMN experiment_id TEXT",
+		"ALTER TABLE requests ADD COLUMN experiment_arm TEXT",
+		"ALTER TABLE requests ADD COLUMN project_path TEXT",
+		"ALTER TABLE requests ADD COLUMN plugins TEXT",
+		"ALTER TABLE requests ADD COLUMN redactions TEXT",
+		"ALTER TABLE requests ADD COLUMN cache_breakpoints INTEGER DEFAULT 0",
+		"ALTER TABLE requests ADD COLUMN body_refs TEXT",
+		"ALTER TABLE requests ADD COLUMN body_size INTEGER DEFAULT 0",
+		"ALTER TABLE requests ADD COLUMN body_stripped INTEGER DEFAULT 0",
 	}
 
 	for _, migration := range migrations {
@@ -132,6 +345,8 @@ func (s *SQLiteStorageService) runMigrations() error {
 	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_provider ON requests(provider)")
 	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_subagent ON requests(subagent_name)")
 	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_timestamp_provider ON requests(timestamp DESC, provider)")
+	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_experiment ON requests(experiment_id, experiment_arm)")
+	s.db.Exec("CREATE INDEX IF NOT EXISTS idx_project_path ON requests(project_path, timestamp DESC)")
 
 
 	return nil
@@ -345,23 +560,56 @@ func (s *SQLiteStorageService) SaveRequest(request *model.RequestLog) (string, e
 		return "", fmt.Errorf("failed to marshal body: %w", err)
 	}
 
+	// Mask secrets in the body before it reaches disk
+	bodyJSON, counts := s.redactor.RedactJSON(bodyJSON)
+	recordRedactions("request", counts)
+	request.Redactions = mergeRedactions(request.Redactions, counts)
+	redactionsJSON := marshalRedactions(request.Redactions)
+
 	toolsUsedJSON, err := json.Marshal(request.ToolsUsed)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal tools_used: %w", err)
 	}
 
+	// Only set when a plugin changed the request
+	var pluginsJSON sql.NullString
+	if len(request.Plugins) > 0 {
+		if data, err := json.Marshal(request.Plugins); err == nil {
+			pluginsJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+
+	// Only set when the proxy rejected the request before forwarding it
+	var rateLimitJSON sql.NullString
+	if request.RateLimit != nil {
+		if data, err := json.Marshal(request.RateLimit); err == nil {
+			rateLimitJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	body, bodyRefs, err := s.storeBody(tx, bodyJSON)
+	if err != nil {
+		return "", err
+	}
+
 	query := `
-		INSERT INTO requests (id, timestamp, method, endpoint, headers, body, user_agent, content_type, model, original_model, routed_model, provider, subagent_name, tools_used, tool_call_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO requests (id, timestamp, method, endpoint, headers, body, user_agent, content_type, model, original_model, routed_model, provider, subagent_name, tools_used, tool_call_count, rate_limit, routing_rule, experiment_id, experiment_arm, project_path, plugins, redactions, cache_breakpoints, body_refs, body_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = s.db.Exec(query,
+	_, err = tx.Exec(query,
 		request.RequestID,
 		request.Timestamp,
 		request.Method,
 		request.Endpoint,
 		string(headersJSON),
-		string(bodyJSON),
+		body,
 		request.UserAgent,
 		request.ContentType,
 		request.Model,
@@ -371,15 +619,156 @@ func (s *SQLiteStorageService) SaveRequest(request *model.RequestLog) (string, e
 		request.SubagentName,
 		string(toolsUsedJSON),
 		request.ToolCallCount,
+		rateLimitJSON,
+		sql.NullString{String: request.RoutingRule, Valid: request.RoutingRule != ""},
+		sql.NullString{String: request.Experiment, Valid: request.Experiment != ""},
+		sql.NullString{String: request.ExperimentArm, Valid: request.ExperimentArm != ""},
+		sql.NullString{String: request.ProjectPath, Valid: request.ProjectPath != ""},
+		pluginsJSON,
+		redactionsJSON,
+		request.Breakpoints,
+		bodyRefs,
+		len(bodyJSON),
 	)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to insert request: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit request: %w", err)
+	}
+
+	// Results of the tool calls made in the previous turn
+	if err := saveToolResults(s.db, toolResultsFromRequest(request, bodyJSON)); err != nil {
+		log.Printf("⚠️  Error saving tool results: %v", err)
+	}
 
 	return request.RequestID, nil
 }
 
+// marshalRedactions encodes per-detector redaction counts for the
+// redactions column, or NULL when nothing was redacted
+func marshalRedactions(counts map[string]int) sql.NullString {
+	if len(counts) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// requestColumns are the requests columns scanRequestRow reads, in order
+const requestColumns = `id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model, provider, hedge, queue, rate_limit, routing_rule, experiment_id, experiment_arm, project_path, plugins, redactions, cache_breakpoints, body_refs`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRequestRow reads one row of requestColumns into a RequestLog,
+// reassembling the body from its blobs
+func scanRequestRow(row rowScanner, bodies *bodyAssembler) (*model.RequestLog, error) {
+	var req model.RequestLog
+	var headersJSON, bodyJSON string
+	var promptGradeJSON, responseJSON, providerName, hedgeJSON, queueJSON, rateLimitJSON, routingRule, experimentID, experimentArm, projectPath, pluginsJSON, redactionsJSON, bodyRefs sql.NullString
+	var breakpoints sql.NullInt64
+
+	err := row.Scan(
+		&req.RequestID,
+		&req.Timestamp,
+		&req.Method,
+		&req.Endpoint,
+		&headersJSON,
+		&bodyJSON,
+		&req.Model,
+		&req.UserAgent,
+		&req.ContentType,
+		&promptGradeJSON,
+		&responseJSON,
+		&req.OriginalModel,
+		&req.RoutedModel,
+		&providerName,
+		&hedgeJSON,
+		&queueJSON,
+		&rateLimitJSON,
+		&routingRule,
+		&experimentID,
+		&experimentArm,
+		&projectPath,
+		&pluginsJSON,
+		&redactionsJSON,
+		&breakpoints,
+		&bodyRefs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal JSON fields
+	if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal headers of request %s: %w", req.RequestID, err)
+	}
+
+	fullBody, err := bodies.assemble(bodyJSON, bodyRefs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble body of request %s: %w", req.RequestID, err)
+	}
+	var body interface{}
+	if err := json.Unmarshal(fullBody, &body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body of request %s: %w", req.RequestID, err)
+	}
+	req.Body = body
+
+	if promptGradeJSON.Valid {
+		var grade model.PromptGrade
+		if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
+			req.PromptGrade = &grade
+		}
+	}
+
+	if responseJSON.Valid {
+		var resp model.ResponseLog
+		if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
+			req.Response = &resp
+		}
+	}
+
+	if hedgeJSON.Valid {
+		var hedge model.HedgeInfo
+		if err := json.Unmarshal([]byte(hedgeJSON.String), &hedge); err == nil {
+			req.Hedge = &hedge
+		}
+	}
+	if queueJSON.Valid {
+		var queue model.QueueInfo
+		if err := json.Unmarshal([]byte(queueJSON.String), &queue); err == nil {
+			req.Queue = &queue
+		}
+	}
+	if rateLimitJSON.Valid {
+		var rateLimit model.RateLimitInfo
+		if err := json.Unmarshal([]byte(rateLimitJSON.String), &rateLimit); err == nil {
+			req.RateLimit = &rateLimit
+		}
+	}
+	req.Provider = providerName.String
+	req.RoutingRule = routingRule.String
+	req.Experiment = experimentID.String
+	req.ExperimentArm = experimentArm.String
+	req.ProjectPath = projectPath.String
+	if pluginsJSON.Valid {
+		json.Unmarshal([]byte(pluginsJSON.String), &req.Plugins)
+	}
+	if redactionsJSON.Valid {
+		json.Unmarshal([]byte(redactionsJSON.String), &req.Redactions)
+	}
+	req.Breakpoints = int(breakpoints.Int64)
+
+	return &req, nil
+}
+
 func (s *SQLiteStorageService) GetRequests(page, limit int) ([]model.RequestLog, int, error) {
 	// Get total count
 	var total int
@@ -391,7 +780,7 @@ func (s *SQLiteStorageService) GetRequests(page, limit int) ([]model.RequestLog,
 	// Get paginated results
 	offset := (page - 1) * limit
 	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+		SELECT ` + requestColumns + `
 		FROM requests
 		ORDER BY timestamp DESC
 		LIMIT ? OFFSET ?
@@ -403,75 +792,43 @@ func (s *SQLiteStorageService) GetRequests(page, limit int) ([]model.RequestLog,
 	}
 	defer rows.Close()
 
+	bodies := newBodyAssembler(s.db)
 	var requests []model.RequestLog
 	for rows.Next() {
-		var req model.RequestLog
-		var headersJSON, bodyJSON string
-		var promptGradeJSON, responseJSON sql.NullString
-
-		err := rows.Scan(
-			&req.RequestID,
-			&req.Timestamp,
-			&req.Method,
-			&req.Endpoint,
-			&headersJSON,
-			&bodyJSON,
-			&req.Model,
-			&req.UserAgent,
-			&req.ContentType,
-			&promptGradeJSON,
-			&responseJSON,
-			&req.OriginalModel,
-			&req.RoutedModel,
-		)
+		req, err := scanRequestRow(rows, bodies)
 		if err != nil {
-			// Error scanning row - skip
-			continue
-		}
-
-		// Unmarshal JSON fields
-		if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-			// Error unmarshaling headers
+			log.Printf("⚠️  Skipping unreadable request: %v", err)
 			continue
 		}
-
-		var body interface{}
-		if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-			// Error unmarshaling body
-			continue
-		}
-		req.Body = body
-
-		if promptGradeJSON.Valid {
-			var grade model.PromptGrade
-			if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-				req.PromptGrade = &grade
-			}
-		}
-
-		if responseJSON.Valid {
-			var resp model.ResponseLog
-			if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-				req.Response = &resp
-			}
-		}
-
-		requests = append(requests, req)
+		requests = append(requests, *req)
 	}
 
 	return requests, total, nil
 }
 
 func (s *SQLiteStorageService) ClearRequests() (int, error) {
-	result, err := s.db.Exec("DELETE FROM requests")
+	// One transaction, so a request saved meanwhile can't lose its blobs
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM requests")
 	if err != nil {
 		return 0, fmt.Errorf("failed to clear requests: %w", err)
 	}
+	if _, err := tx.Exec("DELETE FROM body_blobs"); err != nil {
+		return 0, fmt.Errorf("failed to clear body blobs: %w", err)
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit clearing requests: %w", err)
+	}
 
 	return int(rowsAffected), nil
 }
@@ -497,6 +854,11 @@ func (s *SQLiteStorageService) UpdateRequestWithResponse(request *model.RequestL
 		return fmt.Errorf("failed to marshal response: %w", err)
 	}
 
+	// Mask secrets in the response (and tool calls) before it reaches disk
+	responseJSON, counts := s.redactor.RedactJSON(responseJSON)
+	recordRedactions("response", counts)
+	request.Redactions = mergeRedactions(request.Redactions, counts)
+
 	// Extract token counts and timing from response for indexed columns
 	var inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens int
 	var responseTimeMs, firstByteTimeMs int64
@@ -521,6 +883,20 @@ func (s *SQLiteStorageService) UpdateRequestWithResponse(request *model.RequestL
 		}
 	}
 
+	// Hedge and queue details, and the provider a hedge won on, are only
+	// known once the request has been forwarded
+	var hedgeJSON, queueJSON sql.NullString
+	if request.Hedge != nil {
+		if data, err := json.Marshal(request.Hedge); err == nil {
+			hedgeJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+	if request.Queue != nil {
+		if data, err := json.Marshal(request.Queue); err == nil {
+			queueJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+
 	query := `UPDATE requests SET
 		response = ?,
 		input_tokens = ?,
@@ -529,7 +905,12 @@ func (s *SQLiteStorageService) UpdateRequestWithResponse(request *model.RequestL
 		cache_creation_tokens = ?,
 		response_time_ms = ?,
 		first_byte_time_ms = ?,
-		tool_call_count = ?
+		tool_call_count = ?,
+		hedge = ?,
+		queue = ?,
+		provider = COALESCE(NULLIF(?, ''), provider),
+		routed_model = COALESCE(NULLIF(?, ''), routed_model),
+		redactions = COALESCE(?, redactions)
 		WHERE id = ?`
 
 	_, err = s.db.Exec(query,
@@ -541,12 +922,25 @@ func (s *SQLiteStorageService) UpdateRequestWithResponse(request *model.RequestL
 		responseTimeMs,
 		firstByteTimeMs,
 		toolCallCount,
+		hedgeJSON,
+		queueJSON,
+		request.Provider,
+		request.RoutedModel,
+		marshalRedactions(request.Redactions),
 		request.RequestID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update request with response: %w", err)
 	}
 
+	// Tool calls the response made, with their inputs as redacted above
+	var redactedResponse model.ResponseLog
+	if err := json.Unmarshal(responseJSON, &redactedResponse); err == nil {
+		if err := saveToolUses(s.db, toolUsesFromResponse(request, &redactedResponse)); err != nil {
+			log.Printf("⚠️  Error saving tool calls: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -557,66 +951,21 @@ func (s *SQLiteStorageService) EnsureDirectoryExists() error {
 
 func (s *SQLiteStorageService) GetRequestByShortID(shortID string) (*model.RequestLog, string, error) {
 	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+		SELECT ` + requestColumns + `
 		FROM requests
 		WHERE id LIKE ?
 		ORDER BY timestamp DESC
 		LIMIT 1
 	`
 
-	var req model.RequestLog
-	var headersJSON, bodyJSON string
-	var promptGradeJSON, responseJSON sql.NullString
-
-	err := s.db.QueryRow(query, "%"+shortID).Scan(
-		&req.RequestID,
-		&req.Timestamp,
-		&req.Method,
-		&req.Endpoint,
-		&headersJSON,
-		&bodyJSON,
-		&req.Model,
-		&req.UserAgent,
-		&req.ContentType,
-		&promptGradeJSON,
-		&responseJSON,
-		&req.OriginalModel,
-		&req.RoutedModel,
-	)
-
+	req, err := scanRequestRow(s.db.QueryRow(query, "%"+shortID), newBodyAssembler(s.db))
 	if err == sql.ErrNoRows {
 		return nil, "", fmt.Errorf("request with ID %s not found", shortID)
 	}
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to query request: %w", err)
 	}
-
-	// Unmarshal JSON fields
-	if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal headers: %w", err)
-	}
-
-	var body interface{}
-	if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal body: %w", err)
-	}
-	req.Body = body
-
-	if promptGradeJSON.Valid {
-		var grade model.PromptGrade
-		if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-			req.PromptGrade = &grade
-		}
-	}
-
-	if responseJSON.Valid {
-		var resp model.ResponseLog
-		if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-			req.Response = &resp
-		}
-	}
-
-	return &req, req.RequestID, nil
+	return req, req.RequestID, nil
 }
 
 func (s *SQLiteStorageService) GetConfig() *config.StorageConfig {
@@ -625,7 +974,7 @@ func (s *SQLiteStorageService) GetConfig() *config.StorageConfig {
 
 func (s *SQLiteStorageService) GetAllRequests(modelFilter string) ([]*model.RequestLog, error) {
 	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+		SELECT ` + requestColumns + `
 		FROM requests
 	`
 	args := []interface{}{}
@@ -644,56 +993,15 @@ func (s *SQLiteStorageService) GetAllRequests(modelFilter string) ([]*model.Requ
 	}
 	defer rows.Close()
 
+	bodies := newBodyAssembler(s.db)
 	var requests []*model.RequestLog
 	for rows.Next() {
-		var req model.RequestLog
-		var headersJSON, bodyJSON string
-		var promptGradeJSON, responseJSON sql.NullString
-
-		err := rows.Scan(
-			&req.RequestID,
-			&req.Timestamp,
-			&req.Method,
-			&req.Endpoint,
-			&headersJSON,
-			&bodyJSON,
-			&req.Model,
-			&req.UserAgent,
-			&req.ContentType,
-			&promptGradeJSON,
-			&responseJSON,
-			&req.OriginalModel,
-			&req.RoutedModel,
-		)
+		req, err := scanRequestRow(rows, bodies)
 		if err != nil {
+			log.Printf("⚠️  Skipping unreadable request: %v", err)
 			continue
 		}
-
-		if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-			continue
-		}
-
-		var body interface{}
-		if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-			continue
-		}
-		req.Body = body
-
-		if promptGradeJSON.Valid {
-			var grade model.PromptGrade
-			if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-				req.PromptGrade = &grade
-			}
-		}
-
-		if responseJSON.Valid {
-			var resp model.ResponseLog
-			if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-				req.Response = &resp
-			}
-		}
-
-		requests = append(requests, &req)
+		requests = append(requests, req)
 	}
 
 	return requests, nil
@@ -785,7 +1093,7 @@ func (s *SQLiteStorageService) GetRequestsSummary(modelFilter string) ([]*model.
 }
 
 // GetRequestsSummaryPaginated returns minimal data for list view with pagination - uses indexed columns
-func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTime, endTime string, offset, limit int) ([]*model.RequestSummary, int, error) {
+func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTime, endTime, project string, offset, limit int) ([]*model.RequestSummary, int, error) {
 	// First get total count
 	countQuery := "SELECT COUNT(*) FROM requests"
 	countArgs := []interface{}{}
@@ -801,6 +1109,11 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 		countArgs = append(countArgs, startTime, endTime)
 	}
 
+	if project != "" {
+		whereClauses = append(whereClauses, "project_path = ?")
+		countArgs = append(countArgs, project)
+	}
+
 	if len(whereClauses) > 0 {
 		countQuery += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
@@ -814,7 +1127,7 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 	query := `
 		SELECT id, timestamp, method, endpoint, model, original_model, routed_model,
 			   provider, subagent_name, tool_call_count, response_time_ms, first_byte_time_ms,
-			   input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens
+			   input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens, project_path
 		FROM requests
 	`
 	args := []interface{}{}
@@ -830,6 +1143,11 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 		args = append(args, startTime, endTime)
 	}
 
+	if project != "" {
+		queryWhereClauses = append(queryWhereClauses, "project_path = ?")
+		args = append(args, project)
+	}
+
 	if len(queryWhereClauses) > 0 {
 		query += " WHERE " + strings.Join(queryWhereClauses, " AND ")
 	}
@@ -854,7 +1172,7 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 	var summaries []*model.RequestSummary
 	for rows.Next() {
 		var sum model.RequestSummary
-		var provider, subagentName sql.NullString
+		var provider, subagentName, projectPath sql.NullString
 		var toolCallCount sql.NullInt64
 		var responseTimeMs, firstByteTimeMs sql.NullInt64
 		var inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens sql.NullInt64
@@ -876,11 +1194,13 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 			&outputTokens,
 			&cacheReadTokens,
 			&cacheCreationTokens,
+			&projectPath,
 		)
 		if err != nil {
 			continue
 		}
 
+		sum.ProjectPath = projectPath.String
 		if provider.Valid {
 			sum.Provider = provider.String
 		}
@@ -914,12 +1234,13 @@ func (s *SQLiteStorageService) GetRequestsSummaryPaginated(modelFilter, startTim
 }
 
 // GetStats returns aggregated statistics for the dashboard - uses SQL aggregation
-func (s *SQLiteStorageService) GetStats(startDate, endDate string) (*model.DashboardStats, error) {
+func (s *SQLiteStorageService) GetStats(startDate, endDate, project string) (*model.DashboardStats, error) {
 	stats := &model.DashboardStats{
 		DailyStats: make([]model.DailyTokens, 0),
 	}
 
 	// SQL aggregation - no JSON parsing needed
+	where, args := statsWhere(startDate, endDate, project)
 	query := `
 		SELECT
 			DATE(timestamp) as date,
@@ -927,12 +1248,12 @@ func (s *SQLiteStorageService) GetStats(startDate, endDate string) (*model.Dashb
 			COUNT(*) as requests,
 			SUM(COALESCE(input_tokens, 0) + COALESCE(output_tokens, 0) + COALESCE(cache_read_tokens, 0) + COALESCE(cache_creation_tokens, 0)) as tokens
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		GROUP BY date, model
 		ORDER BY date
 	`
 
-	rows, err := s.db.Query(query, startDate, endDate)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query stats: %w", err)
 	}
@@ -980,9 +1301,22 @@ func (s *SQLiteStorageService) GetStats(startDate, endDate string) (*model.Dashb
 	return stats, nil
 }
 
+// statsWhere returns the condition the stats queries filter by: the time
+// range, and the project directory when one is given
+func statsWhere(startTime, endTime, project string) (string, []interface{}) {
+	where := "timestamp >= ? AND timestamp < ?"
+	args := []interface{}{startTime, endTime}
+	if project != "" {
+		where += " AND project_path = ?"
+		args = append(args, project)
+	}
+	return where, args
+}
+
 // GetHourlyStats returns hourly breakdown for a specific time range - uses SQL aggregation
-func (s *SQLiteStorageService) GetHourlyStats(startTime, endTime string) (*model.HourlyStatsResponse, error) {
+func (s *SQLiteStorageService) GetHourlyStats(startTime, endTime, project string) (*model.HourlyStatsResponse, error) {
 	// SQL aggregation - no JSON parsing needed
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT
 			CAST(strftime('%H', timestamp) AS INTEGER) as hour,
@@ -992,12 +1326,12 @@ func (s *SQLiteStorageService) GetHourlyStats(startTime, endTime string) (*model
 			SUM(COALESCE(response_time_ms, 0)) as total_response_time,
 			SUM(CASE WHEN response_time_ms > 0 THEN 1 ELSE 0 END) as response_count
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		GROUP BY hour, model
 		ORDER BY hour
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query hourly stats: %w", err)
 	}
@@ -1066,20 +1400,21 @@ func (s *SQLiteStorageService) GetHourlyStats(startTime, endTime string) (*model
 }
 
 // GetModelStats returns model breakdown for a specific time range - uses SQL aggregation
-func (s *SQLiteStorageService) GetModelStats(startTime, endTime string) (*model.ModelStatsResponse, error) {
+func (s *SQLiteStorageService) GetModelStats(startTime, endTime, project string) (*model.ModelStatsResponse, error) {
 	// SQL aggregation - no JSON parsing needed
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT
 			COALESCE(model, 'unknown') as model,
 			COUNT(*) as requests,
 			SUM(COALESCE(input_tokens, 0) + COALESCE(output_tokens, 0) + COALESCE(cache_read_tokens, 0) + COALESCE(cache_creation_tokens, 0)) as tokens
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		GROUP BY model
 		ORDER BY tokens DESC
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query model stats: %w", err)
 	}
@@ -1132,7 +1467,8 @@ func (s *SQLiteStorageService) Close() error {
 }
 
 // GetProviderStats returns analytics broken down by provider
-func (s *SQLiteStorageService) GetProviderStats(startTime, endTime string) (*model.ProviderStatsResponse, error) {
+func (s *SQLiteStorageService) GetProviderStats(startTime, endTime, project string) (*model.ProviderStatsResponse, error) {
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT
 			COALESCE(provider, 'unknown') as provider,
@@ -1141,11 +1477,11 @@ func (s *SQLiteStorageService) GetProviderStats(startTime, endTime string) (*mod
 			SUM(output_tokens) as output_tokens,
 			AVG(response_time_ms) as avg_response_ms
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		GROUP BY provider
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query provider stats: %w", err)
 	}
@@ -1182,8 +1518,87 @@ func (s *SQLiteStorageService) GetProviderStats(startTime, endTime string) (*mod
 	}, nil
 }
 
+// GetPromptCachingStats compares cache reads and writes between requests the
+// prompt-caching optimizer added breakpoints to and those it did not
+func (s *SQLiteStorageService) GetPromptCachingStats(startTime, endTime, project string) (*model.PromptCachingStatsResponse, error) {
+	where, args := statsWhere(startTime, endTime, project)
+	query := `
+		SELECT
+			COALESCE(cache_breakpoints, 0) > 0 as optimized,
+			COUNT(*) as requests,
+			SUM(COALESCE(input_tokens, 0)) as input_tokens,
+			SUM(COALESCE(cache_read_tokens, 0)) as cache_read_tokens,
+			SUM(COALESCE(cache_creation_tokens, 0)) as cache_creation_tokens
+		FROM requests
+		WHERE ` + where + `
+		GROUP BY optimized
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prompt caching stats: %w", err)
+	}
+	defer rows.Close()
+
+	response := &model.PromptCachingStatsResponse{
+		StartTime: startTime,
+		EndTime:   endTime,
+	}
+	for rows.Next() {
+		var optimized bool
+		var stat model.PromptCachingStats
+		if err := rows.Scan(&optimized, &stat.Requests, &stat.InputTokens, &stat.CacheReadTokens, &stat.CacheCreationTokens); err != nil {
+			continue
+		}
+		if total := stat.InputTokens + stat.CacheReadTokens + stat.CacheCreationTokens; total > 0 {
+			stat.CacheReadRatio = float64(stat.CacheReadTokens) / float64(total)
+		}
+		if optimized {
+			response.Optimized = stat
+		} else {
+			response.Unoptimized = stat
+		}
+	}
+
+	return response, nil
+}
+
 // GetSubagentStats returns analytics broken down by subagent
-func (s *SQLiteStorageService) GetSubagentStats(startTime, endTime string) (*model.SubagentStatsResponse, error) {
+// GetBodyStorageStats reports how much space deduplicating request bodies saves
+func (s *SQLiteStorageService) GetBodyStorageStats() (*model.BodyStorageStats, error) {
+	stats := &model.BodyStorageStats{}
+
+	err := s.db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN body_refs IS NOT NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN body_size > 0 THEN body_size ELSE length(CAST(body AS BLOB)) END), 0),
+			COALESCE(SUM(length(CAST(body AS BLOB)) + COALESCE(length(CAST(body_refs AS BLOB)), 0)), 0)
+		FROM requests
+	`).Scan(&stats.Requests, &stats.DedupedRequests, &stats.FullBytes, &stats.StoredBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query request body sizes: %w", err)
+	}
+
+	var blobStored int64
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(length(data)), 0)
+		FROM body_blobs
+	`).Scan(&stats.Blobs, &stats.BlobBytes, &blobStored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query body blob sizes: %w", err)
+	}
+
+	stats.StoredBytes += blobStored
+	stats.SavedBytes = stats.FullBytes - stats.StoredBytes
+	if stats.FullBytes > 0 {
+		stats.SavingsRatio = float64(stats.SavedBytes) / float64(stats.FullBytes)
+	}
+	return stats, nil
+}
+
+func (s *SQLiteStorageService) GetSubagentStats(startTime, endTime, project string) (*model.SubagentStatsResponse, error) {
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT
 			COALESCE(subagent_name, '') as subagent_name,
@@ -1194,12 +1609,12 @@ func (s *SQLiteStorageService) GetSubagentStats(startTime, endTime string) (*mod
 			SUM(output_tokens) as output_tokens,
 			AVG(response_time_ms) as avg_response_ms
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		  AND subagent_name IS NOT NULL AND subagent_name != ''
 		GROUP BY subagent_name, provider, target_model
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query subagent stats: %w", err)
 	}
@@ -1237,15 +1652,16 @@ func (s *SQLiteStorageService) GetSubagentStats(startTime, endTime string) (*mod
 }
 
 // GetToolStats returns analytics broken down by tool usage
-func (s *SQLiteStorageService) GetToolStats(startTime, endTime string) (*model.ToolStatsResponse, error) {
+func (s *SQLiteStorageService) GetToolStats(startTime, endTime, project string) (*model.ToolStatsResponse, error) {
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT tools_used, tool_call_count
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		  AND tools_used IS NOT NULL AND tools_used != '[]' AND tools_used != 'null'
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tool stats: %w", err)
 	}
@@ -1296,7 +1712,8 @@ func (s *SQLiteStorageService) GetToolStats(startTime, endTime string) (*model.T
 }
 
 // GetPerformanceStats returns response time analytics by provider/model
-func (s *SQLiteStorageService) GetPerformanceStats(startTime, endTime string) (*model.PerformanceStatsResponse, error) {
+func (s *SQLiteStorageService) GetPerformanceStats(startTime, endTime, project string) (*model.PerformanceStatsResponse, error) {
+	where, args := statsWhere(startTime, endTime, project)
 	query := `
 		SELECT
 			COALESCE(provider, 'unknown') as provider,
@@ -1304,12 +1721,12 @@ func (s *SQLiteStorageService) GetPerformanceStats(startTime, endTime string) (*
 			response_time_ms,
 			first_byte_time_ms
 		FROM requests
-		WHERE timestamp >= ? AND timestamp < ?
+		WHERE ` + where + `
 		  AND response_time_ms > 0
 		ORDER BY provider, model
 	`
 
-	rows, err := s.db.Query(query, startTime, endTime)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query performance stats: %w", err)
 	}
@@ -1373,6 +1790,126 @@ func (s *SQLiteStorageService) GetPerformanceStats(startTime, endTime string) (*
 	}, nil
 }
 
+// GetExperimentResults compares the arms of an experiment. startTime and
+// endTime are optional.
+func (s *SQLiteStorageService) GetExperimentResults(experimentID, startTime, endTime string) (*model.ExperimentResults, error) {
+	query := `
+		SELECT
+			COALESCE(experiment_arm, '') as experiment_arm,
+			response,
+			input_tokens,
+			output_tokens,
+			response_time_ms,
+			first_byte_time_ms,
+			tool_call_count
+		FROM requests
+		WHERE experiment_id = ?
+	`
+	args := []interface{}{experimentID}
+	if startTime != "" {
+		query += " AND timestamp >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != "" {
+		query += " AND timestamp < ?"
+		args = append(args, endTime)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiment results: %w", err)
+	}
+	defer rows.Close()
+
+	arms := make(map[string]*model.ExperimentArmResults)
+	var armOrder []string
+	responseTimes := make(map[string][]int64)
+	firstByteTimes := make(map[string][]int64)
+
+	for rows.Next() {
+		var arm string
+		var responseJSON sql.NullString
+		var inputTokens, outputTokens, responseTimeMs, firstByteTimeMs, toolCalls int64
+
+		if err := rows.Scan(&arm, &responseJSON, &inputTokens, &outputTokens, &responseTimeMs, &firstByteTimeMs, &toolCalls); err != nil {
+			continue
+		}
+
+		stat := arms[arm]
+		if stat == nil {
+			stat = &model.ExperimentArmResults{Arm: arm, StopReasons: make(map[string]int)}
+			arms[arm] = stat
+			armOrder = append(armOrder, arm)
+		}
+		stat.Requests++
+
+		// Requests still in flight (or that never got a response) have no
+		// outcome to compare yet
+		if !responseJSON.Valid {
+			continue
+		}
+		var resp struct {
+			StatusCode int             `json:"statusCode"`
+			Body       json.RawMessage `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(responseJSON.String), &resp); err != nil {
+			continue
+		}
+
+		stat.Completed++
+		stat.InputTokens += inputTokens
+		stat.OutputTokens += outputTokens
+		stat.ToolCalls += toolCalls
+		if resp.StatusCode >= 400 {
+			stat.Errors++
+			continue
+		}
+
+		var body struct {
+			StopReason string `json:"stop_reason"`
+		}
+		if json.Unmarshal(resp.Body, &body) == nil && body.StopReason != "" {
+			stat.StopReasons[body.StopReason]++
+		}
+		if responseTimeMs > 0 {
+			responseTimes[arm] = append(responseTimes[arm], responseTimeMs)
+		}
+		if firstByteTimeMs > 0 {
+			firstByteTimes[arm] = append(firstByteTimes[arm], firstByteTimeMs)
+		}
+	}
+
+	results := &model.ExperimentResults{
+		ExperimentID: experimentID,
+		Arms:         []model.ExperimentArmResults{},
+		StartTime:    startTime,
+		EndTime:      endTime,
+	}
+	for _, arm := range armOrder {
+		stat := arms[arm]
+		if stat.Completed > 0 {
+			completed := float64(stat.Completed)
+			stat.ErrorRate = float64(stat.Errors) / completed
+			stat.AvgInputTokens = float64(stat.InputTokens) / completed
+			stat.AvgOutputTokens = float64(stat.OutputTokens) / completed
+			stat.AvgToolCalls = float64(stat.ToolCalls) / completed
+		}
+		if times := responseTimes[arm]; len(times) > 0 {
+			sortedTimes := make([]int64, len(times))
+			copy(sortedTimes, times)
+			sortInt64Slice(sortedTimes)
+			stat.AvgResponseMs = avgInt64(times)
+			stat.P50ResponseMs = percentileInt64(sortedTimes, 50)
+			stat.P95ResponseMs = percentileInt64(sortedTimes, 95)
+		}
+		if times := firstByteTimes[arm]; len(times) > 0 {
+			stat.AvgFirstByteMs = avgInt64(times)
+		}
+		results.Arms = append(results.Arms, *stat)
+	}
+	return results, nil
+}
+
 // Helper functions for statistics
 func sortInt64Slice(s []int64) {
 	for i := 0; i < len(s)-1; i++ {
@@ -1905,7 +2442,294 @@ func (s *SQLiteStorageService) ReindexConversations() error {
 	return nil
 }
 
+// healthCheckHistoryLimit is how many probe results are kept per provider
+const healthCheckHistoryLimit = 500
+
+// SaveHealthCheck records a probe result and trims the provider's history
+func (s *SQLiteStorageService) SaveHealthCheck(check *model.ProviderHealthCheck) error {
+	result, err := s.db.Exec(`
+		INSERT INTO provider_health_checks (provider, method, checked_at, success, status_code, latency_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, check.Provider, check.Method, check.CheckedAt.UTC().Format(time.RFC3339Nano), check.Success, check.StatusCode, check.LatencyMs, check.Error)
+	if err != nil {
+		return fmt.Errorf("failed to save health check: %w", err)
+	}
+	check.ID, _ = result.LastInsertId()
+
+	_, err = s.db.Exec(`
+		DELETE FROM provider_health_checks
+		WHERE provider = ? AND id NOT IN (
+			SELECT id FROM provider_health_checks WHERE provider = ? ORDER BY id DESC LIMIT ?
+		)
+	`, check.Provider, check.Provider, healthCheckHistoryLimit)
+	if err != nil {
+		return fmt.Errorf("failed to trim health check history: %w", err)
+	}
+	return nil
+}
+
+// GetHealthChecks returns the most recent probe results for a provider, newest first
+func (s *SQLiteStorageService) GetHealthChecks(provider string, limit int) ([]*model.ProviderHealthCheck, error) {
+	rows, err := s.db.Query(`
+		SELECT id, provider, method, checked_at, success, status_code, latency_ms, error
+		FROM provider_health_checks
+		WHERE provider = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, provider, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health checks: %w", err)
+	}
+	defer rows.Close()
+
+	checks := make([]*model.ProviderHealthCheck, 0)
+	for rows.Next() {
+		var check model.ProviderHealthCheck
+		var checkedAt string
+		var errText sql.NullString
+		if err := rows.Scan(&check.ID, &check.Provider, &check.Method, &checkedAt, &check.Success, &check.StatusCode, &check.LatencyMs, &errText); err != nil {
+			return nil, fmt.Errorf("failed to scan health check: %w", err)
+		}
+		check.CheckedAt, _ = time.Parse(time.RFC3339Nano, checkedAt)
+		check.Error = errText.String
+		checks = append(checks, &check)
+	}
+	return checks, rows.Err()
+}
+
+// SaveConfigRevision records a config.yaml revision
+func (s *SQLiteStorageService) SaveConfigRevision(revision *model.ConfigRevision) error {
+	result, err := s.db.Exec(`
+		INSERT INTO config_revisions (created_at, author, summary, content)
+		VALUES (?, ?, ?, ?)
+	`, revision.CreatedAt.UTC().Format(time.RFC3339Nano), revision.Author, revision.Summary, revision.Content)
+	if err != nil {
+		return fmt.Errorf("failed to save config revision: %w", err)
+	}
+	revision.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetConfigRevisions returns the most recent config revisions, newest first,
+// without their content
+func (s *SQLiteStorageService) GetConfigRevisions(limit int) ([]*model.ConfigRevision, error) {
+	rows, err := s.db.Query(`
+		SELECT id, created_at, author, summary
+		FROM config_revisions
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := make([]*model.ConfigRevision, 0)
+	for rows.Next() {
+		var revision model.ConfigRevision
+		var createdAt string
+		var author, summary sql.NullString
+		if err := rows.Scan(&revision.ID, &createdAt, &author, &summary); err != nil {
+			return nil, fmt.Errorf("failed to scan config revision: %w", err)
+		}
+		revision.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		revision.Author = author.String
+		revision.Summary = summary.String
+		revisions = append(revisions, &revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetConfigRevision returns a config revision including its content, or nil
+// if it does not exist
+func (s *SQLiteStorageService) GetConfigRevision(id int64) (*model.ConfigRevision, error) {
+	var revision model.ConfigRevision
+	var createdAt string
+	var author, summary sql.NullString
+	err := s.db.QueryRow(`
+		SELECT id, created_at, author, summary, content
+		FROM config_revisions
+		WHERE id = ?
+	`, id).Scan(&revision.ID, &createdAt, &author, &summary, &revision.Content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config revision: %w", err)
+	}
+	revision.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	revision.Author = author.String
+	revision.Summary = summary.String
+	return &revision, nil
+}
+
 // GetDB returns the underlying database connection for internal package use only
 func (s *SQLiteStorageService) GetDB() *sql.DB {
 	return s.db
 }
+
+// SaveToolPolicyHits records tool calls matched by tool policies. Inputs are
+// redacted like request bodies.
+func (s *SQLiteStorageService) SaveToolPolicyHits(hits []*model.ToolPolicyHit) error {
+	for _, hit := range hits {
+		input, counts := s.redactor.RedactJSON(hit.Input)
+		recordRedactions("tool_policy", counts)
+
+		result, err := s.db.Exec(`
+			INSERT INTO tool_policy_hits (request_id, timestamp, policy, action, tool_name, tool_use_id, input, provider, model, subagent_name, project_path)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, hit.RequestID, hit.Timestamp.UTC().Format(time.RFC3339Nano), hit.Policy, hit.Action, hit.ToolName, hit.ToolUseID, string(input), hit.Provider, hit.Model, hit.SubagentName, hit.ProjectPath)
+		if err != nil {
+			return fmt.Errorf("failed to save tool policy hit: %w", err)
+		}
+		hit.ID, _ = result.LastInsertId()
+	}
+	return nil
+}
+
+// GetToolPolicyHits returns the tool policy hits matching a filter, newest
+// first
+func (s *SQLiteStorageService) GetToolPolicyHits(filter model.ToolPolicyHitFilter) ([]*model.ToolPolicyHit, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Policy != "" {
+		conditions = append(conditions, "policy = ?")
+		args = append(args, filter.Policy)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, "request_id = ?")
+		args = append(args, filter.RequestID)
+	}
+	if filter.StartTime != "" {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.StartTime)
+	}
+	if filter.EndTime != "" {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, filter.EndTime)
+	}
+
+	query := `
+		SELECT id, request_id, timestamp, policy, action, tool_name, tool_use_id, input, provider, model, subagent_name, project_path
+		FROM tool_policy_hits
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY timestamp DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool policy hits: %w", err)
+	}
+	defer rows.Close()
+
+	hits := make([]*model.ToolPolicyHit, 0)
+	for rows.Next() {
+		var hit model.ToolPolicyHit
+		var timestamp string
+		var toolUseID, input, provider, modelName, subagentName, projectPath sql.NullString
+		if err := rows.Scan(&hit.ID, &hit.RequestID, &timestamp, &hit.Policy, &hit.Action, &hit.ToolName, &toolUseID, &input, &provider, &modelName, &subagentName, &projectPath); err != nil {
+			return nil, fmt.Errorf("failed to scan tool policy hit: %w", err)
+		}
+		hit.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+		hit.ToolUseID = toolUseID.String
+		if input.Valid && input.String != "" {
+			hit.Input = json.RawMessage(input.String)
+		}
+		hit.Provider = provider.String
+		hit.Model = modelName.String
+		hit.SubagentName = subagentName.String
+		hit.ProjectPath = projectPath.String
+		hits = append(hits, &hit)
+	}
+	return hits, rows.Err()
+}
+
+// GetToolCalls returns the tool calls matching a filter, newest first, with
+// the total number that match
+func (s *SQLiteStorageService) GetToolCalls(filter model.ToolCallFilter) ([]*model.ToolCall, int, error) {
+	var conditions []string
+	var args []interface{}
+	for column, value := range map[string]string{
+		"tool_name":     filter.ToolName,
+		"provider":      filter.Provider,
+		"model":         filter.Model,
+		"subagent_name": filter.SubagentName,
+		"session_id":    filter.SessionID,
+		"project_path":  filter.ProjectPath,
+	} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if filter.StartTime != "" {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.StartTime)
+	}
+	if filter.EndTime != "" {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, filter.EndTime)
+	}
+	if filter.IsError != nil {
+		conditions = append(conditions, "has_result = 1 AND is_error = ?")
+		args = append(args, *filter.IsError)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM tool_calls"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+
+	query := `
+		SELECT id, tool_use_id, request_id, result_request_id, timestamp, session_id, subagent_name, provider, model, project_path,
+			tool_name, input, has_result, is_error, result_size, result_at, source
+		FROM tool_calls` + where + `
+		ORDER BY timestamp DESC, id DESC`
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	calls := make([]*model.ToolCall, 0)
+	for rows.Next() {
+		var call model.ToolCall
+		var requestID, resultRequestID, sessionID, subagentName, provider, modelName, projectPath, input, resultAt sql.NullString
+		if err := rows.Scan(&call.ID, &call.ToolUseID, &requestID, &resultRequestID, &call.Timestamp, &sessionID, &subagentName, &provider, &modelName, &projectPath,
+			&call.ToolName, &input, &call.HasResult, &call.IsError, &call.ResultSize, &resultAt, &call.Source); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan tool call: %w", err)
+		}
+		call.RequestID = requestID.String
+		call.ResultRequestID = resultRequestID.String
+		call.SessionID = sessionID.String
+		call.SubagentName = subagentName.String
+		call.Provider = provider.String
+		call.Model = modelName.String
+		call.ProjectPath = projectPath.String
+		if input.Valid {
+			call.Input = json.RawMessage(input.String)
+		}
+		call.ResultAt = resultAt.String
+		calls = append(calls, &call)
+	}
+	return calls, total, rows.Err()
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// toolBlock is the part of a tool_use or tool_result content block the
+// tool call audit records
+type toolBlock struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	IsError   bool            `json:"is_error"`
+	Content   json.RawMessage `json:"content"`
+}
+
+type toolMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// sqlExecer is a *sql.DB or *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// contentBlocks decodes a message's content blocks; string content has none
+func contentBlocks(content json.RawMessage) []toolBlock {
+	var blocks []toolBlock
+	if len(content) == 0 || content[0] != '[' {
+		return nil
+	}
+	json.Unmarshal(content, &blocks)
+	return blocks
+}
+
+// toolResultSize is the size of a tool_result's content: the text of string
+// content or text blocks, plus the encoded size of any other blocks
+func toolResultSize(content json.RawMessage) int {
+	if len(content) == 0 {
+		return 0
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return len(text)
+	}
+	var blocks []json.RawMessage
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return len(content)
+	}
+	size := 0
+	for _, raw := range blocks {
+		var block struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(raw, &block) == nil && block.Type == "text" {
+			size += len(block.Text)
+		} else {
+			size += len(raw)
+		}
+	}
+	return size
+}
+
+// sessionFromUserID returns the session part of Claude Code's
+// metadata.user_id ("user_<hash>_account_<uuid>_session_<uuid>"), which is
+// also the ID of the conversation file, or the whole user_id otherwise
+func sessionFromUserID(userID string) string {
+	if i := strings.LastIndex(userID, "_session_"); i >= 0 {
+		return userID[i+len("_session_"):]
+	}
+	return userID
+}
+
+// toolResultsFromRequest returns the results a request sends back: the
+// tool_result blocks of its last message, named after the tool_use blocks
+// of the assistant turn before it
+func toolResultsFromRequest(request *model.RequestLog, bodyJSON []byte) []*model.ToolCall {
+	var body struct {
+		Metadata *struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+		Messages []toolMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(bodyJSON, &body); err != nil || len(body.Messages) == 0 {
+		return nil
+	}
+	last := body.Messages[len(body.Messages)-1]
+	if last.Role != "user" {
+		return nil
+	}
+
+	uses := make(map[string]toolBlock)
+	if len(body.Messages) >= 2 {
+		for _, block := range contentBlocks(body.Messages[len(body.Messages)-2].Content) {
+			if block.Type == "tool_use" {
+				uses[block.ID] = block
+			}
+		}
+	}
+	var sessionID string
+	if body.Metadata != nil {
+		sessionID = sessionFromUserID(body.Metadata.UserID)
+	}
+
+	var results []*model.ToolCall
+	for _, block := range contentBlocks(last.Content) {
+		if block.Type != "tool_result" || block.ToolUseID == "" {
+			continue
+		}
+		use := uses[block.ToolUseID]
+		results = append(results, &model.ToolCall{
+			ToolUseID:       block.ToolUseID,
+			ResultRequestID: request.RequestID,
+			Timestamp:       request.Timestamp,
+			SessionID:       sessionID,
+			SubagentName:    request.SubagentName,
+			ProjectPath:     request.ProjectPath,
+			ToolName:        use.Name,
+			Input:           use.Input,
+			HasResult:       true,
+			IsError:         block.IsError,
+			ResultSize:      toolResultSize(block.Content),
+			ResultAt:        request.Timestamp,
+			Source:          "proxy",
+		})
+	}
+	return results
+}
+
+// toolUsesFromResponse returns the tool_use blocks of a response, whether
+// it was streamed or not
+func toolUsesFromResponse(request *model.RequestLog, response *model.ResponseLog) []*model.ToolCall {
+	if response == nil || response.StatusCode != 200 {
+		return nil
+	}
+
+	var blocks []toolBlock
+	if response.IsStreaming {
+		blocks = toolUsesFromStream(response.StreamingChunks)
+	} else if len(response.Body) > 0 {
+		var body struct {
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(response.Body, &body); err == nil {
+			blocks = contentBlocks(body.Content)
+		}
+	}
+
+	timestamp := response.CompletedAt
+	if timestamp == "" {
+		timestamp = request.Timestamp
+	}
+	sessionID := sessionFromUserID(requestUserID(request.Body))
+
+	var uses []*model.ToolCall
+	for _, block := range blocks {
+		if block.Type != "tool_use" || block.ID == "" {
+			continue
+		}
+		uses = append(uses, &model.ToolCall{
+			ToolUseID:    block.ID,
+			RequestID:    request.RequestID,
+			Timestamp:    timestamp,
+			SessionID:    sessionID,
+			SubagentName: request.SubagentName,
+			Provider:     request.Provider,
+			Model:        request.RoutedModel,
+			ProjectPath:  request.ProjectPath,
+			ToolName:     block.Name,
+			Input:        block.Input,
+			Source:       "proxy",
+		})
+	}
+	return uses
+}
+
+// toolUsesFromStream rebuilds the tool_use blocks of a streamed response
+// from its "data:" events
+func toolUsesFromStream(chunks []string) []toolBlock {
+	var blocks []toolBlock
+	byIndex := make(map[int]int)
+	inputs := make(map[int]*strings.Builder)
+	for _, chunk := range chunks {
+		var event struct {
+			Type         string     `json:"type"`
+			Index        int        `json:"index"`
+			ContentBlock *toolBlock `json:"content_block"`
+			Delta        *struct {
+				Type        string `json:"type"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(chunk, "data:"))
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				byIndex[event.Index] = len(blocks)
+				inputs[event.Index] = &strings.Builder{}
+				blocks = append(blocks, *event.ContentBlock)
+			}
+		case "content_block_delta":
+			if input, ok := inputs[event.Index]; ok && event.Delta != nil && event.Delta.Type == "input_json_delta" {
+				input.WriteString(event.Delta.PartialJSON)
+			}
+		}
+	}
+	for index, i := range byIndex {
+		if input := inputs[index].String(); input != "" && json.Valid([]byte(input)) {
+			blocks[i].Input = json.RawMessage(input)
+		}
+	}
+	return blocks
+}
+
+// requestUserID returns metadata.user_id of a logged request body
+func requestUserID(body interface{}) string {
+	switch req := body.(type) {
+	case model.AnthropicRequest:
+		if req.Metadata != nil {
+			return req.Metadata.UserID
+		}
+		return ""
+	case *model.AnthropicRequest:
+		if req != nil && req.Metadata != nil {
+			return req.Metadata.UserID
+		}
+		return ""
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return ""
+	}
+	var decoded struct {
+		Metadata *struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+	}
+	if json.Unmarshal(data, &decoded) != nil || decoded.Metadata == nil {
+		return ""
+	}
+	return decoded.Metadata.UserID
+}
+
+// saveToolUses records emitted tool calls. A call seen before (from the
+// other source, or from its result) only has its blank fields filled in.
+func saveToolUses(db sqlExecer, calls []*model.ToolCall) error {
+	for _, call := range calls {
+		_, err := db.Exec(`
+			INSERT INTO tool_calls (tool_use_id, request_id, timestamp, session_id, subagent_name, provider, model, project_path, tool_name, input, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(tool_use_id) DO UPDATE SET
+				request_id = COALESCE(NULLIF(tool_calls.request_id, ''), excluded.request_id),
+				timestamp = MIN(tool_calls.timestamp, excluded.timestamp),
+				session_id = COALESCE(NULLIF(tool_calls.session_id, ''), excluded.session_id),
+				subagent_name = COALESCE(NULLIF(tool_calls.subagent_name, ''), excluded.subagent_name),
+				provider = COALESCE(NULLIF(tool_calls.provider, ''), excluded.provider),
+				model = COALESCE(NULLIF(tool_calls.model, ''), excluded.model),
+				project_path = COALESCE(NULLIF(tool_calls.project_path, ''), excluded.project_path),
+				tool_name = COALESCE(NULLIF(tool_calls.tool_name, ''), excluded.tool_name),
+				input = COALESCE(tool_calls.input, excluded.input)
+		`, call.ToolUseID, call.RequestID, call.Timestamp, call.SessionID, call.SubagentName, call.Provider, call.Model, call.ProjectPath, call.ToolName, nullableJSON(call.Input), call.Source)
+		if err != nil {
+			return fmt.Errorf("failed to save tool call %s: %w", call.ToolUseID, err)
+		}
+	}
+	return nil
+}
+
+// saveToolResults records the results of tool calls, adding a row for
+// calls that were not seen being made
+func saveToolResults(db sqlExecer, results []*model.ToolCall) error {
+	for _, result := range results {
+		_, err := db.Exec(`
+			INSERT INTO tool_calls (tool_use_id, result_request_id, timestamp, session_id, subagent_name, project_path, tool_name, input, has_result, is_error, result_size, result_at, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+			ON CONFLICT(tool_use_id) DO UPDATE SET
+				result_request_id = COALESCE(NULLIF(tool_calls.result_request_id, ''), excluded.result_request_id),
+				session_id = COALESCE(NULLIF(tool_calls.session_id, ''), excluded.session_id),
+				project_path = COALESCE(NULLIF(tool_calls.project_path, ''), excluded.project_path),
+				tool_name = COALESCE(NULLIF(tool_calls.tool_name, ''), excluded.tool_name),
+				input = COALESCE(tool_calls.input, excluded.input),
+				has_result = 1,
+				is_error = excluded.is_error,
+				result_size = excluded.result_size,
+				result_at = COALESCE(tool_calls.result_at, excluded.result_at)
+		`, result.ToolUseID, result.ResultRequestID, result.Timestamp, result.SessionID, result.SubagentName, result.ProjectPath, result.ToolName, nullableJSON(result.Input), result.IsError, result.ResultSize, result.ResultAt, result.Source)
+		if err != nil {
+			return fmt.Errorf("failed to save tool result %s: %w", result.ToolUseID, err)
+		}
+	}
+	return nil
+}
+
+func nullableJSON(data json.RawMessage) sql.NullString {
+	if len(data) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// toolCallsFromConversation returns the tool calls and results of one
+// indexed conversation message
+func toolCallsFromConversation(msg *ConversationMessage, content []byte) (uses, results []*model.ToolCall) {
+	var message struct {
+		Role    string          `json:"role"`
+		Model   string          `json:"model"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(content, &message); err != nil {
+		return nil, nil
+	}
+	for _, block := range contentBlocks(message.Content) {
+		switch {
+		case block.Type == "tool_use" && block.ID != "":
+			uses = append(uses, &model.ToolCall{
+				ToolUseID:   block.ID,
+				Timestamp:   msg.Timestamp,
+				SessionID:   msg.SessionID,
+				Model:       message.Model,
+				ProjectPath: msg.CWD,
+				ToolName:    block.Name,
+				Input:       block.Input,
+				Source:      "conversation",
+			})
+		case block.Type == "tool_result" && block.ToolUseID != "":
+			results = append(results, &model.ToolCall{
+				ToolUseID:   block.ToolUseID,
+				Timestamp:   msg.Timestamp,
+				SessionID:   msg.SessionID,
+				ProjectPath: msg.CWD,
+				HasResult:   true,
+				IsError:     block.IsError,
+				ResultSize:  toolResultSize(block.Content),
+				ResultAt:    msg.Timestamp,
+				Source:      "conversation",
+			})
+		}
+	}
+	return uses, results
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestToolCalls_ProxyTraffic(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.AnthropicMetadata{UserID: "user_abc_account_123_session_sess-1"}
+	first := &model.RequestLog{
+		RequestID:    "req-1",
+		Timestamp:    "2024-01-15T10:00:00Z",
+		Method:       "POST",
+		Endpoint:     "/v1/messages",
+		Headers:      map[string][]string{},
+		Body:         model.AnthropicRequest{Model: "claude-sonnet-4", Metadata: metadata, Messages: []model.AnthropicMessage{{Role: "user", Content: "run the tests"}}},
+		Model:        "claude-sonnet-4",
+		RoutedModel:  "gpt-4o",
+		Provider:     "openai",
+		SubagentName: "test-runner",
+	}
+	if _, err := storage.SaveRequest(first); err != nil {
+		t.Fatalf("SaveRequest() error = %v", err)
+	}
+	first.Response = &model.ResponseLog{
+		StatusCode:  200,
+		IsStreaming: true,
+		CompletedAt: "2024-01-15T10:00:02Z",
+		StreamingChunks: []string{
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"Bash","input":{}}}`,
+			`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"command\":"}}`,
+			`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go test ./...\"}"}}`,
+			`data: {"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"Read","input":{}}}`,
+			`data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\":\"/work/go.mod\"}"}}`,
+		},
+	}
+	if err := storage.UpdateRequestWithResponse(first); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() error = %v", err)
+	}
+
+	// The next turn carries the results
+	second := &model.RequestLog{
+		RequestID: "req-2",
+		Timestamp: "2024-01-15T10:00:05Z",
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Headers:   map[string][]string{},
+		Body: model.AnthropicRequest{Model: "claude-sonnet-4", Metadata: metadata, Messages: []model.AnthropicMessage{
+			{Role: "user", Content: "run the tests"},
+			{Role: "assistant", Content: []interface{}{
+				map[string]interface{}{"type": "tool_use", "id": "toolu_1", "name": "Bash", "input": map[string]interface{}{"command": "go test ./..."}},
+				map[string]interface{}{"type": "tool_use", "id": "toolu_2", "name": "Read", "input": map[string]interface{}{"file_path": "/work/go.mod"}},
+			}},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "tool_result", "tool_use_id": "toolu_1", "is_error": true, "content": "FAIL: 3 tests"},
+				map[string]interface{}{"type": "tool_result", "tool_use_id": "toolu_2", "content": []interface{}{map[string]interface{}{"type": "text", "text": "module x"}}},
+			}},
+		}},
+		Model: "claude-sonnet-4",
+	}
+	if _, err := storage.SaveRequest(second); err != nil {
+		t.Fatalf("SaveRequest() error = %v", err)
+	}
+
+	calls, total, err := storage.GetToolCalls(model.ToolCallFilter{})
+	if err != nil {
+		t.Fatalf("GetToolCalls() error = %v", err)
+	}
+	if total != 2 || len(calls) != 2 {
+		t.Fatalf("Expected 2 tool calls, got %d (%+v)", total, calls)
+	}
+
+	isError := true
+	failed, total, err := storage.GetToolCalls(model.ToolCallFilter{ToolName: "Bash", Model: "gpt-4o", IsError: &isError})
+	if err != nil {
+		t.Fatalf("GetToolCalls() error = %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("Expected one failed Bash call, got %+v", failed)
+	}
+	call := failed[0]
+	if call.RequestID != "req-1" || call.ResultRequestID != "req-2" || call.SessionID != "sess-1" || call.Provider != "openai" || call.SubagentName != "test-runner" {
+		t.Errorf("Unexpected call details %+v", call)
+	}
+	if string(call.Input) != `{"command":"go test ./..."}` || !call.HasResult || call.ResultSize != len("FAIL: 3 tests") || call.Source != "proxy" {
+		t.Errorf("Unexpected call input or result %+v", call)
+	}
+
+	isError = false
+	succeeded, _, _ := storage.GetToolCalls(model.ToolCallFilter{IsError: &isError})
+	if len(succeeded) != 1 || succeeded[0].ToolName != "Read" || succeeded[0].ResultSize != len("module x") {
+		t.Errorf("Expected the Read call to have succeeded, got %+v", succeeded)
+	}
+}
+
+func TestToolCalls_ConversationIndexer(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	sqliteStorage := storage.(*SQLiteStorageService)
+
+	// The proxy saw the call being made, but not its result
+	err := saveToolUses(sqliteStorage.db, []*model.ToolCall{{
+		ToolUseID: "toolu_9",
+		RequestID: "req-9",
+		Timestamp: "2024-01-15T10:00:00Z",
+		Provider:  "anthropic",
+		ToolName:  "Edit",
+		Input:     json.RawMessage(`{"file_path":"/work/main.go"}`),
+		Source:    "proxy",
+	}})
+	if err != nil {
+		t.Fatalf("saveToolUses() error = %v", err)
+	}
+
+	projects := t.TempDir()
+	projectDir := filepath.Join(projects, "-work")
+	os.MkdirAll(projectDir, 0755)
+	lines := []string{
+		`{"type":"assistant","uuid":"a1","sessionId":"sess-9","cwd":"/work","timestamp":"2024-01-15T10:00:00Z","message":{"role":"assistant","model":"claude-sonnet-4","content":[{"type":"tool_use","id":"toolu_9","name":"Edit","input":{"file_path":"/work/main.go"}},{"type":"tool_use","id":"toolu_10","name":"Grep","input":{"pattern":"TODO"}}]}}`,
+		`{"type":"user","uuid":"u1","sessionId":"sess-9","cwd":"/work","timestamp":"2024-01-15T10:00:03Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_9","is_error":true,"content":"old_string not found"},{"type":"tool_result","tool_use_id":"toolu_10","content":"main.go:3: TODO"}]}}`,
+	}
+	var data []byte
+	for _, line := range lines {
+		data = append(data, line+"\n"...)
+	}
+	filePath := filepath.Join(projectDir, "sess-9.jsonl")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	indexer, err := NewConversationIndexer(sqliteStorage)
+	if err != nil {
+		t.Fatalf("NewConversationIndexer() error = %v", err)
+	}
+	indexer.claudeProjects = projects
+	if err := indexer.indexFile(filePath); err != nil {
+		t.Fatalf("indexFile() error = %v", err)
+	}
+	// Indexing again changes nothing
+	if err := indexer.indexFile(filePath); err != nil {
+		t.Fatalf("indexFile() error = %v", err)
+	}
+
+	calls, total, err := storage.GetToolCalls(model.ToolCallFilter{SessionID: "sess-9"})
+	if err != nil {
+		t.Fatalf("GetToolCalls() error = %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("Expected 2 tool calls, got %+v", calls)
+	}
+	byID := make(map[string]*model.ToolCall)
+	for _, call := range calls {
+		byID[call.ToolUseID] = call
+	}
+
+	edit := byID["toolu_9"]
+	if edit.Source != "proxy" || edit.RequestID != "req-9" || edit.ProjectPath != "/work" || !edit.IsError || edit.ResultSize != len("old_string not found") {
+		t.Errorf("Expected the proxy's row completed from the conversation, got %+v", edit)
+	}
+	grep := byID["toolu_10"]
+	if grep.Source != "conversation" || grep.ToolName != "Grep" || grep.Model != "claude-sonnet-4" || !grep.HasResult || grep.IsError {
+		t.Errorf("Unexpected conversation tool call %+v", grep)
+	}
+}
+
+func TestToolResultSize(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{``, 0},
+		{`"hello"`, 5},
+		{`[{"type":"text","text":"abc"},{"type":"text","text":"de"}]`, 5},
+		{`[{"type":"image","source":{}}]`, len(`{"type":"image","source":{}}`)},
+	}
+	for _, tt := range tests {
+		if got := toolResultSize(json.RawMessage(tt.content)); got != tt.want {
+			t.Errorf("toolResultSize(%s) = %d, want %d", tt.content, got, tt.want)
+		}
+	}
+
+	if got := sessionFromUserID("user_abc_account_123_session_9f1c"); got != "9f1c" {
+		t.Errorf("sessionFromUserID() = %q, want 9f1c", got)
+	}
+	if got := sessionFromUserID("team-platform"); got != "team-platform" {
+		t.Errorf("sessionFromUserID() = %q, want team-platform", got)
+	}
+}
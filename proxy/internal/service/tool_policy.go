@@ -0,0 +1,538 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// confirmMarkerPattern finds the markers left in text that replaced a call
+// awaiting confirmation
+var confirmMarkerPattern = regexp.MustCompile(`\[tool-policy:[0-9a-f]{12}\]`)
+
+// maxPolicyInputShown caps how much of a call's input the replacement text
+// quotes
+const maxPolicyInputShown = 500
+
+// ToolPolicyEngine checks the tool_use blocks of responses against
+// tool_policies before Claude Code sees them
+type ToolPolicyEngine struct {
+	policies []toolPolicy
+	matcher  *RuleEngine // evaluates policy match conditions
+}
+
+type toolPolicy struct {
+	config  *config.ToolPolicyConfig
+	pattern *regexp.Regexp
+}
+
+// NewToolPolicyEngine creates an engine from already-validated policies, or
+// returns nil if there are none
+func NewToolPolicyEngine(policies []config.ToolPolicyConfig) *ToolPolicyEngine {
+	if len(policies) == 0 {
+		return nil
+	}
+	e := &ToolPolicyEngine{matcher: &RuleEngine{now: time.Now}}
+	for i := range policies {
+		policy := toolPolicy{config: &policies[i]}
+		if policies[i].Pattern != "" {
+			policy.pattern = regexp.MustCompile(policies[i].Pattern)
+		}
+		e.policies = append(e.policies, policy)
+	}
+	return e
+}
+
+// Start picks the policies that apply to a routed request. route is the
+// "provider:model" the request was routed to.
+func (e *ToolPolicyEngine) Start(in RuleInput, route string) *ToolPolicyRun {
+	if e == nil {
+		return nil
+	}
+
+	run := &ToolPolicyRun{projectPath: in.ProjectPath}
+	tokens := lazyTokenEstimate(in.Request)
+	for _, policy := range e.policies {
+		if len(policy.config.Routes) > 0 && !matchAny(policy.config.Routes, route) {
+			continue
+		}
+		if !e.matcher.matches(&policy.config.Match, in, tokens) {
+			continue
+		}
+		run.policies = append(run.policies, policy)
+	}
+	if len(run.policies) == 0 {
+		return nil
+	}
+	run.confirmed = confirmedToolCalls(in.Request)
+	return run
+}
+
+// ToolPolicyRun is the policies applying to one request, and what they
+// matched in its response. A nil run has no policies, so callers don't
+// need to check.
+type ToolPolicyRun struct {
+	policies    []toolPolicy
+	projectPath string
+	confirmed   map[string]bool // markers of calls the user has approved
+	hits        []*model.ToolPolicyHit
+
+	// Streaming state: the tool_use block being held back, how many text
+	// blocks were inserted before the current one, and how many tool_use
+	// blocks were passed on or replaced
+	held     *heldToolUse
+	shift    int
+	passed   int
+	replaced int
+}
+
+type heldToolUse struct {
+	index  int
+	id     string
+	name   string
+	input  strings.Builder
+	events []map[string]interface{}
+}
+
+// toolPolicyVerdict is what the first matching policy decided for a call.
+// text replaces the call (block, confirm) or precedes it (annotate).
+type toolPolicyVerdict struct {
+	action string
+	text   string
+}
+
+// Hits returns the calls the policies matched so far
+func (r *ToolPolicyRun) Hits() []*model.ToolPolicyHit {
+	if r == nil {
+		return nil
+	}
+	return r.hits
+}
+
+// check runs a call past the policies and records a hit for the first one
+// that matches. It returns nil when no policy matches.
+func (r *ToolPolicyRun) check(id, name string, input json.RawMessage) *toolPolicyVerdict {
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+	for _, policy := range r.policies {
+		shown, ok := policy.matches(name, input, r.projectPath)
+		if !ok {
+			continue
+		}
+
+		cfg := policy.config
+		verdict := &toolPolicyVerdict{action: cfg.Action}
+		message := cfg.Message
+		switch cfg.Action {
+		case "block":
+			if message == "" {
+				message = "This call is not allowed."
+			}
+			verdict.text = fmt.Sprintf("[Blocked %s call by tool policy '%s'] %s\nInput: %s", name, cfg.Name, message, shown)
+		case "confirm":
+			marker := confirmMarker(cfg.Name, name, input)
+			if r.confirmed[marker] {
+				verdict = nil
+				break
+			}
+			if message == "" {
+				message = "This call needs your confirmation."
+			}
+			verdict.text = fmt.Sprintf("[%s call held by tool policy '%s'] %s Reply yes to confirm, and the same call will be let through.\nInput: %s %s", name, cfg.Name, message, shown, marker)
+		case "annotate":
+			if message == "" {
+				message = "This call was flagged for review."
+			}
+			verdict.text = fmt.Sprintf("[%s call flagged by tool policy '%s'] %s", name, cfg.Name, message)
+		}
+
+		action := cfg.Action
+		if verdict == nil {
+			action = "confirmed"
+		}
+		r.hits = append(r.hits, &model.ToolPolicyHit{
+			Timestamp: time.Now(),
+			Policy:    cfg.Name,
+			Action:    action,
+			ToolName:  name,
+			ToolUseID: id,
+			Input:     input,
+		})
+		metrics.RecordToolPolicyHit(cfg.Name, action)
+		return verdict
+	}
+	return nil
+}
+
+// matches reports whether the policy matches a call, and returns the part
+// of the input it inspected for quoting
+func (p *toolPolicy) matches(name string, input json.RawMessage, projectPath string) (string, bool) {
+	if !matchAny(p.config.Tools, name) {
+		return "", false
+	}
+
+	value := string(input)
+	if p.config.Field != "" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(input, &fields); err != nil {
+			return "", false
+		}
+		field, ok := fields[p.config.Field]
+		if !ok {
+			return "", false
+		}
+		if s, ok := field.(string); ok {
+			value = s
+		} else {
+			data, _ := json.Marshal(field)
+			value = string(data)
+		}
+	}
+
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return "", false
+	}
+	if p.config.OutsideProject && !outsideProject(value, projectPath) {
+		return "", false
+	}
+	if len(value) > maxPolicyInputShown {
+		value = value[:maxPolicyInputShown] + "…"
+	}
+	return value, true
+}
+
+// outsideProject reports whether path lies outside the project directory.
+// Without a known project, nothing is outside it.
+func outsideProject(path, projectPath string) bool {
+	if projectPath == "" || path == "" {
+		return false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectPath, path)
+	}
+	rel, err := filepath.Rel(filepath.Clean(projectPath), filepath.Clean(path))
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// confirmMarker identifies a call held by a confirm policy, so the same call
+// can be recognized when the model makes it again
+func confirmMarker(policy, tool string, input json.RawMessage) string {
+	// Re-encode so whitespace and key order don't change the marker
+	var decoded interface{}
+	if err := json.Unmarshal(input, &decoded); err == nil {
+		input, _ = json.Marshal(decoded)
+	}
+	sum := sha256.Sum256([]byte(policy + "\x00" + tool + "\x00" + string(input)))
+	return fmt.Sprintf("[tool-policy:%x]", sum[:6])
+}
+
+// confirmApprovePattern matches a reply that approves held calls, and
+// confirmRefusePattern one that, despite that, says not to
+var (
+	confirmApprovePattern = regexp.MustCompile(`(?i)^\W*(yes|yep|y|ok|okay|approve[ds]?|confirm(ed)?|go ahead|proceed|do it)\b`)
+	confirmRefusePattern  = regexp.MustCompile(`(?i)\b(no|not|don'?t|do not|never|stop|cancel|wait)\b`)
+)
+
+// confirmedToolCalls returns the markers of held calls the user has
+// approved: the first human reply after the assistant turn that held a call
+// approves it if it says yes (or similar) or quotes the call's marker, and
+// says nothing like no. Any other reply declines. Turns that only carry
+// tool_result blocks are sent by the client, not the user, and are skipped.
+func confirmedToolCalls(req *model.AnthropicRequest) map[string]bool {
+	if req == nil {
+		return nil
+	}
+	var confirmed map[string]bool
+	var pending []string
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "assistant":
+			pending = append(pending, confirmMarkerPattern.FindAllString(messageText(msg), -1)...)
+		case "user":
+			text := strings.TrimSpace(messageText(msg))
+			if text == "" || len(pending) == 0 {
+				continue
+			}
+			quoted := confirmMarkerPattern.FindAllString(text, -1)
+			refused := confirmRefusePattern.MatchString(text)
+			approved := confirmApprovePattern.MatchString(text)
+			for _, marker := range pending {
+				if !refused && (approved || slices.Contains(quoted, marker)) {
+					if confirmed == nil {
+						confirmed = make(map[string]bool)
+					}
+					confirmed[marker] = true
+				}
+			}
+			pending = nil
+		}
+	}
+	return confirmed
+}
+
+// messageText joins the text of a message's string content or text blocks
+func messageText(msg model.AnthropicMessage) string {
+	switch content := msg.Content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		var text strings.Builder
+		for _, item := range content {
+			if block, ok := item.(map[string]interface{}); ok && block["type"] == "text" {
+				if s, ok := block["text"].(string); ok {
+					text.WriteString(s)
+				}
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// FilterMessage applies the policies to the tool_use blocks of a
+// non-streaming response body
+func (r *ToolPolicyRun) FilterMessage(body []byte) []byte {
+	if r == nil {
+		return body
+	}
+	var message map[string]interface{}
+	if err := decodeJSONNumbers(body, &message); err != nil {
+		return body
+	}
+	blocks, ok := message["content"].([]interface{})
+	if !ok {
+		return body
+	}
+
+	var content []interface{}
+	changed, toolUses := false, 0
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok || block["type"] != "tool_use" {
+			content = append(content, item)
+			continue
+		}
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		input, _ := json.Marshal(block["input"])
+
+		verdict := r.check(id, name, input)
+		switch {
+		case verdict == nil:
+			content = append(content, block)
+			toolUses++
+		case verdict.action == "annotate":
+			content = append(content, map[string]interface{}{"type": "text", "text": verdict.text}, block)
+			toolUses++
+			changed = true
+		default:
+			content = append(content, map[string]interface{}{"type": "text", "text": verdict.text})
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+
+	message["content"] = content
+	if toolUses == 0 && message["stop_reason"] == "tool_use" {
+		message["stop_reason"] = "end_turn"
+	}
+	return encodeJSON(message, body)
+}
+
+// FilterStream applies the policies to a streaming response. Each tool_use
+// block is held back until its input is complete, then passed on, replaced,
+// or preceded by a note. The returned stream carries only the "data:"
+// lines of events.
+func (r *ToolPolicyRun) FilterStream(body io.ReadCloser) io.ReadCloser {
+	if r == nil {
+		return body
+	}
+	return &toolPolicyStream{run: r, body: body, scanner: bufio.NewScanner(body)}
+}
+
+type toolPolicyStream struct {
+	run     *ToolPolicyRun
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	pending []byte
+	done    bool
+}
+
+func (s *toolPolicyStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return 0, err
+			}
+			// A stream cut off mid-block passes the held events on as is
+			s.done = true
+			s.emit(s.run.release())
+			continue
+		}
+		line := s.scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		var event map[string]interface{}
+		if err := decodeJSONNumbers([]byte(data), &event); err != nil {
+			s.pending = append(s.pending, "data: "+data+"\n\n"...)
+			continue
+		}
+		s.emit(s.run.onEvent(event))
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *toolPolicyStream) emit(events []map[string]interface{}) {
+	for _, event := range events {
+		s.pending = append(s.pending, "data: "...)
+		s.pending = append(s.pending, encodeJSON(event, nil)...)
+		s.pending = append(s.pending, "\n\n"...)
+	}
+}
+
+func (s *toolPolicyStream) Close() error {
+	return s.body.Close()
+}
+
+// onEvent takes one streaming event and returns the events to send on
+func (r *ToolPolicyRun) onEvent(event map[string]interface{}) []map[string]interface{} {
+	eventType, _ := event["type"].(string)
+	index, hasIndex := eventIndex(event)
+
+	if r.held != nil && hasIndex && index == r.held.index {
+		r.held.events = append(r.held.events, event)
+		switch eventType {
+		case "content_block_delta":
+			if delta, ok := event["delta"].(map[string]interface{}); ok {
+				if partial, ok := delta["partial_json"].(string); ok {
+					r.held.input.WriteString(partial)
+				}
+			}
+		case "content_block_stop":
+			return r.resolve()
+		}
+		return nil
+	}
+
+	if eventType == "content_block_start" && hasIndex {
+		if block, ok := event["content_block"].(map[string]interface{}); ok && block["type"] == "tool_use" {
+			held := &heldToolUse{index: index, events: []map[string]interface{}{event}}
+			held.id, _ = block["id"].(string)
+			held.name, _ = block["name"].(string)
+			r.held = held
+			return nil
+		}
+	}
+
+	if eventType == "message_delta" && r.passed == 0 && r.replaced > 0 {
+		if delta, ok := event["delta"].(map[string]interface{}); ok && delta["stop_reason"] == "tool_use" {
+			delta["stop_reason"] = "end_turn"
+		}
+	}
+	if hasIndex {
+		event["index"] = index + r.shift
+	}
+	return []map[string]interface{}{event}
+}
+
+// resolve checks the held tool_use block now that its input is complete
+func (r *ToolPolicyRun) resolve() []map[string]interface{} {
+	held := r.held
+	r.held = nil
+
+	input := json.RawMessage(held.input.String())
+	if !json.Valid(input) {
+		input = nil
+	}
+	verdict := r.check(held.id, held.name, input)
+
+	var out []map[string]interface{}
+	if verdict != nil {
+		out = textBlockEvents(held.index+r.shift, verdict.text)
+		if verdict.action != "annotate" {
+			r.replaced++
+			return out
+		}
+		r.shift++
+	}
+	for _, event := range held.events {
+		event["index"] = held.index + r.shift
+		out = append(out, event)
+	}
+	r.passed++
+	return out
+}
+
+// release returns a held block's events unchanged
+func (r *ToolPolicyRun) release() []map[string]interface{} {
+	if r.held == nil {
+		return nil
+	}
+	held := r.held
+	r.held = nil
+	for _, event := range held.events {
+		event["index"] = held.index + r.shift
+	}
+	return held.events
+}
+
+// textBlockEvents are the events of a complete text content block
+func textBlockEvents(index int, text string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"type": "content_block_start", "index": index, "content_block": map[string]interface{}{"type": "text", "text": ""}},
+		{"type": "content_block_delta", "index": index, "delta": map[string]interface{}{"type": "text_delta", "text": text}},
+		{"type": "content_block_stop", "index": index},
+	}
+}
+
+func eventIndex(event map[string]interface{}) (int, bool) {
+	switch index := event["index"].(type) {
+	case json.Number:
+		n, err := index.Int64()
+		return int(n), err == nil
+	case int:
+		return index, true
+	}
+	return 0, false
+}
+
+// decodeJSONNumbers decodes JSON keeping numbers as written
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// encodeJSON encodes v without HTML escaping, or returns fallback if it
+// cannot
+func encodeJSON(v interface{}, fallback []byte) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return fallback
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
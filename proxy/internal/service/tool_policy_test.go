@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func newTestToolPolicies() *ToolPolicyEngine {
+	return NewToolPolicyEngine([]config.ToolPolicyConfig{
+		{Name: "no-rm-root", Tools: []string{"Bash"}, Field: "command", Pattern: `rm\s+-rf\s+/(\s|$)`, Action: "block", Message: "Deleting / is never allowed."},
+		{Name: "force-push", Tools: []string{"Bash"}, Field: "command", Pattern: `git push .*--force`, Action: "confirm"},
+		{Name: "outside-project", Tools: []string{"Edit", "Write"}, Field: "file_path", OutsideProject: true, Action: "annotate"},
+	})
+}
+
+func TestToolPolicyRun_FilterMessage(t *testing.T) {
+	run := newTestToolPolicies().Start(RuleInput{Request: &model.AnthropicRequest{}, ProjectPath: "/work/app"}, "zai:glm-4.6")
+
+	body := []byte(`{"id":"msg_1","type":"message","role":"assistant","content":[` +
+		`{"type":"text","text":"Cleaning up"},` +
+		`{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"rm -rf /"}}` +
+		`],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`)
+	var got model.AnthropicResponse
+	if err := json.Unmarshal(run.FilterMessage(body), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(got.Content) != 2 || got.Content[1].Type != "text" || !strings.Contains(got.Content[1].Text, "Deleting / is never allowed.") {
+		t.Errorf("Expected the call replaced with an explanation, got %+v", got.Content)
+	}
+	if got.StopReason != "end_turn" {
+		t.Errorf("Expected stop_reason end_turn once no tool call remains, got %q", got.StopReason)
+	}
+
+	// Annotated calls are kept, after a note
+	body = []byte(`{"content":[{"type":"tool_use","id":"toolu_2","name":"Write","input":{"file_path":"/etc/hosts","content":"x"}},` +
+		`{"type":"tool_use","id":"toolu_3","name":"Write","input":{"file_path":"src/main.go","content":"x"}}],"stop_reason":"tool_use"}`)
+	var annotated struct {
+		Content    []model.ContentBlock `json:"content"`
+		StopReason string               `json:"stop_reason"`
+	}
+	json.Unmarshal(run.FilterMessage(body), &annotated)
+	if len(annotated.Content) != 3 || annotated.Content[0].Type != "text" || annotated.Content[1].ID != "toolu_2" || annotated.Content[2].ID != "toolu_3" {
+		t.Errorf("Expected a note before the write outside the project only, got %+v", annotated.Content)
+	}
+	if annotated.StopReason != "tool_use" {
+		t.Errorf("Expected stop_reason kept, got %q", annotated.StopReason)
+	}
+
+	// Responses without matching calls are returned unchanged
+	clean := []byte(`{"content":[{"type":"tool_use","id":"toolu_4","name":"Bash","input":{"command":"ls"}}],"stop_reason":"tool_use"}`)
+	if string(run.FilterMessage(clean)) != string(clean) {
+		t.Error("Expected a response without hits to be unchanged")
+	}
+
+	hits := run.Hits()
+	if len(hits) != 2 || hits[0].Policy != "no-rm-root" || hits[0].Action != "block" || hits[1].Action != "annotate" || hits[1].ToolUseID != "toolu_2" {
+		t.Errorf("Unexpected hits %+v", hits)
+	}
+}
+
+func TestToolPolicyRun_ConfirmFlow(t *testing.T) {
+	engine := newTestToolPolicies()
+	call := `{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"git push origin main --force"}}],"stop_reason":"tool_use"}`
+
+	run := engine.Start(RuleInput{Request: &model.AnthropicRequest{}}, "zai:glm-4.6")
+	var held model.AnthropicResponse
+	json.Unmarshal(run.FilterMessage([]byte(call)), &held)
+	if len(held.Content) != 1 || held.Content[0].Type != "text" || !strings.Contains(held.Content[0].Text, "[tool-policy:") {
+		t.Fatalf("Expected the call held for confirmation, got %+v", held.Content)
+	}
+
+	// Once the user replies, the same call goes through
+	req := &model.AnthropicRequest{Messages: []model.AnthropicMessage{
+		{Role: "user", Content: "push my branch"},
+		{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "text", "text": held.Content[0].Text}}},
+		{Role: "user", Content: "yes, go ahead"},
+	}}
+	run = engine.Start(RuleInput{Request: req}, "zai:glm-4.6")
+	if got := run.FilterMessage([]byte(call)); string(got) != call {
+		t.Errorf("Expected the confirmed call to pass, got %s", got)
+	}
+	if hits := run.Hits(); len(hits) != 1 || hits[0].Action != "confirmed" {
+		t.Errorf("Expected a confirmed hit, got %+v", hits)
+	}
+
+	// A different command still needs confirmation
+	other := strings.Replace(call, "main", "release", 1)
+	if got := run.FilterMessage([]byte(other)); string(got) == other {
+		t.Error("Expected a different call to be held")
+	}
+}
+
+func TestToolPolicyRun_ConfirmNeedsApproval(t *testing.T) {
+	engine := newTestToolPolicies()
+	call := `{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"git push origin main --force"}}],"stop_reason":"tool_use"}`
+
+	var held model.AnthropicResponse
+	json.Unmarshal(engine.Start(RuleInput{Request: &model.AnthropicRequest{}}, "zai:glm-4.6").FilterMessage([]byte(call)), &held)
+	heldText := held.Content[0].Text
+	marker := confirmMarkerPattern.FindString(heldText)
+
+	toolResult := []interface{}{map[string]interface{}{"type": "tool_result", "tool_use_id": "toolu_0", "content": "ok"}}
+	tests := []struct {
+		name    string
+		replies []interface{}
+		want    bool
+	}{
+		{"tool result only", []interface{}{toolResult}, false},
+		{"refusal", []interface{}{"no, don't do that"}, false},
+		{"approval with a refusal", []interface{}{"yes but do not push to main"}, false},
+		{"unrelated reply", []interface{}{"what does --force do?"}, false},
+		{"declined, then approved later", []interface{}{"hmm, not sure", "yes"}, false},
+		{"tool result, then approval", []interface{}{toolResult, "yes, go ahead"}, true},
+		{"quoted marker", []interface{}{"run " + marker}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := []model.AnthropicMessage{
+				{Role: "user", Content: "push my branch"},
+				{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "text", "text": heldText}}},
+			}
+			for i, reply := range tt.replies {
+				if i > 0 {
+					messages = append(messages, model.AnthropicMessage{Role: "assistant", Content: "ok"})
+				}
+				messages = append(messages, model.AnthropicMessage{Role: "user", Content: reply})
+			}
+			run := engine.Start(RuleInput{Request: &model.AnthropicRequest{Messages: messages}}, "zai:glm-4.6")
+			if passed := string(run.FilterMessage([]byte(call))) == call; passed != tt.want {
+				t.Errorf("Call let through = %v, want %v", passed, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolPolicyRun_FilterStream(t *testing.T) {
+	run := newTestToolPolicies().Start(RuleInput{Request: &model.AnthropicRequest{}, ProjectPath: "/work/app"}, "zai:glm-4.6")
+
+	stream := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","role":"assistant"}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"Edit","input":{}}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\":\"/home/me/.bashrc\"}"}}`,
+		`data: {"type":"content_block_stop","index":0}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_2","name":"Bash","input":{}}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"command\":"}}`,
+		`data: {"type":"ping"}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"rm -rf /\"}"}}`,
+		`data: {"type":"content_block_stop","index":1}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":40}}`,
+		`data: {"type":"message_stop"}`,
+	}, "\n\n") + "\n\n"
+
+	out, err := io.ReadAll(run.FilterStream(io.NopCloser(strings.NewReader(stream))))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("Invalid event %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+
+	var summary []string
+	for _, event := range events {
+		entry := event["type"].(string)
+		if index, ok := event["index"].(float64); ok {
+			entry += ":" + strconv.Itoa(int(index))
+		}
+		if block, ok := event["content_block"].(map[string]interface{}); ok {
+			entry += ":" + block["type"].(string)
+		}
+		summary = append(summary, entry)
+	}
+	want := []string{
+		"message_start",
+		// The note on the Edit outside the project, then the Edit itself
+		"content_block_start:0:text", "content_block_delta:0", "content_block_stop:0",
+		"content_block_start:1:tool_use", "content_block_delta:1", "content_block_stop:1",
+		// The ping is not held back with the Bash call
+		"ping",
+		// The blocked Bash call, replaced with text
+		"content_block_start:2:text", "content_block_delta:2", "content_block_stop:2",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(summary, " ") != strings.Join(want, " ") {
+		t.Errorf("Unexpected events:\n got %v\nwant %v", summary, want)
+	}
+
+	// One tool call is still there, so the model still waits for its result
+	delta := events[len(events)-2]["delta"].(map[string]interface{})
+	if delta["stop_reason"] != "tool_use" {
+		t.Errorf("Expected stop_reason tool_use, got %v", delta["stop_reason"])
+	}
+	if hits := run.Hits(); len(hits) != 2 || string(hits[1].Input) != `{"command":"rm -rf /"}` {
+		t.Errorf("Unexpected hits %+v", hits)
+	}
+}
+
+func TestToolPolicyEngine_Start(t *testing.T) {
+	engine := NewToolPolicyEngine([]config.ToolPolicyConfig{
+		{Name: "subagents-no-web", Tools: []string{"Web*"}, Action: "block", Match: config.RuleMatchConfig{Subagents: []string{"*"}}, Routes: []string{"zai:*"}},
+	})
+	req := &model.AnthropicRequest{}
+
+	if run := engine.Start(RuleInput{Request: req}, "zai:glm-4.6"); run != nil {
+		t.Error("Expected no policies for the main agent")
+	}
+	if run := engine.Start(RuleInput{Request: req, SubagentName: "researcher"}, "anthropic:claude-sonnet-4"); run != nil {
+		t.Error("Expected no policies for a subagent on anthropic")
+	}
+	run := engine.Start(RuleInput{Request: req, SubagentName: "researcher"}, "zai:glm-4.6")
+	body := []byte(`{"content":[{"type":"tool_use","id":"toolu_1","name":"WebFetch","input":{"url":"https://example.com"}}],"stop_reason":"tool_use"}`)
+	if got := run.FilterMessage(body); string(got) == string(body) {
+		t.Error("Expected WebFetch to be blocked for a subagent on zai")
+	}
+
+	// No policies means a nil engine and nil runs, which change nothing
+	none := NewToolPolicyEngine(nil)
+	if none != nil {
+		t.Fatal("Expected a nil engine without policies")
+	}
+	if got := none.Start(RuleInput{Request: req}, "zai:glm-4.6").FilterMessage(body); string(got) != string(body) {
+		t.Error("Expected a nil run to change nothing")
+	}
+}
+
+func TestOutsideProject(t *testing.T) {
+	tests := []struct {
+		path    string
+		project string
+		want    bool
+	}{
+		{"/work/app/main.go", "/work/app", false},
+		{"src/main.go", "/work/app", false},
+		{"/work/app", "/work/app", false},
+		{"/work/application/x", "/work/app", true},
+		{"../other/x", "/work/app", true},
+		{"/etc/passwd", "/work/app", true},
+		{"/etc/passwd", "", false},
+	}
+	for _, tt := range tests {
+		if got := outsideProject(tt.path, tt.project); got != tt.want {
+			t.Errorf("outsideProject(%q, %q) = %v, want %v", tt.path, tt.project, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/metrics"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// weightScale converts 1-10 profile weights into a finer integer range so
+// that small adjustments still change the load balancer's behaviour
+const weightScale = 10
+
+// ProviderWeightStats is the per-provider view of load balancer weights
+type ProviderWeightStats struct {
+	Provider        string  `json:"provider"`
+	BaseWeight      int     `json:"base_weight"`
+	EffectiveWeight int     `json:"effective_weight"`
+	LatencyMs       float64 `json:"ewma_latency_ms"`
+	TTFBMs          float64 `json:"ewma_ttfb_ms"`
+	ErrorRate       float64 `json:"error_rate"`
+	Samples         int     `json:"samples"`
+}
+
+// providerSignal holds the smoothed live-traffic signals for one provider
+type providerSignal struct {
+	latencyMs float64
+	ttfbMs    float64
+	errorRate float64
+	samples   int
+	observed  bool // observed since the last recompute
+}
+
+// WeightController adjusts LoadBalancer weights from live traffic. It keeps
+// an EWMA of latency, TTFB, and error rate per provider and periodically
+// scales each provider's profile weight by how it compares to the fleet.
+// Idle providers decay back towards neutral so they can win traffic back.
+type WeightController struct {
+	config       config.AdaptiveWeightsConfig
+	loadBalancer *LoadBalancer
+	baseWeights  map[string]int
+	logger       *log.Logger
+
+	mu        sync.Mutex
+	signals   map[string]*providerSignal
+	effective map[string]int
+	done      chan struct{}
+}
+
+// NewWeightController creates a controller that drives lb's weights
+func NewWeightController(cfg config.AdaptiveWeightsConfig, lb *LoadBalancer, baseWeights map[string]int, logger *log.Logger) *WeightController {
+	c := &WeightController{
+		config:       cfg,
+		loadBalancer: lb,
+		baseWeights:  baseWeights,
+		logger:       logger,
+		signals:      make(map[string]*providerSignal),
+		effective:    make(map[string]int),
+		done:         make(chan struct{}),
+	}
+
+	// Start from the scaled profile weights until traffic says otherwise
+	c.Recompute()
+	return c
+}
+
+// Start begins recomputing weights in the background
+func (c *WeightController) Start() {
+	c.logger.Printf("⚖️  Adaptive load balancer weights enabled (interval: %s)", c.config.IntervalDuration)
+	go func() {
+		ticker := time.NewTicker(c.config.IntervalDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Recompute()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background loop
+func (c *WeightController) Stop() {
+	close(c.done)
+}
+
+// Observe records the outcome of one request. Latency and TTFB are only
+// taken from successful requests; failures only move the error rate.
+func (c *WeightController) Observe(providerName string, latency, ttfb time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	signal, exists := c.signals[providerName]
+	if !exists {
+		signal = &providerSignal{}
+		c.signals[providerName] = signal
+	}
+
+	alpha := c.config.Alpha
+	errorSample := 0.0
+	if failed {
+		errorSample = 1.0
+	}
+
+	if signal.samples == 0 {
+		signal.errorRate = errorSample
+	} else {
+		signal.errorRate += alpha * (errorSample - signal.errorRate)
+	}
+
+	if !failed {
+		latencyMs := float64(latency.Milliseconds())
+		ttfbMs := float64(ttfb.Milliseconds())
+		if signal.latencyMs == 0 {
+			signal.latencyMs, signal.ttfbMs = latencyMs, ttfbMs
+		} else {
+			signal.latencyMs += alpha * (latencyMs - signal.latencyMs)
+			signal.ttfbMs += alpha * (ttfbMs - signal.ttfbMs)
+		}
+	}
+
+	signal.samples++
+	signal.observed = true
+}
+
+// Recompute derives new weights from the current signals, pushes them to
+// the load balancer, and decays the signals of providers that saw no traffic
+func (c *WeightController) Recompute() map[string]int {
+	c.mu.Lock()
+
+	fleetLatency, fleetTTFB := c.fleetAverages()
+
+	weights := make(map[string]int, len(c.baseWeights))
+	changed := false
+	for name, base := range c.baseWeights {
+		factor := 1.0
+		if signal, exists := c.signals[name]; exists && signal.samples >= c.config.MinSamples {
+			factor = performanceFactor(signal, fleetLatency, fleetTTFB) * math.Pow(1-signal.errorRate, 2)
+		}
+
+		weight := int(math.Round(float64(base*weightScale) * factor))
+		if weight < c.config.MinWeight {
+			weight = c.config.MinWeight
+		}
+		if weight > c.config.MaxWeight {
+			weight = c.config.MaxWeight
+		}
+		weights[name] = weight
+		if c.effective[name] != weight {
+			changed = true
+		}
+	}
+
+	// Idle providers drift back to neutral so a recovered provider is retried
+	decay := c.config.Decay
+	for _, signal := range c.signals {
+		if !signal.observed {
+			signal.errorRate *= 1 - decay
+			if fleetLatency > 0 && signal.latencyMs > 0 {
+				signal.latencyMs += decay * (fleetLatency - signal.latencyMs)
+			}
+			if fleetTTFB > 0 && signal.ttfbMs > 0 {
+				signal.ttfbMs += decay * (fleetTTFB - signal.ttfbMs)
+			}
+		}
+		signal.observed = false
+	}
+
+	c.effective = weights
+	c.mu.Unlock()
+
+	c.loadBalancer.UpdateWeights(weights)
+	for name, weight := range weights {
+		metrics.UpdateProviderWeight(name, weight)
+	}
+
+	if changed {
+		logEvent := map[string]interface{}{
+			"event":     "provider_weights_updated",
+			"weights":   weights,
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		}
+		logJSON, _ := json.Marshal(logEvent)
+		c.logger.Printf("%s", logJSON)
+	}
+
+	return weights
+}
+
+// Inherit takes over the signals learned by the controller this one
+// replaces on a config reload, for providers that still exist, and
+// recomputes the weights from them
+func (c *WeightController) Inherit(previous *WeightController) {
+	previous.mu.Lock()
+	signals := make(map[string]providerSignal, len(previous.signals))
+	for name, signal := range previous.signals {
+		if _, exists := c.baseWeights[name]; exists {
+			signals[name] = *signal
+		}
+	}
+	previous.mu.Unlock()
+
+	c.mu.Lock()
+	for name, signal := range signals {
+		// Count as observed so this recompute doesn't decay them
+		signal.observed = true
+		c.signals[name] = &signal
+	}
+	c.mu.Unlock()
+	c.Recompute()
+}
+
+// Stats returns the signals and weights for every known provider
+func (c *WeightController) Stats() []ProviderWeightStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]ProviderWeightStats, 0, len(c.baseWeights))
+	for name, base := range c.baseWeights {
+		entry := ProviderWeightStats{
+			Provider:        name,
+			BaseWeight:      base * weightScale,
+			EffectiveWeight: c.effective[name],
+		}
+		if signal, exists := c.signals[name]; exists {
+			entry.LatencyMs = signal.latencyMs
+			entry.TTFBMs = signal.ttfbMs
+			entry.ErrorRate = signal.errorRate
+			entry.Samples = signal.samples
+		}
+		stats = append(stats, entry)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Provider < stats[j].Provider
+	})
+	return stats
+}
+
+// fleetAverages returns the mean EWMA latency and TTFB across providers that
+// have enough samples. Must be called with lock held.
+func (c *WeightController) fleetAverages() (latency, ttfb float64) {
+	var latencySum, ttfbSum float64
+	var latencyCount, ttfbCount int
+	for _, signal := range c.signals {
+		if signal.samples < c.config.MinSamples {
+			continue
+		}
+		if signal.latencyMs > 0 {
+			latencySum += signal.latencyMs
+			latencyCount++
+		}
+		if signal.ttfbMs > 0 {
+			ttfbSum += signal.ttfbMs
+			ttfbCount++
+		}
+	}
+	if latencyCount > 0 {
+		latency = latencySum / float64(latencyCount)
+	}
+	if ttfbCount > 0 {
+		ttfb = ttfbSum / float64(ttfbCount)
+	}
+	return latency, ttfb
+}
+
+// performanceFactor compares a provider's latency and TTFB with the fleet
+// average: faster than average scores above 1, slower scores below 1
+func performanceFactor(signal *providerSignal, fleetLatency, fleetTTFB float64) float64 {
+	latencyFactor, ttfbFactor := 1.0, 1.0
+	if fleetLatency > 0 && signal.latencyMs > 0 {
+		latencyFactor = fleetLatency / signal.latencyMs
+	}
+	if fleetTTFB > 0 && signal.ttfbMs > 0 {
+		ttfbFactor = fleetTTFB / signal.ttfbMs
+	}
+
+	factor := math.Sqrt(latencyFactor * ttfbFactor)
+	return math.Max(0.1, math.Min(factor, 10))
+}
+
+// baseWeightsFromProfiles derives static weights from provider_profiles the
+// same way PreferenceRouter does: the mean of speed, cost, and quality,
+// defaulting to 5 for providers without a profile
+func baseWeightsFromProfiles(profiles map[string]config.ProviderProfileConfig, providers map[string]provider.Provider) map[string]int {
+	weights := make(map[string]int)
+	for name := range providers {
+		weights[name] = 5
+		if profile, exists := profiles[name]; exists {
+			weights[name] = (profile.Speed + profile.Cost + profile.Quality) / 3
+		}
+	}
+	return weights
+}
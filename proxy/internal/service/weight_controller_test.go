@@ -0,0 +1,135 @@
+package service
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func newTestWeightController() (*WeightController, *LoadBalancer) {
+	cfg := config.AdaptiveWeightsConfig{
+		Enabled:          true,
+		IntervalDuration: time.Second,
+		Alpha:            0.5,
+		Decay:            0.5,
+		MinSamples:       3,
+		MinWeight:        1,
+		MaxWeight:        100,
+	}
+	base := map[string]int{"fast": 5, "slow": 5}
+	lb := NewLoadBalancer(map[string]int{"fast": 5, "slow": 5})
+	return NewWeightController(cfg, lb, base, log.New(os.Stdout, "test: ", 0)), lb
+}
+
+func TestWeightController_ShiftsWeightFromSlowProvider(t *testing.T) {
+	controller, lb := newTestWeightController()
+
+	for i := 0; i < 5; i++ {
+		controller.Observe("fast", 100*time.Millisecond, 20*time.Millisecond, false)
+		controller.Observe("slow", 900*time.Millisecond, 400*time.Millisecond, false)
+	}
+	weights := controller.Recompute()
+
+	if weights["fast"] <= weights["slow"] {
+		t.Errorf("Expected fast provider to outweigh slow one, got %v", weights)
+	}
+	if lb.GetWeights()["fast"] != weights["fast"] {
+		t.Error("Expected weights to be pushed to the load balancer")
+	}
+}
+
+func TestWeightController_PenalizesErrors(t *testing.T) {
+	controller, _ := newTestWeightController()
+
+	for i := 0; i < 5; i++ {
+		controller.Observe("fast", 100*time.Millisecond, 20*time.Millisecond, false)
+		controller.Observe("slow", 100*time.Millisecond, 20*time.Millisecond, true)
+	}
+	weights := controller.Recompute()
+
+	if weights["slow"] != 1 {
+		t.Errorf("Expected failing provider to drop to min_weight, got %d", weights["slow"])
+	}
+	if weights["fast"] != 50 {
+		t.Errorf("Expected healthy provider to keep its scaled base weight, got %d", weights["fast"])
+	}
+}
+
+func TestWeightController_IdleProviderDecaysBack(t *testing.T) {
+	controller, _ := newTestWeightController()
+
+	for i := 0; i < 5; i++ {
+		controller.Observe("fast", 100*time.Millisecond, 20*time.Millisecond, false)
+		controller.Observe("slow", 100*time.Millisecond, 20*time.Millisecond, true)
+	}
+	before := controller.Recompute()["slow"]
+
+	// "slow" gets no traffic for a few intervals while "fast" keeps serving
+	var after int
+	for i := 0; i < 6; i++ {
+		controller.Observe("fast", 100*time.Millisecond, 20*time.Millisecond, false)
+		after = controller.Recompute()["slow"]
+	}
+
+	if after <= before {
+		t.Errorf("Expected idle provider's weight to recover (before %d, after %d)", before, after)
+	}
+}
+
+func TestWeightController_StatsBeforeTraffic(t *testing.T) {
+	controller, _ := newTestWeightController()
+
+	stats := controller.Stats()
+	if len(stats) != 2 || stats[0].Provider != "fast" {
+		t.Fatalf("Expected sorted stats for both providers, got %+v", stats)
+	}
+	if stats[0].EffectiveWeight != stats[0].BaseWeight {
+		t.Errorf("Expected effective weight to equal base weight before traffic, got %+v", stats[0])
+	}
+}
+
+func TestModelRouter_ProviderWeightsScale(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &mockProvider{name: "anthropic"},
+		"openai":    &mockProvider{name: "openai"},
+	}
+	newConfig := func(adaptive bool) *config.Config {
+		return &config.Config{
+			Providers: map[string]*config.ProviderConfig{
+				"anthropic": {Format: "anthropic"},
+				"openai":    {Format: "openai"},
+			},
+			Routing: config.RoutingConfig{
+				ProviderProfiles: map[string]config.ProviderProfileConfig{
+					"anthropic": {Speed: 6, Cost: 6, Quality: 6},
+				},
+				AdaptiveWeights: config.AdaptiveWeightsConfig{
+					Enabled:          adaptive,
+					IntervalDuration: time.Second,
+					MinWeight:        1,
+					MaxWeight:        100,
+				},
+			},
+		}
+	}
+
+	// Turning the controller on must not change the weights reported before
+	// any traffic has been seen
+	static := NewModelRouter(newConfig(false), providers, log.New(os.Stdout, "test: ", 0)).ProviderWeights()
+	adaptive := NewModelRouter(newConfig(true), providers, log.New(os.Stdout, "test: ", 0)).ProviderWeights()
+	if len(static) != 2 || len(adaptive) != 2 {
+		t.Fatalf("Expected weights for both providers, got %+v and %+v", static, adaptive)
+	}
+	for i := range static {
+		if static[i] != adaptive[i] {
+			t.Errorf("Static weights %+v differ from adaptive weights %+v", static[i], adaptive[i])
+		}
+	}
+	if static[0].BaseWeight != 6*weightScale {
+		t.Errorf("Expected anthropic's base weight to be %d, got %d", 6*weightScale, static[0].BaseWeight)
+	}
+}